@@ -5,11 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"maps"
-	"strings"
+	"slices"
 
-	"github.com/oklog/ulid/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -23,6 +24,10 @@ import (
 // controller instance.
 const controllerInstanceIDLabelKey = "argo-rollouts.argoproj.io/controller-instance-id"
 
+// clusterAnalysisTemplateKind is the kind of the cluster-scoped variant of
+// the Argo Rollouts AnalysisTemplate.
+const clusterAnalysisTemplateKind = "ClusterAnalysisTemplate"
+
 // Config holds the configuration for the AnalysisRunBuilder.
 type Config struct {
 	// ControllerInstanceID is the unique identifier for the Argo Rollouts
@@ -31,6 +36,22 @@ type Config struct {
 	ControllerInstanceID string
 }
 
+// Builder is an interface for building AnalysisRuns from a verification
+// configuration, so that packages depending on the construction of
+// AnalysisRuns can inject a FakeBuilder in unit tests.
+type Builder interface {
+	// Build creates a new AnalysisRun from the provided verification and
+	// options.
+	Build(
+		ctx context.Context,
+		namespace string,
+		cfg *kargoapi.Verification,
+		opt ...AnalysisRunOption,
+	) (*rolloutsapi.AnalysisRun, error)
+}
+
+var _ Builder = &AnalysisRunBuilder{}
+
 // AnalysisRunBuilder constructs AnalysisRun objects with consistent configuration.
 type AnalysisRunBuilder struct {
 	client client.Client
@@ -47,38 +68,44 @@ func NewAnalysisRunBuilder(c client.Client, cfg Config) *AnalysisRunBuilder {
 }
 
 // Build creates a new AnalysisRun from the provided verification and options.
+// The AnalysisTemplates referenced by the verification and the owners from
+// the options are resolved using the client of the builder.
 func (b *AnalysisRunBuilder) Build(
 	ctx context.Context,
 	namespace string,
 	cfg *kargoapi.Verification,
 	opt ...AnalysisRunOption,
 ) (*rolloutsapi.AnalysisRun, error) {
-	opts := &AnalysisRunOptions{}
-	opts.Apply(opt...)
+	opts := NewAnalysisRunOptions(opt...)
 
 	if cfg == nil {
 		return nil, errors.New("missing verification configuration")
 	}
 
-	metadata := b.buildMetadata(
-		namespace,
-		b.generateName(opts.NamePrefix, opts.NameSuffix),
-		cfg.AnalysisRunMetadata,
-		opts.ExtraLabels,
-	)
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
 
-	templates, err := b.getAnalysisTemplates(
-		ctx,
-		namespace,
-		cfg.AnalysisTemplates,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("get analysis templates: %w", err)
+	if err := validateOwnerNamespaces(opts.namespaceOrDefault(namespace), opts.Owners); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
 	}
 
-	spec, err := b.buildSpec(templates, cfg.Args)
+	if opts.VerificationID != "" {
+		attempt, err := b.nextVerificationAttempt(ctx, opts.namespaceOrDefault(namespace), opts.VerificationID)
+		if err != nil {
+			return nil, fmt.Errorf("determine verification attempt: %w", err)
+		}
+		opts.verificationAttempt = attempt
+	}
+
+	templates, err := b.resolveTemplates(ctx, namespace, cfg, opts)
 	if err != nil {
-		return nil, fmt.Errorf("build spec: %w", err)
+		return nil, err
+	}
+	opts.logger().Debug("resolved AnalysisTemplates", "templates", templateNames(templates))
+
+	if opts.Args, err = b.resolveConfigMapArgs(ctx, namespace, templates, cfg.Args, opts); err != nil {
+		return nil, fmt.Errorf("resolve arguments from ConfigMaps: %w", err)
 	}
 
 	ownerRefs, err := b.buildOwnerReferences(ctx, opts.Owners)
@@ -86,31 +113,126 @@ func (b *AnalysisRunBuilder) Build(
 		return nil, fmt.Errorf("build owner references: %w", err)
 	}
 
-	obj := &rolloutsapi.AnalysisRun{
-		ObjectMeta: metadata,
-		Spec:       spec,
+	return b.assemble(
+		opts.namespaceOrDefault(namespace),
+		cfg.AnalysisRunMetadata,
+		templates,
+		cfg.Args,
+		opts,
+		ownerRefs,
+	)
+}
+
+// Build creates a new AnalysisRun from the provided AnalysisTemplates,
+// arguments and options without consulting the cluster. It can be used when
+// the AnalysisTemplates have already been resolved by the caller.
+//
+// Contrary to AnalysisRunBuilder.Build, the owner references are derived from
+// the Owners in the options as-is, without looking up the owners in the
+// cluster. This means they only carry a UID if it is set on the Owner, e.g. by
+// WithOwnerObject.
+//
+// Apart from the ULID in the name, the AnalysisRun is derived
+// deterministically from its inputs. As labels and annotations are marshalled
+// with sorted keys, the marshalled AnalysisRun is stable when combined with a
+// fixed generator passed using WithULIDGenerator, e.g. for golden tests.
+func Build(
+	namespace string,
+	templates []*rolloutsapi.AnalysisTemplate,
+	args []kargoapi.AnalysisRunArgument,
+	opt ...AnalysisRunOption,
+) (*rolloutsapi.AnalysisRun, error) {
+	opts := NewAnalysisRunOptions(opt...)
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
 	}
-	obj.SetOwnerReferences(ownerRefs)
 
-	return obj, nil
+	if err := validateOwnerNamespaces(opts.namespaceOrDefault(namespace), opts.Owners); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+
+	if len(opts.argsConfigMaps) > 0 {
+		return nil, errors.New("arguments from ConfigMaps require AnalysisRunBuilder.Build")
+	}
+
+	b := &AnalysisRunBuilder{}
+	return b.assemble(opts.namespaceOrDefault(namespace), nil, templates, args, opts, ownerReferences(opts.Owners))
 }
 
-// generateName creates a unique name for an AnalysisRun by combining the prefix,
-// a ULID, and an optional suffix.
-func (b *AnalysisRunBuilder) generateName(prefix, suffix string) string {
-	var parts []string
+// assemble puts together an AnalysisRun from its already resolved parts.
+func (b *AnalysisRunBuilder) assemble(
+	namespace string,
+	metadata *kargoapi.AnalysisRunMetadata,
+	templates []*rolloutsapi.AnalysisTemplate,
+	args []kargoapi.AnalysisRunArgument,
+	opts *AnalysisRunOptions,
+	ownerRefs []metav1.OwnerReference,
+) (*rolloutsapi.AnalysisRun, error) {
+	logger := opts.logger()
+
+	name, err := generateName(opts)
+	if err != nil {
+		return nil, fmt.Errorf("generate name: %w", err)
+	}
+	logger.Debug("assembled name", "name", name, "generateName", opts.GenerateName)
+
+	optionArgs := opts.argsWithBaseline(templateArgs(templates))
+	if err = validateAllowedArgs(opts.AllowedArgs, args, optionArgs); err != nil {
+		return nil, fmt.Errorf("validate allowed arguments: %w", err)
+	}
+
+	args, providedArgs, err := resolveArgsFreightReferences(args, optionArgs, opts.ArgsFreight)
+	if err != nil {
+		return nil, fmt.Errorf("resolve freight references: %w", err)
+	}
+
+	spec, err := b.buildSpec(templates, args, providedArgs)
+	if err != nil {
+		return nil, fmt.Errorf("build spec: %w", err)
+	}
+	logger.Debug("matched arguments", "args", argumentNames(spec.Args))
+
+	if err = appendInlineMetrics(&spec, opts.InlineMetrics); err != nil {
+		return nil, fmt.Errorf("append inline metrics: %w", err)
+	}
+
+	if opts.ValidateArgReferences {
+		if err = validateArgReferences(&spec); err != nil {
+			return nil, fmt.Errorf("validate argument references: %w", err)
+		}
+	}
 
-	if prefix != "" {
-		parts = append(parts, prefix)
+	if err = applyMetricSettings(&spec, opts); err != nil {
+		return nil, err
 	}
 
-	parts = append(parts, ulid.Make().String())
+	if metadata != nil {
+		if err = opts.validateProtectedLabels("verification labels", metadata.Labels); err != nil {
+			return nil, fmt.Errorf("validate verification labels: %w", err)
+		}
+	}
 
-	if suffix != "" {
-		parts = append(parts, suffix)
+	obj := &rolloutsapi.AnalysisRun{
+		ObjectMeta: b.buildMetadata(
+			namespace,
+			name,
+			metadata,
+			opts.labels(),
+			opts.annotations(),
+		),
+		Spec: spec,
+	}
+	if opts.GenerateName {
+		obj.SetGenerateName(opts.generateNamePrefix())
+	}
+	obj.SetOwnerReferences(ownerRefs)
+	logger.Debug("converted owners", "ownerReferences", len(ownerRefs))
+	if len(opts.Finalizers) > 0 {
+		obj.SetFinalizers(slices.Clone(opts.Finalizers))
 	}
 
-	return strings.ToLower(strings.Join(parts, "."))
+	return obj, nil
 }
 
 // buildMetadata creates an ObjectMeta for an AnalysisRun, combining metadata
@@ -118,7 +240,7 @@ func (b *AnalysisRunBuilder) generateName(prefix, suffix string) string {
 func (b *AnalysisRunBuilder) buildMetadata(
 	namespace, name string,
 	metadata *kargoapi.AnalysisRunMetadata,
-	extraLabels map[string]string,
+	extraLabels, extraAnnotations map[string]string,
 ) metav1.ObjectMeta {
 	var annotations map[string]string
 	labels := make(map[string]string)
@@ -134,6 +256,13 @@ func (b *AnalysisRunBuilder) buildMetadata(
 		maps.Copy(labels, extraLabels)
 	}
 
+	if len(extraAnnotations) > 0 {
+		merged := make(map[string]string, len(annotations)+len(extraAnnotations))
+		maps.Copy(merged, annotations)
+		maps.Copy(merged, extraAnnotations)
+		annotations = merged
+	}
+
 	if id := b.cfg.ControllerInstanceID; id != "" {
 		labels[controllerInstanceIDLabelKey] = id
 	}
@@ -151,13 +280,14 @@ func (b *AnalysisRunBuilder) buildMetadata(
 func (b *AnalysisRunBuilder) buildSpec(
 	templates []*rolloutsapi.AnalysisTemplate,
 	args []kargoapi.AnalysisRunArgument,
+	providedArgs map[string]string,
 ) (rolloutsapi.AnalysisRunSpec, error) {
 	template, err := flattenTemplates(templates)
 	if err != nil {
 		return rolloutsapi.AnalysisRunSpec{}, fmt.Errorf("flatten templates: %w", err)
 	}
 
-	finalArgs, err := b.buildArgs(template, args)
+	finalArgs, err := b.buildArgs(template, args, providedArgs)
 	if err != nil {
 		return rolloutsapi.AnalysisRunSpec{}, fmt.Errorf("build arguments: %w", err)
 	}
@@ -171,12 +301,18 @@ func (b *AnalysisRunBuilder) buildSpec(
 }
 
 // buildArgs converts analysis run arguments to rollouts arguments and merges them
-// with template arguments.
+// with template arguments. The provided arguments take precedence over the
+// analysis run arguments, and must be declared by the template.
 func (b *AnalysisRunBuilder) buildArgs(
 	template *rolloutsapi.AnalysisTemplate,
 	args []kargoapi.AnalysisRunArgument,
+	providedArgs map[string]string,
 ) ([]rolloutsapi.Argument, error) {
-	rolloutsArgs := make([]rolloutsapi.Argument, len(args))
+	if err := validateProvidedArgs(template.Spec.Args, providedArgs); err != nil {
+		return nil, fmt.Errorf("validate provided arguments: %w", err)
+	}
+
+	rolloutsArgs := make([]rolloutsapi.Argument, len(args), len(args)+len(providedArgs))
 	for i, arg := range args {
 		rolloutsArgs[i] = rolloutsapi.Argument{
 			Name: arg.Name,
@@ -185,6 +321,7 @@ func (b *AnalysisRunBuilder) buildArgs(
 			rolloutsArgs[i].Value = &arg.Value
 		}
 	}
+	rolloutsArgs = append(rolloutsArgs, providedArgsToArguments(providedArgs)...)
 
 	mergedArgs, err := mergeArgs(rolloutsArgs, template.Spec.Args)
 	if err != nil {
@@ -195,14 +332,17 @@ func (b *AnalysisRunBuilder) buildArgs(
 }
 
 // buildOwnerReferences creates owner references for the specified owners by
-// fetching their current state from the cluster.
+// fetching their current state from the cluster. The references are returned
+// in a deterministic order, see sortOwners. It returns an error if the UID of
+// an owner is set and differs from the UID of the object in the cluster, i.e.
+// the object was recreated.
 func (b *AnalysisRunBuilder) buildOwnerReferences(
 	ctx context.Context,
 	owners []Owner,
 ) ([]metav1.OwnerReference, error) {
 	refs := make([]metav1.OwnerReference, 0, len(owners))
 
-	for _, owner := range owners {
+	for _, owner := range sortOwners(owners) {
 		obj := unstructured.Unstructured{
 			Object: map[string]any{
 				"apiVersion": owner.APIVersion,
@@ -220,18 +360,74 @@ func (b *AnalysisRunBuilder) buildOwnerReferences(
 			)
 		}
 
-		refs = append(refs, metav1.OwnerReference{
-			APIVersion:         obj.GetAPIVersion(),
-			Kind:               obj.GetKind(),
-			Name:               obj.GetName(),
-			UID:                obj.GetUID(),
-			BlockOwnerDeletion: ptr.To(owner.BlockDeletion),
-		})
+		if owner.UID != "" && obj.GetUID() != owner.UID {
+			return nil, fmt.Errorf(
+				"%s %q in namespace %q has UID %q instead of %q",
+				owner.Kind,
+				owner.Reference.Name,
+				owner.Reference.Namespace,
+				obj.GetUID(),
+				owner.UID,
+			)
+		}
+
+		ref := newOwnerReference(owner)
+		ref.APIVersion = obj.GetAPIVersion()
+		ref.Kind = obj.GetKind()
+		ref.Name = obj.GetName()
+		ref.UID = obj.GetUID()
+		refs = append(refs, ref)
 	}
 
 	return refs, nil
 }
 
+// OwnerReferences creates owner references for the specified owners, the same
+// way Build does for the Owners in its options. Owners with the same
+// APIVersion, Kind and Reference are deduplicated as with WithOwner, and the
+// references are returned in a deterministic order, see sortOwners. It returns
+// an error if an owner is missing its APIVersion, Kind or Name, or if more than
+// one owner is a controller.
+func OwnerReferences(owners []Owner) ([]metav1.OwnerReference, error) {
+	if err := validateOwners(owners); err != nil {
+		return nil, err
+	}
+	var deduplicated []Owner
+	for _, owner := range owners {
+		deduplicated = addOwner(deduplicated, owner)
+	}
+	if err := validateControllerOwners(deduplicated); err != nil {
+		return nil, err
+	}
+	return ownerReferences(deduplicated), nil
+}
+
+// ownerReferences creates owner references for the specified owners without
+// looking them up in the cluster. The references are returned in a
+// deterministic order, see sortOwners.
+func ownerReferences(owners []Owner) []metav1.OwnerReference {
+	refs := make([]metav1.OwnerReference, 0, len(owners))
+	for _, owner := range sortOwners(owners) {
+		refs = append(refs, newOwnerReference(owner))
+	}
+	return refs
+}
+
+// newOwnerReference creates an owner reference from the given owner.
+func newOwnerReference(owner Owner) metav1.OwnerReference {
+	ref := metav1.OwnerReference{
+		APIVersion:         owner.APIVersion,
+		Kind:               owner.Kind,
+		Name:               owner.Reference.Name,
+		BlockOwnerDeletion: ptr.To(owner.BlockDeletion),
+		UID:                owner.UID,
+	}
+	if owner.Controller {
+		ref.Controller = ptr.To(true)
+	}
+	return ref
+}
+
 // getAnalysisTemplates retrieves all referenced analysis templates from the
 // cluster.
 func (b *AnalysisRunBuilder) getAnalysisTemplates(
@@ -240,6 +436,7 @@ func (b *AnalysisRunBuilder) getAnalysisTemplates(
 	references []kargoapi.AnalysisTemplateReference,
 ) ([]*rolloutsapi.AnalysisTemplate, error) {
 	templates := make([]*rolloutsapi.AnalysisTemplate, len(references))
+	var missing []error
 
 	for i, ref := range references {
 		template := &rolloutsapi.AnalysisTemplate{}
@@ -247,15 +444,161 @@ func (b *AnalysisRunBuilder) getAnalysisTemplates(
 			Namespace: namespace,
 			Name:      ref.Name,
 		}, template); err != nil {
-			return nil, fmt.Errorf(
-				"get AnalysisRun %q in namespace %q: %w",
+			err = fmt.Errorf(
+				"get AnalysisTemplate %q in namespace %q: %w",
 				ref.Name,
 				namespace,
 				err,
 			)
+			if apierrors.IsNotFound(err) {
+				missing = append(missing, err)
+				continue
+			}
+			return nil, err
+		}
+		templates[i] = template
+	}
+
+	if len(missing) > 0 {
+		return nil, errors.Join(missing...)
+	}
+	return templates, nil
+}
+
+// ResolveTemplates fetches all AnalysisTemplates and ClusterAnalysisTemplates
+// an AnalysisRun built from the verification configuration and options would
+// reference. It can be used to verify the templates exist before building and
+// creating an AnalysisRun, or to resolve the templates for use with Build. If
+// any of the templates cannot be found, the returned error lists all of them.
+func (b *AnalysisRunBuilder) ResolveTemplates(
+	ctx context.Context,
+	namespace string,
+	cfg *kargoapi.Verification,
+	opt ...AnalysisRunOption,
+) ([]*rolloutsapi.AnalysisTemplate, error) {
+	if cfg == nil {
+		return nil, errors.New("missing verification configuration")
+	}
+	return b.resolveTemplates(ctx, namespace, cfg, NewAnalysisRunOptions(opt...))
+}
+
+// resolveTemplates fetches the namespaced and cluster-scoped templates
+// referenced by the verification configuration and options. Namespaced
+// templates are returned before cluster-scoped templates.
+func (b *AnalysisRunBuilder) resolveTemplates(
+	ctx context.Context,
+	namespace string,
+	cfg *kargoapi.Verification,
+	opts *AnalysisRunOptions,
+) ([]*rolloutsapi.AnalysisTemplate, error) {
+	references := templateReferences(cfg.AnalysisTemplates, opts.Templates)
+	if err := validateTemplateReferences(references, opts.ClusterTemplates); err != nil {
+		return nil, fmt.Errorf("invalid template references: %w", err)
+	}
+
+	templates, err := b.getAnalysisTemplates(ctx, namespace, references)
+	if err != nil {
+		err = fmt.Errorf("get analysis templates: %w", err)
+	}
+
+	clusterTemplates, clusterErr := b.getClusterAnalysisTemplates(ctx, opts.ClusterTemplates)
+	if clusterErr != nil {
+		clusterErr = fmt.Errorf("get cluster analysis templates: %w", clusterErr)
+	}
+
+	if err = errors.Join(err, clusterErr); err != nil {
+		return nil, err
+	}
+	return append(templates, clusterTemplates...), nil
+}
+
+// nextVerificationAttempt returns the attempt number for a new AnalysisRun of
+// the verification with the given ID, based on the number of existing
+// AnalysisRuns of that verification in the namespace.
+func (b *AnalysisRunBuilder) nextVerificationAttempt(
+	ctx context.Context,
+	namespace, id string,
+) (int, error) {
+	runs := &rolloutsapi.AnalysisRunList{}
+	if err := b.client.List(
+		ctx,
+		runs,
+		client.InNamespace(namespace),
+		client.MatchingLabels{VerificationIDLabelKey: id},
+	); err != nil {
+		return 0, fmt.Errorf("list AnalysisRuns in namespace %q: %w", namespace, err)
+	}
+	return len(runs.Items) + 1, nil
+}
+
+// getClusterAnalysisTemplates retrieves all referenced cluster analysis
+// templates from the cluster. As ClusterAnalysisTemplates share their spec
+// with AnalysisTemplates, they are returned as AnalysisTemplates.
+func (b *AnalysisRunBuilder) getClusterAnalysisTemplates(
+	ctx context.Context,
+	names []string,
+) ([]*rolloutsapi.AnalysisTemplate, error) {
+	templates := make([]*rolloutsapi.AnalysisTemplate, len(names))
+	var missing []error
+
+	for i, name := range names {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(rolloutsapi.GroupVersion.WithKind(clusterAnalysisTemplateKind))
+		if err := b.client.Get(ctx, types.NamespacedName{Name: name}, obj); err != nil {
+			err = fmt.Errorf("get ClusterAnalysisTemplate %q: %w", name, err)
+			if apierrors.IsNotFound(err) {
+				missing = append(missing, err)
+				continue
+			}
+			return nil, err
+		}
+
+		template := &rolloutsapi.AnalysisTemplate{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, template); err != nil {
+			return nil, fmt.Errorf("convert ClusterAnalysisTemplate %q: %w", name, err)
 		}
 		templates[i] = template
 	}
 
+	if len(missing) > 0 {
+		return nil, errors.Join(missing...)
+	}
 	return templates, nil
 }
+
+// templateReferences returns the references to the AnalysisTemplates from the
+// verification configuration, followed by the references to the
+// AnalysisTemplates with the given names. Names which are already referenced
+// are skipped.
+func templateReferences(
+	references []kargoapi.AnalysisTemplateReference,
+	names []string,
+) []kargoapi.AnalysisTemplateReference {
+	out := slices.Clone(references)
+	for _, name := range names {
+		if !slices.ContainsFunc(out, func(ref kargoapi.AnalysisTemplateReference) bool {
+			return ref.Name == name
+		}) {
+			out = append(out, kargoapi.AnalysisTemplateReference{Name: name})
+		}
+	}
+	return out
+}
+
+// validateTemplateReferences ensures no template name is referenced both as
+// a namespaced AnalysisTemplate and as a ClusterAnalysisTemplate.
+func validateTemplateReferences(
+	references []kargoapi.AnalysisTemplateReference,
+	clusterTemplates []string,
+) error {
+	var errs []error
+	for _, ref := range references {
+		if slices.Contains(clusterTemplates, ref.Name) {
+			errs = append(errs, fmt.Errorf(
+				"template %q is referenced as both AnalysisTemplate and ClusterAnalysisTemplate",
+				ref.Name,
+			))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -2,9 +2,14 @@ package rollouts
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/go-logr/logr/funcr"
+	"github.com/oklog/ulid/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -14,9 +19,12 @@ import (
 	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/yaml"
 
 	kargoapi "github.com/akuity/kargo/api/v1alpha1"
 	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+	"github.com/akuity/kargo/internal/logging"
 )
 
 func TestAnalysisRunBuilder_Build(t *testing.T) {
@@ -40,6 +48,24 @@ func TestAnalysisRunBuilder_Build(t *testing.T) {
 				assert.Nil(t, ar)
 			},
 		},
+		{
+			name:      "invalid options return error",
+			namespace: "default",
+			verification: &kargoapi.Verification{
+				AnalysisTemplates: []kargoapi.AnalysisTemplateReference{
+					{Name: "template1"},
+				},
+			},
+			options: []AnalysisRunOption{
+				WithStrictNaming(true),
+				WithNameSuffix("abcdef12345"),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "invalid options")
+				assert.ErrorContains(t, err, "name suffix")
+				assert.Nil(t, ar)
+			},
+		},
 		{
 			name:      "basic AnalysisRun creation",
 			namespace: "default",
@@ -82,6 +108,8 @@ func TestAnalysisRunBuilder_Build(t *testing.T) {
 				WithNamePrefix("prefix"),
 				WithNameSuffix("suffix"),
 				WithExtraLabels(map[string]string{"extra": "label"}),
+				WithExtraAnnotations(map[string]string{"extra": "annotation"}),
+				WithExtraAnnotations(map[string]string{"another": "annotation"}),
 			},
 			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
 				require.NoError(t, err)
@@ -93,7 +121,11 @@ func TestAnalysisRunBuilder_Build(t *testing.T) {
 				assert.Equal(t, "test-controller", ar.Labels[controllerInstanceIDLabelKey])
 				assert.Equal(t, "value", ar.Labels["custom-label"])
 				assert.Equal(t, "label", ar.Labels["extra"])
-				assert.Equal(t, "value", ar.Annotations["custom-annotation"])
+				assert.Equal(t, map[string]string{
+					"custom-annotation": "value",
+					"extra":             "annotation",
+					"another":           "annotation",
+				}, ar.Annotations)
 
 				assert.Len(t, ar.Spec.Metrics, 1)
 				assert.Equal(t, "metric1", ar.Spec.Metrics[0].Name)
@@ -102,6 +134,38 @@ func TestAnalysisRunBuilder_Build(t *testing.T) {
 				assert.Equal(t, "val1", *ar.Spec.Args[0].Value)
 			},
 		},
+		{
+			name:      "explicit namespace",
+			namespace: "default",
+			verification: &kargoapi.Verification{
+				AnalysisTemplates: []kargoapi.AnalysisTemplateReference{
+					{Name: "template1"},
+				},
+			},
+			objects: []client.Object{
+				&rolloutsapi.AnalysisTemplate{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "template1",
+						Namespace: "default",
+					},
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Metrics: []rolloutsapi.Metric{
+							{Name: "metric1"},
+						},
+					},
+				},
+			},
+			options: []AnalysisRunOption{
+				WithNamespace("verification"),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				require.NotNil(t, ar)
+
+				assert.Equal(t, "verification", ar.Namespace)
+				assert.Len(t, ar.Spec.Metrics, 1)
+			},
+		},
 		{
 			name:      "owner references",
 			namespace: "default",
@@ -150,6 +214,35 @@ func TestAnalysisRunBuilder_Build(t *testing.T) {
 				assert.True(t, *owner.BlockOwnerDeletion)
 			},
 		},
+		{
+			name:      "multiple controller owners",
+			namespace: "default",
+			verification: &kargoapi.Verification{
+				AnalysisTemplates: []kargoapi.AnalysisTemplateReference{
+					{Name: "template1"},
+				},
+			},
+			options: []AnalysisRunOption{
+				WithOwner(Owner{
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
+					Reference:  types.NamespacedName{Name: "deploy1", Namespace: "default"},
+					Controller: true,
+				}),
+				WithOwner(Owner{
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
+					Reference:  types.NamespacedName{Name: "deploy2", Namespace: "default"},
+					Controller: true,
+				}),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "only one owner can be a controller")
+				assert.ErrorContains(t, err, `"deploy1"`)
+				assert.ErrorContains(t, err, `"deploy2"`)
+				assert.Nil(t, ar)
+			},
+		},
 		{
 			name:      "multiple templates",
 			namespace: "default",
@@ -198,7 +291,7 @@ func TestAnalysisRunBuilder_Build(t *testing.T) {
 				},
 			},
 			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
-				assert.ErrorContains(t, err, "get AnalysisRun")
+				assert.ErrorContains(t, err, "get AnalysisTemplate")
 				assert.Nil(t, ar)
 			},
 		},
@@ -268,6 +361,161 @@ func TestAnalysisRunBuilder_Build(t *testing.T) {
 				assert.Nil(t, ar)
 			},
 		},
+		{
+			name:      "cluster analysis templates",
+			namespace: "default",
+			verification: &kargoapi.Verification{
+				AnalysisTemplates: []kargoapi.AnalysisTemplateReference{
+					{Name: "template1"},
+				},
+			},
+			objects: []client.Object{
+				&rolloutsapi.AnalysisTemplate{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "template1",
+						Namespace: "default",
+					},
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Metrics: []rolloutsapi.Metric{
+							{Name: "metric1"},
+						},
+					},
+				},
+				newClusterAnalysisTemplate("cluster-template1", "metric2"),
+			},
+			options: []AnalysisRunOption{
+				WithClusterTemplates{"cluster-template1"},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				require.NotNil(t, ar)
+
+				require.Len(t, ar.Spec.Metrics, 2)
+				assert.Equal(t, "metric1", ar.Spec.Metrics[0].Name)
+				assert.Equal(t, "metric2", ar.Spec.Metrics[1].Name)
+			},
+		},
+		{
+			name:      "additional templates with merged args",
+			namespace: "default",
+			verification: &kargoapi.Verification{
+				AnalysisTemplates: []kargoapi.AnalysisTemplateReference{
+					{Name: "template1"},
+				},
+				Args: []kargoapi.AnalysisRunArgument{
+					{Name: "shared", Value: "value"},
+				},
+			},
+			objects: []client.Object{
+				&rolloutsapi.AnalysisTemplate{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "template1",
+						Namespace: "default",
+					},
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Metrics: []rolloutsapi.Metric{{Name: "metric1"}},
+						Args:    []rolloutsapi.Argument{{Name: "shared"}},
+					},
+				},
+				&rolloutsapi.AnalysisTemplate{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "template2",
+						Namespace: "default",
+					},
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Metrics: []rolloutsapi.Metric{{Name: "metric2"}},
+						Args: []rolloutsapi.Argument{
+							{Name: "shared"},
+							{Name: "other", Value: ptr.To("default")},
+						},
+					},
+				},
+			},
+			options: []AnalysisRunOption{
+				WithTemplates{"template2", "template1"},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				require.NotNil(t, ar)
+
+				require.Len(t, ar.Spec.Metrics, 2)
+				assert.Equal(t, "metric1", ar.Spec.Metrics[0].Name)
+				assert.Equal(t, "metric2", ar.Spec.Metrics[1].Name)
+				assert.Equal(t, []rolloutsapi.Argument{
+					{Name: "shared", Value: ptr.To("value")},
+					{Name: "other", Value: ptr.To("default")},
+				}, ar.Spec.Args)
+			},
+		},
+		{
+			name:      "additional templates with conflicting args",
+			namespace: "default",
+			verification: &kargoapi.Verification{
+				AnalysisTemplates: []kargoapi.AnalysisTemplateReference{
+					{Name: "template1"},
+				},
+			},
+			objects: []client.Object{
+				&rolloutsapi.AnalysisTemplate{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "template1",
+						Namespace: "default",
+					},
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Metrics: []rolloutsapi.Metric{{Name: "metric1"}},
+						Args:    []rolloutsapi.Argument{{Name: "arg1", Value: ptr.To("value1")}},
+					},
+				},
+				&rolloutsapi.AnalysisTemplate{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "template2",
+						Namespace: "default",
+					},
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Metrics: []rolloutsapi.Metric{{Name: "metric2"}},
+						Args:    []rolloutsapi.Argument{{Name: "arg1", Value: ptr.To("value2")}},
+					},
+				},
+			},
+			options: []AnalysisRunOption{
+				WithTemplates{"template2"},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, `template "template2": conflicting values for argument "arg1"`)
+				assert.Nil(t, ar)
+			},
+		},
+		{
+			name:      "template referenced as both namespaced and cluster template",
+			namespace: "default",
+			verification: &kargoapi.Verification{
+				AnalysisTemplates: []kargoapi.AnalysisTemplateReference{
+					{Name: "template1"},
+				},
+			},
+			options: []AnalysisRunOption{
+				WithClusterTemplates{"template1"},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "invalid template references")
+				assert.ErrorContains(t, err, `template "template1"`)
+				assert.Nil(t, ar)
+			},
+		},
+		{
+			name:      "cluster analysis template not found",
+			namespace: "default",
+			verification: &kargoapi.Verification{
+				AnalysisTemplates: []kargoapi.AnalysisTemplateReference{},
+			},
+			options: []AnalysisRunOption{
+				WithClusterTemplates{"nonexistent"},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "get cluster analysis templates")
+				assert.Nil(t, ar)
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -284,61 +532,576 @@ func TestAnalysisRunBuilder_Build(t *testing.T) {
 	}
 }
 
-func TestAnalysisRunBuilder_generateName(t *testing.T) {
-	builder := &AnalysisRunBuilder{}
+func TestAnalysisRunBuilder_Build_verificationID(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, rolloutsapi.AddToScheme(scheme))
+
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	builder := NewAnalysisRunBuilder(c, Config{})
+	verification := &kargoapi.Verification{}
+
+	var names []string
+	for attempt := 1; attempt <= 3; attempt++ {
+		ar, err := builder.Build(
+			context.Background(),
+			"default",
+			verification,
+			WithNamePrefix("stage"),
+			WithVerificationID("verification"),
+		)
+		require.NoError(t, err)
+
+		assert.Equal(t, "verification", ar.Labels[VerificationIDLabelKey])
+		assert.Equal(t, strconv.Itoa(attempt), ar.Annotations[verificationAttemptAnnotationKey])
+		assert.NotContains(t, names, ar.Name)
+		names = append(names, ar.Name)
+
+		require.NoError(t, c.Create(context.Background(), ar))
+	}
+
+	// AnalysisRuns of other verifications do not count as attempts.
+	ar, err := builder.Build(
+		context.Background(),
+		"default",
+		verification,
+		WithVerificationID("other"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "1", ar.Annotations[verificationAttemptAnnotationKey])
+}
+
+func TestAnalysisRunBuilder_Build_logger(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, rolloutsapi.AddToScheme(scheme))
+	require.NoError(t, kargoapi.AddToScheme(scheme))
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&rolloutsapi.AnalysisTemplate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "template"},
+			Spec: rolloutsapi.AnalysisTemplateSpec{
+				Metrics: []rolloutsapi.Metric{{Name: "metric"}},
+				Args:    []rolloutsapi.Argument{{Name: "service"}},
+			},
+		},
+		&kargoapi.Stage{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "stage", UID: "uid"},
+		},
+	).Build()
+	builder := NewAnalysisRunBuilder(c, Config{})
+
+	var lines []string
+	logger := logging.Wrap(funcr.New(func(_, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{Verbosity: 1}))
+
+	ar, err := builder.Build(
+		context.Background(),
+		"default",
+		&kargoapi.Verification{
+			AnalysisTemplates: []kargoapi.AnalysisTemplateReference{{Name: "template"}},
+		},
+		WithNamePrefix("stage"),
+		WithArgs{"service": "api"},
+		WithOwner(Owner{
+			APIVersion: kargoapi.GroupVersion.String(),
+			Kind:       "Stage",
+			Reference:  types.NamespacedName{Namespace: "default", Name: "stage"},
+		}),
+		WithLogger(logger),
+	)
+	require.NoError(t, err)
+
+	require.Len(t, lines, 4)
+	assert.Contains(t, lines[0], `"msg"="resolved AnalysisTemplates" "templates"=["template"]`)
+	assert.Contains(t, lines[1], `"msg"="assembled name" "name"="`+ar.Name+`"`)
+	assert.Contains(t, lines[2], `"msg"="matched arguments" "args"=["service"]`)
+	assert.Contains(t, lines[3], `"msg"="converted owners" "ownerReferences"=1`)
+}
 
+func TestBuild(t *testing.T) {
 	tests := []struct {
 		name       string
-		prefix     string
-		suffix     string
-		assertions func(*testing.T, string)
+		namespace  string
+		templates  []*rolloutsapi.AnalysisTemplate
+		args       []kargoapi.AnalysisRunArgument
+		options    []AnalysisRunOption
+		assertions func(*testing.T, *rolloutsapi.AnalysisRun, error)
 	}{
 		{
-			name:   "no prefix or suffix",
-			prefix: "",
-			suffix: "",
-			assertions: func(t *testing.T, result string) {
-				assert.Len(t, result, 26) // ULID length
+			name:      "assembles AnalysisRun from options",
+			namespace: "default",
+			templates: []*rolloutsapi.AnalysisTemplate{
+				{
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Metrics: []rolloutsapi.Metric{{Name: "metric1"}},
+						Args:    []rolloutsapi.Argument{{Name: "arg1"}},
+					},
+				},
 			},
-		},
-		{
-			name:   "with prefix",
-			prefix: "test",
-			suffix: "",
-			assertions: func(t *testing.T, result string) {
-				assert.True(t, strings.HasPrefix(result, "test."))
-				assert.Len(t, strings.Split(result, "."), 2)
+			args: []kargoapi.AnalysisRunArgument{
+				{Name: "arg1", Value: "val1"},
+			},
+			options: []AnalysisRunOption{
+				WithNamePrefix("prefix"),
+				WithNameSuffix("suffix"),
+				WithExtraLabels{"label": "value"},
+				WithExtraAnnotations{"annotation": "value"},
+				WithOwner(Owner{
+					APIVersion:    "kargo.akuity.io/v1alpha1",
+					Kind:          "Stage",
+					Reference:     types.NamespacedName{Name: "stage", Namespace: "default"},
+					BlockDeletion: true,
+					Controller:    true,
+				}),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				require.NotNil(t, ar)
+
+				assert.Equal(t, "default", ar.Namespace)
+				assert.True(t, strings.HasPrefix(ar.Name, "prefix."))
+				assert.True(t, strings.HasSuffix(ar.Name, ".suffix"))
+				assert.Equal(t, map[string]string{"label": "value"}, ar.Labels)
+				assert.Equal(t, map[string]string{"annotation": "value"}, ar.Annotations)
+
+				assert.Equal(t, []metav1.OwnerReference{{
+					APIVersion:         "kargo.akuity.io/v1alpha1",
+					Kind:               "Stage",
+					Name:               "stage",
+					BlockOwnerDeletion: ptr.To(true),
+					Controller:         ptr.To(true),
+				}}, ar.OwnerReferences)
+
+				require.Len(t, ar.Spec.Metrics, 1)
+				assert.Equal(t, "metric1", ar.Spec.Metrics[0].Name)
+				require.Len(t, ar.Spec.Args, 1)
+				assert.Equal(t, "val1", *ar.Spec.Args[0].Value)
 			},
 		},
 		{
-			name:   "with suffix",
-			prefix: "",
-			suffix: "suffix",
-			assertions: func(t *testing.T, result string) {
-				assert.True(t, strings.HasSuffix(result, ".suffix"))
-				assert.Len(t, strings.Split(result, "."), 2)
+			name:      "generated name",
+			namespace: "default",
+			options: []AnalysisRunOption{
+				WithNamePrefix("prefix"),
+				WithNameSuffix("suffix"),
+				WithGenerateName(),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				require.NotNil(t, ar)
+				assert.Empty(t, ar.Name)
+				assert.Equal(t, "prefix-", ar.GenerateName)
 			},
 		},
 		{
-			name:   "with prefix and suffix",
-			prefix: "test",
-			suffix: "suffix",
-			assertions: func(t *testing.T, result string) {
-				assert.True(t, strings.HasPrefix(result, "test."))
-				assert.True(t, strings.HasSuffix(result, ".suffix"))
-				assert.Len(t, strings.Split(result, "."), 3)
+			name: "dry-run metrics and measurement retention",
+			templates: []*rolloutsapi.AnalysisTemplate{
+				{
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Metrics: []rolloutsapi.Metric{{Name: "metric1"}, {Name: "metric2"}},
+					},
+				},
+			},
+			options: []AnalysisRunOption{
+				WithDryRunMetrics{"metric2"},
+				WithMeasurementRetention("metric1", 10),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []rolloutsapi.DryRun{{MetricName: "metric2"}}, ar.Spec.DryRun)
+				assert.Equal(t, []rolloutsapi.MeasurementRetention{
+					{MetricName: "metric1", Limit: 10},
+				}, ar.Spec.MeasurementRetention)
+			},
+		},
+		{
+			name: "inline metrics",
+			templates: []*rolloutsapi.AnalysisTemplate{
+				{
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Metrics: []rolloutsapi.Metric{{Name: "metric1"}},
+					},
+				},
+			},
+			options: []AnalysisRunOption{
+				WithInlineMetrics{{
+					Name: "inline",
+					Provider: rolloutsapi.MetricProvider{
+						Web: &rolloutsapi.WebMetric{URL: "https://example.com"},
+					},
+				}},
+				WithDryRunMetrics{"inline"},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				require.Len(t, ar.Spec.Metrics, 2)
+				assert.Equal(t, "metric1", ar.Spec.Metrics[0].Name)
+				assert.Equal(t, "inline", ar.Spec.Metrics[1].Name)
+				assert.Equal(t, []rolloutsapi.DryRun{{MetricName: "inline"}}, ar.Spec.DryRun)
+			},
+		},
+		{
+			name: "inline metric colliding with template metric",
+			templates: []*rolloutsapi.AnalysisTemplate{
+				{
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Metrics: []rolloutsapi.Metric{{Name: "metric1"}},
+					},
+				},
+			},
+			options: []AnalysisRunOption{
+				WithInlineMetrics{{
+					Name: "metric1",
+					Provider: rolloutsapi.MetricProvider{
+						Web: &rolloutsapi.WebMetric{URL: "https://example.com"},
+					},
+				}},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "append inline metrics")
+				assert.Nil(t, ar)
+			},
+		},
+		{
+			name: "empty inline metric",
+			options: []AnalysisRunOption{
+				WithInlineMetrics{{}},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "invalid options")
+				assert.ErrorContains(t, err, "has no name")
+				assert.Nil(t, ar)
+			},
+		},
+		{
+			name: "dry-run metric which does not exist",
+			templates: []*rolloutsapi.AnalysisTemplate{
+				{
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Metrics: []rolloutsapi.Metric{{Name: "metric1"}},
+					},
+				},
+			},
+			options: []AnalysisRunOption{
+				WithDryRunMetrics{"unknown"},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "apply metric options")
+				assert.Nil(t, ar)
+			},
+		},
+		{
+			name: "stage is both labeled and owner",
+			options: []AnalysisRunOption{
+				WithStage("project", "stage"),
+				WithOwner(Owner{
+					APIVersion: kargoapi.GroupVersion.String(),
+					Kind:       "Stage",
+					Reference:  types.NamespacedName{Namespace: "project", Name: "stage"},
+					Controller: true,
+				}),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, map[string]string{
+					kargoapi.ProjectLabelKey: "project",
+					kargoapi.StageLabelKey:   "stage",
+				}, ar.Labels)
+				assert.Equal(t, []metav1.OwnerReference{{
+					APIVersion:         kargoapi.GroupVersion.String(),
+					Kind:               "Stage",
+					Name:               "stage",
+					BlockOwnerDeletion: ptr.To(false),
+					Controller:         ptr.To(true),
+				}}, ar.OwnerReferences)
+			},
+		},
+		{
+			name: "freight references in arguments",
+			templates: []*rolloutsapi.AnalysisTemplate{
+				{
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Metrics: []rolloutsapi.Metric{{Name: "metric1"}},
+						Args:    []rolloutsapi.Argument{{Name: "tag"}, {Name: "version"}},
+					},
+				},
+			},
+			args: []kargoapi.AnalysisRunArgument{
+				{Name: "tag", Value: `${freight.images["ghcr.io/example/app"].tag}`},
+			},
+			options: []AnalysisRunOption{
+				WithArgs{"version": `${freight.charts["oci://ghcr.io/example/charts/app"].version}`},
+				WithFreightArgs(&kargoapi.Freight{
+					Images: []kargoapi.Image{{RepoURL: "ghcr.io/example/app", Tag: "v1.2.3"}},
+					Charts: []kargoapi.Chart{{RepoURL: "oci://ghcr.io/example/charts/app", Version: "1.0.0"}},
+				}),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []rolloutsapi.Argument{
+					{Name: "tag", Value: ptr.To("v1.2.3")},
+					{Name: "version", Value: ptr.To("1.0.0")},
+				}, ar.Spec.Args)
+			},
+		},
+		{
+			name: "unresolved freight reference in arguments",
+			templates: []*rolloutsapi.AnalysisTemplate{
+				{
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Args: []rolloutsapi.Argument{{Name: "tag"}},
+					},
+				},
+			},
+			args: []kargoapi.AnalysisRunArgument{
+				{Name: "tag", Value: `${freight.images["ghcr.io/example/app"].tag}`},
+			},
+			options: []AnalysisRunOption{
+				WithFreightArgs(&kargoapi.Freight{}),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "resolve freight references")
+				assert.ErrorIs(t, err, ErrUnresolvedFreightReference)
+				assert.Nil(t, ar)
+			},
+		},
+		{
+			name:      "explicit namespace",
+			namespace: "default",
+			options: []AnalysisRunOption{
+				WithNamespace("verification"),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "verification", ar.Namespace)
+			},
+		},
+		{
+			name:      "owner in other namespace",
+			namespace: "default",
+			options: []AnalysisRunOption{
+				WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Kind:       "Stage",
+					Reference:  types.NamespacedName{Name: "stage", Namespace: "other"},
+				}),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "invalid options")
+				assert.ErrorContains(t, err, `Stage "stage" in namespace "other" cannot own an AnalysisRun in namespace "default"`)
+				assert.Nil(t, ar)
+			},
+		},
+		{
+			name:      "cluster-scoped owner",
+			namespace: "default",
+			options: []AnalysisRunOption{
+				WithOwner(Owner{
+					APIVersion:    "argoproj.io/v1alpha1",
+					Kind:          "ClusterAnalysisTemplate",
+					Reference:     types.NamespacedName{Name: "cluster-template"},
+					BlockDeletion: true,
+				}),
+				WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Kind:       "Stage",
+					Reference:  types.NamespacedName{Name: "stage", Namespace: "default"},
+					Controller: true,
+				}),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []metav1.OwnerReference{
+					{
+						APIVersion:         "kargo.akuity.io/v1alpha1",
+						Kind:               "Stage",
+						Name:               "stage",
+						BlockOwnerDeletion: ptr.To(false),
+						Controller:         ptr.To(true),
+					},
+					{
+						APIVersion:         "argoproj.io/v1alpha1",
+						Kind:               "ClusterAnalysisTemplate",
+						Name:               "cluster-template",
+						BlockOwnerDeletion: ptr.To(true),
+					},
+				}, ar.OwnerReferences)
+			},
+		},
+		{
+			name:      "explicit namespace conflicting with owner",
+			namespace: "default",
+			options: []AnalysisRunOption{
+				WithNamespace("verification"),
+				WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Kind:       "Stage",
+					Reference:  types.NamespacedName{Name: "stage", Namespace: "default"},
+				}),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "invalid options")
+				assert.ErrorContains(t, err, `cannot own an AnalysisRun in namespace "verification"`)
+				assert.Nil(t, ar)
+			},
+		},
+		{
+			name: "finalizers",
+			options: []AnalysisRunOption{
+				WithFinalizers("example.com/archive"),
+				WithFinalizers("example.com/archive", "example.com/cleanup"),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []string{"example.com/archive", "example.com/cleanup"}, ar.Finalizers)
+			},
+		},
+		{
+			name: "freight identity is stamped",
+			options: []AnalysisRunOption{
+				WithExtraLabels{"label": "value"},
+				WithFreight("abc123", "warehouse"),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, map[string]string{
+					"label":           "value",
+					FreightLabelKey:   "abc123",
+					warehouseLabelKey: "warehouse",
+				}, ar.Labels)
+				assert.Equal(t, map[string]string{
+					freightAnnotationKey: "warehouse/abc123",
+				}, ar.Annotations)
+			},
+		},
+		{
+			name: "name never exceeds maximum length",
+			options: []AnalysisRunOption{
+				WithNamePrefix(strings.Repeat("prefix", 100)),
+				WithNameSuffix(strings.Repeat("suffix", 100)),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Len(t, ar.Name, maxNameLength)
+				parts := strings.Split(ar.Name, ".")
+				require.Len(t, parts, 3)
+				assert.Len(t, parts[0], maxNamePrefixLength)
+				assert.Len(t, parts[1], ulidLength)
+				assert.Len(t, parts[2], maxNameSuffixLength)
+			},
+		},
+		{
+			name: "name within reduced maximum length",
+			options: []AnalysisRunOption{
+				WithMaxNameLength(100),
+				WithNamePrefix(strings.Repeat("prefix", 100)),
+				WithNameSuffix(strings.Repeat("suffix", 100)),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Len(t, ar.Name, 100)
+			},
+		},
+		{
+			name:      "explicit name",
+			namespace: "default",
+			options: []AnalysisRunOption{
+				WithExplicitName("stage.verification-1"),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "stage.verification-1", ar.Name)
+			},
+		},
+		{
+			name: "invalid options",
+			options: []AnalysisRunOption{
+				WithMaxNameLength(1),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "invalid options")
+				assert.ErrorIs(t, err, ErrNameBudgetExhausted)
+				assert.Nil(t, ar)
+			},
+		},
+		{
+			name: "spec building error",
+			templates: []*rolloutsapi.AnalysisTemplate{
+				{
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Metrics: []rolloutsapi.Metric{{Name: "duplicate-metric"}},
+					},
+				},
+				{
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Metrics: []rolloutsapi.Metric{{Name: "duplicate-metric"}},
+					},
+				},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "build spec")
+				assert.Nil(t, ar)
 			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := builder.generateName(tt.prefix, tt.suffix)
-			tt.assertions(t, result)
+			ar, err := Build(tt.namespace, tt.templates, tt.args, tt.options...)
+			tt.assertions(t, ar, err)
 		})
 	}
 }
 
+func TestBuild_stableMarshalledOutput(t *testing.T) {
+	id := ulid.MustParse("01HRZ6K7ZW0000000000000000")
+	labels := make(map[string]string)
+	annotations := make(map[string]string)
+	for i := range 50 {
+		labels[fmt.Sprintf("label-%d", i)] = "value"
+		annotations[fmt.Sprintf("annotation-%d", i)] = "value"
+	}
+
+	marshal := func() []byte {
+		ar, err := Build(
+			"project",
+			[]*rolloutsapi.AnalysisTemplate{{
+				Spec: rolloutsapi.AnalysisTemplateSpec{
+					Metrics: []rolloutsapi.Metric{{Name: "metric1"}, {Name: "metric2"}},
+					Args:    []rolloutsapi.Argument{{Name: "arg1"}, {Name: "arg2"}},
+				},
+			}},
+			nil,
+			WithULIDGenerator(func() ulid.ULID { return id }),
+			WithNamePrefix("stage"),
+			WithStage("project", "stage"),
+			WithFreight("abc123", "warehouse"),
+			WithExtraLabels(labels),
+			WithExtraAnnotations(annotations),
+			WithArgs{"arg1": "value1", "arg2": "value2"},
+			WithOwner(Owner{
+				APIVersion: "kargo.akuity.io/v1alpha1",
+				Kind:       "Freight",
+				Reference:  types.NamespacedName{Namespace: "project", Name: "freight2"},
+			}),
+			WithOwner(Owner{
+				APIVersion: "kargo.akuity.io/v1alpha1",
+				Kind:       "Freight",
+				Reference:  types.NamespacedName{Namespace: "project", Name: "freight1"},
+			}),
+		)
+		require.NoError(t, err)
+		b, err := yaml.Marshal(ar)
+		require.NoError(t, err)
+		return b
+	}
+
+	expected := marshal()
+	for range 10 {
+		assert.Equal(t, string(expected), string(marshal()))
+	}
+}
+
 func TestAnalysisRunBuilder_buildMetadata(t *testing.T) {
 	builder := &AnalysisRunBuilder{
 		cfg: Config{
@@ -347,12 +1110,13 @@ func TestAnalysisRunBuilder_buildMetadata(t *testing.T) {
 	}
 
 	tests := []struct {
-		name        string
-		namespace   string
-		objName     string
-		metadata    *kargoapi.AnalysisRunMetadata
-		extraLabels map[string]string
-		assertions  func(*testing.T, metav1.ObjectMeta)
+		name             string
+		namespace        string
+		objName          string
+		metadata         *kargoapi.AnalysisRunMetadata
+		extraLabels      map[string]string
+		extraAnnotations map[string]string
+		assertions       func(*testing.T, metav1.ObjectMeta)
 	}{
 		{
 			name:      "basic metadata",
@@ -386,11 +1150,39 @@ func TestAnalysisRunBuilder_buildMetadata(t *testing.T) {
 				assert.Equal(t, "test-controller", meta.Labels[controllerInstanceIDLabelKey])
 			},
 		},
+		{
+			name:      "with metadata and extra annotations",
+			namespace: "test-ns",
+			objName:   "test-name",
+			metadata: &kargoapi.AnalysisRunMetadata{
+				Annotations: map[string]string{
+					"anno1": "value1",
+					"anno2": "value2",
+				},
+			},
+			extraAnnotations: map[string]string{
+				"anno2": "override",
+				"extra": "value",
+			},
+			assertions: func(t *testing.T, meta metav1.ObjectMeta) {
+				assert.Equal(t, map[string]string{
+					"anno1": "value1",
+					"anno2": "override",
+					"extra": "value",
+				}, meta.Annotations)
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := builder.buildMetadata(tt.namespace, tt.objName, tt.metadata, tt.extraLabels)
+			result := builder.buildMetadata(
+				tt.namespace,
+				tt.objName,
+				tt.metadata,
+				tt.extraLabels,
+				tt.extraAnnotations,
+			)
 			tt.assertions(t, result)
 		})
 	}
@@ -498,7 +1290,7 @@ func TestAnalysisRunBuilder_buildSpec(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			builder := &AnalysisRunBuilder{}
-			spec, err := builder.buildSpec(tt.templates, tt.args)
+			spec, err := builder.buildSpec(tt.templates, tt.args, nil)
 			tt.assertions(t, spec, err)
 		})
 	}
@@ -506,10 +1298,11 @@ func TestAnalysisRunBuilder_buildSpec(t *testing.T) {
 
 func TestAnalysisRunBuilder_buildArgs(t *testing.T) {
 	tests := []struct {
-		name       string
-		template   *rolloutsapi.AnalysisTemplate
-		args       []kargoapi.AnalysisRunArgument
-		assertions func(*testing.T, []rolloutsapi.Argument, error)
+		name         string
+		template     *rolloutsapi.AnalysisTemplate
+		args         []kargoapi.AnalysisRunArgument
+		providedArgs map[string]string
+		assertions   func(*testing.T, []rolloutsapi.Argument, error)
 	}{
 		{
 			name: "nil args",
@@ -565,31 +1358,124 @@ func TestAnalysisRunBuilder_buildArgs(t *testing.T) {
 				assert.Contains(t, err.Error(), "merge arguments")
 			},
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			builder := &AnalysisRunBuilder{}
-			args, err := builder.buildArgs(tt.template, tt.args)
-			tt.assertions(t, args, err)
-		})
-	}
-}
-
-func TestAnalysisRunBuilder_buildOwnerReferences(t *testing.T) {
-	scheme := runtime.NewScheme()
-	require.NoError(t, rolloutsapi.AddToScheme(scheme))
-
-	tests := []struct {
-		name       string
-		owners     []Owner
-		objects    []client.Object
-		assertions func(*testing.T, []metav1.OwnerReference, error)
-	}{
 		{
-			name:   "empty owners list",
-			owners: []Owner{},
-			assertions: func(t *testing.T, refs []metav1.OwnerReference, err error) {
+			name: "provided args take precedence",
+			template: &rolloutsapi.AnalysisTemplate{
+				Spec: rolloutsapi.AnalysisTemplateSpec{
+					Args: []rolloutsapi.Argument{
+						{Name: "param1"},
+						{Name: "param2", Value: ptr.To("default2")},
+					},
+				},
+			},
+			args: []kargoapi.AnalysisRunArgument{
+				{Name: "param1", Value: "value1"},
+			},
+			providedArgs: map[string]string{
+				"param1": "provided1",
+				"param2": "provided2",
+			},
+			assertions: func(t *testing.T, args []rolloutsapi.Argument, err error) {
+				require.NoError(t, err)
+				require.Len(t, args, 2)
+				assert.Equal(t, "provided1", *args[0].Value)
+				assert.Equal(t, "provided2", *args[1].Value)
+			},
+		},
+		{
+			name: "missing required arg",
+			template: &rolloutsapi.AnalysisTemplate{
+				Spec: rolloutsapi.AnalysisTemplateSpec{
+					Args: []rolloutsapi.Argument{
+						{Name: "param1"},
+						{Name: "param2"},
+					},
+				},
+			},
+			providedArgs: map[string]string{
+				"param1": "provided1",
+			},
+			assertions: func(t *testing.T, _ []rolloutsapi.Argument, err error) {
+				assert.ErrorIs(t, err, ErrUnresolvedArgument)
+				assert.ErrorContains(t, err, `"param2"`)
+			},
+		},
+		{
+			name: "extra arg",
+			template: &rolloutsapi.AnalysisTemplate{
+				Spec: rolloutsapi.AnalysisTemplateSpec{
+					Args: []rolloutsapi.Argument{
+						{Name: "param1", Value: ptr.To("default1")},
+					},
+				},
+			},
+			providedArgs: map[string]string{
+				"unknown": "value",
+			},
+			assertions: func(t *testing.T, _ []rolloutsapi.Argument, err error) {
+				assert.ErrorIs(t, err, ErrUnknownArgument)
+				assert.ErrorContains(t, err, "validate provided arguments")
+				assert.ErrorContains(t, err, `"unknown"`)
+			},
+		},
+		{
+			name: "secret ref is passed through",
+			template: &rolloutsapi.AnalysisTemplate{
+				Spec: rolloutsapi.AnalysisTemplateSpec{
+					Args: []rolloutsapi.Argument{
+						{Name: "param1"},
+						{
+							Name: "token",
+							ValueFrom: &rolloutsapi.ValueFrom{
+								SecretKeyRef: &rolloutsapi.SecretKeyRef{
+									Name: "secret",
+									Key:  "token",
+								},
+							},
+						},
+					},
+				},
+			},
+			providedArgs: map[string]string{
+				"param1": "provided1",
+			},
+			assertions: func(t *testing.T, args []rolloutsapi.Argument, err error) {
+				require.NoError(t, err)
+				require.Len(t, args, 2)
+				assert.Equal(t, "provided1", *args[0].Value)
+				assert.Nil(t, args[1].Value)
+				require.NotNil(t, args[1].ValueFrom)
+				assert.Equal(t, &rolloutsapi.SecretKeyRef{
+					Name: "secret",
+					Key:  "token",
+				}, args[1].ValueFrom.SecretKeyRef)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := &AnalysisRunBuilder{}
+			args, err := builder.buildArgs(tt.template, tt.args, tt.providedArgs)
+			tt.assertions(t, args, err)
+		})
+	}
+}
+
+func TestAnalysisRunBuilder_buildOwnerReferences(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, rolloutsapi.AddToScheme(scheme))
+
+	tests := []struct {
+		name       string
+		owners     []Owner
+		objects    []client.Object
+		assertions func(*testing.T, []metav1.OwnerReference, error)
+	}{
+		{
+			name:   "empty owners list",
+			owners: []Owner{},
+			assertions: func(t *testing.T, refs []metav1.OwnerReference, err error) {
 				require.NoError(t, err)
 				assert.Empty(t, refs)
 			},
@@ -629,6 +1515,64 @@ func TestAnalysisRunBuilder_buildOwnerReferences(t *testing.T) {
 				}, refs[0])
 			},
 		},
+		{
+			name: "cluster-scoped and namespaced owners",
+			owners: []Owner{
+				{
+					APIVersion:    "argoproj.io/v1alpha1",
+					Kind:          "ClusterAnalysisTemplate",
+					Reference:     types.NamespacedName{Name: "cluster-template"},
+					BlockDeletion: true,
+				},
+				{
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
+					Reference:  types.NamespacedName{Name: "test-deploy", Namespace: "default"},
+				},
+			},
+			objects: []client.Object{
+				&unstructured.Unstructured{
+					Object: map[string]any{
+						"apiVersion": "argoproj.io/v1alpha1",
+						"kind":       "ClusterAnalysisTemplate",
+						"metadata": map[string]any{
+							"name": "cluster-template",
+							"uid":  "template-uid",
+						},
+					},
+				},
+				&unstructured.Unstructured{
+					Object: map[string]any{
+						"apiVersion": "apps/v1",
+						"kind":       "Deployment",
+						"metadata": map[string]any{
+							"name":      "test-deploy",
+							"namespace": "default",
+							"uid":       "deploy-uid",
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, refs []metav1.OwnerReference, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []metav1.OwnerReference{
+					{
+						APIVersion:         "argoproj.io/v1alpha1",
+						Kind:               "ClusterAnalysisTemplate",
+						Name:               "cluster-template",
+						UID:                "template-uid",
+						BlockOwnerDeletion: ptr.To(true),
+					},
+					{
+						APIVersion:         "apps/v1",
+						Kind:               "Deployment",
+						Name:               "test-deploy",
+						UID:                "deploy-uid",
+						BlockOwnerDeletion: ptr.To(false),
+					},
+				}, refs)
+			},
+		},
 		{
 			name: "multiple owners of different kinds",
 			owners: []Owner{
@@ -690,6 +1634,43 @@ func TestAnalysisRunBuilder_buildOwnerReferences(t *testing.T) {
 				}, refs)
 			},
 		},
+		{
+			name: "controller owner",
+			owners: []Owner{
+				{
+					APIVersion:    "apps/v1",
+					Kind:          "Deployment",
+					Reference:     types.NamespacedName{Name: "test-deploy", Namespace: "default"},
+					BlockDeletion: true,
+					Controller:    true,
+				},
+			},
+			objects: []client.Object{
+				&unstructured.Unstructured{
+					Object: map[string]any{
+						"apiVersion": "apps/v1",
+						"kind":       "Deployment",
+						"metadata": map[string]any{
+							"name":      "test-deploy",
+							"namespace": "default",
+							"uid":       "test-uid",
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, refs []metav1.OwnerReference, err error) {
+				require.NoError(t, err)
+				require.Len(t, refs, 1)
+				assert.Equal(t, metav1.OwnerReference{
+					APIVersion:         "apps/v1",
+					Kind:               "Deployment",
+					Name:               "test-deploy",
+					UID:                "test-uid",
+					BlockOwnerDeletion: ptr.To(true),
+					Controller:         ptr.To(true),
+				}, refs[0])
+			},
+		},
 		{
 			name: "owner not found",
 			owners: []Owner{
@@ -771,6 +1752,63 @@ func TestAnalysisRunBuilder_buildOwnerReferences(t *testing.T) {
 				}, refs[0])
 			},
 		},
+		{
+			name: "owner with matching UID",
+			owners: []Owner{
+				{
+					APIVersion: "custom.io/v1",
+					Kind:       "CustomKind",
+					Reference:  types.NamespacedName{Name: "custom-res", Namespace: "default"},
+					UID:        "custom-uid",
+				},
+			},
+			objects: []client.Object{
+				&unstructured.Unstructured{
+					Object: map[string]any{
+						"apiVersion": "custom.io/v1",
+						"kind":       "CustomKind",
+						"metadata": map[string]any{
+							"name":      "custom-res",
+							"namespace": "default",
+							"uid":       "custom-uid",
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, refs []metav1.OwnerReference, err error) {
+				require.NoError(t, err)
+				require.Len(t, refs, 1)
+				assert.Equal(t, types.UID("custom-uid"), refs[0].UID)
+			},
+		},
+		{
+			name: "recreated owner",
+			owners: []Owner{
+				{
+					APIVersion: "custom.io/v1",
+					Kind:       "CustomKind",
+					Reference:  types.NamespacedName{Name: "custom-res", Namespace: "default"},
+					UID:        "old-uid",
+				},
+			},
+			objects: []client.Object{
+				&unstructured.Unstructured{
+					Object: map[string]any{
+						"apiVersion": "custom.io/v1",
+						"kind":       "CustomKind",
+						"metadata": map[string]any{
+							"name":      "custom-res",
+							"namespace": "default",
+							"uid":       "new-uid",
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, refs []metav1.OwnerReference, err error) {
+				assert.ErrorContains(t, err, `has UID "new-uid" instead of "old-uid"`)
+				assert.Nil(t, refs)
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -787,6 +1825,192 @@ func TestAnalysisRunBuilder_buildOwnerReferences(t *testing.T) {
 	}
 }
 
+func TestAnalysisRunBuilder_buildOwnerReferences_deterministicOrder(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, rolloutsapi.AddToScheme(scheme))
+
+	var objects []client.Object
+	for _, name := range []string{"deploy-a", "deploy-b"} {
+		objects = append(objects, &unstructured.Unstructured{
+			Object: map[string]any{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata": map[string]any{
+					"name":      name,
+					"namespace": "default",
+					"uid":       name + "-uid",
+				},
+			},
+		})
+	}
+	objects = append(objects, &unstructured.Unstructured{
+		Object: map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata": map[string]any{
+				"name":      "svc",
+				"namespace": "default",
+				"uid":       "svc-uid",
+			},
+		},
+	})
+
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objects...).
+		Build()
+	builder := &AnalysisRunBuilder{client: c}
+
+	deployA := Owner{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Reference:  types.NamespacedName{Name: "deploy-a", Namespace: "default"},
+	}
+	deployB := Owner{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Reference:  types.NamespacedName{Name: "deploy-b", Namespace: "default"},
+	}
+	svc := Owner{
+		APIVersion: "v1",
+		Kind:       "Service",
+		Reference:  types.NamespacedName{Name: "svc", Namespace: "default"},
+		Controller: true,
+	}
+
+	refs1, err := builder.buildOwnerReferences(context.Background(), []Owner{deployB, svc, deployA})
+	require.NoError(t, err)
+	refs2, err := builder.buildOwnerReferences(context.Background(), []Owner{deployA, deployB, svc})
+	require.NoError(t, err)
+
+	assert.Equal(t, refs1, refs2)
+	require.Len(t, refs1, 3)
+	assert.Equal(t, "svc", refs1[0].Name)
+	assert.Equal(t, "deploy-a", refs1[1].Name)
+	assert.Equal(t, "deploy-b", refs1[2].Name)
+}
+
+func TestOwnerReferences(t *testing.T) {
+	stage := Owner{
+		APIVersion: "kargo.akuity.io/v1alpha1",
+		Kind:       "Stage",
+		Reference:  types.NamespacedName{Name: "stage", Namespace: "default"},
+	}
+	freight := Owner{
+		APIVersion: "kargo.akuity.io/v1alpha1",
+		Kind:       "Freight",
+		Reference:  types.NamespacedName{Name: "freight", Namespace: "default"},
+	}
+
+	tests := []struct {
+		name       string
+		owners     []Owner
+		assertions func(*testing.T, []metav1.OwnerReference, error)
+	}{
+		{
+			name: "no owners",
+			assertions: func(t *testing.T, refs []metav1.OwnerReference, err error) {
+				require.NoError(t, err)
+				assert.Empty(t, refs)
+			},
+		},
+		{
+			name: "valid owners",
+			owners: []Owner{
+				freight,
+				{
+					APIVersion:    stage.APIVersion,
+					Kind:          stage.Kind,
+					Reference:     stage.Reference,
+					BlockDeletion: true,
+					Controller:    true,
+				},
+			},
+			assertions: func(t *testing.T, refs []metav1.OwnerReference, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []metav1.OwnerReference{
+					{
+						APIVersion:         "kargo.akuity.io/v1alpha1",
+						Kind:               "Stage",
+						Name:               "stage",
+						BlockOwnerDeletion: ptr.To(true),
+						Controller:         ptr.To(true),
+					},
+					{
+						APIVersion:         "kargo.akuity.io/v1alpha1",
+						Kind:               "Freight",
+						Name:               "freight",
+						BlockOwnerDeletion: ptr.To(false),
+					},
+				}, refs)
+			},
+		},
+		{
+			name: "duplicate owners are merged",
+			owners: []Owner{
+				stage,
+				{
+					APIVersion:    stage.APIVersion,
+					Kind:          stage.Kind,
+					Reference:     stage.Reference,
+					BlockDeletion: true,
+				},
+				{
+					APIVersion: stage.APIVersion,
+					Kind:       stage.Kind,
+					Reference:  stage.Reference,
+					Controller: true,
+				},
+			},
+			assertions: func(t *testing.T, refs []metav1.OwnerReference, err error) {
+				require.NoError(t, err)
+				require.Len(t, refs, 1)
+				assert.Equal(t, ptr.To(true), refs[0].BlockOwnerDeletion)
+				assert.Equal(t, ptr.To(true), refs[0].Controller)
+			},
+		},
+		{
+			name: "multiple controllers",
+			owners: []Owner{
+				{
+					APIVersion: stage.APIVersion,
+					Kind:       stage.Kind,
+					Reference:  stage.Reference,
+					Controller: true,
+				},
+				{
+					APIVersion: freight.APIVersion,
+					Kind:       freight.Kind,
+					Reference:  freight.Reference,
+					Controller: true,
+				},
+			},
+			assertions: func(t *testing.T, refs []metav1.OwnerReference, err error) {
+				assert.ErrorContains(t, err, "only one owner can be a controller")
+				assert.Nil(t, refs)
+			},
+		},
+		{
+			name: "invalid owner",
+			owners: []Owner{
+				stage,
+				{Kind: "Freight"},
+			},
+			assertions: func(t *testing.T, refs []metav1.OwnerReference, err error) {
+				assert.ErrorContains(t, err, "owner 1 is missing APIVersion, Name")
+				assert.Nil(t, refs)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refs, err := OwnerReferences(tt.owners)
+			tt.assertions(t, refs, err)
+		})
+	}
+}
+
 func TestAnalysisRunBuilder_getAnalysisTemplates(t *testing.T) {
 	scheme := runtime.NewScheme()
 	require.NoError(t, rolloutsapi.AddToScheme(scheme))
@@ -838,7 +2062,7 @@ func TestAnalysisRunBuilder_getAnalysisTemplates(t *testing.T) {
 				{Name: "nonexistent"},
 			},
 			assertions: func(t *testing.T, templates []*rolloutsapi.AnalysisTemplate, err error) {
-				assert.ErrorContains(t, err, "get AnalysisRun")
+				assert.ErrorContains(t, err, "get AnalysisTemplate")
 				assert.Nil(t, templates)
 			},
 		},
@@ -891,7 +2115,7 @@ func TestAnalysisRunBuilder_getAnalysisTemplates(t *testing.T) {
 				},
 			},
 			assertions: func(t *testing.T, templates []*rolloutsapi.AnalysisTemplate, err error) {
-				assert.ErrorContains(t, err, "get AnalysisRun")
+				assert.ErrorContains(t, err, "get AnalysisTemplate")
 				assert.Nil(t, templates)
 			},
 		},
@@ -910,3 +2134,239 @@ func TestAnalysisRunBuilder_getAnalysisTemplates(t *testing.T) {
 		})
 	}
 }
+
+func TestAnalysisRunBuilder_ResolveTemplates(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, rolloutsapi.AddToScheme(scheme))
+
+	objects := []client.Object{
+		&rolloutsapi.AnalysisTemplate{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "template1",
+				Namespace: "default",
+			},
+		},
+		newClusterAnalysisTemplate("cluster-template1", "metric1"),
+	}
+
+	tests := []struct {
+		name         string
+		verification *kargoapi.Verification
+		options      []AnalysisRunOption
+		interceptor  interceptor.Funcs
+		assertions   func(*testing.T, []*rolloutsapi.AnalysisTemplate, error)
+	}{
+		{
+			name: "nil verification config returns error",
+			assertions: func(t *testing.T, templates []*rolloutsapi.AnalysisTemplate, err error) {
+				assert.ErrorContains(t, err, "missing verification configuration")
+				assert.Nil(t, templates)
+			},
+		},
+		{
+			name: "all templates present",
+			verification: &kargoapi.Verification{
+				AnalysisTemplates: []kargoapi.AnalysisTemplateReference{{Name: "template1"}},
+			},
+			options: []AnalysisRunOption{
+				WithClusterTemplates{"cluster-template1"},
+			},
+			assertions: func(t *testing.T, templates []*rolloutsapi.AnalysisTemplate, err error) {
+				require.NoError(t, err)
+				require.Len(t, templates, 2)
+				assert.Equal(t, "template1", templates[0].Name)
+				assert.Equal(t, "cluster-template1", templates[1].Name)
+			},
+		},
+		{
+			name: "all templates missing",
+			verification: &kargoapi.Verification{
+				AnalysisTemplates: []kargoapi.AnalysisTemplateReference{{Name: "missing1"}},
+			},
+			options: []AnalysisRunOption{
+				WithTemplates{"missing2"},
+				WithClusterTemplates{"missing3"},
+			},
+			assertions: func(t *testing.T, templates []*rolloutsapi.AnalysisTemplate, err error) {
+				assert.ErrorContains(t, err, `get AnalysisTemplate "missing1"`)
+				assert.ErrorContains(t, err, `get AnalysisTemplate "missing2"`)
+				assert.ErrorContains(t, err, `get ClusterAnalysisTemplate "missing3"`)
+				assert.Nil(t, templates)
+			},
+		},
+		{
+			name: "mixed present and missing templates",
+			verification: &kargoapi.Verification{
+				AnalysisTemplates: []kargoapi.AnalysisTemplateReference{
+					{Name: "template1"},
+					{Name: "missing1"},
+				},
+			},
+			options: []AnalysisRunOption{
+				WithClusterTemplates{"cluster-template1", "missing2"},
+			},
+			assertions: func(t *testing.T, templates []*rolloutsapi.AnalysisTemplate, err error) {
+				assert.ErrorContains(t, err, `get AnalysisTemplate "missing1"`)
+				assert.ErrorContains(t, err, `get ClusterAnalysisTemplate "missing2"`)
+				assert.NotContains(t, err.Error(), `"template1"`)
+				assert.NotContains(t, err.Error(), `"cluster-template1"`)
+				assert.Nil(t, templates)
+			},
+		},
+		{
+			name: "other errors are returned immediately",
+			verification: &kargoapi.Verification{
+				AnalysisTemplates: []kargoapi.AnalysisTemplateReference{
+					{Name: "template1"},
+					{Name: "template2"},
+				},
+			},
+			interceptor: interceptor.Funcs{
+				Get: func(context.Context, client.WithWatch, client.ObjectKey, client.Object, ...client.GetOption) error {
+					return errors.New("something went wrong")
+				},
+			},
+			assertions: func(t *testing.T, templates []*rolloutsapi.AnalysisTemplate, err error) {
+				assert.ErrorContains(t, err, `get AnalysisTemplate "template1"`)
+				assert.NotContains(t, err.Error(), `"template2"`)
+				assert.Nil(t, templates)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(objects...).
+				WithInterceptorFuncs(tt.interceptor).
+				Build()
+
+			builder := NewAnalysisRunBuilder(c, Config{})
+			templates, err := builder.ResolveTemplates(context.Background(), "default", tt.verification, tt.options...)
+			tt.assertions(t, templates, err)
+		})
+	}
+}
+
+func TestAnalysisRunBuilder_getClusterAnalysisTemplates(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, rolloutsapi.AddToScheme(scheme))
+
+	tests := []struct {
+		name       string
+		names      []string
+		objects    []client.Object
+		assertions func(*testing.T, []*rolloutsapi.AnalysisTemplate, error)
+	}{
+		{
+			name: "no names",
+			assertions: func(t *testing.T, templates []*rolloutsapi.AnalysisTemplate, err error) {
+				require.NoError(t, err)
+				assert.Empty(t, templates)
+			},
+		},
+		{
+			name:  "multiple templates",
+			names: []string{"template1", "template2"},
+			objects: []client.Object{
+				newClusterAnalysisTemplate("template1", "metric1"),
+				newClusterAnalysisTemplate("template2", "metric2"),
+			},
+			assertions: func(t *testing.T, templates []*rolloutsapi.AnalysisTemplate, err error) {
+				require.NoError(t, err)
+				require.Len(t, templates, 2)
+				assert.Equal(t, "template1", templates[0].Name)
+				require.Len(t, templates[0].Spec.Metrics, 1)
+				assert.Equal(t, "metric1", templates[0].Spec.Metrics[0].Name)
+				assert.Equal(t, "template2", templates[1].Name)
+				require.Len(t, templates[1].Spec.Metrics, 1)
+				assert.Equal(t, "metric2", templates[1].Spec.Metrics[0].Name)
+			},
+		},
+		{
+			name:  "template not found",
+			names: []string{"nonexistent"},
+			assertions: func(t *testing.T, templates []*rolloutsapi.AnalysisTemplate, err error) {
+				assert.ErrorContains(t, err, `get ClusterAnalysisTemplate "nonexistent"`)
+				assert.Nil(t, templates)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(tt.objects...).
+				Build()
+
+			builder := &AnalysisRunBuilder{client: c}
+			templates, err := builder.getClusterAnalysisTemplates(context.Background(), tt.names)
+			tt.assertions(t, templates, err)
+		})
+	}
+}
+
+func Test_validateTemplateReferences(t *testing.T) {
+	tests := []struct {
+		name             string
+		references       []kargoapi.AnalysisTemplateReference
+		clusterTemplates []string
+		assertions       func(*testing.T, error)
+	}{
+		{
+			name:             "distinct names",
+			references:       []kargoapi.AnalysisTemplateReference{{Name: "template1"}},
+			clusterTemplates: []string{"template2"},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "overlapping names",
+			references: []kargoapi.AnalysisTemplateReference{
+				{Name: "template1"},
+				{Name: "template2"},
+			},
+			clusterTemplates: []string{"template1", "template2"},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `template "template1"`)
+				assert.ErrorContains(t, err, `template "template2"`)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.assertions(t, validateTemplateReferences(tt.references, tt.clusterTemplates))
+		})
+	}
+}
+
+func newClusterAnalysisTemplate(name, metric string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{
+		Object: map[string]any{
+			"spec": map[string]any{
+				"metrics": []any{
+					map[string]any{"name": metric},
+				},
+			},
+		},
+	}
+	obj.SetGroupVersionKind(rolloutsapi.GroupVersion.WithKind(clusterAnalysisTemplateKind))
+	obj.SetName(name)
+	return obj
+}
+
+func Test_templateReferences(t *testing.T) {
+	refs := templateReferences(
+		[]kargoapi.AnalysisTemplateReference{{Name: "template1"}, {Name: "template2"}},
+		[]string{"template3", "template1"},
+	)
+	assert.Equal(t, []kargoapi.AnalysisTemplateReference{
+		{Name: "template1"},
+		{Name: "template2"},
+		{Name: "template3"},
+	}, refs)
+}
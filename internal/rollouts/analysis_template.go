@@ -1,6 +1,7 @@
 package rollouts
 
 import (
+	"errors"
 	"fmt"
 
 	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
@@ -93,9 +94,11 @@ func flattenMeasurementRetentionMetrics(
 }
 
 // flattenArgs combines arguments from multiple templates, handling conflicts
-// and updates.
+// and updates. If templates declare the same argument with different values,
+// an error listing all conflicting arguments is returned.
 func flattenArgs(templates []*rolloutsapi.AnalysisTemplate) ([]rolloutsapi.Argument, error) {
 	var combinedArgs []rolloutsapi.Argument
+	var conflicts []error
 
 	updateOrAppend := func(newArg rolloutsapi.Argument) error {
 		for i, existingArg := range combinedArgs {
@@ -114,11 +117,17 @@ func flattenArgs(templates []*rolloutsapi.AnalysisTemplate) ([]rolloutsapi.Argum
 	for _, tmpl := range templates {
 		for _, arg := range tmpl.Spec.Args {
 			if err := updateOrAppend(arg); err != nil {
-				return nil, err
+				if tmpl.Name != "" {
+					err = fmt.Errorf("template %q: %w", tmpl.Name, err)
+				}
+				conflicts = append(conflicts, err)
 			}
 		}
 	}
 
+	if len(conflicts) > 0 {
+		return nil, errors.Join(conflicts...)
+	}
 	return combinedArgs, nil
 }
 
@@ -221,8 +230,19 @@ func findArgIndex(args []rolloutsapi.Argument, name string) int {
 func validateArgsResolution(args []rolloutsapi.Argument) error {
 	for i := range args {
 		if args[i].Value == nil && args[i].ValueFrom == nil {
-			return fmt.Errorf("unresolved argument %q: neither Value nor ValueFrom is set", args[i].Name)
+			return fmt.Errorf("%w %q: neither Value nor ValueFrom is set", ErrUnresolvedArgument, args[i].Name)
 		}
 	}
 	return nil
 }
+
+// templateNames returns the names of the given templates, e.g. for logging.
+func templateNames(templates []*rolloutsapi.AnalysisTemplate) []string {
+	names := make([]string, 0, len(templates))
+	for _, template := range templates {
+		if template != nil {
+			names = append(names, template.Name)
+		}
+	}
+	return names
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/ptr"
 
 	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
@@ -636,6 +637,37 @@ func Test_flattenArgs(t *testing.T) {
 				}, args[0])
 			},
 		},
+		{
+			name: "lists all conflicting args",
+			templates: []*rolloutsapi.AnalysisTemplate{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "template1"},
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Args: []rolloutsapi.Argument{
+							{Name: "foo", Value: ptr.To("value1")},
+							{Name: "bar", Value: ptr.To("value1")},
+							{Name: "baz", Value: ptr.To("value1")},
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "template2"},
+					Spec: rolloutsapi.AnalysisTemplateSpec{
+						Args: []rolloutsapi.Argument{
+							{Name: "foo", Value: ptr.To("value2")},
+							{Name: "bar", Value: ptr.To("value2")},
+							{Name: "baz", Value: ptr.To("value1")},
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, args []rolloutsapi.Argument, err error) {
+				require.ErrorContains(t, err, `template "template2": conflicting values for argument "foo"`)
+				require.ErrorContains(t, err, `template "template2": conflicting values for argument "bar"`)
+				assert.NotContains(t, err.Error(), `"baz"`)
+				assert.Nil(t, args)
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,157 @@
+package rollouts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+var (
+	// ErrUnknownArgument is returned when an argument is provided which is not
+	// declared by any of the AnalysisTemplates.
+	ErrUnknownArgument = errors.New("unknown argument")
+	// ErrSecretArgument is returned when a value is provided for an argument
+	// which the AnalysisTemplates resolve from a Secret.
+	ErrSecretArgument = errors.New("secret-backed argument")
+	// ErrUnresolvedArgument is returned when an argument declared by the
+	// AnalysisTemplates is left without a value.
+	ErrUnresolvedArgument = errors.New("unresolved argument")
+	// ErrDisallowedArgument is returned when an argument is set which is not
+	// allowed by WithAllowedArgs.
+	ErrDisallowedArgument = errors.New("disallowed argument")
+	// ErrUnresolvedArgumentReference is returned when a metric references an
+	// argument which is not supplied to the AnalysisRun.
+	ErrUnresolvedArgumentReference = errors.New("unresolved argument reference")
+)
+
+// argReferenceRegex matches references to arguments in metrics, either in the
+// {{args.<name>}} form substituted by Argo Rollouts, or in the ${args.<name>}
+// form. The first non-empty group holds the name of the argument.
+var argReferenceRegex = regexp.MustCompile(`\{\{\s*args\.([\w.-]+?)\s*\}\}|\$\{args\.([\w.-]+)\}`)
+
+// validateAllowedArgs checks the arguments of the verification configuration
+// and the provided argument values against the allowed argument names. If
+// allowed is nil, all arguments are allowed. It returns an error for every
+// argument which is not allowed, sorted by name.
+func validateAllowedArgs(
+	allowed []string,
+	args []kargoapi.AnalysisRunArgument,
+	provided map[string]string,
+) error {
+	if allowed == nil {
+		return nil
+	}
+	names := slices.Collect(maps.Keys(provided))
+	for _, arg := range args {
+		names = append(names, arg.Name)
+	}
+	slices.Sort(names)
+
+	var errs []error
+	for _, name := range slices.Compact(names) {
+		if !slices.Contains(allowed, name) {
+			errs = append(errs, fmt.Errorf("%w %q: not in the list of allowed arguments", ErrDisallowedArgument, name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateProvidedArgs checks the provided argument values against the
+// arguments declared by the templates. It returns an error for every provided
+// argument which is not declared, or which is declared to be resolved from a
+// Secret. The latter are passed through to the AnalysisRun as ValueFrom
+// references, so that the secret value is never inlined.
+func validateProvidedArgs(declared []rolloutsapi.Argument, provided map[string]string) error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(provided)) {
+		idx := findArgIndex(declared, name)
+		if idx < 0 {
+			errs = append(errs, fmt.Errorf("%w %q: not declared by any template", ErrUnknownArgument, name))
+			continue
+		}
+		if from := declared[idx].ValueFrom; from != nil && from.SecretKeyRef != nil {
+			errs = append(errs, fmt.Errorf(
+				"%w %q: value is resolved from Secret %q and cannot be set",
+				ErrSecretArgument, name, from.SecretKeyRef.Name,
+			))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateArgReferences checks that every argument referenced by the metrics
+// of the spec, e.g. in the query of a Prometheus metric, is supplied to the
+// AnalysisRun by a value or a reference to a value. It returns an error for
+// every unresolved reference, in the order of the metrics.
+func validateArgReferences(spec *rolloutsapi.AnalysisRunSpec) error {
+	supplied := func(name string) bool {
+		idx := findArgIndex(spec.Args, name)
+		return idx >= 0 && (spec.Args[idx].Value != nil || spec.Args[idx].ValueFrom != nil)
+	}
+
+	var errs []error
+	for _, metric := range spec.Metrics {
+		data, err := json.Marshal(metric)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("marshal metric %q: %w", metric.Name, err))
+			continue
+		}
+		for _, name := range argReferences(data) {
+			if supplied(name) {
+				continue
+			}
+			errs = append(errs, fmt.Errorf(
+				"%w %q: referenced by metric %q but not supplied",
+				ErrUnresolvedArgumentReference, name, metric.Name,
+			))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// argReferences returns the names of the arguments referenced in the given
+// data, see argReferenceRegex, in the order of their first reference and
+// without duplicates.
+func argReferences(data []byte) []string {
+	var names []string
+	for _, match := range argReferenceRegex.FindAllSubmatch(data, -1) {
+		name := string(match[1])
+		if name == "" {
+			name = string(match[2])
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// providedArgsToArguments converts the provided argument values to rollouts
+// arguments, sorted by name.
+func providedArgsToArguments(provided map[string]string) []rolloutsapi.Argument {
+	args := make([]rolloutsapi.Argument, 0, len(provided))
+	for _, name := range slices.Sorted(maps.Keys(provided)) {
+		value := provided[name]
+		args = append(args, rolloutsapi.Argument{
+			Name:  name,
+			Value: &value,
+		})
+	}
+	return args
+}
+
+// argumentNames returns the names of the given arguments, e.g. for logging.
+// Their values are omitted, as they may hold sensitive information.
+func argumentNames(args []rolloutsapi.Argument) []string {
+	names := make([]string, 0, len(args))
+	for _, arg := range args {
+		names = append(names, arg.Name)
+	}
+	return names
+}
@@ -0,0 +1,271 @@
+package rollouts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func Test_validateProvidedArgs(t *testing.T) {
+	declared := []rolloutsapi.Argument{
+		{Name: "param1"},
+		{Name: "param2", Value: ptr.To("default2")},
+		{
+			Name: "token",
+			ValueFrom: &rolloutsapi.ValueFrom{
+				SecretKeyRef: &rolloutsapi.SecretKeyRef{
+					Name: "secret",
+					Key:  "token",
+				},
+			},
+		},
+		{
+			Name: "pod",
+			ValueFrom: &rolloutsapi.ValueFrom{
+				FieldRef: &rolloutsapi.FieldRef{
+					FieldPath: "metadata.name",
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		provided   map[string]string
+		assertions func(*testing.T, error)
+	}{
+		{
+			name: "no provided args",
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "declared args",
+			provided: map[string]string{
+				"param1": "value1",
+				"param2": "value2",
+				"pod":    "value3",
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "unknown args",
+			provided: map[string]string{
+				"unknown1": "value1",
+				"unknown2": "value2",
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrUnknownArgument)
+				assert.ErrorContains(t, err, `unknown argument "unknown1"`)
+				assert.ErrorContains(t, err, `unknown argument "unknown2"`)
+			},
+		},
+		{
+			name: "secret-backed arg",
+			provided: map[string]string{
+				"token": "inline",
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrSecretArgument)
+				assert.ErrorContains(t, err, `Secret "secret"`)
+				assert.NotContains(t, err.Error(), "inline")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.assertions(t, validateProvidedArgs(declared, tt.provided))
+		})
+	}
+}
+
+func TestBuild_allowedArgs(t *testing.T) {
+	templates := []*rolloutsapi.AnalysisTemplate{{
+		Spec: rolloutsapi.AnalysisTemplateSpec{
+			Metrics: []rolloutsapi.Metric{{Name: "metric"}},
+			Args: []rolloutsapi.Argument{
+				{Name: "service"},
+				{Name: "namespace", Value: ptr.To("default")},
+			},
+		},
+	}}
+
+	tests := []struct {
+		name       string
+		args       []kargoapi.AnalysisRunArgument
+		options    []AnalysisRunOption
+		assertions func(*testing.T, *rolloutsapi.AnalysisRun, error)
+	}{
+		{
+			name:    "unset allows all arguments",
+			args:    []kargoapi.AnalysisRunArgument{{Name: "service", Value: "api"}},
+			options: []AnalysisRunOption{WithArgs{"namespace": "other"}},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Len(t, ar.Spec.Args, 2)
+			},
+		},
+		{
+			name: "allowed arguments",
+			args: []kargoapi.AnalysisRunArgument{{Name: "service", Value: "api"}},
+			options: []AnalysisRunOption{
+				WithAllowedArgs("service"),
+				WithArgs{"service": "web"},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []rolloutsapi.Argument{
+					{Name: "service", Value: ptr.To("web")},
+					{Name: "namespace", Value: ptr.To("default")},
+				}, ar.Spec.Args)
+			},
+		},
+		{
+			name: "denied arguments",
+			args: []kargoapi.AnalysisRunArgument{{Name: "service", Value: "api"}},
+			options: []AnalysisRunOption{
+				WithAllowedArgs("service"),
+				WithArgs{"namespace": "other"},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.ErrorIs(t, err, ErrDisallowedArgument)
+				assert.ErrorContains(t, err, `disallowed argument "namespace"`)
+				assert.NotContains(t, err.Error(), `"service"`)
+				assert.Nil(t, ar)
+			},
+		},
+		{
+			name:    "empty allowlist denies all arguments",
+			args:    []kargoapi.AnalysisRunArgument{{Name: "service", Value: "api"}},
+			options: []AnalysisRunOption{WithAllowedArgs()},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, `disallowed argument "service"`)
+				assert.Nil(t, ar)
+			},
+		},
+		{
+			name: "allowlist passed multiple times",
+			args: []kargoapi.AnalysisRunArgument{{Name: "service", Value: "api"}},
+			options: []AnalysisRunOption{
+				WithAllowedArgs("service"),
+				WithAllowedArgs("namespace"),
+				WithArgs{"namespace": "other"},
+			},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar, err := Build("default", templates, tt.args, tt.options...)
+			tt.assertions(t, ar, err)
+		})
+	}
+}
+
+func Test_providedArgsToArguments(t *testing.T) {
+	args := providedArgsToArguments(map[string]string{
+		"b": "value-b",
+		"a": "value-a",
+	})
+	require.Len(t, args, 2)
+	assert.Equal(t, "a", args[0].Name)
+	assert.Equal(t, "value-a", *args[0].Value)
+	assert.Equal(t, "b", args[1].Name)
+	assert.Equal(t, "value-b", *args[1].Value)
+}
+
+func TestBuild_argReferences(t *testing.T) {
+	prometheus := func(name, query string) rolloutsapi.Metric {
+		return rolloutsapi.Metric{
+			Name: name,
+			Provider: rolloutsapi.MetricProvider{
+				Prometheus: &rolloutsapi.PrometheusMetric{Query: query},
+			},
+		}
+	}
+	templates := []*rolloutsapi.AnalysisTemplate{{
+		Spec: rolloutsapi.AnalysisTemplateSpec{
+			Args: []rolloutsapi.Argument{{Name: "service", Value: ptr.To("api")}},
+		},
+	}}
+
+	tests := []struct {
+		name       string
+		metrics    []rolloutsapi.Metric
+		options    []AnalysisRunOption
+		assertions func(*testing.T, *rolloutsapi.AnalysisRun, error)
+	}{
+		{
+			name: "satisfied references",
+			metrics: []rolloutsapi.Metric{
+				prometheus("errors", `sum(errors{service="${args.service}"})`),
+				prometheus("latency", `latency{service="{{ args.service }}"}`),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Len(t, ar.Spec.Metrics, 2)
+			},
+		},
+		{
+			name: "unsatisfied references",
+			metrics: []rolloutsapi.Metric{
+				prometheus("errors", `sum(errors{service="${args.service}", env="${args.env}"})`),
+				prometheus("latency", `latency{query="{{args.query}}", env="{{args.env}}"}`),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.ErrorIs(t, err, ErrUnresolvedArgumentReference)
+				assert.ErrorContains(t, err, `unresolved argument reference "env": referenced by metric "errors"`)
+				assert.ErrorContains(t, err, `unresolved argument reference "query": referenced by metric "latency"`)
+				assert.ErrorContains(t, err, `unresolved argument reference "env": referenced by metric "latency"`)
+				assert.NotContains(t, err.Error(), `"service"`)
+				assert.Nil(t, ar)
+			},
+		},
+		{
+			name: "metric using no arguments",
+			metrics: []rolloutsapi.Metric{
+				prometheus("up", `up`),
+			},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "unsatisfied references without validation",
+			metrics: []rolloutsapi.Metric{
+				prometheus("errors", `errors{env="${args.env}"}`),
+			},
+			options: []AnalysisRunOption{WithArgReferenceValidation(false)},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar, err := Build(
+				"default",
+				templates,
+				nil,
+				append([]AnalysisRunOption{
+					WithArgReferenceValidation(true),
+					WithInlineMetrics(tt.metrics),
+				}, tt.options...)...,
+			)
+			tt.assertions(t, ar, err)
+		})
+	}
+}
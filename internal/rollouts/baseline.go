@@ -0,0 +1,84 @@
+package rollouts
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// baselineArgPrefix is the prefix of the names of the arguments set from the
+// measurements of a baseline AnalysisRun.
+const baselineArgPrefix = "baseline-"
+
+// baselineArgs returns the arguments holding the value of the latest
+// successful measurement of every metric of the given baseline AnalysisRun.
+// It returns an error if the AnalysisRun is nil or none of its metrics has a
+// successful measurement with a value.
+func baselineArgs(ar *rolloutsapi.AnalysisRun) (map[string]string, error) {
+	if ar == nil {
+		return nil, errors.New("missing baseline AnalysisRun")
+	}
+	args := make(map[string]string, len(ar.Status.MetricResults))
+	for _, result := range ar.Status.MetricResults {
+		for i := len(result.Measurements) - 1; i >= 0; i-- {
+			m := result.Measurements[i]
+			if m.Phase == rolloutsapi.AnalysisPhaseSuccessful && m.Value != "" {
+				args[baselineArgPrefix+result.Name] = m.Value
+				break
+			}
+		}
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("baseline AnalysisRun %q has no successful measurements", ar.Name)
+	}
+	return args, nil
+}
+
+// argsWithBaseline returns the argument values of the options merged with the
+// baseline arguments which are declared by the given arguments, e.g. those of
+// the templates. Argument values of the options take precedence over the
+// baseline arguments.
+func (o *AnalysisRunOptions) argsWithBaseline(declared []rolloutsapi.Argument) map[string]string {
+	if len(o.baselineArgs) == 0 {
+		return o.Args
+	}
+	args := make(map[string]string, len(o.Args)+len(o.baselineArgs))
+	for name, value := range o.baselineArgs {
+		if findArgIndex(declared, name) >= 0 {
+			args[name] = value
+		}
+	}
+	maps.Copy(args, o.Args)
+	return args
+}
+
+// templateArgs returns the arguments declared by the given templates.
+func templateArgs(templates []*rolloutsapi.AnalysisTemplate) []rolloutsapi.Argument {
+	var args []rolloutsapi.Argument
+	for _, template := range templates {
+		args = append(args, template.Spec.Args...)
+	}
+	return args
+}
+
+// validateBaseline returns an error if no baseline arguments could be derived
+// from the baseline AnalysisRun, unless the baseline policy of the options is
+// BaselinePolicySkip.
+func (o *AnalysisRunOptions) validateBaseline() error {
+	switch o.BaselinePolicy {
+	case "", BaselinePolicyRequire:
+		return o.baselineErr
+	case BaselinePolicySkip:
+		return nil
+	default:
+		return invalidField(
+			field.NewPath("baselinePolicy"),
+			o.BaselinePolicy,
+			fmt.Errorf("unknown baseline policy %q", o.BaselinePolicy),
+		)
+	}
+}
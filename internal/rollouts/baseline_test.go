@@ -0,0 +1,186 @@
+package rollouts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestWithBaselineRun(t *testing.T) {
+	templates := []*rolloutsapi.AnalysisTemplate{
+		{
+			Spec: rolloutsapi.AnalysisTemplateSpec{
+				Metrics: []rolloutsapi.Metric{{Name: "latency"}, {Name: "error-rate"}},
+				Args: []rolloutsapi.Argument{
+					{Name: "baseline-latency", Value: ptr.To("0")},
+					{Name: "baseline-error-rate", Value: ptr.To("0")},
+				},
+			},
+		},
+	}
+	withMeasurements := &rolloutsapi.AnalysisRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "baseline"},
+		Status: rolloutsapi.AnalysisRunStatus{
+			Phase: rolloutsapi.AnalysisPhaseSuccessful,
+			MetricResults: []rolloutsapi.MetricResult{
+				{
+					Name: "latency",
+					Measurements: []rolloutsapi.Measurement{
+						{Phase: rolloutsapi.AnalysisPhaseSuccessful, Value: "0.2"},
+						{Phase: rolloutsapi.AnalysisPhaseSuccessful, Value: "0.3"},
+						{Phase: rolloutsapi.AnalysisPhaseFailed, Value: "0.9"},
+					},
+				},
+				{
+					Name: "error-rate",
+					Measurements: []rolloutsapi.Measurement{
+						{Phase: rolloutsapi.AnalysisPhaseError},
+					},
+				},
+			},
+		},
+	}
+	withoutMeasurements := &rolloutsapi.AnalysisRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "baseline"},
+		Status: rolloutsapi.AnalysisRunStatus{
+			Phase: rolloutsapi.AnalysisPhaseError,
+			MetricResults: []rolloutsapi.MetricResult{
+				{
+					Name: "latency",
+					Measurements: []rolloutsapi.Measurement{
+						{Phase: rolloutsapi.AnalysisPhaseError, Message: "connection refused"},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		templates  []*rolloutsapi.AnalysisTemplate
+		options    []AnalysisRunOption
+		assertions func(*testing.T, *rolloutsapi.AnalysisRun, error)
+	}{
+		{
+			name:    "baseline with measurements",
+			options: []AnalysisRunOption{WithBaselineRun(withMeasurements)},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []rolloutsapi.Argument{
+					{Name: "baseline-latency", Value: ptr.To("0.3")},
+					{Name: "baseline-error-rate", Value: ptr.To("0")},
+				}, ar.Spec.Args)
+			},
+		},
+		{
+			name: "explicit args take precedence when passed later",
+			options: []AnalysisRunOption{
+				WithBaselineRun(withMeasurements),
+				WithArgs{"baseline-latency": "0.5"},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, ptr.To("0.5"), ar.Spec.Args[0].Value)
+			},
+		},
+		{
+			name: "undeclared baseline arguments are ignored",
+			templates: []*rolloutsapi.AnalysisTemplate{{
+				Spec: rolloutsapi.AnalysisTemplateSpec{
+					Metrics: []rolloutsapi.Metric{{Name: "latency"}},
+					Args: []rolloutsapi.Argument{
+						{Name: "baseline-latency", Value: ptr.To("0")},
+					},
+				},
+			}},
+			options: []AnalysisRunOption{
+				WithBaselineRun(&rolloutsapi.AnalysisRun{
+					ObjectMeta: metav1.ObjectMeta{Name: "baseline"},
+					Status: rolloutsapi.AnalysisRunStatus{
+						MetricResults: []rolloutsapi.MetricResult{
+							{
+								Name: "latency",
+								Measurements: []rolloutsapi.Measurement{
+									{Phase: rolloutsapi.AnalysisPhaseSuccessful, Value: "0.3"},
+								},
+							},
+							{
+								Name: "error-rate",
+								Measurements: []rolloutsapi.Measurement{
+									{Phase: rolloutsapi.AnalysisPhaseSuccessful, Value: "0.01"},
+								},
+							},
+						},
+					},
+				}),
+				WithAllowedArgs("baseline-latency"),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []rolloutsapi.Argument{
+					{Name: "baseline-latency", Value: ptr.To("0.3")},
+				}, ar.Spec.Args)
+			},
+		},
+		{
+			name:    "baseline without measurements",
+			options: []AnalysisRunOption{WithBaselineRun(withoutMeasurements)},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, `baseline AnalysisRun "baseline" has no successful measurements`)
+			},
+		},
+		{
+			name: "baseline without measurements required",
+			options: []AnalysisRunOption{
+				WithBaselinePolicy(BaselinePolicyRequire),
+				WithBaselineRun(withoutMeasurements),
+			},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "has no successful measurements")
+			},
+		},
+		{
+			name: "baseline without measurements skipped",
+			options: []AnalysisRunOption{
+				WithBaselineRun(withoutMeasurements),
+				WithBaselinePolicy(BaselinePolicySkip),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []rolloutsapi.Argument{
+					{Name: "baseline-latency", Value: ptr.To("0")},
+					{Name: "baseline-error-rate", Value: ptr.To("0")},
+				}, ar.Spec.Args)
+			},
+		},
+		{
+			name:    "missing baseline",
+			options: []AnalysisRunOption{WithBaselineRun(nil)},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "missing baseline AnalysisRun")
+			},
+		},
+		{
+			name:    "unknown policy",
+			options: []AnalysisRunOption{WithBaselinePolicy("Ignore")},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, `unknown baseline policy "Ignore"`)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.templates == nil {
+				tt.templates = templates
+			}
+			ar, err := Build("default", tt.templates, nil, tt.options...)
+			tt.assertions(t, ar, err)
+		})
+	}
+}
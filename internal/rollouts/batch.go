@@ -0,0 +1,70 @@
+package rollouts
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// Variant describes a single AnalysisRun of a batch built using BuildMany,
+// e.g. the verification of one region of a Stage verifying across multiple
+// regions.
+type Variant struct {
+	// Args holds the argument values of the variant. They are applied on top
+	// of the arguments of the common options.
+	Args map[string]string
+	// SuffixSeed is hashed into the name suffix of the AnalysisRun of the
+	// variant, e.g. the name of the region. If empty, the name suffix of the
+	// common options is used.
+	SuffixSeed string
+	// Options holds additional options of the variant. They are applied after
+	// the common options.
+	Options []AnalysisRunOption
+}
+
+// options returns the options to build the AnalysisRun of the variant with,
+// given the common options of the batch.
+func (v Variant) options(common []AnalysisRunOption) []AnalysisRunOption {
+	opts := slices.Clone(common)
+	if len(v.Args) > 0 {
+		opts = append(opts, WithArgs(v.Args))
+	}
+	if v.SuffixSeed != "" {
+		opts = append(opts, WithContentHashSuffix(v.SuffixSeed))
+	}
+	return append(opts, v.Options...)
+}
+
+// BuildMany creates an AnalysisRun for every variant from the provided
+// verification, the common options and the overrides of the variant. The
+// AnalysisRuns are returned in the order of the variants. It returns an error
+// if any AnalysisRun cannot be built, or if the names of the AnalysisRuns are
+// not unique within the batch.
+func (b *AnalysisRunBuilder) BuildMany(
+	ctx context.Context,
+	namespace string,
+	cfg *kargoapi.Verification,
+	variants []Variant,
+	opt ...AnalysisRunOption,
+) ([]*rolloutsapi.AnalysisRun, error) {
+	runs := make([]*rolloutsapi.AnalysisRun, 0, len(variants))
+	names := make(map[string]int, len(variants))
+	for i, variant := range variants {
+		ar, err := b.Build(ctx, namespace, cfg, variant.options(opt)...)
+		if err != nil {
+			return nil, fmt.Errorf("build variant %d: %w", i, err)
+		}
+		// Names generated by the API server are unique regardless.
+		if ar.Name != "" {
+			if j, ok := names[ar.Name]; ok {
+				return nil, fmt.Errorf("name %q of variant %d is already used by variant %d", ar.Name, i, j)
+			}
+			names[ar.Name] = i
+		}
+		runs = append(runs, ar)
+	}
+	return runs, nil
+}
@@ -0,0 +1,153 @@
+package rollouts
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestAnalysisRunBuilder_BuildMany(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, rolloutsapi.AddToScheme(scheme))
+
+	template := &rolloutsapi.AnalysisTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "template",
+			Namespace: "default",
+		},
+		Spec: rolloutsapi.AnalysisTemplateSpec{
+			Metrics: []rolloutsapi.Metric{{Name: "metric"}},
+			Args: []rolloutsapi.Argument{
+				{Name: "region"},
+				{Name: "service"},
+			},
+		},
+	}
+	verification := &kargoapi.Verification{
+		AnalysisTemplates: []kargoapi.AnalysisTemplateReference{{Name: "template"}},
+	}
+	fixedULID := ulid.MustParse("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+
+	tests := []struct {
+		name       string
+		variants   []Variant
+		options    []AnalysisRunOption
+		assertions func(*testing.T, []*rolloutsapi.AnalysisRun, error)
+	}{
+		{
+			name: "variant per region",
+			variants: []Variant{
+				{Args: map[string]string{"region": "eu-west-1"}, SuffixSeed: "eu-west-1"},
+				{Args: map[string]string{"region": "us-east-1"}, SuffixSeed: "us-east-1"},
+				{Args: map[string]string{"region": "ap-south-1"}, SuffixSeed: "ap-south-1"},
+			},
+			options: []AnalysisRunOption{
+				WithNamePrefix("stage"),
+				WithStage("project", "stage"),
+				WithArgs{"service": "api"},
+			},
+			assertions: func(t *testing.T, runs []*rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				require.Len(t, runs, 3)
+
+				names := make(map[string]struct{}, len(runs))
+				for i, region := range []string{"eu-west-1", "us-east-1", "ap-south-1"} {
+					ar := runs[i]
+					assert.Empty(t, validation.IsDNS1123Subdomain(ar.Name))
+					assert.Equal(t, "stage", ar.Labels[kargoapi.StageLabelKey])
+					names[ar.Name] = struct{}{}
+
+					args := make(map[string]string, len(ar.Spec.Args))
+					for _, arg := range ar.Spec.Args {
+						args[arg.Name] = *arg.Value
+					}
+					assert.Equal(t, map[string]string{
+						"region":  region,
+						"service": "api",
+					}, args)
+				}
+				assert.Len(t, names, 3)
+			},
+		},
+		{
+			name: "variant suffix seeds keep names unique with a fixed ULID",
+			variants: []Variant{
+				{Args: map[string]string{"region": "eu-west-1"}, SuffixSeed: "eu-west-1"},
+				{Args: map[string]string{"region": "us-east-1"}, SuffixSeed: "us-east-1"},
+			},
+			options: []AnalysisRunOption{
+				WithArgs{"service": "api"},
+				WithULIDGenerator(func() ulid.ULID { return fixedULID }),
+			},
+			assertions: func(t *testing.T, runs []*rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				require.Len(t, runs, 2)
+				assert.NotEqual(t, runs[0].Name, runs[1].Name)
+			},
+		},
+		{
+			name: "duplicate names",
+			variants: []Variant{
+				{Args: map[string]string{"region": "eu-west-1"}},
+				{Args: map[string]string{"region": "us-east-1"}},
+			},
+			options: []AnalysisRunOption{
+				WithArgs{"service": "api"},
+				WithULIDGenerator(func() ulid.ULID { return fixedULID }),
+			},
+			assertions: func(t *testing.T, runs []*rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "of variant 1 is already used by variant 0")
+				assert.Nil(t, runs)
+			},
+		},
+		{
+			name: "variant options",
+			variants: []Variant{
+				{
+					Args:    map[string]string{"region": "eu-west-1", "service": "api"},
+					Options: []AnalysisRunOption{WithExtraLabels{"region": "eu-west-1"}},
+				},
+			},
+			assertions: func(t *testing.T, runs []*rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				require.Len(t, runs, 1)
+				assert.Equal(t, "eu-west-1", runs[0].Labels["region"])
+			},
+		},
+		{
+			name: "invalid variant",
+			variants: []Variant{
+				{Args: map[string]string{"region": "eu-west-1", "service": "api"}},
+				{Args: map[string]string{"unknown": "value"}},
+			},
+			assertions: func(t *testing.T, runs []*rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "build variant 1")
+				assert.ErrorIs(t, err, ErrUnknownArgument)
+				assert.Nil(t, runs)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(template.DeepCopy()).
+				Build()
+
+			builder := NewAnalysisRunBuilder(c, Config{})
+			runs, err := builder.BuildMany(context.Background(), "default", verification, tt.variants, tt.options...)
+			tt.assertions(t, runs, err)
+		})
+	}
+}
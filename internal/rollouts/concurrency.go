@@ -0,0 +1,22 @@
+package rollouts
+
+import rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+
+// CanStart reports whether another AnalysisRun of a Stage can be started,
+// given the existing AnalysisRuns of the Stage and the maximum number of
+// concurrent AnalysisRuns, e.g. as set using WithConcurrencyLimit. Only
+// AnalysisRuns which have not completed count towards the limit, i.e. those
+// which are not Successful, Failed, Error or Inconclusive. A limit of zero or
+// less does not limit the number of AnalysisRuns.
+func CanStart(existing []*rolloutsapi.AnalysisRun, limit int) bool {
+	if limit <= 0 {
+		return true
+	}
+	var running int
+	for _, ar := range existing {
+		if ar != nil && !ar.Status.Phase.Completed() {
+			running++
+		}
+	}
+	return running < limit
+}
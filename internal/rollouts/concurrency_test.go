@@ -0,0 +1,81 @@
+package rollouts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestCanStart(t *testing.T) {
+	newAnalysisRun := func(phase rolloutsapi.AnalysisPhase) *rolloutsapi.AnalysisRun {
+		return &rolloutsapi.AnalysisRun{
+			Status: rolloutsapi.AnalysisRunStatus{Phase: phase},
+		}
+	}
+	// Two of the runs have not completed.
+	existing := []*rolloutsapi.AnalysisRun{
+		newAnalysisRun(rolloutsapi.AnalysisPhaseSuccessful),
+		newAnalysisRun(rolloutsapi.AnalysisPhaseRunning),
+		newAnalysisRun(rolloutsapi.AnalysisPhaseFailed),
+		newAnalysisRun(rolloutsapi.AnalysisPhaseError),
+		newAnalysisRun(""),
+		newAnalysisRun(rolloutsapi.AnalysisPhaseInconclusive),
+		nil,
+	}
+
+	tests := []struct {
+		name     string
+		existing []*rolloutsapi.AnalysisRun
+		limit    int
+		expected bool
+	}{
+		{
+			name:     "no existing runs",
+			limit:    1,
+			expected: true,
+		},
+		{
+			name:     "below limit",
+			existing: existing,
+			limit:    3,
+			expected: true,
+		},
+		{
+			name:     "at limit",
+			existing: existing,
+			limit:    2,
+			expected: false,
+		},
+		{
+			name:     "above limit",
+			existing: existing,
+			limit:    1,
+			expected: false,
+		},
+		{
+			name: "only completed runs",
+			existing: []*rolloutsapi.AnalysisRun{
+				newAnalysisRun(rolloutsapi.AnalysisPhaseSuccessful),
+				newAnalysisRun(rolloutsapi.AnalysisPhaseFailed),
+				newAnalysisRun(rolloutsapi.AnalysisPhaseError),
+				newAnalysisRun(rolloutsapi.AnalysisPhaseInconclusive),
+			},
+			limit:    1,
+			expected: true,
+		},
+		{
+			name:     "no limit",
+			existing: existing,
+			limit:    0,
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, CanStart(tt.existing, tt.limit))
+		})
+	}
+}
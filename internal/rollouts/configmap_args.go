@@ -0,0 +1,108 @@
+package rollouts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// argsConfigMap references a ConfigMap holding argument values.
+type argsConfigMap struct {
+	// name is the name of the ConfigMap.
+	name string
+	// reader is used to get the ConfigMap. If nil, the client of the builder
+	// is used.
+	reader client.Reader
+}
+
+// WithArgsFromConfigMap returns an option which sets argument values from the
+// data of the ConfigMap with the given name, e.g. for arguments shared by an
+// environment. The ConfigMap is fetched from the namespace passed to the
+// builder using the given reader, or the client of the builder if nil. It can
+// be passed multiple times, with later ConfigMaps taking precedence over
+// earlier ones.
+//
+// Only keys matching arguments declared by the AnalysisTemplates are used, and
+// argument values of the verification and passed using WithArgs take
+// precedence over the values from ConfigMaps. Building the AnalysisRun fails
+// if a ConfigMap does not exist. As the ConfigMaps need to be fetched, they
+// are not supported by the package-level Build.
+func WithArgsFromConfigMap(name string, reader client.Reader) AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		opts.argsConfigMaps = append(opts.argsConfigMaps, argsConfigMap{
+			name:   name,
+			reader: reader,
+		})
+	})
+}
+
+// resolveConfigMapArgs returns the argument values to provide to the
+// AnalysisRun, merging the values from the ConfigMaps of the options with the
+// provided arguments of the options. Values from the ConfigMaps are only used
+// for arguments which are declared by the templates without a ValueFrom
+// reference, and which are not set by the arguments of the verification or
+// the baseline AnalysisRun.
+func (b *AnalysisRunBuilder) resolveConfigMapArgs(
+	ctx context.Context,
+	namespace string,
+	templates []*rolloutsapi.AnalysisTemplate,
+	args []kargoapi.AnalysisRunArgument,
+	opts *AnalysisRunOptions,
+) (map[string]string, error) {
+	if len(opts.argsConfigMaps) == 0 {
+		return opts.Args, nil
+	}
+
+	data := make(map[string]string)
+	var errs []error
+	for _, ref := range opts.argsConfigMaps {
+		reader := ref.reader
+		if reader == nil {
+			reader = b.client
+		}
+		cm := &corev1.ConfigMap{}
+		if err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.name}, cm); err != nil {
+			errs = append(errs, fmt.Errorf("get ConfigMap %q in namespace %q: %w", ref.name, namespace, err))
+			continue
+		}
+		maps.Copy(data, cm.Data)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	declared := make(map[string]struct{})
+	for _, template := range templates {
+		for _, arg := range template.Spec.Args {
+			if arg.ValueFrom == nil {
+				declared[arg.Name] = struct{}{}
+			}
+		}
+	}
+	for _, arg := range args {
+		if arg.Value != "" {
+			delete(declared, arg.Name)
+		}
+	}
+	// Baseline arguments take precedence over the values from the ConfigMaps.
+	for name := range opts.baselineArgs {
+		delete(declared, name)
+	}
+
+	resolved := make(map[string]string, len(declared)+len(opts.Args))
+	for name := range declared {
+		if value, ok := data[name]; ok {
+			resolved[name] = value
+		}
+	}
+	maps.Copy(resolved, opts.Args)
+	return resolved, nil
+}
@@ -0,0 +1,179 @@
+package rollouts
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestAnalysisRunBuilder_Build_argsFromConfigMap(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, rolloutsapi.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	template := &rolloutsapi.AnalysisTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "template",
+			Namespace: "default",
+		},
+		Spec: rolloutsapi.AnalysisTemplateSpec{
+			Metrics: []rolloutsapi.Metric{{Name: "metric"}},
+			Args: []rolloutsapi.Argument{
+				{Name: "cluster"},
+				{Name: "region"},
+				{Name: "service"},
+			},
+		},
+	}
+	newConfigMap := func(name string, data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+			},
+			Data: data,
+		}
+	}
+	environment := newConfigMap("environment", map[string]string{
+		"cluster":    "prod-1",
+		"region":     "eu-west-1",
+		"service":    "from-config-map",
+		"unrelated":  "value",
+		"monitoring": "prometheus",
+	})
+	argValues := func(ar *rolloutsapi.AnalysisRun) map[string]string {
+		values := make(map[string]string, len(ar.Spec.Args))
+		for _, arg := range ar.Spec.Args {
+			if arg.Value != nil {
+				values[arg.Name] = *arg.Value
+			}
+		}
+		return values
+	}
+
+	tests := []struct {
+		name       string
+		objects    []client.Object
+		args       []kargoapi.AnalysisRunArgument
+		options    func(client.Client) []AnalysisRunOption
+		assertions func(*testing.T, *rolloutsapi.AnalysisRun, error)
+	}{
+		{
+			name:    "arguments from ConfigMap",
+			objects: []client.Object{environment},
+			options: func(c client.Client) []AnalysisRunOption {
+				return []AnalysisRunOption{WithArgsFromConfigMap("environment", c)}
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, map[string]string{
+					"cluster": "prod-1",
+					"region":  "eu-west-1",
+					"service": "from-config-map",
+				}, argValues(ar))
+			},
+		},
+		{
+			name:    "inline arguments take precedence",
+			objects: []client.Object{environment},
+			args: []kargoapi.AnalysisRunArgument{
+				{Name: "cluster", Value: "from-verification"},
+			},
+			options: func(c client.Client) []AnalysisRunOption {
+				return []AnalysisRunOption{
+					WithArgs{"service": "from-options"},
+					WithArgsFromConfigMap("environment", c),
+				}
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, map[string]string{
+					"cluster": "from-verification",
+					"region":  "eu-west-1",
+					"service": "from-options",
+				}, argValues(ar))
+			},
+		},
+		{
+			name: "later ConfigMaps take precedence",
+			objects: []client.Object{
+				environment,
+				newConfigMap("overrides", map[string]string{"region": "us-east-1"}),
+			},
+			options: func(c client.Client) []AnalysisRunOption {
+				return []AnalysisRunOption{
+					WithArgsFromConfigMap("environment", c),
+					WithArgsFromConfigMap("overrides", nil),
+				}
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "us-east-1", argValues(ar)["region"])
+			},
+		},
+		{
+			name: "missing ConfigMap",
+			options: func(c client.Client) []AnalysisRunOption {
+				return []AnalysisRunOption{WithArgsFromConfigMap("environment", c)}
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "resolve arguments from ConfigMaps")
+				assert.ErrorContains(t, err, `get ConfigMap "environment" in namespace "default"`)
+				assert.True(t, apierrors.IsNotFound(err))
+				assert.Nil(t, ar)
+			},
+		},
+		{
+			name: "missing key for required argument",
+			objects: []client.Object{
+				newConfigMap("environment", map[string]string{"cluster": "prod-1", "service": "api"}),
+			},
+			options: func(c client.Client) []AnalysisRunOption {
+				return []AnalysisRunOption{WithArgsFromConfigMap("environment", c)}
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorIs(t, err, ErrUnresolvedArgument)
+				assert.ErrorContains(t, err, `"region"`)
+				assert.Nil(t, ar)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(append(tt.objects, template.DeepCopy())...).
+				Build()
+
+			builder := NewAnalysisRunBuilder(c, Config{})
+			ar, err := builder.Build(
+				context.Background(),
+				"default",
+				&kargoapi.Verification{
+					AnalysisTemplates: []kargoapi.AnalysisTemplateReference{{Name: "template"}},
+					Args:              tt.args,
+				},
+				tt.options(c)...,
+			)
+			tt.assertions(t, ar, err)
+		})
+	}
+}
+
+func TestBuild_argsFromConfigMap(t *testing.T) {
+	ar, err := Build("default", nil, nil, WithArgsFromConfigMap("environment", nil))
+	assert.ErrorContains(t, err, "arguments from ConfigMaps require AnalysisRunBuilder.Build")
+	assert.Nil(t, ar)
+}
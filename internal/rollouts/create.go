@@ -0,0 +1,92 @@
+package rollouts
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/oklog/ulid/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// CreateWithRetry creates the given AnalysisRun. If an AnalysisRun with the
+// same name already exists, the ULID portion of the name is regenerated and
+// the creation is retried, up to the given number of retries. The name prefix
+// and suffix are left untouched. New ULIDs are generated the same way as
+// during the build, i.e. using the generator passed using WithULIDGenerator,
+// if any, so the options used to build the AnalysisRun can be passed. If the
+// name is generated by the API server, see WithGenerateName, the creation is
+// retried as-is.
+//
+// The given AnalysisRun is not modified: the created AnalysisRun is returned
+// as a copy. If the AnalysisRun cannot be created, the last error is returned.
+func CreateWithRetry(
+	ctx context.Context,
+	c client.Client,
+	ar *rolloutsapi.AnalysisRun,
+	retries int,
+	opt ...AnalysisRunOption,
+) (*rolloutsapi.AnalysisRun, error) {
+	opts := NewAnalysisRunOptions(opt...)
+
+	obj := ar.DeepCopy()
+	for attempt := 0; ; attempt++ {
+		err := c.Create(ctx, obj)
+		if err == nil {
+			return obj, nil
+		}
+		if !apierrors.IsAlreadyExists(err) || attempt >= retries {
+			return nil, fmt.Errorf("create AnalysisRun %q in namespace %q: %w", obj.Name, obj.Namespace, err)
+		}
+
+		// A name generated by the API server is generated anew on retry.
+		if obj.Name == "" && obj.GenerateName != "" {
+			continue
+		}
+
+		name, ok := replaceNameULID(obj.Name, opts.newULID())
+		if !ok {
+			return nil, fmt.Errorf(
+				"create AnalysisRun %q in namespace %q: name does not contain a ULID to regenerate: %w",
+				obj.Name, obj.Namespace, err,
+			)
+		}
+		obj.Name = name
+	}
+}
+
+// CreateDryRun issues a dry-run creation of the given AnalysisRun, which runs
+// the request through authorization, admission webhooks and defaulting
+// without persisting the AnalysisRun. It returns the AnalysisRun as the API
+// server would have created it, e.g. to show what would be created or to
+// validate permissions without side effects. Any additional options are
+// passed to the creation.
+//
+// The given AnalysisRun is not modified: the resulting AnalysisRun is
+// returned as a copy.
+func CreateDryRun(
+	ctx context.Context,
+	c client.Client,
+	ar *rolloutsapi.AnalysisRun,
+	opts ...client.CreateOption,
+) (*rolloutsapi.AnalysisRun, error) {
+	obj := ar.DeepCopy()
+	if err := c.Create(ctx, obj, append([]client.CreateOption{client.DryRunAll}, opts...)...); err != nil {
+		return nil, fmt.Errorf("dry-run create AnalysisRun %q in namespace %q: %w", obj.Name, obj.Namespace, err)
+	}
+	return obj, nil
+}
+
+// replaceNameULID replaces the ULID portion of a name generated by
+// generateName, as found by findNameULID, with the given ULID. It returns
+// false if the name does not contain a ULID.
+func replaceNameULID(name string, id ulid.ULID) (string, bool) {
+	offset, _, ok := findNameULID(name)
+	if !ok {
+		return "", false
+	}
+	return name[:offset] + strings.ToLower(id.String()) + name[offset+ulidLength:], true
+}
@@ -0,0 +1,285 @@
+package rollouts
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestCreateWithRetry(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, rolloutsapi.AddToScheme(scheme))
+
+	first := ulid.MustParse("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+	second := ulid.MustParse("01BX5ZZKBKACTAV9WEVGEMMVRZ")
+	sequence := func(ids ...ulid.ULID) WithULIDGenerator {
+		return func() ulid.ULID {
+			id := ids[0]
+			ids = ids[1:]
+			return id
+		}
+	}
+	newRun := func(name string) *rolloutsapi.AnalysisRun {
+		return &rolloutsapi.AnalysisRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      name,
+			},
+		}
+	}
+	alreadyExists := apierrors.NewAlreadyExists(schema.GroupResource{
+		Group:    rolloutsapi.GroupVersion.Group,
+		Resource: "analysisruns",
+	}, "run")
+	name := "prefix." + strings.ToLower(first.String()) + ".suffix"
+
+	tests := []struct {
+		name        string
+		ar          *rolloutsapi.AnalysisRun
+		objects     []client.Object
+		interceptor interceptor.Funcs
+		retries     int
+		options     []AnalysisRunOption
+		assertions  func(*testing.T, client.Client, *rolloutsapi.AnalysisRun, error)
+	}{
+		{
+			name:    "created on first attempt",
+			ar:      newRun(name),
+			retries: 3,
+			assertions: func(t *testing.T, c client.Client, created *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, name, created.Name)
+
+				ar := &rolloutsapi.AnalysisRun{}
+				require.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(created), ar))
+			},
+		},
+		{
+			name: "regenerates ULID once after AlreadyExists",
+			ar:   newRun(name),
+			interceptor: func() interceptor.Funcs {
+				var calls int
+				return interceptor.Funcs{
+					Create: func(
+						ctx context.Context,
+						c client.WithWatch,
+						obj client.Object,
+						opts ...client.CreateOption,
+					) error {
+						calls++
+						if calls == 1 {
+							return alreadyExists
+						}
+						return c.Create(ctx, obj, opts...)
+					},
+				}
+			}(),
+			retries: 3,
+			options: []AnalysisRunOption{sequence(second)},
+			assertions: func(t *testing.T, _ client.Client, created *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "prefix."+strings.ToLower(second.String())+".suffix", created.Name)
+			},
+		},
+		{
+			name:    "regenerates ULID of name without prefix",
+			ar:      newRun(strings.ToLower(first.String()) + ".suffix"),
+			objects: []client.Object{newRun(strings.ToLower(first.String()) + ".suffix")},
+			retries: 1,
+			options: []AnalysisRunOption{sequence(second)},
+			assertions: func(t *testing.T, _ client.Client, created *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, strings.ToLower(second.String())+".suffix", created.Name)
+			},
+		},
+		{
+			name:    "retries exhausted",
+			ar:      newRun(name),
+			objects: []client.Object{newRun(name)},
+			interceptor: interceptor.Funcs{
+				Create: func(context.Context, client.WithWatch, client.Object, ...client.CreateOption) error {
+					return alreadyExists
+				},
+			},
+			retries: 2,
+			options: []AnalysisRunOption{sequence(second, first)},
+			assertions: func(t *testing.T, _ client.Client, created *rolloutsapi.AnalysisRun, err error) {
+				assert.True(t, apierrors.IsAlreadyExists(err))
+				assert.Nil(t, created)
+			},
+		},
+		{
+			name: "does not retry other errors",
+			ar:   newRun(name),
+			interceptor: interceptor.Funcs{
+				Create: func(context.Context, client.WithWatch, client.Object, ...client.CreateOption) error {
+					return errors.New("something went wrong")
+				},
+			},
+			retries: 3,
+			options: []AnalysisRunOption{
+				WithULIDGenerator(func() ulid.ULID {
+					panic("unexpected ULID generation")
+				}),
+			},
+			assertions: func(t *testing.T, _ client.Client, created *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "something went wrong")
+				assert.Nil(t, created)
+			},
+		},
+		{
+			name:    "name without ULID",
+			ar:      newRun("run"),
+			objects: []client.Object{newRun("run")},
+			retries: 3,
+			assertions: func(t *testing.T, _ client.Client, created *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "name does not contain a ULID to regenerate")
+				assert.True(t, apierrors.IsAlreadyExists(err))
+				assert.Nil(t, created)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(tt.objects...).
+				WithInterceptorFuncs(tt.interceptor).
+				Build()
+
+			original := tt.ar.DeepCopy()
+			created, err := CreateWithRetry(context.Background(), c, tt.ar, tt.retries, tt.options...)
+			assert.Equal(t, original, tt.ar)
+			tt.assertions(t, c, created, err)
+		})
+	}
+}
+
+func TestCreateDryRun(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, rolloutsapi.AddToScheme(scheme))
+
+	newRun := func() *rolloutsapi.AnalysisRun {
+		return &rolloutsapi.AnalysisRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "run",
+			},
+		}
+	}
+	// dryRun records the dry-run option of the creation and defaults the
+	// AnalysisRun, as the API server would.
+	dryRun := func(got *[]string) interceptor.Funcs {
+		return interceptor.Funcs{
+			Create: func(
+				ctx context.Context,
+				c client.WithWatch,
+				obj client.Object,
+				opts ...client.CreateOption,
+			) error {
+				createOpts := &client.CreateOptions{}
+				createOpts.ApplyOptions(opts)
+				*got = createOpts.DryRun
+				obj.SetLabels(map[string]string{"defaulted": "true"})
+				return c.Create(ctx, obj, opts...)
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		interceptor func(*[]string) interceptor.Funcs
+		options     []client.CreateOption
+		assertions  func(*testing.T, client.Client, []string, *rolloutsapi.AnalysisRun, error)
+	}{
+		{
+			name:        "returns defaulted AnalysisRun without persisting it",
+			interceptor: dryRun,
+			assertions: func(
+				t *testing.T,
+				c client.Client,
+				dryRun []string,
+				created *rolloutsapi.AnalysisRun,
+				err error,
+			) {
+				require.NoError(t, err)
+				assert.Equal(t, []string{metav1.DryRunAll}, dryRun)
+				assert.Equal(t, "run", created.Name)
+				assert.Equal(t, map[string]string{"defaulted": "true"}, created.Labels)
+
+				err = c.Get(context.Background(), client.ObjectKeyFromObject(created), &rolloutsapi.AnalysisRun{})
+				assert.True(t, apierrors.IsNotFound(err))
+			},
+		},
+		{
+			name:        "passes additional options",
+			interceptor: dryRun,
+			options:     []client.CreateOption{client.FieldOwner("kargo")},
+			assertions: func(
+				t *testing.T,
+				_ client.Client,
+				dryRun []string,
+				created *rolloutsapi.AnalysisRun,
+				err error,
+			) {
+				require.NoError(t, err)
+				assert.Equal(t, []string{metav1.DryRunAll}, dryRun)
+				assert.NotNil(t, created)
+			},
+		},
+		{
+			name: "forbidden",
+			interceptor: func(*[]string) interceptor.Funcs {
+				return interceptor.Funcs{
+					Create: func(context.Context, client.WithWatch, client.Object, ...client.CreateOption) error {
+						return apierrors.NewForbidden(schema.GroupResource{
+							Group:    rolloutsapi.GroupVersion.Group,
+							Resource: "analysisruns",
+						}, "run", errors.New("not allowed"))
+					},
+				}
+			},
+			assertions: func(
+				t *testing.T,
+				_ client.Client,
+				_ []string,
+				created *rolloutsapi.AnalysisRun,
+				err error,
+			) {
+				assert.ErrorContains(t, err, `dry-run create AnalysisRun "run" in namespace "default"`)
+				assert.True(t, apierrors.IsForbidden(err))
+				assert.Nil(t, created)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dryRun []string
+			c := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithInterceptorFuncs(tt.interceptor(&dryRun)).
+				Build()
+
+			ar := newRun()
+			created, err := CreateDryRun(context.Background(), c, ar, tt.options...)
+			assert.Equal(t, newRun(), ar)
+			tt.assertions(t, c, dryRun, created, err)
+		})
+	}
+}
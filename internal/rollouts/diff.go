@@ -0,0 +1,358 @@
+package rollouts
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/oklog/ulid/v2"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// Diff returns a human-readable description of the differences between the
+// given options, with one difference per line, or an empty string if there
+// are none. It compares the name prefix, suffix and explicit name, the
+// labels and annotations which would be set on the AnalysisRun, and the
+// owners. Labels, annotations and owners are compared regardless of the order
+// in which they were added, and the differences are listed in a stable order.
+// The UIDs of the owners are only compared if set in b.
+// A nil AnalysisRunOptions is treated as if no options were set.
+func Diff(a, b *AnalysisRunOptions) string {
+	if a == nil {
+		a = &AnalysisRunOptions{}
+	}
+	if b == nil {
+		b = &AnalysisRunOptions{}
+	}
+
+	var diffs []string
+	if a.NamePrefix != b.NamePrefix {
+		diffs = append(diffs, fmt.Sprintf("name prefix: %q -> %q", a.NamePrefix, b.NamePrefix))
+	}
+	if a.NameSuffix != b.NameSuffix {
+		diffs = append(diffs, fmt.Sprintf("name suffix: %q -> %q", a.NameSuffix, b.NameSuffix))
+	}
+	if a.ExplicitName != b.ExplicitName {
+		diffs = append(diffs, fmt.Sprintf("explicit name: %q -> %q", a.ExplicitName, b.ExplicitName))
+	}
+	if a.GenerateName != b.GenerateName {
+		diffs = append(diffs, fmt.Sprintf("generate name: %t -> %t", a.GenerateName, b.GenerateName))
+	}
+	diffs = append(diffs, diffMaps("label", a.labels(), b.labels())...)
+	diffs = append(diffs, diffMaps("annotation", a.annotations(), b.annotations())...)
+	diffs = append(diffs, diffOwners(a.Owners, b.Owners)...)
+	return strings.Join(diffs, "\n")
+}
+
+// diffMaps describes the entries which were added, removed or changed from
+// map a to map b, sorted by key.
+func diffMaps(kind string, a, b map[string]string) []string {
+	merged := maps.Clone(a)
+	if merged == nil {
+		merged = make(map[string]string, len(b))
+	}
+	maps.Copy(merged, b)
+	keys := slices.Sorted(maps.Keys(merged))
+
+	var diffs []string
+	for _, key := range keys {
+		oldValue, inA := a[key]
+		newValue, inB := b[key]
+		switch {
+		case !inA:
+			diffs = append(diffs, fmt.Sprintf("%s %q: added %q", kind, key, newValue))
+		case !inB:
+			diffs = append(diffs, fmt.Sprintf("%s %q: removed %q", kind, key, oldValue))
+		case oldValue != newValue:
+			diffs = append(diffs, fmt.Sprintf("%s %q: %q -> %q", kind, key, oldValue, newValue))
+		}
+	}
+	return diffs
+}
+
+// diffOwners describes the owners which were added to, removed from or
+// changed between owners a and b. Owners are identified by their APIVersion,
+// Kind and Reference, and listed sorted by Kind, APIVersion, namespace and
+// name. UIDs are only compared if set on the owner in b.
+func diffOwners(a, b []Owner) []string {
+	type ownerKey struct {
+		apiVersion, kind, namespace, name string
+	}
+	keyOf := func(owner Owner) ownerKey {
+		return ownerKey{owner.APIVersion, owner.Kind, owner.Reference.Namespace, owner.Reference.Name}
+	}
+
+	byKey := func(owners []Owner) map[ownerKey]Owner {
+		m := make(map[ownerKey]Owner, len(owners))
+		for _, owner := range owners {
+			m[keyOf(owner)] = owner
+		}
+		return m
+	}
+	ownersA, ownersB := byKey(a), byKey(b)
+
+	all := slices.Collect(maps.Values(ownersA))
+	for key, owner := range ownersB {
+		if _, ok := ownersA[key]; !ok {
+			all = append(all, owner)
+		}
+	}
+	slices.SortFunc(all, func(x, y Owner) int {
+		return cmp.Or(
+			cmp.Compare(x.Kind, y.Kind),
+			cmp.Compare(x.APIVersion, y.APIVersion),
+			cmp.Compare(x.Reference.Namespace, y.Reference.Namespace),
+			cmp.Compare(x.Reference.Name, y.Reference.Name),
+		)
+	})
+
+	var diffs []string
+	for _, owner := range all {
+		oldOwner, inA := ownersA[keyOf(owner)]
+		newOwner, inB := ownersB[keyOf(owner)]
+		switch {
+		case !inA:
+			diffs = append(diffs, fmt.Sprintf("owner %s (%s): added", owner, owner.APIVersion))
+		case !inB:
+			diffs = append(diffs, fmt.Sprintf("owner %s (%s): removed", owner, owner.APIVersion))
+		default:
+			if oldOwner.Controller != newOwner.Controller {
+				diffs = append(diffs, fmt.Sprintf(
+					"owner %s (%s): controller %t -> %t",
+					owner, owner.APIVersion, oldOwner.Controller, newOwner.Controller,
+				))
+			}
+			if oldOwner.BlockDeletion != newOwner.BlockDeletion {
+				diffs = append(diffs, fmt.Sprintf(
+					"owner %s (%s): block deletion %t -> %t",
+					owner, owner.APIVersion, oldOwner.BlockDeletion, newOwner.BlockDeletion,
+				))
+			}
+			if newOwner.UID != "" && oldOwner.UID != newOwner.UID {
+				diffs = append(diffs, fmt.Sprintf(
+					"owner %s (%s): UID %q -> %q",
+					owner, owner.APIVersion, oldOwner.UID, newOwner.UID,
+				))
+			}
+		}
+	}
+	return diffs
+}
+
+// DiffAgainst returns a human-readable description of what would change if
+// the existing AnalysisRun was re-created with the given options, with one
+// difference per line, or an empty string if there are none, e.g. for
+// previewing the effect of a re-verification without consulting the cluster.
+// The same parts are compared as by SemanticEqual, so the ULID portion of the
+// name, timestamps, the status and the UIDs of the owners which are not set
+// in the options are ignored, as well as labels and annotations which are not
+// derived from the options. To compare names regardless of their ULID, the
+// ULID portion of a generated name is shown as zeros. The differences are
+// listed in a stable order. It returns an error if the existing AnalysisRun
+// is nil, the options are invalid, or the options reference metrics which
+// neither exist in the AnalysisRun nor are added as inline metrics.
+func DiffAgainst(existing *rolloutsapi.AnalysisRun, opt ...AnalysisRunOption) (string, error) {
+	if existing == nil {
+		return "", errors.New("missing existing AnalysisRun")
+	}
+	opts := NewAnalysisRunOptions(opt...)
+	if err := opts.Validate(); err != nil {
+		return "", fmt.Errorf("invalid options: %w", err)
+	}
+
+	var diffs []string
+	if opts.Namespace != "" && existing.Namespace != opts.Namespace {
+		diffs = append(diffs, fmt.Sprintf("namespace: %q -> %q", existing.Namespace, opts.Namespace))
+	}
+	nameDiff, err := diffName(existing.Name, opts)
+	if err != nil {
+		return "", fmt.Errorf("generate name: %w", err)
+	}
+	if nameDiff != "" {
+		diffs = append(diffs, nameDiff)
+	}
+
+	labels, annotations := opts.labels(), opts.annotations()
+	diffs = append(diffs, diffMaps("label", restrictKeys(existing.Labels, labels), labels)...)
+	diffs = append(diffs, diffMaps("annotation", restrictKeys(existing.Annotations, annotations), annotations)...)
+	diffs = append(diffs, diffOwners(ownersFromReferences(existing.OwnerReferences), withoutNamespaces(opts.Owners))...)
+
+	specDiffs, err := diffSpec(existing.Spec, opts)
+	if err != nil {
+		return "", err
+	}
+	diffs = append(diffs, specDiffs...)
+	return strings.Join(diffs, "\n"), nil
+}
+
+// diffName describes how the given name differs from the name generated from
+// the options, ignoring the ULID portion of the name, or returns an empty
+// string if it does not.
+func diffName(name string, opts *AnalysisRunOptions) (string, error) {
+	if nameMatches(name, opts) {
+		return "", nil
+	}
+	if opts.GenerateName {
+		return fmt.Sprintf("name: %q does not start with %q", name, opts.generateNamePrefix()), nil
+	}
+
+	expected, err := zeroULIDName(opts)
+	if err != nil {
+		return "", err
+	}
+	if opts.ExplicitName == "" {
+		if normalized, ok := replaceNameULID(name, ulid.ULID{}); ok {
+			name = normalized
+		}
+	}
+	return fmt.Sprintf("name: %q -> %q", name, expected), nil
+}
+
+// restrictKeys returns the entries of map m whose keys are present in the
+// keys map.
+func restrictKeys(m, keys map[string]string) map[string]string {
+	out := make(map[string]string, len(keys))
+	for key := range keys {
+		if value, ok := m[key]; ok {
+			out[key] = value
+		}
+	}
+	return out
+}
+
+// ownersFromReferences converts the given owner references to owners, so
+// they can be compared to the owners from the options using diffOwners. As
+// the owners of an AnalysisRun are always in its namespace, the namespace is
+// left empty.
+func ownersFromReferences(refs []metav1.OwnerReference) []Owner {
+	owners := make([]Owner, 0, len(refs))
+	for _, ref := range refs {
+		owners = append(owners, Owner{
+			APIVersion:    ref.APIVersion,
+			Kind:          ref.Kind,
+			Reference:     types.NamespacedName{Name: ref.Name},
+			BlockDeletion: ptr.Deref(ref.BlockOwnerDeletion, false),
+			Controller:    ptr.Deref(ref.Controller, false),
+			UID:           ref.UID,
+		})
+	}
+	return owners
+}
+
+// withoutNamespaces returns a copy of the given owners with the namespaces of
+// their references cleared.
+func withoutNamespaces(owners []Owner) []Owner {
+	out := slices.Clone(owners)
+	for i := range out {
+		out[i].Reference.Namespace = ""
+	}
+	return out
+}
+
+// diffSpec describes how the given spec differs from the spec which would
+// reflect the argument values, inline metrics and metric settings of the
+// options, see applyMetricSettings.
+func diffSpec(spec rolloutsapi.AnalysisRunSpec, opts *AnalysisRunOptions) ([]string, error) {
+	_, providedArgs, err := resolveArgsFreightReferences(nil, opts.argsWithBaseline(spec.Args), opts.ArgsFreight)
+	if err != nil {
+		return nil, fmt.Errorf("resolve arguments: %w", err)
+	}
+	existingArgs := make(map[string]string, len(spec.Args))
+	for _, arg := range spec.Args {
+		if _, ok := providedArgs[arg.Name]; ok && arg.Value != nil {
+			existingArgs[arg.Name] = *arg.Value
+		}
+	}
+	diffs := diffMaps("argument", existingArgs, providedArgs)
+
+	desired := spec.DeepCopy()
+	setInlineMetrics(desired, opts.InlineMetrics)
+	if err = applyMetricSettings(desired, opts); err != nil {
+		return nil, err
+	}
+	findMetric := func(metrics []rolloutsapi.Metric, name string) (rolloutsapi.Metric, bool) {
+		idx := slices.IndexFunc(metrics, func(m rolloutsapi.Metric) bool {
+			return m.Name == name
+		})
+		if idx < 0 {
+			return rolloutsapi.Metric{}, false
+		}
+		return metrics[idx], true
+	}
+
+	inline := make(map[string]bool, len(opts.InlineMetrics))
+	for _, m := range opts.InlineMetrics {
+		inline[m.Name] = true
+		existing, ok := findMetric(spec.Metrics, m.Name)
+		want, _ := findMetric(desired.Metrics, m.Name)
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("metric %q: added", m.Name))
+		case !equality.Semantic.DeepEqual(existing, want):
+			diffs = append(diffs, fmt.Sprintf("metric %q: changed", m.Name))
+		}
+	}
+
+	for _, existing := range spec.Metrics {
+		if inline[existing.Name] {
+			continue
+		}
+		want, _ := findMetric(desired.Metrics, existing.Name)
+		if limit := want.FailureLimit; !equality.Semantic.DeepEqual(existing.FailureLimit, limit) {
+			diffs = append(diffs, fmt.Sprintf(
+				"metric %q: failure limit %s -> %s", existing.Name, formatLimit(existing.FailureLimit), formatLimit(limit),
+			))
+		}
+		if limit := want.InconclusiveLimit; !equality.Semantic.DeepEqual(existing.InconclusiveLimit, limit) {
+			diffs = append(diffs, fmt.Sprintf(
+				"metric %q: inconclusive limit %s -> %s",
+				existing.Name, formatLimit(existing.InconclusiveLimit), formatLimit(limit),
+			))
+		}
+		// Any other change stems from the Job settings or provider timeout.
+		limited := existing.DeepCopy()
+		limited.FailureLimit, limited.InconclusiveLimit = want.FailureLimit, want.InconclusiveLimit
+		if !equality.Semantic.DeepEqual(*limited, want) {
+			diffs = append(diffs, fmt.Sprintf("metric %q: changed", existing.Name))
+		}
+	}
+
+	for _, dryRun := range desired.DryRun {
+		if !slices.Contains(spec.DryRun, dryRun) {
+			diffs = append(diffs, fmt.Sprintf("dry-run metric %q: added", dryRun.MetricName))
+		}
+	}
+	diffs = append(diffs, diffMaps(
+		"measurement retention",
+		retentionLimits(spec.MeasurementRetention),
+		retentionLimits(desired.MeasurementRetention),
+	)...)
+	return diffs, nil
+}
+
+// formatLimit formats the given metric limit, which may be nil if unset.
+func formatLimit(limit *intstr.IntOrString) string {
+	if limit == nil {
+		return "unset"
+	}
+	return limit.String()
+}
+
+// retentionLimits returns the measurement retention limits by metric name.
+func retentionLimits(retention []rolloutsapi.MeasurementRetention) map[string]string {
+	limits := make(map[string]string, len(retention))
+	for _, r := range retention {
+		limits[r.MetricName] = strconv.Itoa(int(r.Limit))
+	}
+	return limits
+}
@@ -0,0 +1,379 @@
+package rollouts
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestDiff(t *testing.T) {
+	stage := Owner{
+		APIVersion: "kargo.akuity.io/v1alpha1",
+		Kind:       "Stage",
+		Reference:  types.NamespacedName{Name: "stage", Namespace: "default"},
+		Controller: true,
+	}
+	freight := Owner{
+		APIVersion: "kargo.akuity.io/v1alpha1",
+		Kind:       "Freight",
+		Reference:  types.NamespacedName{Name: "freight", Namespace: "default"},
+	}
+
+	tests := []struct {
+		name       string
+		a          *AnalysisRunOptions
+		b          *AnalysisRunOptions
+		assertions func(*testing.T, string)
+	}{
+		{
+			name: "no differences",
+			a: NewAnalysisRunOptions(
+				WithNamePrefix("prefix"),
+				WithExtraLabels{"a": "1", "b": "2"},
+				WithOwner(stage),
+				WithOwner(freight),
+			),
+			b: NewAnalysisRunOptions(
+				WithOwner(freight),
+				WithOwner(stage),
+				WithExtraLabels{"b": "2"},
+				WithExtraLabels{"a": "1"},
+				WithNamePrefix("prefix"),
+			),
+			assertions: func(t *testing.T, diff string) {
+				assert.Empty(t, diff)
+			},
+		},
+		{
+			name: "both nil",
+			assertions: func(t *testing.T, diff string) {
+				assert.Empty(t, diff)
+			},
+		},
+		{
+			name: "name prefix and suffix",
+			a:    NewAnalysisRunOptions(WithNamePrefix("stage-a"), WithNameSuffix("abc")),
+			b:    NewAnalysisRunOptions(WithNamePrefix("stage-b")),
+			assertions: func(t *testing.T, diff string) {
+				assert.Equal(
+					t,
+					"name prefix: \"stage-a\" -> \"stage-b\"\n"+
+						"name suffix: \"abc\" -> \"\"",
+					diff,
+				)
+			},
+		},
+		{
+			name: "label additions, removals and changes",
+			a: NewAnalysisRunOptions(
+				WithExtraLabels{"removed": "1", "changed": "old", "same": "value"},
+			),
+			b: NewAnalysisRunOptions(
+				WithExtraLabels{"added": "2", "changed": "new", "same": "value"},
+			),
+			assertions: func(t *testing.T, diff string) {
+				assert.Equal(
+					t,
+					"label \"added\": added \"2\"\n"+
+						"label \"changed\": \"old\" -> \"new\"\n"+
+						"label \"removed\": removed \"1\"",
+					diff,
+				)
+			},
+		},
+		{
+			name: "canonical labels and annotations",
+			a:    NewAnalysisRunOptions(WithFreight("abc", "warehouse")),
+			b:    NewAnalysisRunOptions(WithFreight("def", "warehouse")),
+			assertions: func(t *testing.T, diff string) {
+				assert.Equal(
+					t,
+					"label \"kargo.akuity.io/freight\": \"abc\" -> \"def\"\n"+
+						"annotation \"kargo.akuity.io/freight\": \"warehouse/abc\" -> \"warehouse/def\"",
+					diff,
+				)
+			},
+		},
+		{
+			name: "owner set differences",
+			a:    NewAnalysisRunOptions(WithOwner(stage)),
+			b:    NewAnalysisRunOptions(WithOwner(freight)),
+			assertions: func(t *testing.T, diff string) {
+				assert.Equal(
+					t,
+					"owner Freight \"freight\" in namespace \"default\" (kargo.akuity.io/v1alpha1): added\n"+
+						"owner Stage \"stage\" in namespace \"default\" (kargo.akuity.io/v1alpha1): removed",
+					diff,
+				)
+			},
+		},
+		{
+			name: "changed owner",
+			a:    NewAnalysisRunOptions(WithOwner(stage)),
+			b: NewAnalysisRunOptions(WithOwner(Owner{
+				APIVersion:    stage.APIVersion,
+				Kind:          stage.Kind,
+				Reference:     stage.Reference,
+				BlockDeletion: true,
+			})),
+			assertions: func(t *testing.T, diff string) {
+				assert.Equal(
+					t,
+					"owner Stage \"stage\" in namespace \"default\" (kargo.akuity.io/v1alpha1): controller true -> false\n"+
+						"owner Stage \"stage\" in namespace \"default\" (kargo.akuity.io/v1alpha1): block deletion false -> true",
+					diff,
+				)
+			},
+		},
+		{
+			name: "nil options",
+			a:    nil,
+			b:    NewAnalysisRunOptions(WithExtraLabels{"key": "value"}),
+			assertions: func(t *testing.T, diff string) {
+				assert.Equal(t, "label \"key\": added \"value\"", diff)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := Diff(tt.a, tt.b)
+			tt.assertions(t, diff)
+			assert.Equal(t, diff, Diff(tt.a, tt.b), "diff must be stable")
+		})
+	}
+}
+
+func TestDiffAgainst(t *testing.T) {
+	templates := []*rolloutsapi.AnalysisTemplate{
+		{
+			Spec: rolloutsapi.AnalysisTemplateSpec{
+				Metrics: []rolloutsapi.Metric{{Name: "metric"}, {Name: "other-metric"}},
+				Args:    []rolloutsapi.Argument{{Name: "service"}, {Name: "region"}},
+			},
+		},
+	}
+	options := []AnalysisRunOption{
+		WithNamePrefix("stage"),
+		WithNameSuffix("abc1234"),
+		WithStage("project", "stage"),
+		WithOwner(Owner{
+			APIVersion:    "kargo.akuity.io/v1alpha1",
+			Kind:          "Stage",
+			Reference:     types.NamespacedName{Name: "stage", Namespace: "default"},
+			BlockDeletion: true,
+			Controller:    true,
+		}),
+		WithArgs{"service": "api", "region": "eu"},
+		WithDryRunMetrics{"other-metric"},
+	}
+	existing, err := Build("default", templates, nil, options...)
+	require.NoError(t, err)
+	existing.CreationTimestamp = metav1.NewTime(time.Now())
+	existing.OwnerReferences[0].UID = "uid"
+	existing.Labels["unrelated"] = "value"
+	existing.Status.Phase = rolloutsapi.AnalysisPhaseRunning
+
+	tests := []struct {
+		name       string
+		existing   *rolloutsapi.AnalysisRun
+		options    []AnalysisRunOption
+		assertions func(*testing.T, string, error)
+	}{
+		{
+			name:     "no differences",
+			existing: existing,
+			options:  options,
+			assertions: func(t *testing.T, diff string, err error) {
+				require.NoError(t, err)
+				assert.Empty(t, diff)
+			},
+		},
+		{
+			name:     "labels",
+			existing: existing,
+			options: append(
+				slices.Clone(options),
+				WithStage("project", "other-stage"),
+				WithExtraLabels{"team": "payments"},
+			),
+			assertions: func(t *testing.T, diff string, err error) {
+				require.NoError(t, err)
+				assert.Equal(
+					t,
+					`label "`+StageLabelKey+`": "stage" -> "other-stage"`+"\n"+
+						`label "team": added "payments"`,
+					diff,
+				)
+			},
+		},
+		{
+			name:     "args",
+			existing: existing,
+			options:  append(slices.Clone(options), WithArgs{"region": "us", "version": "v1"}),
+			assertions: func(t *testing.T, diff string, err error) {
+				require.NoError(t, err)
+				assert.Equal(
+					t,
+					`argument "region": "eu" -> "us"`+"\n"+
+						`argument "version": added "v1"`,
+					diff,
+				)
+			},
+		},
+		{
+			name:     "name, owners and metrics",
+			existing: existing,
+			options: append(
+				slices.Clone(options),
+				WithNameSuffix("def5678"),
+				WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Kind:       "Freight",
+					Reference:  types.NamespacedName{Name: "freight", Namespace: "default"},
+				}),
+				WithInlineMetrics{{
+					Name: "inline-metric",
+					Provider: rolloutsapi.MetricProvider{
+						Web: &rolloutsapi.WebMetric{URL: "https://example.com"},
+					},
+				}},
+				WithDryRunMetrics{"metric"},
+				WithFailureLimit("metric", 2),
+				WithMeasurementRetention("metric", 5),
+			),
+			assertions: func(t *testing.T, diff string, err error) {
+				require.NoError(t, err)
+				assert.Equal(
+					t,
+					`name: "stage.00000000000000000000000000.abc1234" -> "stage.00000000000000000000000000.def5678"`+"\n"+
+						`owner Freight "freight" (kargo.akuity.io/v1alpha1): added`+"\n"+
+						`metric "inline-metric": added`+"\n"+
+						`metric "metric": failure limit unset -> 2`+"\n"+
+						`dry-run metric "metric": added`+"\n"+
+						`measurement retention "metric": added "5"`,
+					diff,
+				)
+			},
+		},
+		{
+			name:     "owner UID",
+			existing: existing,
+			options: append(slices.Clone(options), WithOwner(Owner{
+				APIVersion: "kargo.akuity.io/v1alpha1",
+				Kind:       "Stage",
+				Reference:  types.NamespacedName{Name: "stage", Namespace: "default"},
+				UID:        "other-uid",
+			})),
+			assertions: func(t *testing.T, diff string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, `owner Stage "stage" (kargo.akuity.io/v1alpha1): UID "uid" -> "other-uid"`, diff)
+			},
+		},
+		{
+			name:     "unknown metric",
+			existing: existing,
+			options:  append(slices.Clone(options), WithFailureLimit("missing", 2)),
+			assertions: func(t *testing.T, _ string, err error) {
+				assert.ErrorContains(t, err, `failure limit metric "missing" does not exist`)
+			},
+		},
+		{
+			name:     "invalid options",
+			existing: existing,
+			options:  []AnalysisRunOption{WithMaxNameLength(1)},
+			assertions: func(t *testing.T, _ string, err error) {
+				assert.ErrorContains(t, err, "invalid options")
+			},
+		},
+		{
+			name:    "nil AnalysisRun",
+			options: options,
+			assertions: func(t *testing.T, _ string, err error) {
+				assert.ErrorContains(t, err, "missing existing AnalysisRun")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := DiffAgainst(tt.existing, tt.options...)
+			tt.assertions(t, diff, err)
+		})
+	}
+}
+
+func TestDiffAgainst_metricSettings(t *testing.T) {
+	templates := []*rolloutsapi.AnalysisTemplate{{
+		Spec: rolloutsapi.AnalysisTemplateSpec{
+			Metrics: []rolloutsapi.Metric{{
+				Name: "job",
+				Provider: rolloutsapi.MetricProvider{
+					Job: &rolloutsapi.JobMetric{
+						Spec: batchv1.JobSpec{
+							Template: corev1.PodTemplateSpec{
+								Spec: corev1.PodSpec{
+									Containers: []corev1.Container{{Name: "check", Image: "bitnami/kubectl"}},
+								},
+							},
+						},
+					},
+				},
+			}},
+		},
+	}}
+	options := []AnalysisRunOption{
+		WithInlineMetrics{{
+			Name: "inline",
+			Provider: rolloutsapi.MetricProvider{
+				Prometheus: &rolloutsapi.PrometheusMetric{Query: "up"},
+			},
+		}},
+		WithProviderTimeout(5 * time.Second),
+		WithJobPriorityClass("verification"),
+		WithServiceAccount("verifier"),
+		WithJobNodeSelector{"pool": "verification"},
+		WithJobTolerations{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+	}
+	existing, err := Build("default", templates, nil, options...)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		options    []AnalysisRunOption
+		assertions func(*testing.T, string, error)
+	}{
+		{
+			name:    "no differences",
+			options: options,
+			assertions: func(t *testing.T, diff string, err error) {
+				require.NoError(t, err)
+				assert.Empty(t, diff)
+			},
+		},
+		{
+			name:    "provider timeout and Job settings",
+			options: append(slices.Clone(options), WithProviderTimeout(10*time.Second), WithServiceAccount("other")),
+			assertions: func(t *testing.T, diff string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, `metric "inline": changed`+"\n"+`metric "job": changed`, diff)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := DiffAgainst(existing, tt.options...)
+			tt.assertions(t, diff, err)
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package rollouts
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/oklog/ulid/v2"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// SemanticEqual reports whether the existing AnalysisRun already matches the
+// AnalysisRun which would be built with the given options, e.g. so that a
+// reconciliation can skip re-creating it. The ULID portion of the name,
+// timestamps and the status of the existing AnalysisRun are ignored.
+//
+// As the AnalysisRun is also built from the verification configuration and
+// templates which are not part of the options, only what is derived from the
+// options is compared:
+//
+//   - The name, apart from its ULID, and the namespace if set explicitly.
+//   - The labels and annotations, which must be present with the same value.
+//     Labels and annotations not derived from the options are ignored.
+//   - The owners, which must match exactly, apart from their UIDs unless set
+//     in the options.
+//   - The argument values, inline metrics, dry-run metrics and measurement
+//     retention limits of the spec. Arguments from ConfigMaps are ignored, as
+//     they cannot be resolved without a client.
+//
+// It returns false if the existing AnalysisRun is nil or the options are
+// invalid.
+func SemanticEqual(existing *rolloutsapi.AnalysisRun, opt ...AnalysisRunOption) bool {
+	if existing == nil {
+		return false
+	}
+	opts := NewAnalysisRunOptions(opt...)
+	if err := opts.Validate(); err != nil {
+		return false
+	}
+
+	if opts.Namespace != "" && existing.Namespace != opts.Namespace {
+		return false
+	}
+	if !nameMatches(existing.Name, opts) {
+		return false
+	}
+	if !containsAll(existing.Labels, opts.labels()) || !containsAll(existing.Annotations, opts.annotations()) {
+		return false
+	}
+	if !ownerReferencesMatch(existing.OwnerReferences, ownerReferences(opts.Owners)) {
+		return false
+	}
+	return specMatches(existing.Spec, opts)
+}
+
+// nameMatches reports whether the given name matches the name generated from
+// the options, ignoring the ULID portion of the name.
+func nameMatches(name string, opts *AnalysisRunOptions) bool {
+	expected, err := zeroULIDName(opts)
+	if err != nil {
+		return false
+	}
+	if opts.ExplicitName != "" {
+		return name == expected
+	}
+	if opts.GenerateName {
+		return strings.HasPrefix(name, opts.generateNamePrefix())
+	}
+	normalized, ok := replaceNameULID(name, ulid.ULID{})
+	return ok && normalized == expected
+}
+
+// zeroULIDName returns the name generated from the options with the zero
+// ULID, without reporting truncations.
+func zeroULIDName(opts *AnalysisRunOptions) (string, error) {
+	o := opts.DeepCopy()
+	o.ULIDGenerator = func() ulid.ULID { return ulid.ULID{} }
+	o.TruncationReporter = nil
+	return generateName(o)
+}
+
+// containsAll reports whether every entry of the desired map is present in
+// the actual map with the same value.
+func containsAll(actual, desired map[string]string) bool {
+	for key, value := range desired {
+		if v, ok := actual[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// setInlineMetrics replaces the metrics of the spec with the same names as the
+// given inline metrics with copies of them, and appends the inline metrics
+// which are not in the spec.
+func setInlineMetrics(spec *rolloutsapi.AnalysisRunSpec, metrics []rolloutsapi.Metric) {
+	for _, metric := range metrics {
+		idx := slices.IndexFunc(spec.Metrics, func(m rolloutsapi.Metric) bool {
+			return m.Name == metric.Name
+		})
+		if idx < 0 {
+			spec.Metrics = append(spec.Metrics, *metric.DeepCopy())
+			continue
+		}
+		spec.Metrics[idx] = *metric.DeepCopy()
+	}
+}
+
+// ownerReferencesMatch reports whether the actual owner references match the
+// desired owner references, regardless of their order. UIDs are only compared
+// if set on the desired owner reference.
+func ownerReferencesMatch(actual, desired []metav1.OwnerReference) bool {
+	if len(actual) != len(desired) {
+		return false
+	}
+	for _, want := range desired {
+		if !slices.ContainsFunc(actual, func(ref metav1.OwnerReference) bool {
+			return ref.APIVersion == want.APIVersion &&
+				ref.Kind == want.Kind &&
+				ref.Name == want.Name &&
+				(want.UID == "" || ref.UID == want.UID) &&
+				ptr.Deref(ref.Controller, false) == ptr.Deref(want.Controller, false) &&
+				ptr.Deref(ref.BlockOwnerDeletion, false) == ptr.Deref(want.BlockOwnerDeletion, false)
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// specMatches reports whether the given spec reflects the argument values,
+// inline metrics and metric settings of the options, see
+// applyMetricSettings.
+func specMatches(spec rolloutsapi.AnalysisRunSpec, opts *AnalysisRunOptions) bool {
+	_, providedArgs, err := resolveArgsFreightReferences(nil, opts.argsWithBaseline(spec.Args), opts.ArgsFreight)
+	if err != nil {
+		return false
+	}
+	for name, value := range providedArgs {
+		if !slices.ContainsFunc(spec.Args, func(arg rolloutsapi.Argument) bool {
+			return arg.Name == name && arg.Value != nil && *arg.Value == value
+		}) {
+			return false
+		}
+	}
+
+	// Replacing the inline metrics and applying the metric settings to a spec
+	// which already reflects them leaves it unchanged.
+	applied := spec.DeepCopy()
+	setInlineMetrics(applied, opts.InlineMetrics)
+	if err = applyMetricSettings(applied, opts); err != nil {
+		return false
+	}
+	return equality.Semantic.DeepEqual(*applied, spec)
+}
@@ -0,0 +1,164 @@
+package rollouts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestSemanticEqual(t *testing.T) {
+	templates := []*rolloutsapi.AnalysisTemplate{
+		{
+			Spec: rolloutsapi.AnalysisTemplateSpec{
+				Metrics: []rolloutsapi.Metric{{Name: "metric"}, {Name: "other-metric"}},
+				Args:    []rolloutsapi.Argument{{Name: "service"}},
+			},
+		},
+	}
+	options := []AnalysisRunOption{
+		WithNamePrefix("stage"),
+		WithNameSuffix("abc1234"),
+		WithStage("project", "stage"),
+		WithExtraAnnotations{"annotation": "value"},
+		WithOwner(Owner{
+			APIVersion:    "kargo.akuity.io/v1alpha1",
+			Kind:          "Stage",
+			Reference:     types.NamespacedName{Name: "stage", Namespace: "default"},
+			BlockDeletion: true,
+			Controller:    true,
+		}),
+		WithArgs{"service": "api"},
+		WithDryRunMetrics{"other-metric"},
+	}
+	existing, err := Build("default", templates, nil, options...)
+	require.NoError(t, err)
+	existing.CreationTimestamp = metav1.NewTime(time.Now())
+	existing.OwnerReferences[0].UID = "uid"
+	existing.Labels["unrelated"] = "value"
+	existing.Status.Phase = rolloutsapi.AnalysisPhaseRunning
+
+	tests := []struct {
+		name     string
+		existing *rolloutsapi.AnalysisRun
+		options  []AnalysisRunOption
+		expected bool
+	}{
+		{
+			name:     "only ULID differs",
+			existing: existing,
+			options:  options,
+			expected: true,
+		},
+		{
+			name:     "nil AnalysisRun",
+			options:  options,
+			expected: false,
+		},
+		{
+			name:     "label differs",
+			existing: existing,
+			options:  append(options, WithStage("project", "other-stage")),
+			expected: false,
+		},
+		{
+			name:     "annotation differs",
+			existing: existing,
+			options:  append(options, WithExtraAnnotations{"annotation": "other"}),
+			expected: false,
+		},
+		{
+			name:     "name suffix differs",
+			existing: existing,
+			options:  append(options, WithNameSuffix("def5678")),
+			expected: false,
+		},
+		{
+			name:     "namespace differs",
+			existing: existing,
+			options:  append(options, WithNamespace("other")),
+			expected: false,
+		},
+		{
+			name:     "owner differs",
+			existing: existing,
+			options: append(options, WithOwner(Owner{
+				APIVersion: "kargo.akuity.io/v1alpha1",
+				Kind:       "Freight",
+				Reference:  types.NamespacedName{Name: "freight", Namespace: "default"},
+			})),
+			expected: false,
+		},
+		{
+			name:     "argument differs",
+			existing: existing,
+			options:  append(options, WithArgs{"service": "web"}),
+			expected: false,
+		},
+		{
+			name:     "dry-run metric differs",
+			existing: existing,
+			options:  append(options, WithDryRunMetrics{"metric"}),
+			expected: false,
+		},
+		{
+			name:     "invalid options",
+			existing: existing,
+			options:  append(options, WithMaxNameLength(1)),
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, SemanticEqual(tt.existing, tt.options...))
+		})
+	}
+}
+
+func TestSemanticEqual_metricSettings(t *testing.T) {
+	templates := []*rolloutsapi.AnalysisTemplate{{
+		Spec: rolloutsapi.AnalysisTemplateSpec{
+			Metrics: []rolloutsapi.Metric{{
+				Name: "job",
+				Provider: rolloutsapi.MetricProvider{
+					Job: &rolloutsapi.JobMetric{
+						Spec: batchv1.JobSpec{
+							Template: corev1.PodTemplateSpec{
+								Spec: corev1.PodSpec{
+									Containers: []corev1.Container{{Name: "check", Image: "bitnami/kubectl"}},
+								},
+							},
+						},
+					},
+				},
+			}},
+		},
+	}}
+	options := []AnalysisRunOption{
+		WithInlineMetrics{{
+			Name: "inline",
+			Provider: rolloutsapi.MetricProvider{
+				Prometheus: &rolloutsapi.PrometheusMetric{Query: "up"},
+			},
+		}},
+		WithProviderTimeout(5 * time.Second),
+		WithJobPriorityClass("verification"),
+		WithServiceAccount("verifier"),
+		WithJobNodeSelector{"pool": "verification"},
+		WithJobTolerations{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+		WithFailureLimit("inline", 2),
+	}
+	ar, err := Build("default", templates, nil, options...)
+	require.NoError(t, err)
+
+	assert.True(t, SemanticEqual(ar, options...))
+	assert.False(t, SemanticEqual(ar, append(options, WithProviderTimeout(10*time.Second))...))
+}
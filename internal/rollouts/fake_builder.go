@@ -0,0 +1,39 @@
+package rollouts
+
+import (
+	"context"
+
+	"github.com/oklog/ulid/v2"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// FakeBuilder is a mock implementation of the Builder interface that can be
+// used to facilitate unit testing.
+type FakeBuilder struct {
+	BuildFn func(
+		ctx context.Context,
+		namespace string,
+		cfg *kargoapi.Verification,
+		opt ...AnalysisRunOption,
+	) (*rolloutsapi.AnalysisRun, error)
+}
+
+// Build implements the Builder interface. Without function injection, it
+// builds the AnalysisRun from the options only, without resolving any
+// templates, and with the zero ULID unless a generator is passed using
+// WithULIDGenerator, so that the result is deterministic.
+func (b *FakeBuilder) Build(
+	ctx context.Context,
+	namespace string,
+	cfg *kargoapi.Verification,
+	opt ...AnalysisRunOption,
+) (*rolloutsapi.AnalysisRun, error) {
+	if b.BuildFn == nil {
+		var zero ulid.ULID
+		opt = append([]AnalysisRunOption{WithULIDGenerator(func() ulid.ULID { return zero })}, opt...)
+		return Build(namespace, nil, nil, opt...)
+	}
+	return b.BuildFn(ctx, namespace, cfg, opt...)
+}
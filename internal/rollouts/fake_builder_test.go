@@ -0,0 +1,96 @@
+package rollouts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestFakeBuilder_Build(t *testing.T) {
+	t.Run("without function injection", func(t *testing.T) {
+		builder := &FakeBuilder{}
+		ar, err := builder.Build(
+			context.Background(),
+			"project",
+			&kargoapi.Verification{},
+			WithNamePrefix("stage"),
+			WithStage("project", "stage"),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, "stage.00000000000000000000000000", ar.Name)
+		assert.Equal(t, "project", ar.Namespace)
+		assert.Equal(t, "stage", ar.Labels[kargoapi.StageLabelKey])
+	})
+
+	t.Run("with function injection", func(t *testing.T) {
+		ctx := context.Background()
+		cfg := &kargoapi.Verification{}
+
+		builder := &FakeBuilder{
+			BuildFn: func(
+				givenCtx context.Context,
+				givenNamespace string,
+				givenCfg *kargoapi.Verification,
+				givenOpt ...AnalysisRunOption,
+			) (*rolloutsapi.AnalysisRun, error) {
+				assert.Equal(t, ctx, givenCtx)
+				assert.Equal(t, "project", givenNamespace)
+				assert.Same(t, cfg, givenCfg)
+				assert.Equal(t, "stage", NewAnalysisRunOptions(givenOpt...).NamePrefix)
+				return nil, errors.New("something went wrong")
+			},
+		}
+		ar, err := builder.Build(ctx, "project", cfg, WithNamePrefix("stage"))
+		assert.ErrorContains(t, err, "something went wrong")
+		assert.Nil(t, ar)
+	})
+}
+
+// startVerification is an example of a consumer of the Builder interface.
+func startVerification(ctx context.Context, builder Builder, project, stage string) (string, error) {
+	ar, err := builder.Build(
+		ctx,
+		project,
+		&kargoapi.Verification{},
+		WithNamePrefix(stage),
+		WithStage(project, stage),
+	)
+	if err != nil {
+		return "", err
+	}
+	return ar.Name, nil
+}
+
+func ExampleFakeBuilder() {
+	var opts *AnalysisRunOptions
+	builder := &FakeBuilder{
+		BuildFn: func(
+			_ context.Context,
+			namespace string,
+			_ *kargoapi.Verification,
+			opt ...AnalysisRunOption,
+		) (*rolloutsapi.AnalysisRun, error) {
+			// Record the options the consumer called Build with.
+			opts = NewAnalysisRunOptions(opt...)
+			return (&FakeBuilder{}).Build(context.Background(), namespace, nil, opt...)
+		},
+	}
+
+	name, err := startVerification(context.Background(), builder, "project", "stage")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(name)
+	fmt.Println(opts.Project, opts.Stage)
+	// Output:
+	// stage.00000000000000000000000000
+	// project stage
+}
@@ -0,0 +1,139 @@
+package rollouts
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+)
+
+// ErrUnresolvedFreightReference is returned when an argument value references
+// a field of the Freight which cannot be resolved.
+var ErrUnresolvedFreightReference = errors.New("unresolved freight reference")
+
+var (
+	// freightReferenceRegex matches references to fields of the Freight in
+	// argument values, e.g. ${freight.images["repo"].tag}.
+	freightReferenceRegex = regexp.MustCompile(`\$\{freight\.[^}]*\}`)
+	// freightArtifactRegex matches the expression of a reference to a field of
+	// an artifact of the Freight, capturing the kind of artifact, the key of
+	// the artifact and the field.
+	freightArtifactRegex = regexp.MustCompile(`^\$\{freight\.(images|charts|commits)\["([^"]+)"\]\.(\w+)\}$`)
+)
+
+// resolveArgsFreightReferences resolves the references to fields of the given
+// Freight in the values of the given arguments and provided arguments. If the
+// Freight is nil, the arguments are returned as-is. It returns an error
+// listing every reference which cannot be resolved.
+func resolveArgsFreightReferences(
+	args []kargoapi.AnalysisRunArgument,
+	providedArgs map[string]string,
+	freight *kargoapi.Freight,
+) ([]kargoapi.AnalysisRunArgument, map[string]string, error) {
+	if freight == nil {
+		return args, providedArgs, nil
+	}
+
+	var errs []error
+	resolvedArgs := make([]kargoapi.AnalysisRunArgument, len(args))
+	for i, arg := range args {
+		value, err := resolveFreightReferences(arg.Value, freight)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("argument %q: %w", arg.Name, err))
+		}
+		resolvedArgs[i] = kargoapi.AnalysisRunArgument{Name: arg.Name, Value: value}
+	}
+
+	resolvedProvidedArgs := make(map[string]string, len(providedArgs))
+	for _, name := range slices.Sorted(maps.Keys(providedArgs)) {
+		resolved, err := resolveFreightReferences(providedArgs[name], freight)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("argument %q: %w", name, err))
+		}
+		resolvedProvidedArgs[name] = resolved
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+	return resolvedArgs, resolvedProvidedArgs, nil
+}
+
+// resolveFreightReferences replaces every reference to a field of the given
+// Freight in the value with the value of the field. The following references
+// are supported, keyed by the repository URL of the artifact:
+//
+//   - ${freight.images["<repoURL>"].tag} and .digest
+//   - ${freight.charts["<repoURL>"].version} for charts from OCI
+//     repositories, and ${freight.charts["<repoURL>/<name>"].version} for
+//     charts from Helm chart repositories
+//   - ${freight.commits["<repoURL>"].id} and .tag
+//
+// It returns an error wrapping ErrUnresolvedFreightReference for every
+// reference which cannot be resolved.
+func resolveFreightReferences(value string, freight *kargoapi.Freight) (string, error) {
+	var errs []error
+	resolved := freightReferenceRegex.ReplaceAllStringFunc(value, func(token string) string {
+		field, ok := freightField(token, freight)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%w %q", ErrUnresolvedFreightReference, token))
+			return token
+		}
+		return field
+	})
+	return resolved, errors.Join(errs...)
+}
+
+// freightField returns the value of the field of the Freight the reference
+// token refers to. It returns false if the token is not a valid reference,
+// the Freight has no matching artifact, or the field is not set.
+func freightField(token string, freight *kargoapi.Freight) (string, bool) {
+	match := freightArtifactRegex.FindStringSubmatch(token)
+	if match == nil {
+		return "", false
+	}
+	kind, key, field := match[1], match[2], match[3]
+
+	switch kind {
+	case "images":
+		for _, image := range freight.Images {
+			if image.RepoURL == key {
+				return nonEmpty(map[string]string{
+					"tag":    image.Tag,
+					"digest": image.Digest,
+				}[field])
+			}
+		}
+	case "charts":
+		for _, chart := range freight.Charts {
+			chartKey := chart.RepoURL
+			if chart.Name != "" {
+				chartKey = strings.TrimSuffix(chart.RepoURL, "/") + "/" + chart.Name
+			}
+			if chartKey == key {
+				return nonEmpty(map[string]string{
+					"version": chart.Version,
+				}[field])
+			}
+		}
+	case "commits":
+		for _, commit := range freight.Commits {
+			if commit.RepoURL == key {
+				return nonEmpty(map[string]string{
+					"id":  commit.ID,
+					"tag": commit.Tag,
+				}[field])
+			}
+		}
+	}
+	return "", false
+}
+
+// nonEmpty returns the value, and whether it is not empty.
+func nonEmpty(value string) (string, bool) {
+	return value, value != ""
+}
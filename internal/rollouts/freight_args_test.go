@@ -0,0 +1,158 @@
+package rollouts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+)
+
+func Test_resolveFreightReferences(t *testing.T) {
+	freight := &kargoapi.Freight{
+		Images: []kargoapi.Image{
+			{RepoURL: "ghcr.io/example/app", Tag: "v1.2.3", Digest: "sha256:abc"},
+			{RepoURL: "ghcr.io/example/sidecar", Tag: "v0.1.0"},
+		},
+		Charts: []kargoapi.Chart{
+			{RepoURL: "oci://ghcr.io/example/charts/app", Version: "1.0.0"},
+			{RepoURL: "https://charts.example.com/", Name: "db", Version: "2.0.0"},
+		},
+		Commits: []kargoapi.GitCommit{
+			{RepoURL: "https://github.com/example/config", ID: "abc123", Tag: "v1"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		value      string
+		assertions func(*testing.T, string, error)
+	}{
+		{
+			name:  "no references",
+			value: "plain value with {{args.other}}",
+			assertions: func(t *testing.T, resolved string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "plain value with {{args.other}}", resolved)
+			},
+		},
+		{
+			name:  "image tag",
+			value: `${freight.images["ghcr.io/example/app"].tag}`,
+			assertions: func(t *testing.T, resolved string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "v1.2.3", resolved)
+			},
+		},
+		{
+			name:  "image tag and digest within a value",
+			value: `app:${freight.images["ghcr.io/example/app"].tag}@${freight.images["ghcr.io/example/app"].digest}`,
+			assertions: func(t *testing.T, resolved string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "app:v1.2.3@sha256:abc", resolved)
+			},
+		},
+		{
+			name:  "OCI chart version",
+			value: `${freight.charts["oci://ghcr.io/example/charts/app"].version}`,
+			assertions: func(t *testing.T, resolved string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "1.0.0", resolved)
+			},
+		},
+		{
+			name:  "Helm chart repository chart version",
+			value: `${freight.charts["https://charts.example.com/db"].version}`,
+			assertions: func(t *testing.T, resolved string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "2.0.0", resolved)
+			},
+		},
+		{
+			name:  "commit ID",
+			value: `${freight.commits["https://github.com/example/config"].id}`,
+			assertions: func(t *testing.T, resolved string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "abc123", resolved)
+			},
+		},
+		{
+			name:  "unknown reference",
+			value: `${freight.images["ghcr.io/example/app"].tag}-${freight.images["ghcr.io/example/other"].tag}`,
+			assertions: func(t *testing.T, _ string, err error) {
+				assert.ErrorIs(t, err, ErrUnresolvedFreightReference)
+				assert.ErrorContains(t, err, `"${freight.images[\"ghcr.io/example/other\"].tag}"`)
+				assert.NotContains(t, err.Error(), "example/app")
+			},
+		},
+		{
+			name:  "unset field",
+			value: `${freight.images["ghcr.io/example/sidecar"].digest}`,
+			assertions: func(t *testing.T, _ string, err error) {
+				assert.ErrorIs(t, err, ErrUnresolvedFreightReference)
+			},
+		},
+		{
+			name:  "unknown field",
+			value: `${freight.charts["oci://ghcr.io/example/charts/app"].tag}`,
+			assertions: func(t *testing.T, _ string, err error) {
+				assert.ErrorIs(t, err, ErrUnresolvedFreightReference)
+			},
+		},
+		{
+			name:  "malformed reference",
+			value: `${freight.alias}`,
+			assertions: func(t *testing.T, _ string, err error) {
+				assert.ErrorContains(t, err, `unresolved freight reference "${freight.alias}"`)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, err := resolveFreightReferences(tt.value, freight)
+			tt.assertions(t, resolved, err)
+		})
+	}
+}
+
+func Test_resolveArgsFreightReferences(t *testing.T) {
+	freight := &kargoapi.Freight{
+		Images: []kargoapi.Image{
+			{RepoURL: "ghcr.io/example/app", Tag: "v1.2.3"},
+		},
+	}
+	args := []kargoapi.AnalysisRunArgument{
+		{Name: "tag", Value: `${freight.images["ghcr.io/example/app"].tag}`},
+	}
+	providedArgs := map[string]string{
+		"query": `version="${freight.images["ghcr.io/example/app"].tag}"`,
+	}
+
+	t.Run("without freight", func(t *testing.T) {
+		resolvedArgs, resolvedProvidedArgs, err := resolveArgsFreightReferences(args, providedArgs, nil)
+		require.NoError(t, err)
+		assert.Equal(t, args, resolvedArgs)
+		assert.Equal(t, providedArgs, resolvedProvidedArgs)
+	})
+
+	t.Run("with freight", func(t *testing.T) {
+		resolvedArgs, resolvedProvidedArgs, err := resolveArgsFreightReferences(args, providedArgs, freight)
+		require.NoError(t, err)
+		assert.Equal(t, []kargoapi.AnalysisRunArgument{{Name: "tag", Value: "v1.2.3"}}, resolvedArgs)
+		assert.Equal(t, map[string]string{"query": `version="v1.2.3"`}, resolvedProvidedArgs)
+		// The inputs are left untouched.
+		assert.Equal(t, `${freight.images["ghcr.io/example/app"].tag}`, args[0].Value)
+	})
+
+	t.Run("unresolved references", func(t *testing.T) {
+		_, _, err := resolveArgsFreightReferences(
+			[]kargoapi.AnalysisRunArgument{{Name: "tag", Value: `${freight.images["unknown"].tag}`}},
+			map[string]string{"version": `${freight.charts["unknown"].version}`},
+			freight,
+		)
+		assert.ErrorContains(t, err, `argument "tag": unresolved freight reference`)
+		assert.ErrorContains(t, err, `argument "version": unresolved freight reference`)
+	})
+}
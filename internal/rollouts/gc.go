@@ -0,0 +1,110 @@
+package rollouts
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// RetentionPolicy describes which completed AnalysisRuns should be retained
+// when garbage collecting AnalysisRuns.
+type RetentionPolicy struct {
+	// KeepSuccessful is the number of most recent successful AnalysisRuns to
+	// retain per Stage, regardless of their age.
+	KeepSuccessful int
+	// MaxAge is the age after completion at which an AnalysisRun becomes
+	// eligible for deletion. If zero, completed AnalysisRuns are eligible
+	// regardless of their age.
+	MaxAge time.Duration
+}
+
+// SelectForDeletion returns the AnalysisRuns which are eligible for deletion
+// according to the retention policy, in the order in which they appear in
+// runs. The returned pointers refer to the elements of runs.
+//
+// AnalysisRuns which did not complete yet are never eligible for deletion.
+// Of the completed AnalysisRuns, the policy.KeepSuccessful most recent
+// successful runs per Stage are always retained. The Stage of an AnalysisRun
+// is determined by its namespace and StageLabelKey label. The
+// remaining completed runs are eligible once they are older than
+// policy.MaxAge.
+//
+// Completed AnalysisRuns marked as ephemeral using WithEphemeral are always
+// eligible for deletion, and do not count towards policy.KeepSuccessful.
+func SelectForDeletion(
+	runs []rolloutsapi.AnalysisRun,
+	policy RetentionPolicy,
+	now time.Time,
+) []*rolloutsapi.AnalysisRun {
+	type stageKey struct {
+		namespace string
+		stage     string
+	}
+
+	successful := make(map[stageKey][]*rolloutsapi.AnalysisRun)
+	for i := range runs {
+		run := &runs[i]
+		if run.Status.Phase == rolloutsapi.AnalysisPhaseSuccessful && !isEphemeral(run) {
+			key := stageKey{namespace: run.Namespace, stage: run.Labels[StageLabelKey]}
+			successful[key] = append(successful[key], run)
+		}
+	}
+
+	retained := make(map[*rolloutsapi.AnalysisRun]struct{})
+	for _, stageRuns := range successful {
+		slices.SortFunc(stageRuns, compareRecency)
+		for _, run := range stageRuns[:min(max(policy.KeepSuccessful, 0), len(stageRuns))] {
+			retained[run] = struct{}{}
+		}
+	}
+
+	var eligible []*rolloutsapi.AnalysisRun
+	for i := range runs {
+		run := &runs[i]
+		if !run.Status.Phase.Completed() {
+			continue
+		}
+		if isEphemeral(run) {
+			eligible = append(eligible, run)
+			continue
+		}
+		if _, ok := retained[run]; ok {
+			continue
+		}
+		if policy.MaxAge > 0 && now.Sub(completionTime(run)) < policy.MaxAge {
+			continue
+		}
+		eligible = append(eligible, run)
+	}
+	return eligible
+}
+
+// isEphemeral returns true if the AnalysisRun is marked as ephemeral.
+func isEphemeral(run *rolloutsapi.AnalysisRun) bool {
+	return run.Annotations[ephemeralAnnotationKey] == "true"
+}
+
+// completionTime returns the time at which the AnalysisRun completed. If this
+// cannot be determined from its measurements, the time at which it started or
+// was created is returned instead.
+func completionTime(run *rolloutsapi.AnalysisRun) time.Time {
+	if completedAt := run.Status.CompletedAt(); completedAt != nil {
+		return completedAt.Time
+	}
+	if run.Status.StartedAt != nil {
+		return run.Status.StartedAt.Time
+	}
+	return run.CreationTimestamp.Time
+}
+
+// compareRecency orders AnalysisRuns from most to least recently completed.
+// Runs which completed at the same time are ordered by name in descending
+// order, which due to the ULID in the name is from newest to oldest.
+func compareRecency(a, b *rolloutsapi.AnalysisRun) int {
+	return cmp.Or(
+		completionTime(b).Compare(completionTime(a)),
+		cmp.Compare(b.Name, a.Name),
+	)
+}
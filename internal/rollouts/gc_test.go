@@ -0,0 +1,188 @@
+package rollouts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestSelectForDeletion(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	newRun := func(name, stage string, phase rolloutsapi.AnalysisPhase, age time.Duration) rolloutsapi.AnalysisRun {
+		startedAt := metav1.NewTime(now.Add(-age))
+		run := rolloutsapi.AnalysisRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: startedAt,
+				Labels: map[string]string{
+					kargoapi.StageLabelKey: stage,
+				},
+			},
+			Status: rolloutsapi.AnalysisRunStatus{
+				Phase:     phase,
+				StartedAt: &startedAt,
+			},
+		}
+		if phase.Completed() {
+			run.Status.MetricResults = []rolloutsapi.MetricResult{{
+				Name: "metric",
+				Measurements: []rolloutsapi.Measurement{{
+					FinishedAt: &startedAt,
+				}},
+			}}
+		}
+		return run
+	}
+
+	ephemeral := func(run rolloutsapi.AnalysisRun) rolloutsapi.AnalysisRun {
+		run.Annotations = map[string]string{ephemeralAnnotationKey: "true"}
+		return run
+	}
+
+	names := func(runs []*rolloutsapi.AnalysisRun) []string {
+		out := make([]string, len(runs))
+		for i, run := range runs {
+			out[i] = run.Name
+		}
+		return out
+	}
+
+	tests := []struct {
+		name       string
+		runs       []rolloutsapi.AnalysisRun
+		policy     RetentionPolicy
+		assertions func(*testing.T, []*rolloutsapi.AnalysisRun)
+	}{
+		{
+			name: "no runs",
+			assertions: func(t *testing.T, eligible []*rolloutsapi.AnalysisRun) {
+				assert.Empty(t, eligible)
+			},
+		},
+		{
+			name: "never deletes runs which did not complete",
+			runs: []rolloutsapi.AnalysisRun{
+				newRun("pending", "stage", rolloutsapi.AnalysisPhasePending, 48*time.Hour),
+				newRun("running", "stage", rolloutsapi.AnalysisPhaseRunning, 48*time.Hour),
+				newRun("unknown", "stage", "", 48*time.Hour),
+			},
+			assertions: func(t *testing.T, eligible []*rolloutsapi.AnalysisRun) {
+				assert.Empty(t, eligible)
+			},
+		},
+		{
+			name: "keeps most recent successful runs per Stage",
+			runs: []rolloutsapi.AnalysisRun{
+				newRun("stage-a-1", "stage-a", rolloutsapi.AnalysisPhaseSuccessful, 3*time.Hour),
+				newRun("stage-a-2", "stage-a", rolloutsapi.AnalysisPhaseSuccessful, 2*time.Hour),
+				newRun("stage-a-3", "stage-a", rolloutsapi.AnalysisPhaseSuccessful, time.Hour),
+				newRun("stage-b-1", "stage-b", rolloutsapi.AnalysisPhaseSuccessful, 4*time.Hour),
+			},
+			policy: RetentionPolicy{KeepSuccessful: 2},
+			assertions: func(t *testing.T, eligible []*rolloutsapi.AnalysisRun) {
+				assert.Equal(t, []string{"stage-a-1"}, names(eligible))
+			},
+		},
+		{
+			name: "does not count failed runs towards retained runs",
+			runs: []rolloutsapi.AnalysisRun{
+				newRun("successful", "stage", rolloutsapi.AnalysisPhaseSuccessful, 3*time.Hour),
+				newRun("failed", "stage", rolloutsapi.AnalysisPhaseFailed, 2*time.Hour),
+				newRun("error", "stage", rolloutsapi.AnalysisPhaseError, time.Hour),
+				newRun("inconclusive", "stage", rolloutsapi.AnalysisPhaseInconclusive, time.Hour),
+				newRun("running", "stage", rolloutsapi.AnalysisPhaseRunning, time.Minute),
+			},
+			policy: RetentionPolicy{KeepSuccessful: 1},
+			assertions: func(t *testing.T, eligible []*rolloutsapi.AnalysisRun) {
+				assert.Equal(t, []string{"failed", "error", "inconclusive"}, names(eligible))
+			},
+		},
+		{
+			name: "only deletes runs older than max age",
+			runs: []rolloutsapi.AnalysisRun{
+				newRun("old-successful", "stage", rolloutsapi.AnalysisPhaseSuccessful, 72*time.Hour),
+				newRun("old-failed", "stage", rolloutsapi.AnalysisPhaseFailed, 48*time.Hour),
+				newRun("new-successful", "stage", rolloutsapi.AnalysisPhaseSuccessful, 2*time.Hour),
+				newRun("new-failed", "stage", rolloutsapi.AnalysisPhaseFailed, time.Hour),
+				newRun("old-running", "stage", rolloutsapi.AnalysisPhaseRunning, 96*time.Hour),
+			},
+			policy: RetentionPolicy{MaxAge: 24 * time.Hour},
+			assertions: func(t *testing.T, eligible []*rolloutsapi.AnalysisRun) {
+				assert.Equal(t, []string{"old-successful", "old-failed"}, names(eligible))
+			},
+		},
+		{
+			name: "retains successful runs regardless of max age",
+			runs: []rolloutsapi.AnalysisRun{
+				newRun("oldest", "stage", rolloutsapi.AnalysisPhaseSuccessful, 96*time.Hour),
+				newRun("older", "stage", rolloutsapi.AnalysisPhaseSuccessful, 72*time.Hour),
+				newRun("old", "stage", rolloutsapi.AnalysisPhaseSuccessful, 48*time.Hour),
+			},
+			policy: RetentionPolicy{KeepSuccessful: 1, MaxAge: 24 * time.Hour},
+			assertions: func(t *testing.T, eligible []*rolloutsapi.AnalysisRun) {
+				assert.Equal(t, []string{"oldest", "older"}, names(eligible))
+			},
+		},
+		{
+			name: "orders runs completed at the same time by name",
+			runs: []rolloutsapi.AnalysisRun{
+				newRun("stage.01hrz6k7zw0000000000000001", "stage", rolloutsapi.AnalysisPhaseSuccessful, time.Hour),
+				newRun("stage.01hrz6k7zw0000000000000002", "stage", rolloutsapi.AnalysisPhaseSuccessful, time.Hour),
+			},
+			policy: RetentionPolicy{KeepSuccessful: 1},
+			assertions: func(t *testing.T, eligible []*rolloutsapi.AnalysisRun) {
+				assert.Equal(t, []string{"stage.01hrz6k7zw0000000000000001"}, names(eligible))
+			},
+		},
+		{
+			name: "deletes ephemeral runs once completed",
+			runs: []rolloutsapi.AnalysisRun{
+				ephemeral(newRun("successful", "stage", rolloutsapi.AnalysisPhaseSuccessful, time.Minute)),
+				ephemeral(newRun("failed", "stage", rolloutsapi.AnalysisPhaseFailed, time.Minute)),
+				ephemeral(newRun("pending", "stage", rolloutsapi.AnalysisPhasePending, 96*time.Hour)),
+				ephemeral(newRun("running", "stage", rolloutsapi.AnalysisPhaseRunning, 96*time.Hour)),
+			},
+			policy: RetentionPolicy{KeepSuccessful: 5, MaxAge: 24 * time.Hour},
+			assertions: func(t *testing.T, eligible []*rolloutsapi.AnalysisRun) {
+				assert.Equal(t, []string{"successful", "failed"}, names(eligible))
+			},
+		},
+		{
+			name: "does not count ephemeral runs towards retained runs",
+			runs: []rolloutsapi.AnalysisRun{
+				newRun("durable", "stage", rolloutsapi.AnalysisPhaseSuccessful, 2*time.Hour),
+				ephemeral(newRun("ephemeral", "stage", rolloutsapi.AnalysisPhaseSuccessful, time.Hour)),
+			},
+			policy: RetentionPolicy{KeepSuccessful: 1},
+			assertions: func(t *testing.T, eligible []*rolloutsapi.AnalysisRun) {
+				assert.Equal(t, []string{"ephemeral"}, names(eligible))
+			},
+		},
+		{
+			name: "treats Stages in different namespaces separately",
+			runs: func() []rolloutsapi.AnalysisRun {
+				a := newRun("a", "stage", rolloutsapi.AnalysisPhaseSuccessful, 2*time.Hour)
+				b := newRun("b", "stage", rolloutsapi.AnalysisPhaseSuccessful, time.Hour)
+				b.Namespace = "other"
+				return []rolloutsapi.AnalysisRun{a, b}
+			}(),
+			policy: RetentionPolicy{KeepSuccessful: 1},
+			assertions: func(t *testing.T, eligible []*rolloutsapi.AnalysisRun) {
+				assert.Empty(t, eligible)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.assertions(t, SelectForDeletion(tt.runs, tt.policy, now))
+		})
+	}
+}
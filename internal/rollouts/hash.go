@@ -0,0 +1,156 @@
+package rollouts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// volatileLabelKeys holds the keys of the labels which are excluded from the
+// CanonicalHash, as they identify a single verification rather than what is
+// verified.
+var volatileLabelKeys = []string{
+	VerificationIDLabelKey,
+	PromotionLabelKey,
+}
+
+// canonicalAnnotationKeys holds the keys of the annotations which are
+// included in the CanonicalHash.
+var canonicalAnnotationKeys = []string{
+	freightAnnotationKey,
+	deadlineAnnotationKey,
+	maxRunDurationAnnotationKey,
+	concurrencyLimitAnnotationKey,
+	ephemeralAnnotationKey,
+	targetClusterAnnotationKey,
+	gitRepoURLAnnotationKey,
+	gitCommitAnnotationKey,
+}
+
+// canonicalOwner holds an owner as included in the CanonicalHash. The UID is
+// omitted if empty, so the hash of options without UIDs is unaffected by it.
+type canonicalOwner struct {
+	APIVersion    string
+	Kind          string
+	Reference     types.NamespacedName
+	BlockDeletion bool
+	Controller    bool
+	UID           types.UID `json:",omitempty"`
+}
+
+// canonicalAnalysisRun holds the parts of the AnalysisRun described by the
+// options which are included in the CanonicalHash.
+type canonicalAnalysisRun struct {
+	Namespace             string               `json:"namespace,omitempty"`
+	Labels                map[string]string    `json:"labels,omitempty"`
+	Annotations           map[string]string    `json:"annotations,omitempty"`
+	Owners                []canonicalOwner     `json:"owners,omitempty"`
+	Templates             []string             `json:"templates,omitempty"`
+	ClusterTemplates      []string             `json:"clusterTemplates,omitempty"`
+	Args                  map[string]string    `json:"args,omitempty"`
+	BaselineArgs          map[string]string    `json:"baselineArgs,omitempty"`
+	ArgsConfigMaps        []string             `json:"argsConfigMaps,omitempty"`
+	ArgsFreight           string               `json:"argsFreight,omitempty"`
+	AllowedArgs           []string             `json:"allowedArgs,omitempty"`
+	InlineMetrics         []rolloutsapi.Metric `json:"inlineMetrics,omitempty"`
+	DryRunMetrics         []string             `json:"dryRunMetrics,omitempty"`
+	MeasurementRetention  map[string]int32     `json:"measurementRetention,omitempty"`
+	FailureLimits         map[string]int32     `json:"failureLimits,omitempty"`
+	InconclusiveLimits    map[string]int32     `json:"inconclusiveLimits,omitempty"`
+	JobPriorityClassName  string               `json:"jobPriorityClassName,omitempty"`
+	JobServiceAccountName string               `json:"jobServiceAccountName,omitempty"`
+	JobNodeSelector       map[string]string    `json:"jobNodeSelector,omitempty"`
+	JobTolerations        []corev1.Toleration  `json:"jobTolerations,omitempty"`
+	ProviderTimeout       time.Duration        `json:"providerTimeout,omitempty"`
+}
+
+// CanonicalHash returns a hash of the semantically meaningful parts of the
+// AnalysisRun which would be built with the given options, e.g. to store the
+// hash of the desired AnalysisRun and detect drift. Contrary to a hash of the
+// built AnalysisRun, it is stable across builds, as it does not depend on the
+// ULID, timestamps or status. The following parts are included:
+//
+//   - The namespace set using WithNamespace.
+//   - The labels, apart from the verification ID and Promotion labels, which
+//     differ between verifications of the same AnalysisRun.
+//   - The annotations holding the Freight, deadline, maximum run duration,
+//     concurrency limit, ephemerality, target cluster and Git revision. Extra
+//     annotations, the description, and annotations describing a single
+//     verification, i.e. the attempt, correlation ID and Promotion, are
+//     excluded.
+//   - The owners, including their UIDs if set, regardless of the order in
+//     which they were added.
+//   - The names of the AnalysisTemplates and ClusterAnalysisTemplates.
+//   - The argument values, including those derived from a baseline
+//     AnalysisRun, the names of the ConfigMaps holding argument values, the
+//     name of the Freight argument values can reference, and the allowed
+//     arguments.
+//   - The inline metrics, dry-run metrics, measurement retention limits,
+//     failure and inconclusive limits, Job PriorityClass, ServiceAccount, node
+//     selector and tolerations, and provider timeout.
+//
+// Any other part, including the name, is excluded. As the templates and
+// verification configuration are not part of the options, changes to them do
+// not affect the hash. It returns an error if the options are invalid.
+func CanonicalHash(opt ...AnalysisRunOption) (string, error) {
+	opts := NewAnalysisRunOptions(opt...)
+	if err := opts.Validate(); err != nil {
+		return "", fmt.Errorf("invalid options: %w", err)
+	}
+
+	labels := opts.labels()
+	for _, key := range volatileLabelKeys {
+		delete(labels, key)
+	}
+	annotations := opts.annotations()
+	maps.DeleteFunc(annotations, func(key, _ string) bool {
+		return !slices.Contains(canonicalAnnotationKeys, key)
+	})
+
+	canonical := canonicalAnalysisRun{
+		Namespace:             opts.Namespace,
+		Labels:                labels,
+		Annotations:           annotations,
+		Templates:             opts.Templates,
+		ClusterTemplates:      opts.ClusterTemplates,
+		Args:                  opts.Args,
+		BaselineArgs:          opts.baselineArgs,
+		AllowedArgs:           slices.Sorted(slices.Values(opts.AllowedArgs)),
+		InlineMetrics:         opts.InlineMetrics,
+		DryRunMetrics:         slices.Sorted(slices.Values(opts.DryRunMetrics)),
+		MeasurementRetention:  opts.MeasurementRetention,
+		FailureLimits:         opts.FailureLimits,
+		InconclusiveLimits:    opts.InconclusiveLimits,
+		JobPriorityClassName:  opts.JobPriorityClassName,
+		JobServiceAccountName: opts.JobServiceAccountName,
+		JobNodeSelector:       opts.JobNodeSelector,
+		JobTolerations:        opts.JobTolerations,
+		ProviderTimeout:       opts.ProviderTimeout,
+	}
+	for _, owner := range sortOwners(opts.Owners) {
+		canonical.Owners = append(canonical.Owners, canonicalOwner(owner))
+	}
+	for _, cm := range opts.argsConfigMaps {
+		canonical.ArgsConfigMaps = append(canonical.ArgsConfigMaps, cm.name)
+	}
+	if opts.ArgsFreight != nil {
+		canonical.ArgsFreight = opts.ArgsFreight.Name
+	}
+
+	// Maps are marshaled with sorted keys, which makes the output stable.
+	data, err := json.Marshal(canonical)
+	if err != nil {
+		return "", fmt.Errorf("marshal AnalysisRun: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
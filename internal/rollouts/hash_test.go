@@ -0,0 +1,150 @@
+package rollouts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestCanonicalHash(t *testing.T) {
+	stageOwner := WithOwner(Owner{
+		APIVersion: "kargo.akuity.io/v1alpha1",
+		Kind:       "Stage",
+		Reference:  types.NamespacedName{Namespace: "project", Name: "stage"},
+		Controller: true,
+	})
+	freightOwner := WithOwner(Owner{
+		APIVersion: "kargo.akuity.io/v1alpha1",
+		Kind:       "Freight",
+		Reference:  types.NamespacedName{Namespace: "project", Name: "freight"},
+	})
+	options := []AnalysisRunOption{
+		WithNamePrefix("stage"),
+		WithStage("project", "stage"),
+		WithFreight("freight", "warehouse"),
+		stageOwner,
+		freightOwner,
+		WithTemplates{"template"},
+		WithArgs{"service": "api"},
+		WithDryRunMetrics{"metric"},
+	}
+	base, err := CanonicalHash(options...)
+	require.NoError(t, err)
+	assert.Len(t, base, 64)
+
+	t.Run("volatile changes", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			options []AnalysisRunOption
+		}{
+			{
+				name: "ULID",
+				options: append(options, WithULIDGenerator(func() ulid.ULID {
+					return ulid.MustParse("01HRZ6K7ZW0000000000000000")
+				})),
+			},
+			{
+				name:    "name suffix",
+				options: append(options, WithNameSuffix("abc1234")),
+			},
+			{
+				name:    "verification ID and attempt",
+				options: append(options, WithVerificationID("verification"), WithAttempt(2)),
+			},
+			{
+				name:    "correlation ID",
+				options: append(options, WithCorrelationID("4bf92f3577b34da6a3ce929d0e0e4736")),
+			},
+			{
+				name:    "Promotion",
+				options: append(options, WithPromotion("promotion")),
+			},
+			{
+				name:    "extra annotation",
+				options: append(options, WithExtraAnnotations{"example.com/timestamp": "now"}),
+			},
+			{
+				name: "order of owners",
+				options: []AnalysisRunOption{
+					WithNamePrefix("stage"),
+					WithStage("project", "stage"),
+					WithFreight("freight", "warehouse"),
+					freightOwner,
+					stageOwner,
+					WithTemplates{"template"},
+					WithArgs{"service": "api"},
+					WithDryRunMetrics{"metric"},
+				},
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				hash, err := CanonicalHash(tt.options...)
+				require.NoError(t, err)
+				assert.Equal(t, base, hash)
+			})
+		}
+	})
+
+	t.Run("meaningful changes", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			options []AnalysisRunOption
+		}{
+			{
+				name:    "label",
+				options: append(options, WithExtraLabels{"example.com/team": "payments"}),
+			},
+			{
+				name:    "Freight",
+				options: append(options, WithFreight("other-freight", "warehouse")),
+			},
+			{
+				name:    "deadline",
+				options: append(options, WithDeadline(time.Hour)),
+			},
+			{
+				name: "owner",
+				options: append(options, WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Kind:       "Freight",
+					Reference:  types.NamespacedName{Namespace: "project", Name: "other-freight"},
+				})),
+			},
+			{
+				name:    "template",
+				options: append(options, WithTemplates{"other-template"}),
+			},
+			{
+				name:    "argument",
+				options: append(options, WithArgs{"service": "web"}),
+			},
+			{
+				name:    "dry-run metric",
+				options: append(options, WithDryRunMetrics{"other-metric"}),
+			},
+			{
+				name:    "ServiceAccount",
+				options: append(options, WithServiceAccount("analysis")),
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				hash, err := CanonicalHash(tt.options...)
+				require.NoError(t, err)
+				assert.NotEqual(t, base, hash)
+			})
+		}
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := CanonicalHash(WithMaxNameLength(1))
+		assert.ErrorContains(t, err, "invalid options")
+	})
+}
@@ -0,0 +1,510 @@
+package rollouts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	apimachineryvalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	"github.com/akuity/kargo/internal/git"
+)
+
+// The keys of the canonical labels set on AnalysisRuns. They can be used by
+// consumers to e.g. build label selectors.
+const (
+	// ProjectLabelKey is the key of the label holding the name of the Project
+	// an AnalysisRun belongs to.
+	ProjectLabelKey = kargoapi.ProjectLabelKey
+	// StageLabelKey is the key of the label holding the name of the Stage an
+	// AnalysisRun verifies.
+	StageLabelKey = kargoapi.StageLabelKey
+	// FreightLabelKey is the key of the label holding the name of the Freight
+	// an AnalysisRun verifies.
+	FreightLabelKey = "kargo.akuity.io/freight"
+	// ShardLabelKey is the key of the label holding the name of the shard of
+	// the controller responsible for an AnalysisRun.
+	ShardLabelKey = kargoapi.ShardLabelKey
+	// VerificationIDLabelKey is the key of the label holding the ID shared by
+	// all attempts of the same verification.
+	VerificationIDLabelKey = "kargo.akuity.io/verification-id"
+	// PromotionLabelKey is the key of the label holding the name of the
+	// Promotion which triggered the verification of an AnalysisRun.
+	PromotionLabelKey = kargoapi.PromotionLabelKey
+	// TargetClusterLabelKey is the key of the label holding the name of the
+	// cluster the verification of an AnalysisRun targets.
+	TargetClusterLabelKey = "kargo.akuity.io/target-cluster"
+	// GitCommitLabelKey is the key of the label holding the abbreviated ID
+	// of the Git commit an AnalysisRun verifies.
+	GitCommitLabelKey = "kargo.akuity.io/git-commit"
+)
+
+const (
+	// warehouseLabelKey is the key of the label holding the name of the
+	// Warehouse the Freight an AnalysisRun verifies originates from.
+	warehouseLabelKey = "kargo.akuity.io/warehouse"
+	// freightAnnotationKey is the key of the annotation holding the
+	// untruncated "<warehouse>/<freight>" identity of the Freight an
+	// AnalysisRun verifies, for display purposes.
+	freightAnnotationKey = "kargo.akuity.io/freight"
+
+	// verificationAttemptAnnotationKey is the key of the annotation holding
+	// the attempt number of the verification an AnalysisRun belongs to.
+	verificationAttemptAnnotationKey = "kargo.akuity.io/verification-attempt"
+
+	// correlationIDAnnotationKey is the key of the annotation holding the ID
+	// correlating an AnalysisRun with e.g. the trace of a promotion.
+	correlationIDAnnotationKey = "kargo.akuity.io/correlation-id"
+
+	// promotionAnnotationKey is the key of the annotation holding the
+	// untruncated name of the Promotion which triggered the verification of
+	// an AnalysisRun, for display purposes.
+	promotionAnnotationKey = kargoapi.PromotionLabelKey
+
+	// targetClusterAnnotationKey is the key of the annotation holding the
+	// untruncated name of the cluster the verification of an AnalysisRun
+	// targets, for display purposes.
+	targetClusterAnnotationKey = TargetClusterLabelKey
+
+	// gitRepoURLAnnotationKey is the key of the annotation holding the
+	// normalized URL of the Git repository an AnalysisRun verifies.
+	gitRepoURLAnnotationKey = "kargo.akuity.io/git-repo-url"
+	// gitCommitAnnotationKey is the key of the annotation holding the full
+	// ID of the Git commit an AnalysisRun verifies.
+	gitCommitAnnotationKey = GitCommitLabelKey
+	// gitCommitLabelLength is the number of characters of the ID of the Git
+	// commit set as a label, matching the default abbreviation of Git.
+	gitCommitLabelLength = 7
+
+	// controllerVersionAnnotationKey is the key of the annotation holding the
+	// version of the Kargo controller which built an AnalysisRun.
+	controllerVersionAnnotationKey = "kargo.akuity.io/controller-version"
+	// descriptionAnnotationKey is the key of the annotation holding the
+	// human-readable description of an AnalysisRun.
+	descriptionAnnotationKey = "kargo.akuity.io/description"
+
+	// deadlineAnnotationKey is the key of the annotation holding the
+	// duration after the creation of an AnalysisRun at which it should be
+	// terminated, as a time.Duration string.
+	deadlineAnnotationKey = "kargo.akuity.io/verification-deadline"
+
+	// maxRunDurationAnnotationKey is the key of the annotation holding the
+	// duration after the start of an AnalysisRun at which it is considered
+	// stuck if it is still running, as a time.Duration string.
+	maxRunDurationAnnotationKey = "kargo.akuity.io/max-run-duration"
+	// concurrencyLimitAnnotationKey is the key of the annotation holding the
+	// maximum number of concurrent AnalysisRuns of the Stage an AnalysisRun
+	// verifies.
+	concurrencyLimitAnnotationKey = "kargo.akuity.io/concurrency-limit"
+	// ephemeralAnnotationKey is the key of the annotation marking an
+	// AnalysisRun for deletion as soon as it completed.
+	ephemeralAnnotationKey = "kargo.akuity.io/ephemeral"
+
+	// labelValueHashLength is the number of hexadecimal characters of the
+	// hash appended to label values which had to be altered to be valid.
+	labelValueHashLength = 8
+)
+
+// defaultProtectedLabelKeys holds the keys of the labels which are always
+// protected, as they determine which project, Stage and controller shard an
+// AnalysisRun belongs to.
+var defaultProtectedLabelKeys = []string{
+	ProjectLabelKey,
+	StageLabelKey,
+	ShardLabelKey,
+}
+
+var (
+	// gitCommitRegex matches the hexadecimal ID of a Git commit, abbreviated
+	// or not, using SHA-1 or SHA-256.
+	gitCommitRegex = regexp.MustCompile(`^[0-9a-f]{7,64}$`)
+	// scpGitRepoURLRegex matches Git repository URLs in SCP-like syntax.
+	scpGitRepoURLRegex = regexp.MustCompile(`^(?:[\w.-]+@)?[\w-]+(?:\.[\w-]+)*:[^/].*$`)
+)
+
+// labels returns the labels from the options which should be set on the
+// AnalysisRun. Extra labels matching any of the excluded prefixes are
+// dropped, and the canonical labels derived from dedicated options take
+// precedence over the extra labels.
+func (o *AnalysisRunOptions) labels() map[string]string {
+	labels := o.extraLabels()
+	if canonical := o.canonicalLabels(); len(canonical) > 0 {
+		if labels == nil {
+			labels = make(map[string]string, len(canonical))
+		}
+		maps.Copy(labels, canonical)
+	}
+	// An empty shard label would not match the selector of the default
+	// shard, which selects resources without the label.
+	if value, ok := labels[ShardLabelKey]; ok && value == "" {
+		delete(labels, ShardLabelKey)
+	}
+
+	return labels
+}
+
+// canonicalLabels returns the labels derived from the dedicated options, e.g.
+// WithStage, without the extra labels.
+func (o *AnalysisRunOptions) canonicalLabels() map[string]string {
+	var labels map[string]string
+	set := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[key] = labelValue(value)
+	}
+
+	set(ProjectLabelKey, o.Project)
+	set(StageLabelKey, o.Stage)
+	set(FreightLabelKey, o.Freight)
+	set(warehouseLabelKey, o.Warehouse)
+	set(VerificationIDLabelKey, o.VerificationID)
+	set(PromotionLabelKey, o.Promotion)
+	set(ShardLabelKey, o.Shard)
+	set(TargetClusterLabelKey, o.TargetCluster)
+	set(GitCommitLabelKey, o.GitCommit[:min(len(o.GitCommit), gitCommitLabelLength)])
+	return labels
+}
+
+// extraLabels returns the extra labels, without the labels matching any of
+// the excluded prefixes.
+func (o *AnalysisRunOptions) extraLabels() map[string]string {
+	labels := maps.Clone(o.ExtraLabels)
+	maps.DeleteFunc(labels, func(key, _ string) bool {
+		return slices.ContainsFunc(o.ExcludedLabelPrefixes, func(prefix string) bool {
+			return strings.HasPrefix(key, prefix)
+		})
+	})
+	return labels
+}
+
+// isProtectedLabel reports whether the label with the given key can only be
+// set by dedicated options.
+func (o *AnalysisRunOptions) isProtectedLabel(key string) bool {
+	return slices.Contains(defaultProtectedLabelKeys, key) || slices.Contains(o.ProtectedLabelKeys, key)
+}
+
+// validateProtectedLabels returns an error for every label with a protected
+// key of the given source, e.g. the extra labels, which differs from the
+// label set by a dedicated option. Protected labels which are not set by a
+// dedicated option can be set by any source.
+func (o *AnalysisRunOptions) validateProtectedLabels(source string, labels map[string]string) error {
+	canonical := o.canonicalLabels()
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		if !o.isProtectedLabel(key) {
+			continue
+		}
+		if value, ok := canonical[key]; !ok || value == labels[key] {
+			continue
+		}
+		errs = append(errs, invalidField(
+			field.NewPath("metadata", "labels").Key(key),
+			labels[key],
+			fmt.Errorf(
+				"conflicting values %q and %q for label %q, which is protected and cannot be overridden by %s",
+				labels[key], canonical[key], key, source,
+			),
+		))
+	}
+	return errors.Join(errs...)
+}
+
+// annotations returns the annotations from the options which should be set
+// on the AnalysisRun. The canonical annotations derived from dedicated
+// options take precedence over the extra annotations.
+func (o *AnalysisRunOptions) annotations() map[string]string {
+	annotations := maps.Clone(o.ExtraAnnotations)
+	if o.Freight != "" {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		value := o.Freight
+		if o.Warehouse != "" {
+			value = o.Warehouse + "/" + o.Freight
+		}
+		annotations[freightAnnotationKey] = value
+	}
+	if o.verificationAttempt > 0 {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[verificationAttemptAnnotationKey] = strconv.Itoa(o.verificationAttempt)
+	}
+	if o.CorrelationID != "" {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[correlationIDAnnotationKey] = o.CorrelationID
+	}
+	if o.Promotion != "" {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[promotionAnnotationKey] = o.Promotion
+	}
+	if o.TargetCluster != "" {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[targetClusterAnnotationKey] = o.TargetCluster
+	}
+	if o.GitRepoURL != "" {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[gitRepoURLAnnotationKey] = git.NormalizeURL(o.GitRepoURL)
+	}
+	if o.GitCommit != "" {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[gitCommitAnnotationKey] = o.GitCommit
+	}
+	if o.ControllerVersion != "" {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[controllerVersionAnnotationKey] = o.ControllerVersion
+	}
+	if o.Description != "" {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[descriptionAnnotationKey] = o.Description
+	}
+	if o.Deadline > 0 {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[deadlineAnnotationKey] = o.Deadline.String()
+	}
+	if o.MaxRunDuration > 0 {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[maxRunDurationAnnotationKey] = o.MaxRunDuration.String()
+	}
+	if o.ConcurrencyLimit > 0 {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[concurrencyLimitAnnotationKey] = strconv.Itoa(o.ConcurrencyLimit)
+	}
+	if o.Ephemeral {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[ephemeralAnnotationKey] = "true"
+	}
+	return annotations
+}
+
+// labelValue returns the given value as a valid label value. Valid values are
+// returned as-is. Otherwise, invalid characters are replaced with '-', and the
+// value is truncated and suffixed with a hash of the original value to keep
+// it unique.
+func labelValue(value string) string {
+	if len(validation.IsValidLabelValue(value)) == 0 {
+		return value
+	}
+
+	sanitized := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '-'
+		}
+	}, value)
+
+	sum := sha256.Sum256([]byte(value))
+	hash := hex.EncodeToString(sum[:])[:labelValueHashLength]
+
+	maxLength := validation.LabelValueMaxLength - (1 + labelValueHashLength)
+	if len(sanitized) > maxLength {
+		sanitized = sanitized[:maxLength]
+	}
+	sanitized = strings.TrimRight(strings.TrimLeft(sanitized, "-_."), "-_.")
+	if sanitized == "" {
+		return hash
+	}
+	return sanitized + "-" + hash
+}
+
+// labelConflict describes a label which was set to different values.
+type labelConflict struct {
+	key      string
+	existing string
+	value    string
+}
+
+// validateLabelConflicts returns an error for every label which was set to
+// different values, if the label conflict policy of the options is
+// LabelConflictPolicyError. Conflicts of extra labels which are excluded
+// from the AnalysisRun are ignored, as are extra labels which override a
+// protected label, which are reported by validateProtectedLabels regardless of
+// the policy.
+func (o *AnalysisRunOptions) validateLabelConflicts() error {
+	switch o.LabelConflictPolicy {
+	case "", LabelConflictPolicyOverwrite:
+		return nil
+	case LabelConflictPolicyError:
+	default:
+		return invalidField(
+			field.NewPath("labelConflictPolicy"),
+			o.LabelConflictPolicy,
+			fmt.Errorf("unknown label conflict policy %q", o.LabelConflictPolicy),
+		)
+	}
+
+	extra := o.extraLabels()
+	conflicts := slices.DeleteFunc(slices.Clone(o.labelConflicts), func(c labelConflict) bool {
+		_, ok := extra[c.key]
+		return !ok
+	})
+	labels := o.labels()
+	for _, key := range slices.Sorted(maps.Keys(extra)) {
+		if labels[key] != extra[key] && !o.isProtectedLabel(key) {
+			conflicts = append(conflicts, labelConflict{key: key, existing: extra[key], value: labels[key]})
+		}
+	}
+
+	var errs []error
+	path := field.NewPath("metadata", "labels")
+	for _, c := range conflicts {
+		errs = append(errs, invalidField(
+			path.Key(c.key),
+			c.value,
+			fmt.Errorf("conflicting values %q and %q for label %q", c.existing, c.value, c.key),
+		))
+	}
+	return errors.Join(errs...)
+}
+
+// validateLabelsAndAnnotations validates the extra labels and annotations
+// against the Kubernetes constraints for label and annotation keys and
+// values. Contrary to label values, annotation values are not limited to 63
+// characters.
+func validateLabelsAndAnnotations(labels, annotations map[string]string) error {
+	metadata := field.NewPath("metadata")
+	errs := metav1validation.ValidateLabels(labels, metadata.Child("labels"))
+	errs = append(errs, apimachineryvalidation.ValidateAnnotations(annotations, metadata.Child("annotations"))...)
+	if len(errs) == 0 {
+		return nil
+	}
+	return withFields(errs.ToAggregate(), errs...)
+}
+
+// validateVerificationID validates that the verification ID can be used as a
+// label value as-is.
+func validateVerificationID(id string) error {
+	if id == "" {
+		return nil
+	}
+	if errs := validation.IsValidLabelValue(id); len(errs) > 0 {
+		detail := strings.Join(errs, "; ")
+		return withFields(
+			fmt.Errorf("verification ID %q is not a valid label value: %s", id, detail),
+			field.Invalid(field.NewPath("metadata", "labels").Key(VerificationIDLabelKey), id, detail),
+		)
+	}
+	return nil
+}
+
+// validateTargetCluster validates that the name of the target cluster only
+// contains characters allowed in a label value. Names exceeding the maximum
+// length of a label value are allowed, as they are hashed by labelValue.
+func validateTargetCluster(name string) error {
+	if name == "" {
+		return nil
+	}
+	errs := slices.DeleteFunc(validation.IsValidLabelValue(name), func(msg string) bool {
+		return msg == validation.MaxLenError(validation.LabelValueMaxLength)
+	})
+	if len(errs) > 0 {
+		detail := strings.Join(errs, "; ")
+		return withFields(
+			fmt.Errorf("target cluster %q is not a valid label value: %s", name, detail),
+			field.Invalid(field.NewPath("metadata", "labels").Key(TargetClusterLabelKey), name, detail),
+		)
+	}
+	return nil
+}
+
+// validateGitRevision validates that the Git repository URL can be parsed,
+// either as a URL with a host or in SCP-like syntax, and that the commit is a
+// hexadecimal SHA. Both must be set if either of them is.
+func validateGitRevision(repoURL, commit string) error {
+	if repoURL == "" && commit == "" {
+		return nil
+	}
+	var errs []error
+	if repoURL == "" {
+		errs = append(errs, withFields(
+			errors.New("repository URL is required when a Git commit is set"),
+			field.Required(field.NewPath("gitRepoURL"), "required when a commit is set"),
+		))
+	} else if !isGitRepoURL(repoURL) {
+		errs = append(errs, invalidField(
+			field.NewPath("gitRepoURL"),
+			repoURL,
+			fmt.Errorf("invalid Git repository URL %q", repoURL),
+		))
+	}
+	if commit == "" {
+		errs = append(errs, withFields(
+			errors.New("commit is required when a Git repository URL is set"),
+			field.Required(field.NewPath("gitCommit"), "required when a repository URL is set"),
+		))
+	} else if !gitCommitRegex.MatchString(commit) {
+		errs = append(errs, invalidField(
+			field.NewPath("gitCommit"),
+			commit,
+			fmt.Errorf("invalid Git commit %q: must be a hexadecimal SHA of 7 to 64 characters", commit),
+		))
+	}
+	return errors.Join(errs...)
+}
+
+// isGitRepoURL reports whether the given Git repository URL can be parsed,
+// either as a URL with a host, or in SCP-like syntax, e.g.
+// git@github.com:akuity/kargo.git.
+func isGitRepoURL(repoURL string) bool {
+	if strings.Contains(repoURL, "://") {
+		u, err := url.Parse(repoURL)
+		return err == nil && u.Host != ""
+	}
+	return scpGitRepoURLRegex.MatchString(repoURL)
+}
+
+// validateCorrelationID validates that the correlation ID can be used as an
+// annotation value.
+func validateCorrelationID(id string) error {
+	if id == "" {
+		return nil
+	}
+	errs := apimachineryvalidation.ValidateAnnotations(
+		map[string]string{correlationIDAnnotationKey: id},
+		field.NewPath("metadata", "annotations"),
+	)
+	if err := errs.ToAggregate(); err != nil {
+		return withFields(fmt.Errorf("correlation ID is not a valid annotation value: %w", err), errs...)
+	}
+	return nil
+}
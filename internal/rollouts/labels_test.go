@@ -0,0 +1,790 @@
+package rollouts
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestAnalysisRunOptions_labels(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    []AnalysisRunOption
+		assertions func(*testing.T, map[string]string, map[string]string)
+	}{
+		{
+			name: "no options",
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Nil(t, labels)
+				assert.Nil(t, annotations)
+			},
+		},
+		{
+			name: "freight and warehouse",
+			options: []AnalysisRunOption{
+				WithExtraLabels{"extra": "label"},
+				WithExtraAnnotations{"extra": "annotation"},
+				WithFreight("abc123", "warehouse"),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Equal(t, map[string]string{
+					"extra":           "label",
+					FreightLabelKey:   "abc123",
+					warehouseLabelKey: "warehouse",
+				}, labels)
+				assert.Equal(t, map[string]string{
+					"extra":              "annotation",
+					freightAnnotationKey: "warehouse/abc123",
+				}, annotations)
+			},
+		},
+		{
+			name: "project and stage",
+			options: []AnalysisRunOption{
+				WithExtraLabels{kargoapi.StageLabelKey: "other"},
+				WithStage("project", "stage"),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Equal(t, map[string]string{
+					kargoapi.ProjectLabelKey: "project",
+					kargoapi.StageLabelKey:   "stage",
+				}, labels)
+				assert.Nil(t, annotations)
+			},
+		},
+		{
+			name: "excluded label prefixes",
+			options: []AnalysisRunOption{
+				WithExcludedLabelPrefixes{"internal.example.com/", "checksum"},
+				WithExtraLabels{
+					"internal.example.com/bookkeeping": "value",
+					"internal.example.com/other":       "value",
+					"checksum":                         "value",
+					"example.com/checksum":             "value",
+					"team":                             "value",
+				},
+				WithStage("project", "stage"),
+				WithExcludedLabelPrefixes{"kargo.akuity.io/"},
+			},
+			assertions: func(t *testing.T, labels, _ map[string]string) {
+				assert.Equal(t, map[string]string{
+					"example.com/checksum":   "value",
+					"team":                   "value",
+					kargoapi.ProjectLabelKey: "project",
+					kargoapi.StageLabelKey:   "stage",
+				}, labels)
+			},
+		},
+		{
+			name: "excluded exact label key",
+			options: []AnalysisRunOption{
+				WithExtraLabels{"example.com/checksum": "value", "example.com/other": "value"},
+				WithExcludedLabelPrefixes{"example.com/checksum"},
+			},
+			assertions: func(t *testing.T, labels, _ map[string]string) {
+				assert.Equal(t, map[string]string{"example.com/other": "value"}, labels)
+			},
+		},
+		{
+			name: "freight without warehouse",
+			options: []AnalysisRunOption{
+				WithFreight("abc123", ""),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Equal(t, map[string]string{FreightLabelKey: "abc123"}, labels)
+				assert.Equal(t, map[string]string{freightAnnotationKey: "abc123"}, annotations)
+			},
+		},
+		{
+			name: "freight labels take precedence over extra labels",
+			options: []AnalysisRunOption{
+				WithExtraLabels{FreightLabelKey: "other"},
+				WithFreight("abc123", "warehouse"),
+			},
+			assertions: func(t *testing.T, labels, _ map[string]string) {
+				assert.Equal(t, "abc123", labels[FreightLabelKey])
+			},
+		},
+		{
+			name: "long warehouse name is hashed in label only",
+			options: []AnalysisRunOption{
+				WithFreight("abc123", strings.Repeat("w", 100)),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Empty(t, validation.IsValidLabelValue(labels[warehouseLabelKey]))
+				assert.Equal(t, strings.Repeat("w", 100)+"/abc123", annotations[freightAnnotationKey])
+			},
+		},
+		{
+			name: "shard",
+			options: []AnalysisRunOption{
+				WithShard("shard1"),
+			},
+			assertions: func(t *testing.T, labels, _ map[string]string) {
+				assert.Equal(t, map[string]string{
+					kargoapi.ShardLabelKey: "shard1",
+				}, labels)
+			},
+		},
+		{
+			name: "empty shard",
+			options: []AnalysisRunOption{
+				WithExtraLabels{"extra": "label"},
+				WithShard(""),
+			},
+			assertions: func(t *testing.T, labels, _ map[string]string) {
+				assert.Equal(t, map[string]string{"extra": "label"}, labels)
+			},
+		},
+		{
+			name: "empty shard from extra labels is omitted",
+			options: []AnalysisRunOption{
+				WithExtraLabels{"extra": "label", kargoapi.ShardLabelKey: ""},
+			},
+			assertions: func(t *testing.T, labels, _ map[string]string) {
+				assert.NotContains(t, labels, kargoapi.ShardLabelKey)
+			},
+		},
+		{
+			name: "shard takes precedence over extra labels",
+			options: []AnalysisRunOption{
+				WithExtraLabels{kargoapi.ShardLabelKey: "other"},
+				WithShard("shard1"),
+			},
+			assertions: func(t *testing.T, labels, _ map[string]string) {
+				assert.Equal(t, "shard1", labels[kargoapi.ShardLabelKey])
+			},
+		},
+		{
+			name: "ephemeral",
+			options: []AnalysisRunOption{
+				WithEphemeral(),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Nil(t, labels)
+				assert.Equal(t, map[string]string{
+					ephemeralAnnotationKey: "true",
+				}, annotations)
+			},
+		},
+		{
+			name: "concurrency limit",
+			options: []AnalysisRunOption{
+				WithConcurrencyLimit(3),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Nil(t, labels)
+				assert.Equal(t, map[string]string{
+					concurrencyLimitAnnotationKey: "3",
+				}, annotations)
+			},
+		},
+		{
+			name: "maximum run duration",
+			options: []AnalysisRunOption{
+				WithMaxRunDuration(2 * time.Hour),
+			},
+			assertions: func(t *testing.T, _, annotations map[string]string) {
+				assert.Equal(t, map[string]string{
+					maxRunDurationAnnotationKey: "2h0m0s",
+				}, annotations)
+			},
+		},
+		{
+			name: "correlation ID",
+			options: []AnalysisRunOption{
+				WithVerificationID("verification"),
+				WithCorrelationID("4bf92f3577b34da6a3ce929d0e0e4736"),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Equal(t, map[string]string{
+					VerificationIDLabelKey: "verification",
+				}, labels)
+				assert.Equal(t, map[string]string{
+					correlationIDAnnotationKey: "4bf92f3577b34da6a3ce929d0e0e4736",
+				}, annotations)
+			},
+		},
+		{
+			name: "promotion",
+			options: []AnalysisRunOption{
+				WithPromotion("stage.01hrz6k7zw0000000000000000.abc1234"),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Equal(t, map[string]string{
+					PromotionLabelKey: "stage.01hrz6k7zw0000000000000000.abc1234",
+				}, labels)
+				assert.Equal(t, map[string]string{
+					promotionAnnotationKey: "stage.01hrz6k7zw0000000000000000.abc1234",
+				}, annotations)
+			},
+		},
+		{
+			name: "long promotion name",
+			options: []AnalysisRunOption{
+				WithPromotion(stringWithLength(validation.LabelValueMaxLength + 1)),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				require.Contains(t, labels, PromotionLabelKey)
+				assert.Len(t, labels[PromotionLabelKey], validation.LabelValueMaxLength)
+				assert.Equal(t, stringWithLength(validation.LabelValueMaxLength+1), annotations[promotionAnnotationKey])
+			},
+		},
+		{
+			name: "target cluster",
+			options: []AnalysisRunOption{
+				WithShard("shard"),
+				WithTargetCluster("us-east-1"),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Equal(t, map[string]string{
+					ShardLabelKey:         "shard",
+					TargetClusterLabelKey: "us-east-1",
+				}, labels)
+				assert.Equal(t, map[string]string{
+					targetClusterAnnotationKey: "us-east-1",
+				}, annotations)
+			},
+		},
+		{
+			name: "long target cluster",
+			options: []AnalysisRunOption{
+				WithTargetCluster(stringWithLength(validation.LabelValueMaxLength + 10)),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				require.Contains(t, labels, TargetClusterLabelKey)
+				assert.Len(t, labels[TargetClusterLabelKey], validation.LabelValueMaxLength)
+				assert.Empty(t, validation.IsValidLabelValue(labels[TargetClusterLabelKey]))
+				assert.Equal(t, stringWithLength(validation.LabelValueMaxLength+10), annotations[targetClusterAnnotationKey])
+			},
+		},
+		{
+			name: "Git revision",
+			options: []AnalysisRunOption{
+				WithGitRevision("https://GitHub.com/akuity/kargo.git/", "ABCDEF0123456789abcdef0123456789abcdef01"),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Equal(t, map[string]string{
+					GitCommitLabelKey: "abcdef0",
+				}, labels)
+				assert.Equal(t, map[string]string{
+					gitRepoURLAnnotationKey: "https://github.com/akuity/kargo",
+					gitCommitAnnotationKey:  "abcdef0123456789abcdef0123456789abcdef01",
+				}, annotations)
+			},
+		},
+		{
+			name: "controller version",
+			options: []AnalysisRunOption{
+				WithControllerVersion("v1.2.3+abcdef0"),
+				WithCorrelationID("4bf92f3577b34da6a3ce929d0e0e4736"),
+				WithExtraAnnotations{"example.com/key": "value"},
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Nil(t, labels)
+				assert.Equal(t, map[string]string{
+					controllerVersionAnnotationKey: "v1.2.3+abcdef0",
+					correlationIDAnnotationKey:     "4bf92f3577b34da6a3ce929d0e0e4736",
+					"example.com/key":              "value",
+				}, annotations)
+			},
+		},
+		{
+			name: "empty controller version",
+			options: []AnalysisRunOption{
+				WithControllerVersion(""),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Nil(t, labels)
+				assert.Nil(t, annotations)
+			},
+		},
+		{
+			name: "description",
+			options: []AnalysisRunOption{
+				WithDescription("Verify {{ .Freight }} in Stage {{ .Stage }}", map[string]string{
+					"Freight": "abc123",
+					"Stage":   "staging",
+				}),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Nil(t, labels)
+				assert.Equal(t, map[string]string{
+					descriptionAnnotationKey: "Verify abc123 in Stage staging",
+				}, annotations)
+			},
+		},
+		{
+			name: "empty correlation ID",
+			options: []AnalysisRunOption{
+				WithCorrelationID(""),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Nil(t, labels)
+				assert.Nil(t, annotations)
+			},
+		},
+		{
+			name: "deadline",
+			options: []AnalysisRunOption{
+				WithDeadline(90 * time.Minute),
+			},
+			assertions: func(t *testing.T, labels, annotations map[string]string) {
+				assert.Nil(t, labels)
+				assert.Equal(t, map[string]string{
+					deadlineAnnotationKey: "1h30m0s",
+				}, annotations)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewAnalysisRunOptions(tt.options...)
+			tt.assertions(t, opts.labels(), opts.annotations())
+		})
+	}
+}
+
+func TestBuild_canonicalLabelKeys(t *testing.T) {
+	ar, err := Build(
+		"default",
+		nil,
+		nil,
+		WithStage("project", "stage"),
+		WithFreight("freight", ""),
+		WithShard("shard"),
+		WithVerificationID("verification"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		ProjectLabelKey:        "project",
+		StageLabelKey:          "stage",
+		FreightLabelKey:        "freight",
+		ShardLabelKey:          "shard",
+		VerificationIDLabelKey: "verification",
+	}, ar.Labels)
+	assert.Equal(t, []string{
+		"kargo.akuity.io/freight",
+		"kargo.akuity.io/project",
+		"kargo.akuity.io/shard",
+		"kargo.akuity.io/stage",
+		"kargo.akuity.io/verification-id",
+	}, slices.Sorted(maps.Keys(ar.Labels)))
+}
+
+func TestBuild_labelConflictPolicy(t *testing.T) {
+	conflicting := []AnalysisRunOption{
+		WithStage("project", "stage"),
+		WithExtraLabels{"example.com/team": "payments", "example.com/tier": "backend"},
+		WithExtraLabels{"example.com/team": "checkout", "example.com/tier": "backend"},
+		WithExtraLabels{StageLabelKey: "stage"},
+	}
+
+	tests := []struct {
+		name       string
+		options    []AnalysisRunOption
+		assertions func(*testing.T, map[string]string, error)
+	}{
+		{
+			name:    "overwrite by default",
+			options: conflicting,
+			assertions: func(t *testing.T, labels map[string]string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "checkout", labels["example.com/team"])
+				assert.Equal(t, "stage", labels[StageLabelKey])
+			},
+		},
+		{
+			name:    "overwrite",
+			options: append([]AnalysisRunOption{WithLabelConflictPolicy(LabelConflictPolicyOverwrite)}, conflicting...),
+			assertions: func(t *testing.T, labels map[string]string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "checkout", labels["example.com/team"])
+			},
+		},
+		{
+			name: "error",
+			options: append(
+				slices.Clone(conflicting),
+				WithExtraLabels{FreightLabelKey: "other-freight"},
+				WithFreight("freight", ""),
+				WithLabelConflictPolicy(LabelConflictPolicyError),
+			),
+			assertions: func(t *testing.T, _ map[string]string, err error) {
+				assert.ErrorContains(t, err, `conflicting values "payments" and "checkout" for label "example.com/team"`)
+				assert.ErrorContains(t, err, `conflicting values "other-freight" and "freight" for label "`+FreightLabelKey+`"`)
+				assert.NotContains(t, err.Error(), "example.com/tier")
+			},
+		},
+		{
+			name: "error without conflicts",
+			options: []AnalysisRunOption{
+				WithLabelConflictPolicy(LabelConflictPolicyError),
+				WithStage("project", "stage"),
+				WithExtraLabels{"example.com/team": "payments", StageLabelKey: "stage"},
+				WithExtraLabels{"example.com/team": "payments"},
+			},
+			assertions: func(t *testing.T, labels map[string]string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "payments", labels["example.com/team"])
+			},
+		},
+		{
+			name: "error ignores excluded labels",
+			options: []AnalysisRunOption{
+				WithLabelConflictPolicy(LabelConflictPolicyError),
+				WithExtraLabels{"example.com/team": "payments"},
+				WithExtraLabels{"example.com/team": "checkout"},
+				WithExcludedLabelPrefixes{"example.com/"},
+			},
+			assertions: func(t *testing.T, _ map[string]string, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name:    "unknown policy",
+			options: []AnalysisRunOption{WithLabelConflictPolicy("Merge")},
+			assertions: func(t *testing.T, _ map[string]string, err error) {
+				assert.ErrorContains(t, err, `unknown label conflict policy "Merge"`)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar, err := Build("project", nil, nil, tt.options...)
+			if err != nil {
+				tt.assertions(t, nil, err)
+				return
+			}
+			tt.assertions(t, ar.Labels, err)
+		})
+	}
+}
+
+func TestBuild_protectedLabels(t *testing.T) {
+	tests := []struct {
+		name       string
+		metadata   *kargoapi.AnalysisRunMetadata
+		options    []AnalysisRunOption
+		assertions func(*testing.T, *rolloutsapi.AnalysisRun, error)
+	}{
+		{
+			name: "extra label overriding the project",
+			options: []AnalysisRunOption{
+				WithStage("project", "stage"),
+				WithExtraLabels{ProjectLabelKey: "other-project"},
+			},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(
+					t,
+					err,
+					`conflicting values "other-project" and "project" for label "`+ProjectLabelKey+
+						`", which is protected and cannot be overridden by extra labels`,
+				)
+			},
+		},
+		{
+			name: "extra label overriding the shard regardless of the policy",
+			options: []AnalysisRunOption{
+				WithLabelConflictPolicy(LabelConflictPolicyOverwrite),
+				WithExtraLabels{ShardLabelKey: "other-shard"},
+				WithShard("shard"),
+			},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, `for label "`+ShardLabelKey+`", which is protected`)
+			},
+		},
+		{
+			name: "extra label with the same value",
+			options: []AnalysisRunOption{
+				WithStage("project", "stage"),
+				WithExtraLabels{StageLabelKey: "stage"},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "stage", ar.Labels[StageLabelKey])
+			},
+		},
+		{
+			name: "extra label without dedicated option",
+			options: []AnalysisRunOption{
+				WithExtraLabels{StageLabelKey: "stage"},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "stage", ar.Labels[StageLabelKey])
+			},
+		},
+		{
+			name: "additional protected key",
+			options: []AnalysisRunOption{
+				WithProtectedLabelKeys{FreightLabelKey},
+				WithFreight("freight", ""),
+				WithExtraLabels{FreightLabelKey: "other-freight"},
+			},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, `for label "`+FreightLabelKey+`", which is protected`)
+			},
+		},
+		{
+			name: "unprotected key",
+			options: []AnalysisRunOption{
+				WithFreight("freight", ""),
+				WithExtraLabels{FreightLabelKey: "other-freight"},
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "freight", ar.Labels[FreightLabelKey])
+			},
+		},
+		{
+			name: "verification label overriding the Stage",
+			metadata: &kargoapi.AnalysisRunMetadata{
+				Labels: map[string]string{StageLabelKey: "other-stage"},
+			},
+			options: []AnalysisRunOption{WithStage("project", "stage")},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "cannot be overridden by verification labels")
+			},
+		},
+		{
+			name: "verification label and extra label without dedicated option",
+			metadata: &kargoapi.AnalysisRunMetadata{
+				Labels: map[string]string{StageLabelKey: "verification-stage"},
+			},
+			options: []AnalysisRunOption{WithExtraLabels{StageLabelKey: "extra-stage"}},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "extra-stage", ar.Labels[StageLabelKey])
+			},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, rolloutsapi.AddToScheme(scheme))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewAnalysisRunBuilder(fake.NewClientBuilder().WithScheme(scheme).Build(), Config{})
+			ar, err := b.Build(context.Background(), "project", &kargoapi.Verification{
+				AnalysisRunMetadata: tt.metadata,
+			}, tt.options...)
+			tt.assertions(t, ar, err)
+		})
+	}
+}
+
+func TestWithLabelsFromEnv(t *testing.T) {
+	t.Setenv("KARGO_TEST_LABEL_ACTOR", "jane")
+	t.Setenv("KARGO_TEST_LABEL_CI_JOB_URL", "https://ci.example.com/jobs/42")
+	t.Setenv("KARGO_TEST_LABEL_EMPTY", "")
+	t.Setenv("KARGO_TEST_LABEL_", "no-key")
+	t.Setenv("KARGO_TEST_LABEL__INVALID", "value")
+	t.Setenv("KARGO_TEST_OTHER_ACTOR", "john")
+
+	tests := []struct {
+		name       string
+		options    []AnalysisRunOption
+		assertions func(*testing.T, *AnalysisRunOptions)
+	}{
+		{
+			name:    "present variables",
+			options: []AnalysisRunOption{WithLabelsFromEnv("KARGO_TEST_LABEL_")},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				require.NoError(t, opts.Validate())
+				assert.Equal(t, map[string]string{
+					"actor":      "jane",
+					"ci-job-url": labelValue("https://ci.example.com/jobs/42"),
+				}, opts.ExtraLabels)
+				assert.Empty(t, validation.IsValidLabelValue(opts.ExtraLabels["ci-job-url"]))
+			},
+		},
+		{
+			name:    "absent variables",
+			options: []AnalysisRunOption{WithLabelsFromEnv("KARGO_TEST_MISSING_")},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				require.NoError(t, opts.Validate())
+				assert.Nil(t, opts.ExtraLabels)
+			},
+		},
+		{
+			name:    "empty prefix",
+			options: []AnalysisRunOption{WithLabelsFromEnv("")},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Nil(t, opts.ExtraLabels)
+			},
+		},
+		{
+			name: "merged with extra labels",
+			options: []AnalysisRunOption{
+				WithExtraLabels{"actor": "john", "team": "payments"},
+				WithLabelsFromEnv("KARGO_TEST_LABEL_"),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Equal(t, "jane", opts.ExtraLabels["actor"])
+				assert.Equal(t, "payments", opts.ExtraLabels["team"])
+				opts.LabelConflictPolicy = LabelConflictPolicyError
+				assert.ErrorContains(t, opts.Validate(), `conflicting values "john" and "jane" for label "actor"`)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.assertions(t, NewAnalysisRunOptions(tt.options...))
+		})
+	}
+}
+
+func TestBuild_description(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    []AnalysisRunOption
+		assertions func(*testing.T, *rolloutsapi.AnalysisRun, error)
+	}{
+		{
+			name: "rendered",
+			options: []AnalysisRunOption{
+				WithDescription(
+					"Verify canary for freight {{ .Freight.Name }} in stage {{ .Stage }}",
+					struct {
+						Freight kargoapi.FreightReference
+						Stage   string
+					}{
+						Freight: kargoapi.FreightReference{Name: "abc123"},
+						Stage:   "staging",
+					},
+				),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(
+					t,
+					"Verify canary for freight abc123 in stage staging",
+					ar.Annotations[descriptionAnnotationKey],
+				)
+			},
+		},
+		{
+			name: "empty",
+			options: []AnalysisRunOption{
+				WithDescription("{{ if false }}never{{ end }}", nil),
+			},
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.NotContains(t, ar.Annotations, descriptionAnnotationKey)
+			},
+		},
+		{
+			name: "invalid template",
+			options: []AnalysisRunOption{
+				WithDescription("Verify {{ .Freight ", nil),
+			},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "parse description template")
+			},
+		},
+		{
+			name: "missing key",
+			options: []AnalysisRunOption{
+				WithDescription("Verify {{ .Freight }}", map[string]string{"Stage": "staging"}),
+			},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "render description")
+			},
+		},
+		{
+			name: "execution error",
+			options: []AnalysisRunOption{
+				WithDescription("Verify {{ .Freight.Missing }}", struct{ Freight string }{}),
+			},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "render description")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar, err := Build("project", nil, nil, tt.options...)
+			tt.assertions(t, ar, err)
+		})
+	}
+}
+
+func Test_labelValue(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		assertions func(*testing.T, string)
+	}{
+		{
+			name:  "valid value",
+			value: "Valid_value.1-2",
+			assertions: func(t *testing.T, value string) {
+				assert.Equal(t, "Valid_value.1-2", value)
+			},
+		},
+		{
+			name:  "invalid characters",
+			value: "invalid/value",
+			assertions: func(t *testing.T, value string) {
+				assert.Empty(t, validation.IsValidLabelValue(value))
+				assert.True(t, strings.HasPrefix(value, "invalid-value-"))
+				assert.Len(t, value, len("invalid-value-")+labelValueHashLength)
+			},
+		},
+		{
+			name:  "invalid leading and trailing characters",
+			value: "-value-",
+			assertions: func(t *testing.T, value string) {
+				assert.Empty(t, validation.IsValidLabelValue(value))
+				assert.True(t, strings.HasPrefix(value, "value-"))
+			},
+		},
+		{
+			name:  "only invalid characters",
+			value: "///",
+			assertions: func(t *testing.T, value string) {
+				assert.Empty(t, validation.IsValidLabelValue(value))
+				assert.Len(t, value, labelValueHashLength)
+			},
+		},
+		{
+			name:  "too long value",
+			value: strings.Repeat("a", 100),
+			assertions: func(t *testing.T, value string) {
+				assert.Empty(t, validation.IsValidLabelValue(value))
+				assert.Len(t, value, validation.LabelValueMaxLength)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.assertions(t, labelValue(tt.value))
+		})
+	}
+
+	t.Run("distinct values remain distinct", func(t *testing.T) {
+		assert.NotEqual(t,
+			labelValue(strings.Repeat("a", 100)+"b"),
+			labelValue(strings.Repeat("a", 100)+"c"),
+		)
+		assert.NotEqual(t, labelValue("a/b"), labelValue("a:b"))
+	})
+}
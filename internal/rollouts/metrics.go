@@ -0,0 +1,282 @@
+package rollouts
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// allMetrics is the metric name which can be passed to WithDryRunMetrics to
+// select all metrics of the AnalysisRun.
+const allMetrics = "*"
+
+// appendInlineMetrics appends the inline metrics to the metrics of the spec.
+// It returns an error if an inline metric has the same name as a metric
+// already in the spec.
+func appendInlineMetrics(spec *rolloutsapi.AnalysisRunSpec, metrics []rolloutsapi.Metric) error {
+	var errs []error
+	for _, metric := range metrics {
+		if slices.ContainsFunc(spec.Metrics, func(m rolloutsapi.Metric) bool {
+			return m.Name == metric.Name
+		}) {
+			errs = append(errs, fmt.Errorf("inline metric %q conflicts with existing metric", metric.Name))
+			continue
+		}
+		spec.Metrics = append(spec.Metrics, *metric.DeepCopy())
+	}
+	return errors.Join(errs...)
+}
+
+// validateInlineMetrics validates that every inline metric has a name and at
+// least one provider.
+func validateInlineMetrics(metrics []rolloutsapi.Metric) error {
+	var errs []error
+	for i, metric := range metrics {
+		path := field.NewPath("inlineMetrics").Index(i)
+		if metric.Name == "" {
+			errs = append(errs, withFields(
+				fmt.Errorf("inline metric at index %d has no name", i),
+				field.Required(path.Child("name"), ""),
+			))
+		}
+		if providers := metricProviders(metric.Provider); len(providers) == 1 && providers[0] == unknownProvider {
+			errs = append(errs, withFields(
+				fmt.Errorf("inline metric %q at index %d has no provider", metric.Name, i),
+				field.Required(path.Child("provider"), ""),
+			))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyMetricSettings applies the metric settings of the options to the spec,
+// i.e. the dry-run metrics, measurement retention limits, failure and
+// inconclusive limits, Job PriorityClass, ServiceAccount and scheduling, and
+// provider timeout, as done when building the AnalysisRun. Applying them to a
+// spec which already reflects them leaves it unchanged. It returns an error
+// if any of the referenced metrics does not exist in the spec.
+func applyMetricSettings(spec *rolloutsapi.AnalysisRunSpec, opts *AnalysisRunOptions) error {
+	if err := applyMetricOptions(spec, opts.DryRunMetrics, opts.MeasurementRetention); err != nil {
+		return fmt.Errorf("apply metric options: %w", err)
+	}
+	if err := applyMetricLimits(spec, opts.FailureLimits, opts.InconclusiveLimits); err != nil {
+		return fmt.Errorf("apply metric limits: %w", err)
+	}
+	applyJobPriorityClass(spec, opts.JobPriorityClassName)
+	applyJobServiceAccount(spec, opts.JobServiceAccountName)
+	applyJobScheduling(spec, opts.JobNodeSelector, opts.JobTolerations)
+	applyProviderTimeout(spec, opts.ProviderTimeout)
+	return nil
+}
+
+// applyMetricOptions adds the dry-run metrics and measurement retention
+// limits from the options to the spec. Dry-run metrics already declared by
+// the templates are not duplicated, while measurement retention limits from
+// the options take precedence over those declared by the templates. It
+// returns an error if any of the referenced metrics does not exist in the
+// spec.
+func applyMetricOptions(
+	spec *rolloutsapi.AnalysisRunSpec,
+	dryRunMetrics []string,
+	retention map[string]int32,
+) error {
+	var errs []error
+	exists := func(name string) bool {
+		return slices.ContainsFunc(spec.Metrics, func(m rolloutsapi.Metric) bool {
+			return m.Name == name
+		})
+	}
+
+	var names []string
+	for _, name := range dryRunMetrics {
+		if name == allMetrics {
+			for _, m := range spec.Metrics {
+				names = append(names, m.Name)
+			}
+			continue
+		}
+		if !exists(name) {
+			errs = append(errs, fmt.Errorf("dry-run metric %q does not exist", name))
+			continue
+		}
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(spec.DryRun, func(d rolloutsapi.DryRun) bool {
+			return d.MetricName == name
+		}) {
+			spec.DryRun = append(spec.DryRun, rolloutsapi.DryRun{MetricName: name})
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(retention)) {
+		if !exists(name) {
+			errs = append(errs, fmt.Errorf("measurement retention metric %q does not exist", name))
+			continue
+		}
+		idx := slices.IndexFunc(spec.MeasurementRetention, func(m rolloutsapi.MeasurementRetention) bool {
+			return m.MetricName == name
+		})
+		if idx >= 0 {
+			spec.MeasurementRetention[idx].Limit = retention[name]
+			continue
+		}
+		spec.MeasurementRetention = append(spec.MeasurementRetention, rolloutsapi.MeasurementRetention{
+			MetricName: name,
+			Limit:      retention[name],
+		})
+	}
+
+	return errors.Join(errs...)
+}
+
+// applyMetricLimits sets the failure and inconclusive limits of the metrics
+// of the spec to the given limits per metric name. It returns an error if any
+// of the referenced metrics does not exist in the spec.
+func applyMetricLimits(
+	spec *rolloutsapi.AnalysisRunSpec,
+	failureLimits map[string]int32,
+	inconclusiveLimits map[string]int32,
+) error {
+	var errs []error
+	exists := func(name string) bool {
+		return slices.ContainsFunc(spec.Metrics, func(m rolloutsapi.Metric) bool {
+			return m.Name == name
+		})
+	}
+	for _, name := range slices.Sorted(maps.Keys(failureLimits)) {
+		if !exists(name) {
+			errs = append(errs, fmt.Errorf("failure limit metric %q does not exist", name))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(inconclusiveLimits)) {
+		if !exists(name) {
+			errs = append(errs, fmt.Errorf("inconclusive limit metric %q does not exist", name))
+		}
+	}
+
+	for i := range spec.Metrics {
+		overrideMetricLimits(&spec.Metrics[i], failureLimits, inconclusiveLimits)
+	}
+	return errors.Join(errs...)
+}
+
+// overrideMetricLimits sets the failure and inconclusive limits of the given
+// metric to the limits for its name, if any.
+func overrideMetricLimits(metric *rolloutsapi.Metric, failureLimits, inconclusiveLimits map[string]int32) {
+	if limit, ok := failureLimits[metric.Name]; ok {
+		metric.FailureLimit = ptr.To(intstr.FromInt32(limit))
+	}
+	if limit, ok := inconclusiveLimits[metric.Name]; ok {
+		metric.InconclusiveLimit = ptr.To(intstr.FromInt32(limit))
+	}
+}
+
+// applyProviderTimeout sets the timeout of the Prometheus and Web providers of
+// the metrics of the spec which do not specify one to the given timeout,
+// rounded up to whole seconds, if positive. Other providers do not support a
+// timeout. The providers are copied before being modified, as they may be
+// shared with the templates.
+func applyProviderTimeout(spec *rolloutsapi.AnalysisRunSpec, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	seconds := int64((timeout + time.Second - 1) / time.Second)
+	for i := range spec.Metrics {
+		provider := &spec.Metrics[i].Provider
+		if provider.Prometheus != nil && provider.Prometheus.Timeout == nil {
+			provider.Prometheus = provider.Prometheus.DeepCopy()
+			provider.Prometheus.Timeout = ptr.To(seconds)
+		}
+		if provider.Web != nil && provider.Web.TimeoutSeconds == 0 {
+			provider.Web = provider.Web.DeepCopy()
+			provider.Web.TimeoutSeconds = seconds
+		}
+	}
+}
+
+// applyJobPriorityClass sets the PriorityClass of the Pod templates of the
+// Job metrics of the spec to the given name, if not empty.
+func applyJobPriorityClass(spec *rolloutsapi.AnalysisRunSpec, name string) {
+	if name == "" {
+		return
+	}
+	updateJobPodSpecs(spec, func(podSpec *corev1.PodSpec) {
+		podSpec.PriorityClassName = name
+	})
+}
+
+// applyJobServiceAccount sets the ServiceAccount of the Pod templates of the
+// Job metrics of the spec to the given name, if not empty.
+func applyJobServiceAccount(spec *rolloutsapi.AnalysisRunSpec, name string) {
+	if name == "" {
+		return
+	}
+	updateJobPodSpecs(spec, func(podSpec *corev1.PodSpec) {
+		podSpec.ServiceAccountName = name
+	})
+}
+
+// applyJobScheduling merges the given node selector and tolerations into the
+// Pod templates of the Job metrics of the spec. Labels of the node selector
+// take precedence over those of the Pod templates, while tolerations which
+// are already present are not duplicated.
+func applyJobScheduling(
+	spec *rolloutsapi.AnalysisRunSpec,
+	nodeSelector map[string]string,
+	tolerations []corev1.Toleration,
+) {
+	if len(nodeSelector) == 0 && len(tolerations) == 0 {
+		return
+	}
+	updateJobPodSpecs(spec, func(podSpec *corev1.PodSpec) {
+		if len(nodeSelector) > 0 {
+			if podSpec.NodeSelector == nil {
+				podSpec.NodeSelector = make(map[string]string, len(nodeSelector))
+			}
+			maps.Copy(podSpec.NodeSelector, nodeSelector)
+		}
+		for _, toleration := range tolerations {
+			if !slices.ContainsFunc(podSpec.Tolerations, func(t corev1.Toleration) bool {
+				return equality.Semantic.DeepEqual(t, toleration)
+			}) {
+				podSpec.Tolerations = append(podSpec.Tolerations, *toleration.DeepCopy())
+			}
+		}
+	})
+}
+
+// validateJobNodeSelector validates that the labels of the node selector of
+// the Pods of the Jobs spawned by Job metrics are valid.
+func validateJobNodeSelector(nodeSelector map[string]string) error {
+	errs := metav1validation.ValidateLabels(nodeSelector, field.NewPath("jobNodeSelector"))
+	if len(errs) == 0 {
+		return nil
+	}
+	return withFields(errs.ToAggregate(), errs...)
+}
+
+// updateJobPodSpecs applies the given update to the Pod templates of the Job
+// metrics of the spec. The Jobs are copied before being updated, as they may
+// be shared with the templates.
+func updateJobPodSpecs(spec *rolloutsapi.AnalysisRunSpec, update func(*corev1.PodSpec)) {
+	for i := range spec.Metrics {
+		provider := &spec.Metrics[i].Provider
+		if provider.Job == nil {
+			continue
+		}
+		provider.Job = provider.Job.DeepCopy()
+		update(&provider.Job.Spec.Template.Spec)
+	}
+}
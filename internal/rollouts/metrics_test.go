@@ -0,0 +1,534 @@
+package rollouts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func Test_appendInlineMetrics(t *testing.T) {
+	tests := []struct {
+		name       string
+		metrics    []rolloutsapi.Metric
+		assertions func(*testing.T, *rolloutsapi.AnalysisRunSpec, error)
+	}{
+		{
+			name: "appends metrics",
+			metrics: []rolloutsapi.Metric{
+				{Name: "inline1"},
+				{Name: "inline2"},
+			},
+			assertions: func(t *testing.T, spec *rolloutsapi.AnalysisRunSpec, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []rolloutsapi.Metric{
+					{Name: "template"},
+					{Name: "inline1"},
+					{Name: "inline2"},
+				}, spec.Metrics)
+			},
+		},
+		{
+			name: "collision with template metric",
+			metrics: []rolloutsapi.Metric{
+				{Name: "template"},
+			},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRunSpec, err error) {
+				assert.ErrorContains(t, err, `inline metric "template" conflicts with existing metric`)
+			},
+		},
+		{
+			name: "collision between inline metrics",
+			metrics: []rolloutsapi.Metric{
+				{Name: "inline"},
+				{Name: "inline"},
+			},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRunSpec, err error) {
+				assert.ErrorContains(t, err, `inline metric "inline" conflicts with existing metric`)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &rolloutsapi.AnalysisRunSpec{
+				Metrics: []rolloutsapi.Metric{{Name: "template"}},
+			}
+			err := appendInlineMetrics(spec, tt.metrics)
+			tt.assertions(t, spec, err)
+		})
+	}
+}
+
+func Test_validateInlineMetrics(t *testing.T) {
+	tests := []struct {
+		name       string
+		metrics    []rolloutsapi.Metric
+		assertions func(*testing.T, error)
+	}{
+		{
+			name: "valid metrics",
+			metrics: []rolloutsapi.Metric{
+				{
+					Name: "metric",
+					Provider: rolloutsapi.MetricProvider{
+						Web: &rolloutsapi.WebMetric{URL: "https://example.com"},
+					},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "empty metric",
+			metrics: []rolloutsapi.Metric{
+				{},
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "inline metric at index 0 has no name")
+				assert.ErrorContains(t, err, `inline metric "" at index 0 has no provider`)
+			},
+		},
+		{
+			name: "metric without provider",
+			metrics: []rolloutsapi.Metric{
+				{Name: "metric"},
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `inline metric "metric" at index 0 has no provider`)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.assertions(t, validateInlineMetrics(tt.metrics))
+		})
+	}
+}
+
+func Test_applyMetricOptions(t *testing.T) {
+	newSpec := func() *rolloutsapi.AnalysisRunSpec {
+		return &rolloutsapi.AnalysisRunSpec{
+			Metrics: []rolloutsapi.Metric{
+				{Name: "metric1"},
+				{Name: "metric2"},
+				{Name: "metric3"},
+			},
+			DryRun: []rolloutsapi.DryRun{
+				{MetricName: "metric1"},
+			},
+			MeasurementRetention: []rolloutsapi.MeasurementRetention{
+				{MetricName: "metric1", Limit: 5},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		dryRun     []string
+		retention  map[string]int32
+		assertions func(*testing.T, *rolloutsapi.AnalysisRunSpec, error)
+	}{
+		{
+			name: "no options",
+			assertions: func(t *testing.T, spec *rolloutsapi.AnalysisRunSpec, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, newSpec(), spec)
+			},
+		},
+		{
+			name:   "dry-run metrics",
+			dryRun: []string{"metric3", "metric1"},
+			assertions: func(t *testing.T, spec *rolloutsapi.AnalysisRunSpec, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []rolloutsapi.DryRun{
+					{MetricName: "metric1"},
+					{MetricName: "metric3"},
+				}, spec.DryRun)
+			},
+		},
+		{
+			name:   "all metrics dry-run",
+			dryRun: []string{"*"},
+			assertions: func(t *testing.T, spec *rolloutsapi.AnalysisRunSpec, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []rolloutsapi.DryRun{
+					{MetricName: "metric1"},
+					{MetricName: "metric2"},
+					{MetricName: "metric3"},
+				}, spec.DryRun)
+			},
+		},
+		{
+			name: "measurement retention",
+			retention: map[string]int32{
+				"metric3": 10,
+				"metric1": 20,
+			},
+			assertions: func(t *testing.T, spec *rolloutsapi.AnalysisRunSpec, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []rolloutsapi.MeasurementRetention{
+					{MetricName: "metric1", Limit: 20},
+					{MetricName: "metric3", Limit: 10},
+				}, spec.MeasurementRetention)
+			},
+		},
+		{
+			name:   "unknown metrics",
+			dryRun: []string{"unknown1"},
+			retention: map[string]int32{
+				"unknown2": 10,
+			},
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRunSpec, err error) {
+				assert.ErrorContains(t, err, `dry-run metric "unknown1" does not exist`)
+				assert.ErrorContains(t, err, `measurement retention metric "unknown2" does not exist`)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newSpec()
+			err := applyMetricOptions(spec, tt.dryRun, tt.retention)
+			tt.assertions(t, spec, err)
+		})
+	}
+}
+
+func TestBuild_jobPriorityClass(t *testing.T) {
+	template := &rolloutsapi.AnalysisTemplate{
+		Spec: rolloutsapi.AnalysisTemplateSpec{
+			Metrics: []rolloutsapi.Metric{
+				{
+					Name: "job",
+					Provider: rolloutsapi.MetricProvider{
+						Job: &rolloutsapi.JobMetric{
+							Spec: batchv1.JobSpec{
+								Template: corev1.PodTemplateSpec{
+									Spec: corev1.PodSpec{
+										Containers: []corev1.Container{{Name: "check", Image: "alpine"}},
+									},
+								},
+							},
+						},
+					},
+				},
+				{
+					Name: "prometheus",
+					Provider: rolloutsapi.MetricProvider{
+						Prometheus: &rolloutsapi.PrometheusMetric{Query: "up"},
+					},
+				},
+			},
+		},
+	}
+	original := template.DeepCopy()
+
+	ar, err := Build(
+		"default",
+		[]*rolloutsapi.AnalysisTemplate{template},
+		nil,
+		WithJobPriorityClass("verification-critical"),
+	)
+	require.NoError(t, err)
+	require.Len(t, ar.Spec.Metrics, 2)
+
+	job := ar.Spec.Metrics[0].Provider.Job
+	require.NotNil(t, job)
+	assert.Equal(t, "verification-critical", job.Spec.Template.Spec.PriorityClassName)
+	assert.Equal(t, original.Spec.Metrics[1], ar.Spec.Metrics[1])
+	assert.Equal(t, original, template, "template must not be modified")
+
+	t.Run("invalid priority class", func(t *testing.T) {
+		ar, err := Build("default", nil, nil, WithJobPriorityClass("Invalid_Name"))
+		assert.ErrorContains(t, err, `invalid job priority class "Invalid_Name"`)
+		assert.Nil(t, ar)
+	})
+}
+
+func TestBuild_serviceAccount(t *testing.T) {
+	jobMetric := rolloutsapi.Metric{
+		Name: "job",
+		Provider: rolloutsapi.MetricProvider{
+			Job: &rolloutsapi.JobMetric{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							ServiceAccountName: "default",
+							Containers:         []corev1.Container{{Name: "check", Image: "bitnami/kubectl"}},
+						},
+					},
+				},
+			},
+		},
+	}
+	prometheusMetric := rolloutsapi.Metric{
+		Name: "prometheus",
+		Provider: rolloutsapi.MetricProvider{
+			Prometheus: &rolloutsapi.PrometheusMetric{Query: "up"},
+		},
+	}
+
+	t.Run("with Job metrics", func(t *testing.T) {
+		template := &rolloutsapi.AnalysisTemplate{
+			Spec: rolloutsapi.AnalysisTemplateSpec{
+				Metrics: []rolloutsapi.Metric{jobMetric, prometheusMetric},
+			},
+		}
+		original := template.DeepCopy()
+
+		ar, err := Build(
+			"default",
+			[]*rolloutsapi.AnalysisTemplate{template},
+			nil,
+			WithServiceAccount("verification"),
+		)
+		require.NoError(t, err)
+		require.Len(t, ar.Spec.Metrics, 2)
+
+		job := ar.Spec.Metrics[0].Provider.Job
+		require.NotNil(t, job)
+		assert.Equal(t, "verification", job.Spec.Template.Spec.ServiceAccountName)
+		assert.Equal(t, original.Spec.Metrics[1], ar.Spec.Metrics[1])
+		assert.Equal(t, original, template, "template must not be modified")
+	})
+
+	t.Run("without Job metrics", func(t *testing.T) {
+		template := &rolloutsapi.AnalysisTemplate{
+			Spec: rolloutsapi.AnalysisTemplateSpec{
+				Metrics: []rolloutsapi.Metric{prometheusMetric},
+			},
+		}
+
+		ar, err := Build(
+			"default",
+			[]*rolloutsapi.AnalysisTemplate{template},
+			nil,
+			WithServiceAccount("verification"),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, template.Spec.Metrics, ar.Spec.Metrics)
+	})
+
+	t.Run("invalid service account", func(t *testing.T) {
+		ar, err := Build("default", nil, nil, WithServiceAccount("Invalid_Name"))
+		assert.ErrorContains(t, err, `invalid service account "Invalid_Name"`)
+		assert.Nil(t, ar)
+	})
+}
+
+func TestBuild_jobScheduling(t *testing.T) {
+	existing := corev1.Toleration{
+		Key:      "example.com/spot",
+		Operator: corev1.TolerationOpExists,
+		Effect:   corev1.TaintEffectNoSchedule,
+	}
+	dedicated := corev1.Toleration{
+		Key:      "example.com/pool",
+		Operator: corev1.TolerationOpEqual,
+		Value:    "verification",
+		Effect:   corev1.TaintEffectNoSchedule,
+	}
+	jobMetric := rolloutsapi.Metric{
+		Name: "job",
+		Provider: rolloutsapi.MetricProvider{
+			Job: &rolloutsapi.JobMetric{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							NodeSelector: map[string]string{
+								"kubernetes.io/arch": "amd64",
+								"example.com/pool":   "default",
+							},
+							Tolerations: []corev1.Toleration{existing},
+							Containers:  []corev1.Container{{Name: "check", Image: "bitnami/kubectl"}},
+						},
+					},
+				},
+			},
+		},
+	}
+	prometheusMetric := rolloutsapi.Metric{
+		Name: "prometheus",
+		Provider: rolloutsapi.MetricProvider{
+			Prometheus: &rolloutsapi.PrometheusMetric{Query: "up"},
+		},
+	}
+
+	t.Run("with Job metrics", func(t *testing.T) {
+		template := &rolloutsapi.AnalysisTemplate{
+			Spec: rolloutsapi.AnalysisTemplateSpec{
+				Metrics: []rolloutsapi.Metric{jobMetric, prometheusMetric},
+			},
+		}
+		original := template.DeepCopy()
+
+		ar, err := Build(
+			"default",
+			[]*rolloutsapi.AnalysisTemplate{template},
+			nil,
+			WithJobNodeSelector{"example.com/pool": "verification"},
+			WithJobTolerations{existing, dedicated},
+		)
+		require.NoError(t, err)
+		require.Len(t, ar.Spec.Metrics, 2)
+
+		job := ar.Spec.Metrics[0].Provider.Job
+		require.NotNil(t, job)
+		assert.Equal(t, map[string]string{
+			"kubernetes.io/arch": "amd64",
+			"example.com/pool":   "verification",
+		}, job.Spec.Template.Spec.NodeSelector)
+		assert.Equal(t, []corev1.Toleration{existing, dedicated}, job.Spec.Template.Spec.Tolerations)
+		assert.Equal(t, original.Spec.Metrics[1], ar.Spec.Metrics[1])
+		assert.Equal(t, original, template, "template must not be modified")
+	})
+
+	t.Run("without Job metrics", func(t *testing.T) {
+		template := &rolloutsapi.AnalysisTemplate{
+			Spec: rolloutsapi.AnalysisTemplateSpec{
+				Metrics: []rolloutsapi.Metric{prometheusMetric},
+			},
+		}
+
+		ar, err := Build(
+			"default",
+			[]*rolloutsapi.AnalysisTemplate{template},
+			nil,
+			WithJobNodeSelector{"example.com/pool": "verification"},
+			WithJobTolerations{dedicated},
+		)
+		require.NoError(t, err)
+		assert.Equal(t, template.Spec.Metrics, ar.Spec.Metrics)
+	})
+
+	t.Run("invalid node selector", func(t *testing.T) {
+		ar, err := Build("default", nil, nil, WithJobNodeSelector{"example.com/pool": "invalid value"})
+		assert.ErrorContains(t, err, "jobNodeSelector")
+		assert.Nil(t, ar)
+	})
+}
+
+func TestBuild_providerTimeout(t *testing.T) {
+	template := &rolloutsapi.AnalysisTemplate{
+		Spec: rolloutsapi.AnalysisTemplateSpec{
+			Metrics: []rolloutsapi.Metric{
+				{
+					Name: "prometheus",
+					Provider: rolloutsapi.MetricProvider{
+						Prometheus: &rolloutsapi.PrometheusMetric{Query: "up"},
+					},
+				},
+				{
+					Name: "prometheus-with-timeout",
+					Provider: rolloutsapi.MetricProvider{
+						Prometheus: &rolloutsapi.PrometheusMetric{Query: "up", Timeout: ptr.To[int64](5)},
+					},
+				},
+				{
+					Name: "web",
+					Provider: rolloutsapi.MetricProvider{
+						Web: &rolloutsapi.WebMetric{URL: "http://example.com"},
+					},
+				},
+				{
+					Name: "web-with-timeout",
+					Provider: rolloutsapi.MetricProvider{
+						Web: &rolloutsapi.WebMetric{URL: "http://example.com", TimeoutSeconds: 10},
+					},
+				},
+				{
+					Name: "datadog",
+					Provider: rolloutsapi.MetricProvider{
+						Datadog: &rolloutsapi.DatadogMetric{Query: "avg:errors{*}"},
+					},
+				},
+			},
+		},
+	}
+	original := template.DeepCopy()
+
+	ar, err := Build(
+		"default",
+		[]*rolloutsapi.AnalysisTemplate{template},
+		nil,
+		WithProviderTimeout(29500*time.Millisecond),
+	)
+	require.NoError(t, err)
+	require.Len(t, ar.Spec.Metrics, 5)
+
+	assert.Equal(t, ptr.To[int64](30), ar.Spec.Metrics[0].Provider.Prometheus.Timeout)
+	assert.Equal(t, ptr.To[int64](5), ar.Spec.Metrics[1].Provider.Prometheus.Timeout)
+	assert.Equal(t, int64(30), ar.Spec.Metrics[2].Provider.Web.TimeoutSeconds)
+	assert.Equal(t, int64(10), ar.Spec.Metrics[3].Provider.Web.TimeoutSeconds)
+	assert.Equal(t, original.Spec.Metrics[4], ar.Spec.Metrics[4])
+	assert.Equal(t, original, template, "template must not be modified")
+
+	t.Run("negative timeout", func(t *testing.T) {
+		ar, err := Build("default", nil, nil, WithProviderTimeout(-time.Second))
+		assert.ErrorContains(t, err, "provider timeout -1s must not be negative")
+		assert.Nil(t, ar)
+	})
+}
+
+func TestBuild_metricLimits(t *testing.T) {
+	template := &rolloutsapi.AnalysisTemplate{
+		Spec: rolloutsapi.AnalysisTemplateSpec{
+			Metrics: []rolloutsapi.Metric{
+				{
+					Name:         "error-rate",
+					FailureLimit: ptr.To(intstr.FromInt32(0)),
+					Provider: rolloutsapi.MetricProvider{
+						Prometheus: &rolloutsapi.PrometheusMetric{Query: "errors"},
+					},
+				},
+				{
+					Name:              "latency",
+					FailureLimit:      ptr.To(intstr.FromInt32(1)),
+					InconclusiveLimit: ptr.To(intstr.FromInt32(2)),
+					Provider: rolloutsapi.MetricProvider{
+						Prometheus: &rolloutsapi.PrometheusMetric{Query: "latency"},
+					},
+				},
+			},
+		},
+	}
+	original := template.DeepCopy()
+
+	ar, err := Build(
+		"default",
+		[]*rolloutsapi.AnalysisTemplate{template},
+		nil,
+		WithFailureLimit("error-rate", 3),
+		WithInconclusiveLimit("error-rate", 4),
+	)
+	require.NoError(t, err)
+	require.Len(t, ar.Spec.Metrics, 2)
+
+	assert.Equal(t, ptr.To(intstr.FromInt32(3)), ar.Spec.Metrics[0].FailureLimit)
+	assert.Equal(t, ptr.To(intstr.FromInt32(4)), ar.Spec.Metrics[0].InconclusiveLimit)
+	assert.Equal(t, original.Spec.Metrics[1], ar.Spec.Metrics[1])
+	assert.Equal(t, original, template, "template must not be modified")
+
+	t.Run("unknown metrics", func(t *testing.T) {
+		ar, err := Build(
+			"default",
+			[]*rolloutsapi.AnalysisTemplate{template},
+			nil,
+			WithFailureLimit("unknown1", 1),
+			WithInconclusiveLimit("unknown2", 1),
+		)
+		assert.ErrorContains(t, err, `failure limit metric "unknown1" does not exist`)
+		assert.ErrorContains(t, err, `inconclusive limit metric "unknown2" does not exist`)
+		assert.Nil(t, ar)
+	})
+}
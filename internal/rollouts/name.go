@@ -0,0 +1,256 @@
+package rollouts
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"k8s.io/apiserver/pkg/storage/names"
+)
+
+// ErrNameBudgetExhausted is returned when the maximum name length of the
+// options does not leave room for the ULID of the AnalysisRun name.
+var ErrNameBudgetExhausted = errors.New("name budget exhausted")
+
+// nameSeparators holds the separators which can be used between the name
+// prefix, ULID and suffix of an AnalysisRun, in the order in which they are
+// tried when looking for the ULID in a name.
+var nameSeparators = []string{defaultNameSeparator, "-"}
+
+// generateName creates a unique name for an AnalysisRun by combining the
+// prefix, a ULID, and an optional suffix and attempt number from the given
+// options. The prefix and suffix are truncated to fit within the name budget
+// of the options, and truncations are reported to the TruncationReporter of
+// the options. If an explicit name is set, it is returned instead. If the
+// name is generated by the API server, an empty name is returned.
+func generateName(opts *AnalysisRunOptions) (string, error) {
+	if opts.ExplicitName != "" {
+		return opts.ExplicitName, nil
+	}
+	if opts.GenerateName {
+		return "", nil
+	}
+
+	prefixMax, suffixMax, err := opts.nameBudget()
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+
+	prefix := truncateNamePrefix(opts.NamePrefix, prefixMax)
+	opts.reportTruncation("name prefix", opts.NamePrefix, prefix)
+	if prefix != "" {
+		parts = append(parts, prefix)
+	}
+
+	parts = append(parts, opts.newULID().String())
+
+	suffix := opts.NameSuffix
+	if baseMax := opts.nameSuffixBudget(suffixMax); len(suffix) > baseMax {
+		suffix = suffix[0:baseMax]
+	}
+	opts.reportTruncation("name suffix", opts.NameSuffix, suffix)
+	if opts.Attempt != nil {
+		attempt := formatAttempt(*opts.Attempt)
+		if len(attempt) > suffixMax {
+			return "", fmt.Errorf(
+				"attempt %q exceeds maximum name suffix length of %d characters",
+				attempt, suffixMax,
+			)
+		}
+		if suffix != "" {
+			attempt = suffix + "-" + attempt
+		}
+		suffix = attempt
+	}
+	if suffix != "" {
+		parts = append(parts, suffix)
+	}
+
+	return strings.ToLower(strings.Join(parts, opts.nameSeparator())), nil
+}
+
+// CreationTimeFromName returns the time encoded in the ULID portion of the
+// given AnalysisRun name, i.e. the time at which the name was generated, so
+// that AnalysisRuns can be sorted or filtered chronologically without reading
+// them. The name must consist of an optional prefix, the ULID and an optional
+// suffix separated by periods or hyphens, as generated by the builder. It
+// returns an error if the name does not have this structure, e.g. because it
+// was set using WithExplicitName or generated by the API server.
+func CreationTimeFromName(name string) (time.Time, error) {
+	_, id, ok := findNameULID(name)
+	if !ok {
+		return time.Time{}, fmt.Errorf("name %q does not contain a ULID", name)
+	}
+	return ulid.Time(id.Time()).UTC(), nil
+}
+
+// findNameULID returns the offset and value of the ULID in the given name
+// generated by generateName. As the name consists of an optional prefix, the
+// ULID and an optional suffix separated by periods, the ULID is either the
+// second or the first part of the name. If the name was generated with '-'
+// as separator, which may also occur in the prefix and suffix, the ULID is
+// the first part which is a ULID, not counting the first part unless no other
+// part is. It returns false if the name does not contain a ULID.
+func findNameULID(name string) (int, ulid.ULID, bool) {
+	for _, sep := range nameSeparators {
+		parts := strings.Split(name, sep)
+		candidates := []int{1, 0}
+		if sep != defaultNameSeparator {
+			candidates = make([]int, 0, len(parts))
+			for i := 1; i < len(parts); i++ {
+				candidates = append(candidates, i)
+			}
+			candidates = append(candidates, 0)
+		}
+		for _, i := range candidates {
+			if i >= len(parts) || len(parts[i]) != ulidLength {
+				continue
+			}
+			id, err := ulid.ParseStrict(parts[i])
+			if err != nil {
+				continue
+			}
+			offset := 0
+			for _, part := range parts[:i] {
+				offset += len(part) + len(sep)
+			}
+			return offset, id, true
+		}
+	}
+	return 0, ulid.ULID{}, false
+}
+
+// PreviewName returns the name an AnalysisRun built with the given options
+// would have, using the same assembly of prefix, ULID and suffix as the
+// builder. As the ULID differs between calls unless a fixed generator is
+// injected using WithULIDGenerator, the name of an AnalysisRun built later
+// may differ from the preview in the ULID portion only. It returns an empty
+// string if no name can be assembled from the options.
+func PreviewName(opts ...AnalysisRunOption) string {
+	name, err := generateName(NewAnalysisRunOptions(opts...))
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// nameBudget returns the maximum length of the name prefix and suffix, taking
+// into account the maximum name length and suffix length of the options. If
+// the options have neither a name suffix nor an attempt number, no budget is
+// reserved for the suffix, and the prefix may take its place. It returns an
+// error if the maximum name length does not leave room for the ULID, which
+// wraps ErrNameBudgetExhausted if the maximum name length is too short.
+func (o *AnalysisRunOptions) nameBudget() (prefixMax, suffixMax int, err error) {
+	maxLength := maxNameLength
+	if o.MaxNameLength != 0 {
+		maxLength = o.MaxNameLength
+	}
+	if maxLength > maxNameLength {
+		return 0, 0, fmt.Errorf(
+			"maximum name length %d must be between %d and %d characters to leave room for the ULID",
+			maxLength, ulidLength, maxNameLength,
+		)
+	}
+	if maxLength < ulidLength {
+		return 0, 0, fmt.Errorf(
+			"%w: maximum name length %d must be between %d and %d characters to leave room for the ULID",
+			ErrNameBudgetExhausted, maxLength, ulidLength, maxNameLength,
+		)
+	}
+
+	suffixLength := maxNameSuffixLength
+	if o.SuffixLength != 0 {
+		suffixLength = o.SuffixLength
+	}
+	if suffixLength < 0 {
+		return 0, 0, fmt.Errorf("name suffix length %d must not be negative", suffixLength)
+	}
+
+	// The suffix is given precedence over the prefix, as it typically
+	// contains an identifier which distinguishes AnalysisRuns. Every part
+	// next to the ULID is preceded or followed by a separator.
+	sepLength := len(o.nameSeparator())
+	suffixMax = max(min(suffixLength, maxLength-(sepLength+ulidLength)), 0)
+	if o.NameSuffix == "" && o.Attempt == nil {
+		suffixMax = 0
+	}
+	reserved := ulidLength
+	if suffixMax > 0 {
+		reserved += sepLength + suffixMax
+	}
+	prefixMax = max(maxLength-reserved-sepLength, 0)
+	return prefixMax, suffixMax, nil
+}
+
+// nameSeparator returns the separator between the name prefix, ULID and
+// suffix of the AnalysisRun.
+func (o *AnalysisRunOptions) nameSeparator() string {
+	if o.NameSeparator == "" {
+		return defaultNameSeparator
+	}
+	return o.NameSeparator
+}
+
+// generateNamePrefix returns the generateName of the AnalysisRun, i.e. the
+// name prefix followed by '-'.
+func (o *AnalysisRunOptions) generateNamePrefix() string {
+	return o.NamePrefix + "-"
+}
+
+// generateNameBudget returns the maximum length of the generateName of the
+// AnalysisRun, taking into account the maximum name length of the options and
+// the random suffix appended by the API server. Longer generateNames would be
+// truncated by the API server.
+func (o *AnalysisRunOptions) generateNameBudget() int {
+	maxLength := maxNameLength
+	if o.MaxNameLength != 0 {
+		maxLength = o.MaxNameLength
+	}
+	return max(min(maxLength-generatedNameRandomLength, names.MaxGeneratedNameLength), 0)
+}
+
+// nameSuffixBudget returns the maximum length of the name suffix of the
+// options within the given maximum suffix length, leaving room for the
+// attempt number and its separator, if any.
+func (o *AnalysisRunOptions) nameSuffixBudget(suffixMax int) int {
+	if o.Attempt == nil {
+		return suffixMax
+	}
+	return max(suffixMax-(1+len(formatAttempt(*o.Attempt))), 0)
+}
+
+// formatAttempt formats the given attempt number for use in a name suffix,
+// zero-padded to two digits.
+func formatAttempt(attempt int) string {
+	return fmt.Sprintf("%02d", attempt)
+}
+
+// newULID returns a new ULID using the ULIDGenerator of the options, or
+// ulid.Make if none is set.
+func (o *AnalysisRunOptions) newULID() ulid.ULID {
+	if o.ULIDGenerator != nil {
+		return o.ULIDGenerator()
+	}
+	return ulid.Make()
+}
+
+// contentHash returns a hash of the given inputs of maxNameSuffixLength
+// characters, suitable for use as a name suffix. Every input is prefixed with
+// its length before hashing, so that e.g. ("ab", "c") and ("a", "bc") result
+// in different hashes.
+func contentHash(inputs ...string) string {
+	h := sha256.New()
+	for _, input := range inputs {
+		_ = binary.Write(h, binary.BigEndian, uint64(len(input)))
+		_, _ = h.Write([]byte(input))
+	}
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(h.Sum(nil))
+	return strings.ToLower(encoded[:maxNameSuffixLength])
+}
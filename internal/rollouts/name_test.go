@@ -0,0 +1,817 @@
+package rollouts
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apiserver/pkg/storage/names"
+)
+
+func Test_generateName(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    []AnalysisRunOption
+		assertions func(*testing.T, string, error)
+	}{
+		{
+			name: "no prefix or suffix",
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.Len(t, result, ulidLength)
+			},
+		},
+		{
+			name: "with prefix",
+			options: []AnalysisRunOption{
+				WithNamePrefix("test"),
+			},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.True(t, strings.HasPrefix(result, "test."))
+				assert.Len(t, strings.Split(result, "."), 2)
+			},
+		},
+		{
+			name: "with suffix",
+			options: []AnalysisRunOption{
+				WithNameSuffix("suffix"),
+			},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.True(t, strings.HasSuffix(result, ".suffix"))
+				assert.Len(t, strings.Split(result, "."), 2)
+			},
+		},
+		{
+			name: "with prefix and suffix",
+			options: []AnalysisRunOption{
+				WithNamePrefix("test"),
+				WithNameSuffix("suffix"),
+			},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.True(t, strings.HasPrefix(result, "test."))
+				assert.True(t, strings.HasSuffix(result, ".suffix"))
+				assert.Len(t, strings.Split(result, "."), 3)
+			},
+		},
+		{
+			name: "maximum length prefix and suffix",
+			options: []AnalysisRunOption{
+				WithNamePrefix(stringWithLength(maxNameLength)),
+				WithNameSuffix(stringWithLength(maxNameLength)),
+			},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.Len(t, result, maxNameLength)
+			},
+		},
+		{
+			name: "explicit name",
+			options: []AnalysisRunOption{
+				WithExplicitName("explicit-name"),
+			},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "explicit-name", result)
+			},
+		},
+		{
+			name: "reduced maximum name length truncates prefix",
+			options: []AnalysisRunOption{
+				WithMaxNameLength(63),
+				WithNamePrefix(stringWithLength(100)),
+				WithNameSuffix("suffix1"),
+			},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.Len(t, result, 63)
+				parts := strings.Split(result, ".")
+				require.Len(t, parts, 3)
+				assert.Len(t, parts[0], 63-(1+ulidLength)-(1+maxNameSuffixLength))
+				assert.Equal(t, "suffix1", parts[2])
+			},
+		},
+		{
+			name: "reduced maximum name length without room for prefix",
+			options: []AnalysisRunOption{
+				WithMaxNameLength(ulidLength + 4),
+				WithNamePrefix("test"),
+				WithNameSuffix("suffix1"),
+			},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.Len(t, result, ulidLength+4)
+				parts := strings.Split(result, ".")
+				require.Len(t, parts, 2)
+				assert.Equal(t, "suf", parts[1])
+			},
+		},
+		{
+			name: "empty suffix leaves its budget to the prefix",
+			options: []AnalysisRunOption{
+				WithMaxNameLength(63),
+				WithNamePrefix(stringWithLength(63)),
+				WithNameSuffix(""),
+			},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.Len(t, result, 63)
+				assert.False(t, strings.HasSuffix(result, "."))
+				parts := strings.Split(result, ".")
+				require.Len(t, parts, 2)
+				assert.Len(t, parts[0], 63-(1+ulidLength))
+			},
+		},
+		{
+			name: "present suffix reserves its budget",
+			options: []AnalysisRunOption{
+				WithMaxNameLength(63),
+				WithNamePrefix(stringWithLength(63)),
+				WithNameSuffix("abc"),
+			},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.Len(t, result, 63-(maxNameSuffixLength-3))
+				parts := strings.Split(result, ".")
+				require.Len(t, parts, 3)
+				assert.Len(t, parts[0], 63-(1+ulidLength)-(1+maxNameSuffixLength))
+				assert.Equal(t, "abc", parts[2])
+			},
+		},
+		{
+			name: "longer suffix length keeps the suffix and shrinks the prefix",
+			options: []AnalysisRunOption{
+				WithNamePrefix(stringWithLength(maxNamePrefixLength)),
+				WithNameSuffix("abcdef123456"),
+				WithSuffixLength(12),
+			},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.Len(t, result, maxNameLength)
+				parts := strings.Split(result, ".")
+				require.Len(t, parts, 3)
+				assert.Len(t, parts[0], maxNamePrefixLength-5)
+				assert.Equal(t, "abcdef123456", parts[2])
+			},
+		},
+		{
+			name: "maximum name length equal to ULID length",
+			options: []AnalysisRunOption{
+				WithMaxNameLength(ulidLength),
+				WithNamePrefix("test"),
+				WithNameSuffix("suffix1"),
+			},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.Len(t, result, ulidLength)
+			},
+		},
+		{
+			name: "maximum name length too small for ULID",
+			options: []AnalysisRunOption{
+				WithMaxNameLength(ulidLength - 1),
+			},
+			assertions: func(t *testing.T, _ string, err error) {
+				assert.ErrorContains(t, err, "leave room for the ULID")
+				assert.ErrorIs(t, err, ErrNameBudgetExhausted)
+			},
+		},
+		{
+			name: "maximum name length exceeds Kubernetes limit",
+			options: []AnalysisRunOption{
+				WithMaxNameLength(maxNameLength + 1),
+			},
+			assertions: func(t *testing.T, _ string, err error) {
+				assert.ErrorContains(t, err, "leave room for the ULID")
+				assert.NotErrorIs(t, err, ErrNameBudgetExhausted)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &AnalysisRunOptions{}
+			opts.Apply(tt.options...)
+			result, err := generateName(opts)
+			tt.assertions(t, result, err)
+		})
+	}
+}
+
+func Test_nameBudget(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    []AnalysisRunOption
+		assertions func(t *testing.T, prefixMax, suffixMax int, err error)
+	}{
+		{
+			name: "defaults",
+			options: []AnalysisRunOption{
+				WithNameSuffix("abc"),
+			},
+			assertions: func(t *testing.T, prefixMax, suffixMax int, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, maxNamePrefixLength, prefixMax)
+				assert.Equal(t, maxNameSuffixLength, suffixMax)
+			},
+		},
+		{
+			name: "longer suffix shrinks the prefix",
+			options: []AnalysisRunOption{
+				WithNameSuffix("abc"),
+				WithSuffixLength(12),
+			},
+			assertions: func(t *testing.T, prefixMax, suffixMax int, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, 12, suffixMax)
+				assert.Equal(t, maxNamePrefixLength-5, prefixMax)
+				assert.Equal(t, maxNameLength, prefixMax+1+ulidLength+1+suffixMax)
+			},
+		},
+		{
+			name: "longer suffix with reduced maximum name length",
+			options: []AnalysisRunOption{
+				WithMaxNameLength(63),
+				WithNameSuffix("abc"),
+				WithSuffixLength(12),
+			},
+			assertions: func(t *testing.T, prefixMax, suffixMax int, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, 12, suffixMax)
+				assert.Equal(t, 63-(1+ulidLength)-(1+12), prefixMax)
+			},
+		},
+		{
+			name: "suffix filling the budget leaves no room for the prefix",
+			options: []AnalysisRunOption{
+				WithMaxNameLength(63),
+				WithNameSuffix("abc"),
+				WithSuffixLength(63 - (1 + ulidLength)),
+			},
+			assertions: func(t *testing.T, prefixMax, suffixMax int, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, 63-(1+ulidLength), suffixMax)
+				assert.Zero(t, prefixMax)
+			},
+		},
+		{
+			name: "suffix exceeding the budget is clamped",
+			options: []AnalysisRunOption{
+				WithNameSuffix("abc"),
+				WithSuffixLength(maxNameLength),
+			},
+			assertions: func(t *testing.T, prefixMax, suffixMax int, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, maxNameLength-(1+ulidLength), suffixMax)
+				assert.Zero(t, prefixMax)
+			},
+		},
+		{
+			name: "no suffix leaves its budget to the prefix",
+			assertions: func(t *testing.T, prefixMax, suffixMax int, err error) {
+				require.NoError(t, err)
+				assert.Zero(t, suffixMax)
+				assert.Equal(t, maxUnsuffixedNamePrefixLength, prefixMax)
+			},
+		},
+		{
+			name: "attempt reserves the suffix budget",
+			options: []AnalysisRunOption{
+				WithAttempt(1),
+			},
+			assertions: func(t *testing.T, prefixMax, suffixMax int, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, maxNameSuffixLength, suffixMax)
+				assert.Equal(t, maxNamePrefixLength, prefixMax)
+			},
+		},
+		{
+			name: "negative suffix length",
+			options: []AnalysisRunOption{
+				WithSuffixLength(-1),
+			},
+			assertions: func(t *testing.T, _, _ int, err error) {
+				assert.ErrorContains(t, err, "must not be negative")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewAnalysisRunOptions(tt.options...)
+			prefixMax, suffixMax, err := opts.nameBudget()
+			tt.assertions(t, prefixMax, suffixMax, err)
+		})
+	}
+}
+
+func Test_generateNameBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  []AnalysisRunOption
+		expected int
+	}{
+		{
+			name:     "defaults",
+			expected: names.MaxGeneratedNameLength,
+		},
+		{
+			name:     "maximum name length leaving room for the random suffix",
+			options:  []AnalysisRunOption{WithMaxNameLength(40)},
+			expected: 40 - generatedNameRandomLength,
+		},
+		{
+			name:     "maximum name length above the generated name limit",
+			options:  []AnalysisRunOption{WithMaxNameLength(100)},
+			expected: names.MaxGeneratedNameLength,
+		},
+		{
+			name:     "maximum name length shorter than the random suffix",
+			options:  []AnalysisRunOption{WithMaxNameLength(3)},
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NewAnalysisRunOptions(tt.options...).generateNameBudget())
+		})
+	}
+}
+
+func Test_generateName_generateName(t *testing.T) {
+	opts := NewAnalysisRunOptions(
+		WithNamePrefix("stage"),
+		WithNameSuffix("abc1234"),
+		WithAttempt(1),
+		WithGenerateName(),
+	)
+	name, err := generateName(opts)
+	require.NoError(t, err)
+	assert.Empty(t, name)
+	assert.Equal(t, "stage-", opts.generateNamePrefix())
+}
+
+func Test_generateName_truncationReporter(t *testing.T) {
+	type report struct {
+		field, original, truncated string
+	}
+
+	longPrefix := stringWithLength(maxNamePrefixLength + 10)
+
+	tests := []struct {
+		name       string
+		options    []AnalysisRunOption
+		assertions func(*testing.T, []report)
+	}{
+		{
+			name: "no truncation",
+			options: []AnalysisRunOption{
+				WithNamePrefix("prefix"),
+				WithNameSuffix("suffix"),
+			},
+			assertions: func(t *testing.T, reports []report) {
+				assert.Empty(t, reports)
+			},
+		},
+		{
+			name: "truncated prefix",
+			options: []AnalysisRunOption{
+				WithNamePrefix(longPrefix),
+			},
+			assertions: func(t *testing.T, reports []report) {
+				assert.Equal(t, []report{
+					{"name prefix", longPrefix, longPrefix[:maxUnsuffixedNamePrefixLength]},
+				}, reports)
+			},
+		},
+		{
+			name: "truncated suffix",
+			options: []AnalysisRunOption{
+				WithNameSuffix("abcdef123456"),
+			},
+			assertions: func(t *testing.T, reports []report) {
+				assert.Equal(t, []report{
+					{"name suffix", "abcdef123456", "abcdef1"},
+				}, reports)
+			},
+		},
+		{
+			name: "truncated prefix overridden by short prefix",
+			options: []AnalysisRunOption{
+				WithNamePrefix(stringWithLength(300)),
+				WithNamePrefix("short"),
+			},
+			assertions: func(t *testing.T, reports []report) {
+				assert.Empty(t, reports)
+			},
+		},
+		{
+			name: "truncated to reduced maximum name length",
+			options: []AnalysisRunOption{
+				WithMaxNameLength(63),
+				WithNamePrefix(longPrefix),
+				WithNameSuffix("abc"),
+			},
+			assertions: func(t *testing.T, reports []report) {
+				assert.Equal(t, []report{
+					{"name prefix", longPrefix, longPrefix[:63-(1+ulidLength)-(1+maxNameSuffixLength)]},
+				}, reports)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reports []report
+			opts := NewAnalysisRunOptions(append(
+				tt.options,
+				WithTruncationReporter(func(field, original, truncated string) {
+					reports = append(reports, report{field, original, truncated})
+				}),
+			)...)
+			_, err := generateName(opts)
+			require.NoError(t, err)
+			tt.assertions(t, reports)
+		})
+	}
+}
+
+func Test_generateName_attempt(t *testing.T) {
+	id := ulid.MustParse("01HRZ6K7ZW0000000000000000")
+	fixedULID := WithULIDGenerator(func() ulid.ULID { return id })
+	hash := contentHash("template", "freight")
+
+	var names []string
+	for _, attempt := range []int{0, 9, 99} {
+		t.Run(fmt.Sprintf("attempt %d", attempt), func(t *testing.T) {
+			name, err := generateName(NewAnalysisRunOptions(
+				WithNamePrefix(stringWithLength(maxNamePrefixLength)),
+				WithContentHashSuffix("template", "freight"),
+				WithAttempt(attempt),
+				fixedULID,
+			))
+			require.NoError(t, err)
+			assert.Len(t, name, maxNameLength)
+			assert.Empty(t, validation.IsDNS1123Subdomain(name))
+
+			parts := strings.Split(name, ".")
+			require.Len(t, parts, 3)
+			assert.Equal(t, fmt.Sprintf("%s-%02d", hash[:maxNameSuffixLength-3], attempt), parts[2])
+			names = append(names, name)
+		})
+	}
+	assert.True(t, slices.IsSorted(names))
+
+	t.Run("without name suffix", func(t *testing.T) {
+		name, err := generateName(NewAnalysisRunOptions(WithNamePrefix("prefix"), WithAttempt(3), fixedULID))
+		require.NoError(t, err)
+		assert.Equal(t, "prefix."+strings.ToLower(id.String())+".03", name)
+	})
+
+	t.Run("longer suffix length keeps the name suffix", func(t *testing.T) {
+		name, err := generateName(NewAnalysisRunOptions(
+			WithContentHashSuffix("template", "freight"),
+			WithSuffixLength(maxNameSuffixLength+3),
+			WithAttempt(1),
+			fixedULID,
+		))
+		require.NoError(t, err)
+		assert.Equal(t, strings.ToLower(id.String())+"."+hash+"-01", name)
+	})
+
+	t.Run("no room for attempt", func(t *testing.T) {
+		_, err := generateName(NewAnalysisRunOptions(WithSuffixLength(1), WithAttempt(1)))
+		assert.ErrorContains(t, err, `attempt "01" exceeds maximum name suffix length of 1 characters`)
+	})
+}
+
+func Test_generateName_promotion(t *testing.T) {
+	id := ulid.MustParse("01HRZ6K7ZW0000000000000000")
+	fixedULID := WithULIDGenerator(func() ulid.ULID { return id })
+
+	t.Run("suffix is stable for the same promotion", func(t *testing.T) {
+		name1, err := generateName(NewAnalysisRunOptions(WithPromotion("promotion"), fixedULID))
+		require.NoError(t, err)
+		name2, err := generateName(NewAnalysisRunOptions(WithPromotion("promotion"), fixedULID))
+		require.NoError(t, err)
+		assert.Equal(t, name1, name2)
+		assert.Equal(t, strings.ToLower(id.String())+"."+contentHash("promotion"), name1)
+	})
+
+	t.Run("suffix differs between promotions", func(t *testing.T) {
+		name1, err := generateName(NewAnalysisRunOptions(WithPromotion("promotion"), fixedULID))
+		require.NoError(t, err)
+		name2, err := generateName(NewAnalysisRunOptions(WithPromotion("other-promotion"), fixedULID))
+		require.NoError(t, err)
+		assert.NotEqual(t, name1, name2)
+	})
+
+	t.Run("last suffix option takes precedence", func(t *testing.T) {
+		opts := NewAnalysisRunOptions(
+			WithPromotion("promotion"),
+			WithContentHashSuffix("template", "freight"),
+		)
+		assert.Equal(t, contentHash("template", "freight"), opts.NameSuffix)
+		assert.Equal(t, "promotion", opts.labels()[PromotionLabelKey])
+
+		opts = NewAnalysisRunOptions(
+			WithContentHashSuffix("template", "freight"),
+			WithPromotion("promotion"),
+		)
+		assert.Equal(t, contentHash("promotion"), opts.NameSuffix)
+	})
+}
+
+func Test_generateName_separator(t *testing.T) {
+	id := ulid.MustParse("01HRZ6K7ZW0000000000000000")
+	lowerID := strings.ToLower(id.String())
+
+	tests := []struct {
+		name       string
+		options    []AnalysisRunOption
+		assertions func(*testing.T, string, error)
+	}{
+		{
+			name:    "default",
+			options: []AnalysisRunOption{WithNamePrefix("my-stage"), WithNameSuffix("abc1234")},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "my-stage."+lowerID+".abc1234", result)
+			},
+		},
+		{
+			name: "period",
+			options: []AnalysisRunOption{
+				WithNamePrefix("my-stage"),
+				WithNameSuffix("abc1234"),
+				WithNameSeparator("."),
+			},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "my-stage."+lowerID+".abc1234", result)
+			},
+		},
+		{
+			name: "hyphen",
+			options: []AnalysisRunOption{
+				WithNamePrefix("my-stage"),
+				WithNameSuffix("abc1234"),
+				WithAttempt(2),
+				WithNameSeparator("-"),
+			},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "my-stage-"+lowerID+"-abc1-02", result)
+
+				created, err := CreationTimeFromName(result)
+				require.NoError(t, err)
+				assert.Equal(t, ulid.Time(id.Time()).UTC(), created)
+
+				replaced, ok := replaceNameULID(result, ulid.ULID{})
+				require.True(t, ok)
+				assert.Equal(t, "my-stage-"+strings.Repeat("0", ulidLength)+"-abc1-02", replaced)
+			},
+		},
+		{
+			name: "hyphen without prefix",
+			options: []AnalysisRunOption{
+				WithNameSuffix("abc1234"),
+				WithNameSeparator("-"),
+			},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, lowerID+"-abc1234", result)
+
+				replaced, ok := replaceNameULID(result, ulid.ULID{})
+				require.True(t, ok)
+				assert.Equal(t, strings.Repeat("0", ulidLength)+"-abc1234", replaced)
+			},
+		},
+		{
+			name: "hyphen within budget",
+			options: []AnalysisRunOption{
+				WithNamePrefix(strings.Repeat("a", maxNameLength)),
+				WithNameSuffix(strings.Repeat("b", maxNameSuffixLength)),
+				WithNameSeparator("-"),
+			},
+			assertions: func(t *testing.T, result string, err error) {
+				require.NoError(t, err)
+				assert.Len(t, result, maxNameLength)
+				assert.True(t, strings.HasSuffix(result, "-"+lowerID+"-"+strings.Repeat("b", maxNameSuffixLength)))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewAnalysisRunOptions(append(
+				[]AnalysisRunOption{WithULIDGenerator(func() ulid.ULID { return id })},
+				tt.options...,
+			)...)
+			require.NoError(t, opts.Validate())
+			result, err := generateName(opts)
+			tt.assertions(t, result, err)
+		})
+	}
+
+	t.Run("invalid separator", func(t *testing.T) {
+		for _, sep := range []string{"_", "--", "/", " "} {
+			_, err := Build("default", nil, nil, WithNameSeparator(sep))
+			assert.ErrorContains(t, err, fmt.Sprintf("name separator %q must be one of", sep))
+		}
+	})
+}
+
+func Test_generateName_ULIDGenerator(t *testing.T) {
+	t.Run("fixed generator produces identical names", func(t *testing.T) {
+		id := ulid.MustParse("01HRZ6K7ZW0000000000000000")
+		opts := NewAnalysisRunOptions(
+			WithNamePrefix("prefix"),
+			WithNameSuffix("suffix"),
+			WithULIDGenerator(func() ulid.ULID { return id }),
+		)
+
+		name1, err := generateName(opts)
+		require.NoError(t, err)
+		name2, err := generateName(opts)
+		require.NoError(t, err)
+
+		assert.Equal(t, name1, name2)
+		assert.Equal(t, "prefix."+strings.ToLower(id.String())+".suffix", name1)
+	})
+
+	t.Run("default generator produces unique sortable names", func(t *testing.T) {
+		opts := NewAnalysisRunOptions(WithNamePrefix("prefix"))
+
+		names := make([]string, 100)
+		for i := range names {
+			name, err := generateName(opts)
+			require.NoError(t, err)
+			names[i] = name
+		}
+
+		assert.True(t, slices.IsSorted(names))
+		assert.Len(t, slices.Compact(slices.Clone(names)), len(names))
+	})
+}
+
+func Test_contentHash(t *testing.T) {
+	t.Run("identical inputs produce identical hashes", func(t *testing.T) {
+		assert.Equal(t,
+			contentHash("template", "arg=value", "freight"),
+			contentHash("template", "arg=value", "freight"),
+		)
+	})
+
+	t.Run("different inputs diverge", func(t *testing.T) {
+		base := contentHash("template", "arg=value", "freight")
+		assert.NotEqual(t, base, contentHash("template", "arg=other", "freight"))
+		assert.NotEqual(t, base, contentHash("freight", "arg=value", "template"))
+		assert.NotEqual(t, base, contentHash("template", "arg=value"))
+		assert.NotEqual(t, contentHash("ab", "c"), contentHash("a", "bc"))
+	})
+
+	t.Run("hash is a valid name suffix", func(t *testing.T) {
+		hash := contentHash("template", "arg=value", "freight")
+		assert.Len(t, hash, maxNameSuffixLength)
+		assert.Regexp(t, "^[a-z2-7]+$", hash)
+	})
+}
+
+func TestPreviewName(t *testing.T) {
+	id := ulid.MustParse("01HRZ6K7ZW0000000000000000")
+	generator := WithULIDGenerator(func() ulid.ULID { return id })
+
+	t.Run("matches built name", func(t *testing.T) {
+		opts := []AnalysisRunOption{
+			generator,
+			WithNamePrefix("Stage"),
+			WithNameSuffix("abcdef12345"),
+		}
+
+		preview := PreviewName(opts...)
+		assert.Equal(t, "stage.01hrz6k7zw0000000000000000.abcdef1", preview)
+
+		ar, err := Build("default", nil, nil, opts...)
+		require.NoError(t, err)
+		assert.Equal(t, preview, ar.Name)
+	})
+
+	t.Run("differs only in ULID without fixed generator", func(t *testing.T) {
+		preview := strings.Split(PreviewName(WithNamePrefix("stage"), WithNameSuffix("abc")), ".")
+		built := strings.Split(PreviewName(WithNamePrefix("stage"), WithNameSuffix("abc")), ".")
+		require.Len(t, preview, 3)
+		require.Len(t, built, 3)
+		assert.Equal(t, preview[0], built[0])
+		assert.NotEqual(t, preview[1], built[1])
+		assert.Equal(t, preview[2], built[2])
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		assert.Empty(t, PreviewName(WithMaxNameLength(10)))
+	})
+}
+
+func TestCreationTimeFromName(t *testing.T) {
+	createdAt := time.Date(2024, 3, 14, 15, 9, 26, 535000000, time.UTC)
+	id := strings.ToLower(ulid.MustNew(ulid.Timestamp(createdAt), nil).String())
+
+	tests := []struct {
+		name       string
+		input      string
+		assertions func(*testing.T, time.Time, error)
+	}{
+		{
+			name:  "prefix and ULID",
+			input: "stage." + id,
+			assertions: func(t *testing.T, result time.Time, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, createdAt, result)
+			},
+		},
+		{
+			name:  "ULID only",
+			input: id,
+			assertions: func(t *testing.T, result time.Time, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, createdAt, result)
+			},
+		},
+		{
+			name:  "custom suffix",
+			input: "stage." + id + ".abcdef1-02",
+			assertions: func(t *testing.T, result time.Time, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, createdAt, result)
+			},
+		},
+		{
+			name:  "ULID and suffix without prefix",
+			input: id + ".abcdef1",
+			assertions: func(t *testing.T, result time.Time, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, createdAt, result)
+			},
+		},
+		{
+			name: "generated by the builder",
+			input: PreviewName(
+				WithNamePrefix("stage"),
+				WithNameSuffix("abcdef1"),
+				WithULIDGenerator(func() ulid.ULID { return ulid.MustParse(id) }),
+			),
+			assertions: func(t *testing.T, result time.Time, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, createdAt, result)
+			},
+		},
+		{
+			name:  "no ULID",
+			input: "stage.abcdef1",
+			assertions: func(t *testing.T, _ time.Time, err error) {
+				assert.ErrorContains(t, err, `name "stage.abcdef1" does not contain a ULID`)
+			},
+		},
+		{
+			name:  "invalid ULID",
+			input: "stage." + strings.Repeat("u", ulidLength),
+			assertions: func(t *testing.T, _ time.Time, err error) {
+				assert.ErrorContains(t, err, "does not contain a ULID")
+			},
+		},
+		{
+			name: "suffix with periods",
+			input: PreviewName(
+				WithNamePrefix("stage"),
+				WithNameSuffix("v1.2"),
+				WithULIDGenerator(func() ulid.ULID { return ulid.MustParse(id) }),
+			),
+			assertions: func(t *testing.T, result time.Time, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, createdAt, result)
+			},
+		},
+		{
+			name: "empty name",
+			assertions: func(t *testing.T, _ time.Time, err error) {
+				assert.ErrorContains(t, err, "does not contain a ULID")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := CreationTimeFromName(tt.input)
+			tt.assertions(t, result, err)
+		})
+	}
+}
@@ -1,44 +1,347 @@
 package rollouts
 
 import (
+	"cmp"
+	"errors"
+	"fmt"
 	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
 
+	"github.com/go-logr/logr"
+	"github.com/oklog/ulid/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+	"github.com/akuity/kargo/internal/logging"
 )
 
 const (
+	// maxNameLength is the maximum length of the name field of an AnalysisRun.
+	maxNameLength = 253
 	// ulidLength is the length of a ulid.ULID string.
 	ulidLength = 26
-	// maxNameSuffixLength is the maximum length of the name suffix for an
-	// AnalysisRun. It assumes that the suffix contains e.g. a SHA and can
-	// be truncated to a smaller length than the maxNamePrefixLength.
+	// maxNameSuffixLength is the default maximum length of the name suffix
+	// for an AnalysisRun. It assumes that the suffix contains e.g. a SHA and
+	// can be truncated to a smaller length than the maxNamePrefixLength. It
+	// can be changed using WithSuffixLength.
 	maxNameSuffixLength = 7
 	// maxNamePrefixLength is the maximum length of the name prefix for an
-	// AnalysisRun. It takes into account the maximum length of the name
-	// field (253 characters), and the additional characters that will be
-	// appended to the name (ULID, SHA, and period separators).
-	maxNamePrefixLength = 253 - (1 + ulidLength) - (1 + maxNameSuffixLength)
+	// AnalysisRun with a name suffix. It takes into account the maximum
+	// length of the name field (253 characters), and the additional
+	// characters that will be appended to the name (ULID, SHA, and period
+	// separators).
+	maxNamePrefixLength = maxNameLength - (1 + ulidLength) - (1 + maxNameSuffixLength)
+	// maxUnsuffixedNamePrefixLength is the maximum length of the name prefix
+	// for an AnalysisRun without a name suffix, which only leaves room for the
+	// ULID and its period separator.
+	maxUnsuffixedNamePrefixLength = maxNameLength - (1 + ulidLength)
+	// defaultNameSeparator is the separator between the name prefix, ULID and
+	// suffix of an AnalysisRun, unless changed using WithNameSeparator.
+	defaultNameSeparator = "."
+	// generatedNameRandomLength is the length of the random suffix the API
+	// server appends to the generateName of an object.
+	generatedNameRandomLength = 5
 )
 
+// discardLogger is the logger used if no logger is set using WithLogger.
+var discardLogger = logging.Wrap(logr.Discard())
+
 // AnalysisRunOption is an option for configuring the build of an AnalysisRun.
 type AnalysisRunOption interface {
 	ApplyToAnalysisRun(*AnalysisRunOptions)
 }
 
+// LabelConflictPolicy determines how conflicting values of the same label
+// are handled.
+type LabelConflictPolicy string
+
+const (
+	// LabelConflictPolicyOverwrite resolves conflicting values of the same
+	// label silently: later extra labels overwrite earlier ones, and the
+	// labels derived from dedicated options overwrite the extra labels. It is
+	// the default.
+	LabelConflictPolicyOverwrite LabelConflictPolicy = "Overwrite"
+	// LabelConflictPolicyError causes the build of the AnalysisRun to fail if
+	// the same label is set to different values.
+	LabelConflictPolicyError LabelConflictPolicy = "Error"
+)
+
+// BaselinePolicy determines how a baseline AnalysisRun without successful
+// measurements is handled.
+type BaselinePolicy string
+
+const (
+	// BaselinePolicyRequire causes the build of the AnalysisRun to fail if
+	// the baseline AnalysisRun is missing or has no successful measurements.
+	// It is the default.
+	BaselinePolicyRequire BaselinePolicy = "Require"
+	// BaselinePolicySkip builds the AnalysisRun without baseline arguments if
+	// the baseline AnalysisRun is missing or has no successful measurements,
+	// e.g. for the first verification of a Stage. The AnalysisTemplates are
+	// then expected to provide default values for the baseline arguments.
+	BaselinePolicySkip BaselinePolicy = "Skip"
+)
+
+// AnalysisRunOptionFunc is a function that implements AnalysisRunOption. It
+// can be used to define options inline without declaring a new type.
+type AnalysisRunOptionFunc func(*AnalysisRunOptions)
+
+func (f AnalysisRunOptionFunc) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	f(opts)
+}
+
 // AnalysisRunOptions holds the options for building an AnalysisRun.
 type AnalysisRunOptions struct {
-	NamePrefix  string
-	NameSuffix  string
-	ExtraLabels map[string]string
-	Owners      []Owner
+	NamePrefix       string
+	NameSuffix       string
+	ExtraLabels      map[string]string
+	ExtraAnnotations map[string]string
+	Owners           []Owner
+	// LabelConflictPolicy determines how conflicting values of the same label
+	// are handled. If empty, LabelConflictPolicyOverwrite is used.
+	LabelConflictPolicy LabelConflictPolicy
+	// BaselinePolicy determines how a baseline AnalysisRun without successful
+	// measurements is handled. If empty, BaselinePolicyRequire is used.
+	BaselinePolicy BaselinePolicy
+	// ExplicitName is the exact name of the AnalysisRun. If set, no name is
+	// generated from the name prefix, ULID and suffix.
+	ExplicitName string
+	// GenerateName makes the API server generate the name of the AnalysisRun
+	// from the name prefix, instead of generating it from the name prefix,
+	// ULID and suffix.
+	GenerateName bool
+	// Deadline is the duration after the creation of the AnalysisRun at which
+	// it should be terminated. If zero, the AnalysisRun has no deadline.
+	Deadline time.Duration
+	// MaxRunDuration is the duration after the start of the AnalysisRun at
+	// which it is considered stuck if it is still running. If zero, it is
+	// never considered stuck.
+	MaxRunDuration time.Duration
+	// ConcurrencyLimit is the maximum number of concurrent AnalysisRuns of the
+	// Stage intended by the caller, for use by CanStart. If zero, the number
+	// is not limited.
+	ConcurrencyLimit int
+	// Ephemeral marks the AnalysisRun for deletion as soon as it completed,
+	// regardless of the RetentionPolicy used by SelectForDeletion.
+	Ephemeral bool
+	// Finalizers holds the finalizers to set on the AnalysisRun.
+	Finalizers []string
+	// ExcludedLabelPrefixes holds the prefixes of the keys of extra labels
+	// which should not be set on the AnalysisRun.
+	ExcludedLabelPrefixes []string
+	// ProtectedLabelKeys holds the keys of the labels which cannot be
+	// overridden once set by a dedicated option, in addition to the project,
+	// Stage and shard labels, which are always protected.
+	ProtectedLabelKeys []string
+	// Namespace is the namespace of the AnalysisRun. If empty, the namespace
+	// passed to the builder is used.
+	Namespace string
+	// Project is the name of the Project the AnalysisRun belongs to.
+	Project string
+	// Stage is the name of the Stage the AnalysisRun verifies.
+	Stage string
+	// Freight is the name of the Freight the AnalysisRun verifies.
+	Freight string
+	// Warehouse is the name of the Warehouse the Freight originates from.
+	Warehouse string
+	// ArgsFreight is the Freight whose fields argument values can reference,
+	// e.g. ${freight.images["<repoURL>"].tag}. If nil, argument values are
+	// used as-is.
+	ArgsFreight *kargoapi.Freight
+	// Shard is the name of the shard of the controller responsible for the
+	// AnalysisRun. If empty, the AnalysisRun belongs to the default shard.
+	Shard string
+	// TargetCluster is the name of the cluster the verification targets, e.g.
+	// in multi-cluster setups. Contrary to the shard, it does not affect
+	// which controller instance reconciles the AnalysisRun.
+	TargetCluster string
+	// GitRepoURL is the URL of the Git repository whose revision the
+	// AnalysisRun verifies.
+	GitRepoURL string
+	// GitCommit is the ID of the commit the AnalysisRun verifies.
+	GitCommit string
+	// ControllerVersion is the version of the Kargo controller which built
+	// the AnalysisRun. If empty, no version is stamped on the AnalysisRun.
+	ControllerVersion string
+	// Description is the human-readable description of the AnalysisRun. If
+	// empty, no description is set on the AnalysisRun.
+	Description string
+	// Templates holds the names of the AnalysisTemplates to build the
+	// AnalysisRun from, in addition to the AnalysisTemplates referenced by
+	// the verification configuration.
+	Templates []string
+	// VerificationID is the ID shared by all attempts of the same
+	// verification.
+	VerificationID string
+	// CorrelationID is the ID correlating the AnalysisRun with e.g. the trace
+	// of the promotion it originates from.
+	CorrelationID string
+	// Promotion is the name of the Promotion which triggered the
+	// verification.
+	Promotion string
+	// ClusterTemplates holds the names of the ClusterAnalysisTemplates to
+	// build the AnalysisRun from, in addition to any namespaced
+	// AnalysisTemplates.
+	ClusterTemplates []string
+	// Args holds argument values for the arguments declared by the
+	// AnalysisTemplates. They take precedence over the arguments of the
+	// verification configuration.
+	Args map[string]string
+	// AllowedArgs holds the names of the arguments which may be set by the
+	// verification configuration and the options. If nil, all arguments may
+	// be set. If empty but not nil, no argument may be set.
+	AllowedArgs []string
+	// InlineMetrics holds metrics which are added to the AnalysisRun in
+	// addition to the metrics of the templates.
+	InlineMetrics []rolloutsapi.Metric
+	// DryRunMetrics holds the names of the metrics which should be evaluated
+	// in dry-run mode. The name "*" selects all metrics.
+	DryRunMetrics []string
+	// MeasurementRetention holds the number of measurements to retain per
+	// metric name.
+	MeasurementRetention map[string]int32
+	// FailureLimits holds the maximum number of failed measurements per
+	// metric name, overriding the limits declared by the templates.
+	FailureLimits map[string]int32
+	// InconclusiveLimits holds the maximum number of inconclusive
+	// measurements per metric name, overriding the limits declared by the
+	// templates.
+	InconclusiveLimits map[string]int32
+	// JobPriorityClassName is the name of the PriorityClass of the Pods of
+	// the Jobs spawned by Job metrics. If empty, the PriorityClass of the
+	// Job templates is kept.
+	JobPriorityClassName string
+	// JobServiceAccountName is the name of the ServiceAccount of the Pods of
+	// the Jobs spawned by Job metrics. If empty, the ServiceAccount of the
+	// Job templates is kept.
+	JobServiceAccountName string
+	// JobNodeSelector holds the node selector of the Pods of the Jobs spawned
+	// by Job metrics, merged into the node selector of the Job templates.
+	JobNodeSelector map[string]string
+	// JobTolerations holds the tolerations of the Pods of the Jobs spawned by
+	// Job metrics, added to the tolerations of the Job templates.
+	JobTolerations []corev1.Toleration
+	// ProviderTimeout is the timeout of the metric providers supporting one,
+	// applied to the metrics which do not specify a timeout. If zero, the
+	// timeouts of the metrics are kept.
+	ProviderTimeout time.Duration
+	// Logger receives debug logs of the stages of the build. If nil, nothing
+	// is logged.
+	Logger *logging.Logger
+	// ULIDGenerator generates the ULID which is included in the name of the
+	// AnalysisRun. If nil, ulid.Make is used, which generates monotonically
+	// increasing ULIDs.
+	ULIDGenerator func() ulid.ULID
+	// TruncationReporter is called when the name prefix or suffix of the
+	// AnalysisRun is truncated to fit within its maximum length. If nil,
+	// truncations are not reported.
+	TruncationReporter func(field, original, truncated string)
+	// MaxNameLength is the maximum length of the name of the AnalysisRun. If
+	// zero, the Kubernetes maximum of 253 characters is used.
+	MaxNameLength int
+	// SuffixLength is the maximum length of the name suffix of the
+	// AnalysisRun. If zero, maxNameSuffixLength is used.
+	SuffixLength int
+	// NameSeparator is the separator between the name prefix, ULID and suffix
+	// of the AnalysisRun, either '.' or '-'. If empty, '.' is used.
+	NameSeparator string
+	// Attempt is the attempt number of the verification to encode in the
+	// name suffix of the AnalysisRun. If nil, no attempt number is encoded.
+	Attempt *int
+	// StrictNaming causes Validate to return an error when the name prefix or
+	// suffix had to be truncated, instead of silently truncating them.
+	StrictNaming bool
+	// ValidateArgReferences causes the build of the AnalysisRun to fail when
+	// a metric references an argument which is not supplied.
+	ValidateArgReferences bool
+
+	// verificationAttempt is the attempt number of the verification, as
+	// determined by the builder.
+	verificationAttempt int
+
+	// argsConfigMaps references the ConfigMaps holding argument values, as
+	// resolved by the builder.
+	argsConfigMaps []argsConfigMap
+
+	// errs holds errors which occurred while applying the options. They are
+	// returned by Validate.
+	errs []error
+
+	// labelConflicts records the extra labels which were overwritten with a
+	// different value.
+	labelConflicts []labelConflict
+
+	// baselineArgs holds the arguments derived from the baseline AnalysisRun.
+	// They are kept apart from Args, as only those declared by the templates
+	// are set.
+	baselineArgs map[string]string
+
+	// baselineErr holds the reason why no baseline arguments could be derived
+	// from the baseline AnalysisRun. It is returned by Validate, unless the
+	// baseline policy is BaselinePolicySkip.
+	baselineErr error
+
+	// truncations records the name parts which had to be truncated while
+	// applying the options.
+	truncations []truncation
+}
+
+// truncation describes a name part which was truncated to fit within its
+// maximum length.
+type truncation struct {
+	path      *field.Path
+	field     string
+	original  string
+	truncated string
+	maxLength int
 }
 
-// Owner represents a reference to an owner object.
+// Owner represents a reference to an owner object. An owner without a
+// namespace in its Reference is cluster-scoped, and can own an AnalysisRun in
+// any namespace, while a namespaced owner must be in the namespace of the
+// AnalysisRun.
 type Owner struct {
 	APIVersion    string
 	Kind          string
 	Reference     types.NamespacedName
 	BlockDeletion bool
+	// Controller indicates whether the owner is the managing controller of
+	// the AnalysisRun. At most one owner can be marked as controller.
+	Controller bool
+	// UID is the UID of the owner object. If set, it is included in the owner
+	// reference, so the AnalysisRun is garbage collected once the object is
+	// deleted, even if another object with the same name is created
+	// afterwards. If empty, it is omitted.
+	UID types.UID
+}
+
+// String returns a human-readable representation of the Owner.
+func (o Owner) String() string {
+	if o.Reference.Namespace == "" {
+		return fmt.Sprintf("%s %q", o.Kind, o.Reference.Name)
+	}
+	return fmt.Sprintf("%s %q in namespace %q", o.Kind, o.Reference.Name, o.Reference.Namespace)
+}
+
+// NewAnalysisRunOptions returns new AnalysisRunOptions with the given options
+// applied.
+func NewAnalysisRunOptions(opts ...AnalysisRunOption) *AnalysisRunOptions {
+	o := &AnalysisRunOptions{}
+	o.Apply(opts...)
+	return o
 }
 
 // Apply applies the given options to the AnalysisRunOptions.
@@ -48,46 +351,1295 @@ func (o *AnalysisRunOptions) Apply(opts ...AnalysisRunOption) {
 	}
 }
 
-// WithNamePrefix sets the name prefix for the AnalysisRun. If it is longer
-// than maxNamePrefixLength, it will be truncated.
+// DeepCopy returns a deep copy of the AnalysisRunOptions, which can be
+// safely modified (e.g. by applying more options) without affecting the
+// original.
+func (o *AnalysisRunOptions) DeepCopy() *AnalysisRunOptions {
+	if o == nil {
+		return nil
+	}
+	out := *o
+	out.ExtraLabels = maps.Clone(o.ExtraLabels)
+	out.ExtraAnnotations = maps.Clone(o.ExtraAnnotations)
+	out.Args = maps.Clone(o.Args)
+	out.baselineArgs = maps.Clone(o.baselineArgs)
+	out.AllowedArgs = slices.Clone(o.AllowedArgs)
+	out.ArgsFreight = o.ArgsFreight.DeepCopy()
+	if o.Attempt != nil {
+		out.Attempt = ptr.To(*o.Attempt)
+	}
+	if o.InlineMetrics != nil {
+		out.InlineMetrics = make([]rolloutsapi.Metric, len(o.InlineMetrics))
+		for i := range o.InlineMetrics {
+			o.InlineMetrics[i].DeepCopyInto(&out.InlineMetrics[i])
+		}
+	}
+	out.DryRunMetrics = slices.Clone(o.DryRunMetrics)
+	out.MeasurementRetention = maps.Clone(o.MeasurementRetention)
+	out.FailureLimits = maps.Clone(o.FailureLimits)
+	out.JobNodeSelector = maps.Clone(o.JobNodeSelector)
+	if o.JobTolerations != nil {
+		out.JobTolerations = make([]corev1.Toleration, len(o.JobTolerations))
+		for i := range o.JobTolerations {
+			o.JobTolerations[i].DeepCopyInto(&out.JobTolerations[i])
+		}
+	}
+	out.InconclusiveLimits = maps.Clone(o.InconclusiveLimits)
+	out.Owners = slices.Clone(o.Owners)
+	out.Finalizers = slices.Clone(o.Finalizers)
+	out.ExcludedLabelPrefixes = slices.Clone(o.ExcludedLabelPrefixes)
+	out.ProtectedLabelKeys = slices.Clone(o.ProtectedLabelKeys)
+	out.argsConfigMaps = slices.Clone(o.argsConfigMaps)
+	out.errs = slices.Clone(o.errs)
+	out.Templates = slices.Clone(o.Templates)
+	out.ClusterTemplates = slices.Clone(o.ClusterTemplates)
+	out.truncations = slices.Clone(o.truncations)
+	out.labelConflicts = slices.Clone(o.labelConflicts)
+	return &out
+}
+
+// Validate checks the AnalysisRunOptions for consistency. It returns an error
+// describing all problems found, or nil if the options are valid. Callers
+// which need to know which fields are affected, e.g. an admission webhook,
+// should use ValidateFields instead.
+func (o *AnalysisRunOptions) Validate() error {
+	errs := slices.Clone(o.errs)
+	if err := validateOwners(o.Owners); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateControllerOwners(o.Owners); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateNamespace(o.Namespace, o.Owners); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateLabelsAndAnnotations(o.extraLabels(), o.ExtraAnnotations); err != nil {
+		errs = append(errs, err)
+	}
+	if err := o.validateLabelConflicts(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := o.validateProtectedLabels("extra labels", o.extraLabels()); err != nil {
+		errs = append(errs, err)
+	}
+	if err := o.validateBaseline(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := o.validateExplicitName(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateVerificationID(o.VerificationID); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateCorrelationID(o.CorrelationID); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateTargetCluster(o.TargetCluster); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateGitRevision(o.GitRepoURL, o.GitCommit); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateInlineMetrics(o.InlineMetrics); err != nil {
+		errs = append(errs, err)
+	}
+	if o.JobPriorityClassName != "" {
+		if msgs := validation.IsDNS1123Subdomain(o.JobPriorityClassName); len(msgs) > 0 {
+			errs = append(errs, invalidField(
+				field.NewPath("jobPriorityClassName"),
+				o.JobPriorityClassName,
+				fmt.Errorf("invalid job priority class %q: %s", o.JobPriorityClassName, strings.Join(msgs, "; ")),
+			))
+		}
+	}
+	if o.JobServiceAccountName != "" {
+		if msgs := validation.IsDNS1123Subdomain(o.JobServiceAccountName); len(msgs) > 0 {
+			errs = append(errs, invalidField(
+				field.NewPath("jobServiceAccountName"),
+				o.JobServiceAccountName,
+				fmt.Errorf("invalid service account %q: %s", o.JobServiceAccountName, strings.Join(msgs, "; ")),
+			))
+		}
+	}
+	if err := validateJobNodeSelector(o.JobNodeSelector); err != nil {
+		errs = append(errs, err)
+	}
+	if o.ProviderTimeout < 0 {
+		errs = append(errs, invalidField(
+			field.NewPath("providerTimeout"),
+			o.ProviderTimeout.String(),
+			fmt.Errorf("provider timeout %s must not be negative", o.ProviderTimeout),
+		))
+	}
+	if o.Deadline < 0 {
+		errs = append(errs, invalidField(
+			field.NewPath("deadline"),
+			o.Deadline.String(),
+			fmt.Errorf("deadline %s must not be negative", o.Deadline),
+		))
+	}
+	if o.MaxRunDuration < 0 {
+		errs = append(errs, invalidField(
+			field.NewPath("maxRunDuration"),
+			o.MaxRunDuration.String(),
+			fmt.Errorf("maximum run duration %s must not be negative", o.MaxRunDuration),
+		))
+	}
+	for i, finalizer := range o.Finalizers {
+		if msgs := validation.IsQualifiedName(finalizer); len(msgs) > 0 {
+			errs = append(errs, invalidField(
+				field.NewPath("metadata", "finalizers").Index(i),
+				finalizer,
+				fmt.Errorf("invalid finalizer %q: %s", finalizer, strings.Join(msgs, "; ")),
+			))
+		}
+	}
+	if o.ConcurrencyLimit < 0 {
+		errs = append(errs, invalidField(
+			field.NewPath("concurrencyLimit"),
+			o.ConcurrencyLimit,
+			fmt.Errorf("concurrency limit %d must not be negative", o.ConcurrencyLimit),
+		))
+	}
+	if o.GenerateName {
+		if err := o.validateGenerateName(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if o.NameSeparator != "" && !slices.Contains(nameSeparators, o.NameSeparator) {
+		errs = append(errs, invalidField(
+			field.NewPath("nameSeparator"),
+			o.NameSeparator,
+			fmt.Errorf("name separator %q must be one of %q", o.NameSeparator, nameSeparators),
+		))
+	}
+	prefixMax, suffixMax, err := o.nameBudget()
+	if err != nil {
+		errs = append(errs, invalidField(field.NewPath("maxNameLength"), o.MaxNameLength, err))
+	}
+	if o.Attempt != nil {
+		if *o.Attempt < 0 {
+			errs = append(errs, invalidField(
+				field.NewPath("attempt"),
+				*o.Attempt,
+				fmt.Errorf("attempt %d must not be negative", *o.Attempt),
+			))
+		} else if attempt := formatAttempt(*o.Attempt); err == nil && len(attempt) > suffixMax {
+			errs = append(errs, invalidField(
+				field.NewPath("attempt"),
+				*o.Attempt,
+				fmt.Errorf("attempt %q exceeds maximum name suffix length of %d characters", attempt, suffixMax),
+			))
+		}
+	}
+	if o.StrictNaming {
+		// A truncated prefix is reported once, against the effective budget
+		// of the prefix rather than the limit it was truncated to.
+		prefixTruncated := false
+		for _, t := range o.truncations {
+			maxLength := t.maxLength
+			if t.field == "name prefix" {
+				prefixTruncated = true
+				if err == nil {
+					maxLength = min(maxLength, prefixMax)
+				}
+			}
+			errs = append(errs, withFields(
+				fmt.Errorf("%s %q exceeds maximum length of %d characters", t.field, t.original, maxLength),
+				field.TooLong(t.path, t.original, maxLength),
+			))
+		}
+		if !prefixTruncated && err == nil && len(o.NamePrefix) > prefixMax {
+			errs = append(errs, withFields(
+				fmt.Errorf("name prefix %q exceeds maximum length of %d characters", o.NamePrefix, prefixMax),
+				field.TooLong(field.NewPath("namePrefix"), o.NamePrefix, prefixMax),
+			))
+		}
+		if baseMax := o.nameSuffixBudget(suffixMax); err == nil && len(o.NameSuffix) > baseMax {
+			errs = append(errs, withFields(
+				fmt.Errorf("name suffix %q exceeds maximum length of %d characters", o.NameSuffix, baseMax),
+				field.TooLong(field.NewPath("nameSuffix"), o.NameSuffix, baseMax),
+			))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sortOwners returns a sorted copy of the given owners. The controller owner,
+// if any, is always sorted first, followed by the remaining owners sorted by
+// Kind, APIVersion, namespace and name.
+func sortOwners(owners []Owner) []Owner {
+	sorted := slices.Clone(owners)
+	slices.SortStableFunc(sorted, func(a, b Owner) int {
+		if a.Controller != b.Controller {
+			if a.Controller {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(
+			cmp.Compare(a.Kind, b.Kind),
+			cmp.Compare(a.APIVersion, b.APIVersion),
+			cmp.Compare(a.Reference.Namespace, b.Reference.Namespace),
+			cmp.Compare(a.Reference.Name, b.Reference.Name),
+		)
+	})
+	return sorted
+}
+
+// validateOwners ensures that every owner has an APIVersion, Kind and Name,
+// as these are required for a valid owner reference. The Namespace is not
+// required, as the owner may be cluster-scoped. It returns an error listing
+// the missing fields of every owner by its index.
+func validateOwners(owners []Owner) error {
+	var errs []error
+	for i, owner := range owners {
+		path := field.NewPath("ownerReferences").Index(i)
+		var missing []string
+		var fields field.ErrorList
+		if owner.APIVersion == "" {
+			missing = append(missing, "APIVersion")
+			fields = append(fields, field.Required(path.Child("apiVersion"), ""))
+		}
+		if owner.Kind == "" {
+			missing = append(missing, "Kind")
+			fields = append(fields, field.Required(path.Child("kind"), ""))
+		}
+		if owner.Reference.Name == "" {
+			missing = append(missing, "Name")
+			fields = append(fields, field.Required(path.Child("name"), ""))
+		}
+		if len(missing) > 0 {
+			errs = append(errs, withFields(
+				fmt.Errorf("owner %d is missing %s", i, strings.Join(missing, ", ")),
+				fields...,
+			))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateNamespace ensures that the explicitly set namespace of the
+// AnalysisRun, if any, is a valid namespace name, and that it matches the
+// namespace of every namespaced owner, as the owner references would be
+// invalid otherwise.
+func validateNamespace(namespace string, owners []Owner) error {
+	if namespace == "" {
+		return nil
+	}
+	if msgs := validation.IsDNS1123Label(namespace); len(msgs) > 0 {
+		detail := strings.Join(msgs, "; ")
+		return withFields(
+			fmt.Errorf("invalid namespace %q: %s", namespace, detail),
+			field.Invalid(field.NewPath("metadata", "namespace"), namespace, detail),
+		)
+	}
+	return validateOwnerNamespaces(namespace, owners)
+}
+
+// validateOwnerNamespaces ensures that every namespaced owner is in the given
+// namespace of the AnalysisRun, as a namespaced object can only be owned by
+// objects in the same namespace. Owners without a namespace are considered to
+// be cluster-scoped, and can own an AnalysisRun in any namespace. If the
+// namespace is empty, the owners are not validated.
+func validateOwnerNamespaces(namespace string, owners []Owner) error {
+	if namespace == "" {
+		return nil
+	}
+	var errs []error
+	for i, owner := range owners {
+		if owner.Reference.Namespace != "" && owner.Reference.Namespace != namespace {
+			err := fmt.Errorf("owner %s cannot own an AnalysisRun in namespace %q", owner, namespace)
+			errs = append(errs, withFields(err, field.Invalid(
+				field.NewPath("ownerReferences").Index(i).Child("namespace"),
+				owner.Reference.Namespace,
+				err.Error(),
+			)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateExplicitName ensures that the explicit name of the AnalysisRun, if
+// any, is a valid object name within the maximum name length of the options,
+// and that it is not combined with a name prefix or suffix, as it would be
+// ambiguous which of them should be used.
+func (o *AnalysisRunOptions) validateExplicitName() error {
+	if o.ExplicitName == "" {
+		return nil
+	}
+	path := field.NewPath("metadata", "name")
+	if o.NamePrefix != "" || o.NameSuffix != "" {
+		return withFields(
+			fmt.Errorf("explicit name %q cannot be combined with a name prefix or suffix", o.ExplicitName),
+			field.Forbidden(path, "explicit name cannot be combined with a name prefix or suffix"),
+		)
+	}
+	maxLength := maxNameLength
+	if o.MaxNameLength != 0 {
+		maxLength = o.MaxNameLength
+	}
+	if len(o.ExplicitName) > maxLength {
+		return withFields(
+			fmt.Errorf("explicit name %q exceeds maximum length of %d characters", o.ExplicitName, maxLength),
+			field.TooLong(path, o.ExplicitName, maxLength),
+		)
+	}
+	if msgs := validation.IsDNS1123Subdomain(o.ExplicitName); len(msgs) > 0 {
+		detail := strings.Join(msgs, "; ")
+		return withFields(
+			fmt.Errorf("invalid explicit name %q: %s", o.ExplicitName, detail),
+			field.Invalid(path, o.ExplicitName, detail),
+		)
+	}
+	return nil
+}
+
+// namespaceOrDefault returns the explicitly set namespace of the AnalysisRun,
+// or the given default namespace if none is set.
+func (o *AnalysisRunOptions) namespaceOrDefault(namespace string) string {
+	if o.Namespace != "" {
+		return o.Namespace
+	}
+	return namespace
+}
+
+// validateControllerOwners ensures that at most one owner is marked as the
+// controller.
+func validateControllerOwners(owners []Owner) error {
+	var controller *Owner
+	for i := range owners {
+		if !owners[i].Controller {
+			continue
+		}
+		if controller != nil {
+			return invalidField(
+				field.NewPath("ownerReferences").Index(i).Child("controller"),
+				true,
+				fmt.Errorf("only one owner can be a controller, but both %s and %s are", controller, owners[i]),
+			)
+		}
+		controller = &owners[i]
+	}
+	return nil
+}
+
+// reportTruncation reports the truncation of the given name part to the
+// TruncationReporter of the options, if the truncated value differs from the
+// value originally passed to the options.
+func (o *AnalysisRunOptions) reportTruncation(field, value, truncated string) {
+	if o.TruncationReporter == nil {
+		return
+	}
+	original := value
+	for _, t := range o.truncations {
+		if t.field == field {
+			original = t.original
+		}
+	}
+	if original != truncated {
+		o.TruncationReporter(field, original, truncated)
+	}
+}
+
+// recordTruncation records that the given name part was truncated, replacing
+// any earlier record for the same part.
+func (o *AnalysisRunOptions) recordTruncation(
+	path *field.Path,
+	field, original, truncated string,
+	maxLength int,
+) {
+	o.clearTruncation(field)
+	o.truncations = append(o.truncations, truncation{
+		path:      path,
+		field:     field,
+		original:  original,
+		truncated: truncated,
+		maxLength: maxLength,
+	})
+}
+
+// clearTruncation drops the record of the truncation of the given name part,
+// e.g. once the part is set anew.
+func (o *AnalysisRunOptions) clearTruncation(field string) {
+	o.truncations = slices.DeleteFunc(o.truncations, func(t truncation) bool {
+		return t.field == field
+	})
+}
+
+// validateGenerateName validates that the name prefix can be used as the
+// generateName of the AnalysisRun, leaving room for the random suffix
+// appended by the API server.
+func (o *AnalysisRunOptions) validateGenerateName() error {
+	path := field.NewPath("metadata", "generateName")
+	if o.ExplicitName != "" {
+		return withFields(
+			fmt.Errorf("explicit name %q cannot be combined with a generated name", o.ExplicitName),
+			field.Forbidden(path, "generated name cannot be combined with an explicit name"),
+		)
+	}
+	if o.NamePrefix == "" {
+		return withFields(
+			errors.New("generated name requires a name prefix"),
+			field.Required(path, "generated name requires a name prefix"),
+		)
+	}
+	generateName := o.generateNamePrefix()
+	if maxLength := o.generateNameBudget(); len(generateName) > maxLength {
+		return withFields(
+			fmt.Errorf(
+				"generated name %q exceeds maximum length of %d characters to leave room for the random suffix",
+				generateName, maxLength,
+			),
+			field.TooLong(path, generateName, maxLength),
+		)
+	}
+	return nil
+}
+
+// WithNamePrefix sets the name prefix for the AnalysisRun. The prefix is
+// sanitized to only contain lowercase alphanumeric characters and '-'. If it
+// is longer than maxUnsuffixedNamePrefixLength after sanitization, it will be
+// truncated. When the name is generated, it is truncated further to leave
+// room for the name suffix, if any.
 type WithNamePrefix string
 
 func (o WithNamePrefix) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
-	prefix := o
-	if len(prefix) > maxNamePrefixLength {
-		prefix = prefix[0:maxNamePrefixLength]
+	prefix := sanitizeNamePrefix(string(o))
+	opts.clearTruncation("name prefix")
+	if len(prefix) > maxUnsuffixedNamePrefixLength {
+		truncated := truncateNamePrefix(prefix, maxUnsuffixedNamePrefixLength)
+		opts.recordTruncation(
+			field.NewPath("namePrefix"), "name prefix", prefix, truncated, maxUnsuffixedNamePrefixLength,
+		)
+		prefix = truncated
 	}
-	opts.NamePrefix = string(prefix)
+	opts.NamePrefix = prefix
 }
 
 // WithNameSuffix sets the name suffix for the AnalysisRun. If it is longer
-// than maxNameSuffixLength, it will be truncated.
+// than the suffix length of the options (maxNameSuffixLength unless changed
+// using WithSuffixLength), it is truncated when the name is generated. An
+// empty suffix omits the suffix, leaving its budget to the name prefix.
 type WithNameSuffix string
 
 func (o WithNameSuffix) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
-	suffix := o
-	if len(suffix) > maxNameSuffixLength {
-		suffix = suffix[0:maxNameSuffixLength]
+	opts.NameSuffix = string(o)
+}
+
+// WithExplicitName sets the exact name of the AnalysisRun, e.g. for a
+// reconciliation which must re-create the AnalysisRun under a known name. The
+// name is used as-is, without a ULID. Validate returns an error if the name is
+// not a valid object name, exceeds the maximum name length, or is combined
+// with WithNamePrefix or WithNameSuffix.
+type WithExplicitName string
+
+func (o WithExplicitName) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.ExplicitName = string(o)
+}
+
+// WithGenerateName returns an option which makes the API server generate the
+// name of the AnalysisRun, e.g. for operators preferring server-side naming.
+// The generateName of the AnalysisRun is set to the name prefix followed by
+// '-', and its name is left empty. The ULID, name suffix and attempt number
+// are not part of the name. As the API server appends a random suffix of
+// generatedNameRandomLength characters and truncates longer generateNames,
+// Validate returns an error if the name prefix does not fit within
+// names.MaxGeneratedNameLength, or within the maximum name length of the
+// options once the random suffix is appended. It also returns an error if no
+// name prefix is set, or if an explicit name is set.
+func WithGenerateName() AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		opts.GenerateName = true
+	})
+}
+
+// WithContentHashSuffix returns an option which sets the name suffix of the
+// AnalysisRun to a hash of the given inputs, e.g. the names of the templates,
+// arguments and Freight. Identical inputs result in an identical suffix,
+// which makes re-runs of the same verification recognizable, while differing
+// inputs result in a different suffix.
+func WithContentHashSuffix(inputs ...string) AnalysisRunOption {
+	return WithNameSuffix(contentHash(inputs...))
+}
+
+// WithPromotion sets the name of the Promotion which triggered the
+// verification, so that operators can trace the AnalysisRun back to it. The
+// name is set as a label and, untruncated, as an annotation, and hashed into
+// the name suffix like WithContentHashSuffix does. The suffix is identical
+// for every AnalysisRun of the same Promotion.
+//
+// Like any other option setting the name suffix, e.g. WithNameSuffix or
+// WithContentHashSuffix, the option applied last determines the suffix:
+// applying such an option after WithPromotion replaces the suffix derived
+// from the Promotion, but keeps the label and annotation.
+type WithPromotion string
+
+func (o WithPromotion) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.Promotion = string(o)
+	opts.NameSuffix = contentHash(string(o))
+}
+
+// WithMaxNameLength sets the maximum length of the name of the AnalysisRun.
+// It can be used to shrink the default budget of 253 characters, e.g. when an
+// admission webhook adds characters to the name. The name prefix and suffix
+// are truncated to fit within the budget.
+type WithMaxNameLength int
+
+func (o WithMaxNameLength) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.MaxNameLength = int(o)
+}
+
+// WithAttempt encodes the given attempt number of the verification in the
+// name suffix of the AnalysisRun, zero-padded to two digits so that the names
+// of the first 100 attempts sort in order, e.g. "<prefix>.<ULID>.<suffix>-07".
+// The attempt number is part of the suffix length: if the name suffix set
+// using e.g. WithContentHashSuffix would not fit together with the attempt
+// number, the name suffix is truncated. Validate returns an error if the
+// attempt number is negative, or does not fit within the suffix length.
+type WithAttempt int
+
+func (o WithAttempt) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.Attempt = ptr.To(int(o))
+}
+
+// WithNameSeparator sets the separator between the name prefix, ULID and
+// suffix of the AnalysisRun, e.g. '-' for tooling which does not support
+// periods in names. The separator must be either '.', the default, or '-'.
+// The separator between the name suffix and the attempt number is always '-'.
+type WithNameSeparator string
+
+func (o WithNameSeparator) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.NameSeparator = string(o)
+}
+
+// WithSuffixLength sets the maximum length of the name suffix of the
+// AnalysisRun, e.g. to keep more characters of a SHA to prevent collisions.
+// The suffix is given precedence over the prefix: if the suffix would not fit
+// within the maximum name length together with the prefix and the ULID, the
+// prefix is truncated further. The suffix itself is only shortened if it does
+// not fit next to the ULID.
+type WithSuffixLength int
+
+func (o WithSuffixLength) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.SuffixLength = int(o)
+}
+
+// WithTemplates adds the names of AnalysisTemplates to build the AnalysisRun
+// from, in addition to the AnalysisTemplates referenced by the verification
+// configuration. It can be passed multiple times to add more templates, which
+// are used in the order in which they were added. The arguments declared by
+// the templates are merged, and building the AnalysisRun fails if templates
+// declare the same argument with different values.
+type WithTemplates []string
+
+func (o WithTemplates) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	for _, name := range o {
+		if !slices.Contains(opts.Templates, name) {
+			opts.Templates = append(opts.Templates, name)
+		}
+	}
+}
+
+// WithClusterTemplates adds the names of ClusterAnalysisTemplates to build the
+// AnalysisRun from, in addition to the namespaced AnalysisTemplates. It can be
+// passed multiple times to add more templates.
+type WithClusterTemplates []string
+
+func (o WithClusterTemplates) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	for _, name := range o {
+		if !slices.Contains(opts.ClusterTemplates, name) {
+			opts.ClusterTemplates = append(opts.ClusterTemplates, name)
+		}
+	}
+}
+
+// WithLogger returns an option which sets the logger receiving debug logs of
+// the stages of the build, i.e. the resolution of the templates, the matching
+// of the arguments, the conversion of the owners and the assembly of the
+// name, to trace which of them caused a build to fail. Without a logger,
+// nothing is logged.
+func WithLogger(logger *logging.Logger) AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		opts.Logger = logger
+	})
+}
+
+// logger returns the Logger of the options, or a logger discarding all logs
+// if none is set.
+func (o *AnalysisRunOptions) logger() *logging.Logger {
+	if o.Logger == nil {
+		return discardLogger
 	}
-	opts.NameSuffix = string(suffix)
+	return o.Logger
+}
+
+// WithULIDGenerator sets the function used to generate the ULID which is
+// included in the name of the AnalysisRun. This is primarily useful for tests
+// which require a deterministic name.
+type WithULIDGenerator func() ulid.ULID
+
+func (o WithULIDGenerator) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.ULIDGenerator = o
+}
+
+// WithTruncationReporter sets a function which is called when the name of the
+// AnalysisRun is generated and its prefix ("name prefix") or suffix ("name
+// suffix") had to be truncated, with the original and the truncated value.
+// This allows e.g. logging truncations, which otherwise go unnoticed.
+type WithTruncationReporter func(field, original, truncated string)
+
+func (o WithTruncationReporter) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.TruncationReporter = o
+}
+
+// WithStrictNaming enables strict naming. When enabled, a name prefix or
+// suffix exceeding its maximum length causes the build of the AnalysisRun to
+// fail instead of being truncated.
+type WithStrictNaming bool
+
+func (o WithStrictNaming) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.StrictNaming = bool(o)
+}
+
+// WithArgReferenceValidation enables the validation of the arguments
+// referenced by the metrics, e.g. ${args.query} or {{args.query}} in the
+// query of a Prometheus metric. When enabled, a reference to an argument
+// which is not supplied to the AnalysisRun causes the build to fail, instead
+// of the AnalysisRun failing once created.
+type WithArgReferenceValidation bool
+
+func (o WithArgReferenceValidation) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.ValidateArgReferences = bool(o)
 }
 
 // WithExtraLabels sets the extra labels for the AnalysisRun. It can be passed
-// multiple times to add more labels.
+// multiple times to add more labels. The labels are copied, so later changes
+// to the passed map do not affect the options. A label which is already set
+// to a different value is overwritten, unless the label conflict policy is
+// LabelConflictPolicyError.
 type WithExtraLabels map[string]string
 
 func (o WithExtraLabels) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
-	if opts.ExtraLabels != nil {
-		maps.Copy(opts.ExtraLabels, o)
+	if opts.ExtraLabels == nil {
+		opts.ExtraLabels = make(map[string]string, len(o))
+	}
+	for _, key := range slices.Sorted(maps.Keys(o)) {
+		if existing, ok := opts.ExtraLabels[key]; ok && existing != o[key] {
+			opts.labelConflicts = append(opts.labelConflicts, labelConflict{
+				key:      key,
+				existing: existing,
+				value:    o[key],
+			})
+		}
+		opts.ExtraLabels[key] = o[key]
+	}
+}
+
+// WithLabelsFromEnv adds extra labels from the environment variables whose
+// names start with the given prefix, e.g. to stamp CI build metadata on the
+// AnalysisRun. The label key is the remainder of the name, lowercased and
+// with '_' replaced with '-', so "CI_JOB_URL" becomes "job-url" with prefix
+// "CI_". Values are made valid label values the same way as the values of
+// labels derived from dedicated options. On a best-effort basis, variables
+// whose name does not result in a valid label key, or which have an empty
+// value, are skipped without an error. An empty prefix adds no labels. The
+// environment is read when the option is applied, and the labels are merged
+// as if passed using WithExtraLabels.
+type WithLabelsFromEnv string
+
+func (o WithLabelsFromEnv) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	if o == "" {
 		return
 	}
-	opts.ExtraLabels = o
+	labels := make(map[string]string)
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		suffix, ok := strings.CutPrefix(name, string(o))
+		if !ok || value == "" {
+			continue
+		}
+		key := strings.ToLower(strings.ReplaceAll(suffix, "_", "-"))
+		if len(validation.IsQualifiedName(key)) > 0 {
+			continue
+		}
+		labels[key] = labelValue(value)
+	}
+	if len(labels) > 0 {
+		WithExtraLabels(labels).ApplyToAnalysisRun(opts)
+	}
+}
+
+// WithLabelConflictPolicy sets how conflicting values of the same label are
+// handled, e.g. LabelConflictPolicyError to make the build of the AnalysisRun
+// fail rather than silently overwriting a label. The policy covers labels set
+// to different values by WithExtraLabels, and extra labels which differ from
+// the labels derived from dedicated options, such as WithStage. It applies
+// regardless of the order in which the options are passed.
+type WithLabelConflictPolicy LabelConflictPolicy
+
+func (o WithLabelConflictPolicy) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.LabelConflictPolicy = LabelConflictPolicy(o)
+}
+
+// WithExtraAnnotations sets the extra annotations for the AnalysisRun. It can
+// be passed multiple times to add more annotations. The annotations are
+// copied, so later changes to the passed map do not affect the options.
+type WithExtraAnnotations map[string]string
+
+func (o WithExtraAnnotations) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	if opts.ExtraAnnotations == nil {
+		opts.ExtraAnnotations = make(map[string]string, len(o))
+	}
+	maps.Copy(opts.ExtraAnnotations, o)
+}
+
+// WithInheritedAnnotations returns an option which copies the annotations
+// with the given keys from the given object, e.g. the Promotion triggering the
+// verification, to the AnalysisRun. Keys which are not present on the object
+// are skipped. Validate returns an error if the object is nil.
+func WithInheritedAnnotations(obj client.Object, keys ...string) AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		if v := reflect.ValueOf(obj); !v.IsValid() || (v.Kind() == reflect.Pointer && v.IsNil()) {
+			opts.errs = append(opts.errs, errors.New("inherit annotations: missing object"))
+			return
+		}
+		annotations := obj.GetAnnotations()
+		inherited := make(WithExtraAnnotations, len(keys))
+		for _, key := range keys {
+			if value, ok := annotations[key]; ok {
+				inherited[key] = value
+			}
+		}
+		if len(inherited) > 0 {
+			inherited.ApplyToAnalysisRun(opts)
+		}
+	})
+}
+
+// WithArgs sets argument values for the arguments declared by the
+// AnalysisTemplates. It can be passed multiple times to add more arguments,
+// e.g. composed from defaults, Stage-level and Freight-derived values, with
+// later values overriding earlier values of the same argument. The arguments
+// are copied, so later changes to the passed map do not affect the options.
+//
+// Building the AnalysisRun fails if an argument is not declared by any of the
+// templates, or if it is declared to be resolved from a Secret.
+type WithArgs map[string]string
+
+func (o WithArgs) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	if opts.Args == nil {
+		opts.Args = make(map[string]string, len(o))
+	}
+	maps.Copy(opts.Args, o)
+}
+
+// WithBaselineRun returns an option which sets arguments from the latest
+// successful measurement of every metric of the given baseline AnalysisRun,
+// e.g. the last successful AnalysisRun of the Stage, so metrics can compare
+// against it. The argument of a metric is named after the metric, prefixed
+// with "baseline-", e.g. "baseline-latency"; arguments which are not declared
+// by the AnalysisTemplates are ignored. Arguments set using WithArgs take
+// precedence, and the declared arguments must be allowed if WithAllowedArgs
+// is used. If passed multiple times, the last baseline AnalysisRun is used. If
+// the baseline AnalysisRun is nil or has no successful measurements, the
+// build of the AnalysisRun fails, unless the baseline policy is
+// BaselinePolicySkip.
+func WithBaselineRun(ar *rolloutsapi.AnalysisRun) AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		opts.baselineArgs, opts.baselineErr = baselineArgs(ar)
+	})
+}
+
+// WithBaselinePolicy sets how a baseline AnalysisRun passed using
+// WithBaselineRun without successful measurements is handled, e.g.
+// BaselinePolicySkip to build the AnalysisRun without baseline arguments. It
+// applies regardless of the order in which the options are passed.
+type WithBaselinePolicy BaselinePolicy
+
+func (o WithBaselinePolicy) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.BaselinePolicy = BaselinePolicy(o)
+}
+
+// WithAllowedArgs returns an option which restricts the arguments which may
+// be set, by the verification configuration or using WithArgs, to the given
+// names, e.g. to prevent a verification from overriding a query to target the
+// metrics of another namespace. Arguments declared by the AnalysisTemplates
+// which are not set keep their default values. Once the option is passed, all
+// other arguments are denied, even if no names are given. It can be passed
+// multiple times to allow more arguments. Building the AnalysisRun fails if
+// an argument which is not allowed is set.
+func WithAllowedArgs(names ...string) AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		opts.AllowedArgs = append(opts.AllowedArgs, names...)
+		if opts.AllowedArgs == nil {
+			opts.AllowedArgs = []string{}
+		}
+	})
+}
+
+// WithFreightArgs enables the resolution of references to fields of the given
+// Freight in argument values, e.g. to pass the tag of the image which is
+// verified to a metric query using ${freight.images["<repoURL>"].tag}. The
+// references are resolved in the argument values of the verification and the
+// values passed using WithArgs. Building the AnalysisRun fails if a reference
+// cannot be resolved.
+func WithFreightArgs(freight *kargoapi.Freight) AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		opts.ArgsFreight = freight.DeepCopy()
+	})
+}
+
+// WithNamespace sets the namespace of the AnalysisRun, overriding the
+// namespace passed to the builder, e.g. for verification setups spanning
+// namespaces. The AnalysisTemplates are still resolved from the namespace
+// passed to the builder. Validate returns an error if the namespace is not a
+// valid namespace name, or if a namespaced owner is in a different namespace.
+type WithNamespace string
+
+func (o WithNamespace) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.Namespace = string(o)
+}
+
+// WithStage sets the Project and Stage the AnalysisRun belongs to. They are
+// stamped on the AnalysisRun as labels, for RBAC scoping and display purposes.
+// To also make the Stage own the AnalysisRun, combine it with WithOwner.
+func WithStage(project, stage string) AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		opts.Project = project
+		opts.Stage = stage
+	})
+}
+
+// WithTargetCluster sets the name of the cluster the verification targets,
+// e.g. a remote cluster in multi-cluster setups, so that AnalysisRuns can be
+// filtered by it. The name is set as a label and, untruncated, as an
+// annotation. Names longer than a label value allows are truncated and
+// suffixed with a hash in the label. The label is distinct from the shard
+// label set using WithShard. Validate returns an error if the name contains
+// characters which are not allowed in a label value.
+type WithTargetCluster string
+
+func (o WithTargetCluster) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.TargetCluster = string(o)
+}
+
+// WithShard sets the shard of the controller responsible for the
+// AnalysisRun. It is stamped on the AnalysisRun as a label, so that the right
+// controller instance reconciles it. If empty, no shard label is set at all,
+// matching the selector of the default shard.
+type WithShard string
+
+func (o WithShard) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.Shard = string(o)
+}
+
+// WithFreight sets the Freight the AnalysisRun verifies, and the Warehouse it
+// originates from. They are stamped on the AnalysisRun as labels, so that
+// AnalysisRuns can be filtered by Freight, and as an annotation for display
+// purposes. Values which are not valid label values are sanitized, and
+// truncated and hashed if needed.
+func WithFreight(name, warehouse string) AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		opts.Freight = name
+		opts.Warehouse = warehouse
+	})
+}
+
+// WithGitRevision sets the Git repository and commit the AnalysisRun
+// verifies, for the audit trail. The normalized repository URL and the commit
+// are stamped on the AnalysisRun as annotations, and the abbreviated commit
+// as a label, so that AnalysisRuns can be filtered by commit. Validate
+// returns an error if the repository URL cannot be parsed, or if the commit
+// is not a hexadecimal SHA of at least 7 characters.
+func WithGitRevision(repoURL, commit string) AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		opts.GitRepoURL = repoURL
+		opts.GitCommit = strings.ToLower(commit)
+	})
+}
+
+// WithControllerVersion sets the version of the Kargo controller which builds
+// the AnalysisRun, e.g. to find out which build of the controller created an
+// AnalysisRun when debugging. The version is stamped on the AnalysisRun as an
+// annotation, as versions such as "v1.2.3+abc" are not valid label values.
+// An empty version is omitted.
+type WithControllerVersion string
+
+func (o WithControllerVersion) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.ControllerVersion = string(o)
+}
+
+// WithDescription returns an option which sets a human-readable description
+// of the AnalysisRun, e.g. "Verify canary for Freight abc123 in Stage
+// staging", rendered from the given text/template with the given data. The
+// description is set as an annotation, so it can be shown instead of the
+// name. References to missing map keys are errors. If the template cannot
+// be parsed or executed, the error is returned when the AnalysisRun is built.
+func WithDescription(tmpl string, data any) AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		t, err := template.New("description").Option("missingkey=error").Parse(tmpl)
+		if err != nil {
+			opts.errs = append(opts.errs, fmt.Errorf("parse description template: %w", err))
+			return
+		}
+		var sb strings.Builder
+		if err = t.Execute(&sb, data); err != nil {
+			opts.errs = append(opts.errs, fmt.Errorf("render description: %w", err))
+			return
+		}
+		opts.Description = strings.TrimSpace(sb.String())
+	})
+}
+
+// WithInlineMetrics adds metrics to the AnalysisRun, in addition to the
+// metrics of the templates. This allows one-off metrics to be specified
+// without authoring an AnalysisTemplate. Every metric must have a name and at
+// least one provider, and building the AnalysisRun fails if a metric has the
+// same name as a metric of the templates. It can be passed multiple times to
+// add more metrics. The metrics are copied, so later changes to the passed
+// metrics do not affect the options.
+type WithInlineMetrics []rolloutsapi.Metric
+
+func (o WithInlineMetrics) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	for i := range o {
+		opts.InlineMetrics = append(opts.InlineMetrics, *o[i].DeepCopy())
+	}
+}
+
+// WithJobPriorityClass sets the name of the PriorityClass of the Pods of the
+// Jobs spawned by Job metrics, so that verifications are not preempted. Only
+// metrics using the Job provider are affected. Validate returns an error if
+// the name is not a valid PriorityClass name.
+type WithJobPriorityClass string
+
+func (o WithJobPriorityClass) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.JobPriorityClassName = string(o)
+}
+
+// WithServiceAccount sets the name of the ServiceAccount of the Pods of the
+// Jobs spawned by Job metrics, so that verifications run with least
+// privileges instead of the default ServiceAccount. Only metrics using the Job
+// provider are affected: for AnalysisRuns without Job metrics, the option has
+// no effect. Validate returns an error if the name is not a valid
+// ServiceAccount name.
+type WithServiceAccount string
+
+func (o WithServiceAccount) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.JobServiceAccountName = string(o)
+}
+
+// WithJobNodeSelector sets the node selector of the Pods of the Jobs spawned
+// by Job metrics, e.g. to schedule verifications on a dedicated node pool.
+// The node selector is merged into the node selector of the Job templates,
+// taking precedence for keys present in both. It can be passed multiple times
+// to add more labels. The labels are copied, so later changes to the passed
+// map do not affect the options. Only metrics using the Job provider are
+// affected. Validate returns an error if a label is invalid.
+type WithJobNodeSelector map[string]string
+
+func (o WithJobNodeSelector) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	if opts.JobNodeSelector == nil {
+		opts.JobNodeSelector = make(map[string]string, len(o))
+	}
+	maps.Copy(opts.JobNodeSelector, o)
+}
+
+// WithJobTolerations adds tolerations to the Pods of the Jobs spawned by Job
+// metrics, e.g. to allow verifications to run on tainted nodes of a dedicated
+// node pool. Tolerations already present on a Job template are not
+// duplicated. It can be passed multiple times to add more tolerations. Only
+// metrics using the Job provider are affected.
+type WithJobTolerations []corev1.Toleration
+
+func (o WithJobTolerations) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	for i := range o {
+		opts.JobTolerations = append(opts.JobTolerations, *o[i].DeepCopy())
+	}
+}
+
+// WithProviderTimeout sets the default timeout of the metric providers which
+// support one, so that a hanging provider does not stall the AnalysisRun. It
+// is applied to the metrics using the Prometheus or Web provider which do not
+// specify a timeout, rounded up to whole seconds. Metrics specifying a
+// timeout, and metrics using providers without a timeout, e.g. Datadog, are
+// left untouched. Validate returns an error if the timeout is negative.
+type WithProviderTimeout time.Duration
+
+func (o WithProviderTimeout) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.ProviderTimeout = time.Duration(o)
+}
+
+// WithDryRunMetrics sets the names of the metrics which should be evaluated
+// in dry-run mode, meaning their failure does not affect the outcome of the
+// AnalysisRun. The name "*" marks all metrics as dry-run. It can be passed
+// multiple times to add more metrics. Building the AnalysisRun fails if a
+// metric does not exist in any of the templates.
+type WithDryRunMetrics []string
+
+func (o WithDryRunMetrics) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	for _, name := range o {
+		if !slices.Contains(opts.DryRunMetrics, name) {
+			opts.DryRunMetrics = append(opts.DryRunMetrics, name)
+		}
+	}
+}
+
+// WithMeasurementRetention returns an option which sets the number of
+// measurements to retain for the given metric, overriding the limit declared
+// by the templates. Building the AnalysisRun fails if the metric does not
+// exist in any of the templates.
+func WithMeasurementRetention(metric string, limit int32) AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		if opts.MeasurementRetention == nil {
+			opts.MeasurementRetention = make(map[string]int32)
+		}
+		opts.MeasurementRetention[metric] = limit
+	})
+}
+
+// WithFailureLimit returns an option which sets the maximum number of failed
+// measurements of the given metric, overriding the limit declared by the
+// templates, e.g. to tolerate transient failures in some environments only.
+// Building the AnalysisRun fails if the metric does not exist.
+func WithFailureLimit(metric string, limit int32) AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		if opts.FailureLimits == nil {
+			opts.FailureLimits = make(map[string]int32)
+		}
+		opts.FailureLimits[metric] = limit
+	})
+}
+
+// WithInconclusiveLimit returns an option which sets the maximum number of
+// inconclusive measurements of the given metric, overriding the limit
+// declared by the templates. Building the AnalysisRun fails if the metric
+// does not exist.
+func WithInconclusiveLimit(metric string, limit int32) AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		if opts.InconclusiveLimits == nil {
+			opts.InconclusiveLimits = make(map[string]int32)
+		}
+		opts.InconclusiveLimits[metric] = limit
+	})
+}
+
+// WithVerificationID sets the ID shared by all attempts of the same
+// verification. It is stamped on the AnalysisRun as a label, so that the
+// AnalysisRuns of retried verifications can be grouped. When building using
+// an AnalysisRunBuilder, the attempt number is derived from the number of
+// existing AnalysisRuns with the same ID and recorded as an annotation. The
+// ID must be a valid label value, and is never altered.
+type WithVerificationID string
+
+func (o WithVerificationID) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.VerificationID = string(o)
+}
+
+// WithCorrelationID sets the ID correlating the AnalysisRun with e.g. the
+// OpenTelemetry trace of the promotion it originates from. It is stamped on
+// the AnalysisRun as an annotation, so that logs can be correlated. Contrary
+// to the verification ID, it is not used to group retried verifications. An
+// empty ID sets no annotation.
+type WithCorrelationID string
+
+func (o WithCorrelationID) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.CorrelationID = string(o)
+}
+
+// WithDeadline sets the duration after the creation of the AnalysisRun at
+// which it should be terminated. The deadline is stamped on the AnalysisRun as
+// an annotation, and enforced by terminating the AnalysisRun once
+// ShouldTerminate reports it has passed.
+type WithDeadline time.Duration
+
+func (o WithDeadline) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.Deadline = time.Duration(o)
+}
+
+// WithMaxRunDuration sets the duration after the start of the AnalysisRun at
+// which it is considered stuck if it is still running. The duration is stamped
+// on the AnalysisRun as an annotation, for use by ClassifyStuck.
+type WithMaxRunDuration time.Duration
+
+func (o WithMaxRunDuration) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.MaxRunDuration = time.Duration(o)
+}
+
+// WithConcurrencyLimit sets the maximum number of concurrent AnalysisRuns of
+// the Stage, e.g. to protect the metric providers the AnalysisRuns query. The
+// limit is stamped on the AnalysisRun as an annotation, so that the
+// controller can pass it to CanStart before starting the next AnalysisRun.
+// Validate returns an error if the limit is negative.
+type WithConcurrencyLimit int
+
+func (o WithConcurrencyLimit) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	opts.ConcurrencyLimit = int(o)
+}
+
+// WithEphemeral returns an option which marks the AnalysisRun as ephemeral,
+// e.g. for verifications in preview environments. Ephemeral AnalysisRuns are
+// stamped with an annotation, and selected for deletion by SelectForDeletion
+// as soon as they completed, regardless of the retention policy.
+func WithEphemeral() AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		opts.Ephemeral = true
+	})
+}
+
+// WithFinalizers returns an option which adds the given finalizers to the
+// AnalysisRun, e.g. to archive its results before it is deleted. Duplicate
+// finalizers are added once. Every finalizer must be a qualified name.
+func WithFinalizers(finalizers ...string) AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		for _, finalizer := range finalizers {
+			if !slices.Contains(opts.Finalizers, finalizer) {
+				opts.Finalizers = append(opts.Finalizers, finalizer)
+			}
+		}
+	})
+}
+
+// WithExcludedLabelPrefixes excludes extra labels with keys starting with any
+// of the given prefixes from the AnalysisRun. A full label key excludes that
+// label. The exclusions apply regardless of the order in which the options
+// are passed, so they always win over WithExtraLabels. Labels derived from
+// dedicated options, such as WithStage, are not affected. It can be passed
+// multiple times to add more prefixes.
+type WithExcludedLabelPrefixes []string
+
+func (o WithExcludedLabelPrefixes) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	for _, prefix := range o {
+		if !slices.Contains(opts.ExcludedLabelPrefixes, prefix) {
+			opts.ExcludedLabelPrefixes = append(opts.ExcludedLabelPrefixes, prefix)
+		}
+	}
+}
+
+// WithProtectedLabelKeys protects the labels with the given keys, in addition
+// to the project, Stage and shard labels, which are always protected. Once a
+// protected label is set by a dedicated option, such as WithFreight for the
+// Freight label, the build of the AnalysisRun fails if WithExtraLabels or the
+// labels of the verification configuration set it to another value,
+// regardless of the label conflict policy, e.g. so a user cannot make an
+// AnalysisRun appear to belong to another project. Protected labels which are
+// not set by a dedicated option can still be set by WithExtraLabels. It can
+// be passed multiple times to protect more labels.
+type WithProtectedLabelKeys []string
+
+func (o WithProtectedLabelKeys) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
+	for _, key := range o {
+		if !slices.Contains(opts.ProtectedLabelKeys, key) {
+			opts.ProtectedLabelKeys = append(opts.ProtectedLabelKeys, key)
+		}
+	}
 }
 
 // WithOwner sets the owner for the AnalysisRun. It can be passed multiple times
-// to add more owners.
+// to add more owners. Owners with the same APIVersion, Kind and Reference are
+// deduplicated, with BlockDeletion and Controller enabled if any of the
+// duplicates enables them, and the UID of the last duplicate which has one.
 type WithOwner Owner
 
 func (o WithOwner) ApplyToAnalysisRun(opts *AnalysisRunOptions) {
-	opts.Owners = append(opts.Owners, Owner(o))
+	opts.Owners = addOwner(opts.Owners, Owner(o))
+}
+
+// addOwner adds the given owner to the owners, unless an owner with the same
+// APIVersion, Kind and Reference is already present. In which case,
+// BlockDeletion and Controller are enabled on the present owner if the given
+// owner enables them, and its UID is replaced if the given owner has one.
+func addOwner(owners []Owner, owner Owner) []Owner {
+	for i, existing := range owners {
+		if existing.APIVersion == owner.APIVersion &&
+			existing.Kind == owner.Kind &&
+			existing.Reference == owner.Reference {
+			owners[i].BlockDeletion = existing.BlockDeletion || owner.BlockDeletion
+			owners[i].Controller = existing.Controller || owner.Controller
+			if owner.UID != "" {
+				owners[i].UID = owner.UID
+			}
+			return owners
+		}
+	}
+	return append(owners, owner)
+}
+
+// WithOwnerObject returns an option which adds the given object as an owner
+// of the AnalysisRun, with BlockDeletion enabled. The APIVersion and Kind of
+// the owner are resolved using the scheme, and the Reference and UID are
+// derived from the namespace, name and UID of the object. If the scheme cannot
+// resolve the kind of the object, Validate returns an error.
+func WithOwnerObject(obj client.Object, scheme *runtime.Scheme) AnalysisRunOption {
+	return withOwnerObject(obj, scheme, true, false)
+}
+
+// WithControllerOwner returns an option which adds the given object as the
+// controller owner of the AnalysisRun, e.g. the Stage the AnalysisRun
+// verifies, with BlockDeletion enabled. The owner is resolved the same way as
+// by WithOwnerObject. As only one owner can be a controller, Validate returns
+// an error if another controller owner is added, e.g. using WithOwner.
+func WithControllerOwner(obj client.Object, scheme *runtime.Scheme) AnalysisRunOption {
+	return withOwnerObject(obj, scheme, true, true)
+}
+
+// WithReferenceOwner returns an option which adds the given object as a
+// reference owner of the AnalysisRun, e.g. the Freight or Promotion the
+// AnalysisRun relates to, to make the AnalysisRun discoverable from it. A
+// reference owner neither blocks the deletion of the object, nor is it a
+// controller, so it can be combined with WithControllerOwner. The owner is
+// resolved the same way as by WithOwnerObject. If the same object is also
+// added using another option, BlockDeletion and Controller are enabled as
+// requested by that option.
+func WithReferenceOwner(obj client.Object, scheme *runtime.Scheme) AnalysisRunOption {
+	return withOwnerObject(obj, scheme, false, false)
+}
+
+// withOwnerObject returns an option which adds the given object as an owner
+// of the AnalysisRun, with BlockDeletion and Controller set as given.
+func withOwnerObject(obj client.Object, scheme *runtime.Scheme, blockDeletion, controller bool) AnalysisRunOption {
+	return AnalysisRunOptionFunc(func(opts *AnalysisRunOptions) {
+		gvk, err := apiutil.GVKForObject(obj, scheme)
+		if err != nil {
+			opts.errs = append(opts.errs, fmt.Errorf("resolve owner kind: %w", err))
+			return
+		}
+		WithOwner{
+			APIVersion:    gvk.GroupVersion().String(),
+			Kind:          gvk.Kind,
+			Reference:     client.ObjectKeyFromObject(obj),
+			BlockDeletion: blockDeletion,
+			Controller:    controller,
+			UID:           obj.GetUID(),
+		}.ApplyToAnalysisRun(opts)
+	})
+}
+
+// truncateNamePrefix truncates the given prefix to the given length, trimming
+// any trailing '-' which would otherwise end up next to a separator.
+func truncateNamePrefix(prefix string, length int) string {
+	if len(prefix) <= length {
+		return prefix
+	}
+	return strings.TrimRight(prefix[0:length], "-")
+}
+
+// sanitizeNamePrefix lowercases the given prefix and replaces any character
+// outside [a-z0-9-] with '-'. Runs of '-' are collapsed into a single '-', and
+// leading and trailing '-' are trimmed.
+func sanitizeNamePrefix(prefix string) string {
+	var b strings.Builder
+	b.Grow(len(prefix))
+	var prev rune
+	for _, r := range strings.ToLower(prefix) {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			r = '-'
+		}
+		if r == '-' && prev == '-' {
+			continue
+		}
+		b.WriteRune(r)
+		prev = r
+	}
+	return strings.Trim(b.String(), "-")
 }
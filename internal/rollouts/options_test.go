@@ -1,10 +1,21 @@
 package rollouts
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apimachineryvalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/storage/names"
+	"k8s.io/utils/ptr"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
 )
 
 func TestAnalysisRunOptions(t *testing.T) {
@@ -25,10 +36,57 @@ func TestAnalysisRunOptions(t *testing.T) {
 		{
 			name: "name prefix truncates long prefix",
 			options: []AnalysisRunOption{
-				WithNamePrefix("a" + stringWithLength(maxNamePrefixLength+10)),
+				WithNamePrefix("a" + stringWithLength(maxUnsuffixedNamePrefixLength+10)),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Len(t, opts.NamePrefix, maxUnsuffixedNamePrefixLength)
+			},
+		},
+		{
+			name: "name prefix with mixed case",
+			options: []AnalysisRunOption{
+				WithNamePrefix("Test-Prefix"),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Equal(t, "test-prefix", opts.NamePrefix)
+			},
+		},
+		{
+			name: "name prefix with dots and underscores",
+			options: []AnalysisRunOption{
+				WithNamePrefix("my.test_prefix"),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Equal(t, "my-test-prefix", opts.NamePrefix)
+			},
+		},
+		{
+			name: "name prefix collapses and trims separators",
+			options: []AnalysisRunOption{
+				WithNamePrefix("--my..test__prefix--"),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Equal(t, "my-test-prefix", opts.NamePrefix)
+			},
+		},
+		{
+			name: "name prefix empty after sanitization",
+			options: []AnalysisRunOption{
+				WithNamePrefix("._."),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Empty(t, opts.NamePrefix)
+			},
+		},
+		{
+			name: "name prefix is truncated after sanitization",
+			options: []AnalysisRunOption{
+				WithNamePrefix(strings.Repeat("A_", maxUnsuffixedNamePrefixLength)),
 			},
 			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
-				assert.Len(t, opts.NamePrefix, maxNamePrefixLength)
+				assert.LessOrEqual(t, len(opts.NamePrefix), maxUnsuffixedNamePrefixLength)
+				assert.True(t, strings.HasPrefix(opts.NamePrefix, "a-a-"))
+				assert.False(t, strings.HasSuffix(opts.NamePrefix, "-"))
 			},
 		},
 		{
@@ -41,12 +99,22 @@ func TestAnalysisRunOptions(t *testing.T) {
 			},
 		},
 		{
-			name: "name suffix truncates long suffix",
+			name: "name suffix is kept until name generation",
 			options: []AnalysisRunOption{
 				WithNameSuffix("a" + stringWithLength(maxNameSuffixLength+10)),
 			},
 			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
-				assert.Len(t, opts.NameSuffix, maxNameSuffixLength)
+				assert.Len(t, opts.NameSuffix, maxNameSuffixLength+11)
+				assert.Empty(t, opts.truncations)
+			},
+		},
+		{
+			name: "suffix length",
+			options: []AnalysisRunOption{
+				WithSuffixLength(12),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Equal(t, 12, opts.SuffixLength)
 			},
 		},
 		{
@@ -74,6 +142,86 @@ func TestAnalysisRunOptions(t *testing.T) {
 				}, opts.ExtraLabels)
 			},
 		},
+		{
+			name:    "extra annotations: not set",
+			options: []AnalysisRunOption{},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Nil(t, opts.ExtraAnnotations)
+			},
+		},
+		{
+			name: "extra annotations: single set",
+			options: []AnalysisRunOption{
+				WithExtraAnnotations{"key1": "value1", "key2": "value2"},
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Equal(t, map[string]string{
+					"key1": "value1",
+					"key2": "value2",
+				}, opts.ExtraAnnotations)
+			},
+		},
+		{
+			name: "extra annotations: multiple sets are merged",
+			options: []AnalysisRunOption{
+				WithExtraAnnotations{"key1": "value1"},
+				WithExtraAnnotations{"key2": "value2"},
+				WithExtraAnnotations{"key1": "override"},
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Equal(t, map[string]string{
+					"key1": "override",
+					"key2": "value2",
+				}, opts.ExtraAnnotations)
+			},
+		},
+		{
+			name: "inherited annotations: only requested keys present on the object are copied",
+			options: []AnalysisRunOption{
+				WithInheritedAnnotations(&kargoapi.Promotion{
+					ObjectMeta: metav1.ObjectMeta{
+						Annotations: map[string]string{
+							"example.com/git-commit": "abc123",
+							"example.com/author":     "someone",
+						},
+					},
+				}, "example.com/git-commit", "example.com/missing"),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Equal(t, map[string]string{
+					"example.com/git-commit": "abc123",
+				}, opts.ExtraAnnotations)
+			},
+		},
+		{
+			name: "inherited annotations: no requested keys present on the object",
+			options: []AnalysisRunOption{
+				WithInheritedAnnotations(&kargoapi.Promotion{}, "example.com/git-commit"),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Nil(t, opts.ExtraAnnotations)
+			},
+		},
+		{
+			name: "inherited annotations: nil object",
+			options: []AnalysisRunOption{
+				WithInheritedAnnotations(nil, "example.com/git-commit"),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Nil(t, opts.ExtraAnnotations)
+				assert.ErrorContains(t, opts.Validate(), "inherit annotations: missing object")
+			},
+		},
+		{
+			name: "inherited annotations: typed nil object",
+			options: []AnalysisRunOption{
+				WithInheritedAnnotations((*kargoapi.Promotion)(nil), "example.com/git-commit"),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Nil(t, opts.ExtraAnnotations)
+				assert.ErrorContains(t, opts.Validate(), "inherit annotations: missing object")
+			},
+		},
 		{
 			name: "single owner",
 			options: []AnalysisRunOption{
@@ -114,12 +262,82 @@ func TestAnalysisRunOptions(t *testing.T) {
 				assert.Equal(t, "Deployment", opts.Owners[1].Kind)
 			},
 		},
+		{
+			name: "duplicate owners are deduplicated",
+			options: []AnalysisRunOption{
+				WithOwner(Owner{
+					APIVersion:    "v1",
+					Kind:          "Pod",
+					Reference:     types.NamespacedName{Name: "pod1", Namespace: "default"},
+					BlockDeletion: false,
+				}),
+				WithOwner(Owner{
+					APIVersion:    "v1",
+					Kind:          "Pod",
+					Reference:     types.NamespacedName{Name: "pod1", Namespace: "default"},
+					BlockDeletion: true,
+				}),
+				WithOwner(Owner{
+					APIVersion:    "v1",
+					Kind:          "Pod",
+					Reference:     types.NamespacedName{Name: "pod1", Namespace: "default"},
+					BlockDeletion: false,
+				}),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Equal(t, []Owner{{
+					APIVersion:    "v1",
+					Kind:          "Pod",
+					Reference:     types.NamespacedName{Name: "pod1", Namespace: "default"},
+					BlockDeletion: true,
+				}}, opts.Owners)
+			},
+		},
+		{
+			name: "duplicate owners retain controller",
+			options: []AnalysisRunOption{
+				WithOwner(Owner{
+					APIVersion: "v1",
+					Kind:       "Pod",
+					Reference:  types.NamespacedName{Name: "pod1", Namespace: "default"},
+					Controller: true,
+				}),
+				WithOwner(Owner{
+					APIVersion: "v1",
+					Kind:       "Pod",
+					Reference:  types.NamespacedName{Name: "pod1", Namespace: "default"},
+				}),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				require.Len(t, opts.Owners, 1)
+				assert.True(t, opts.Owners[0].Controller)
+			},
+		},
+		{
+			name: "owners differing in reference are kept",
+			options: []AnalysisRunOption{
+				WithOwner(Owner{
+					APIVersion: "v1",
+					Kind:       "Pod",
+					Reference:  types.NamespacedName{Name: "pod1", Namespace: "default"},
+				}),
+				WithOwner(Owner{
+					APIVersion: "v1",
+					Kind:       "Pod",
+					Reference:  types.NamespacedName{Name: "pod1", Namespace: "other"},
+				}),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Len(t, opts.Owners, 2)
+			},
+		},
 		{
 			name: "combined options",
 			options: []AnalysisRunOption{
 				WithNamePrefix("prefix"),
 				WithNameSuffix("suffix"),
 				WithExtraLabels{"key": "value"},
+				WithExtraAnnotations{"annotation": "value"},
 				WithOwner(Owner{
 					APIVersion: "v1",
 					Kind:       "Pod",
@@ -130,9 +348,74 @@ func TestAnalysisRunOptions(t *testing.T) {
 				assert.Equal(t, "prefix", opts.NamePrefix)
 				assert.Equal(t, "suffix", opts.NameSuffix)
 				assert.Equal(t, map[string]string{"key": "value"}, opts.ExtraLabels)
+				assert.Equal(t, map[string]string{"annotation": "value"}, opts.ExtraAnnotations)
 				assert.Len(t, opts.Owners, 1)
 			},
 		},
+		{
+			name: "content hash suffix",
+			options: []AnalysisRunOption{
+				WithContentHashSuffix("template", "freight"),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Equal(t, contentHash("template", "freight"), opts.NameSuffix)
+				assert.Len(t, opts.NameSuffix, maxNameSuffixLength)
+				assert.Empty(t, opts.truncations)
+			},
+		},
+		{
+			name: "args are merged",
+			options: []AnalysisRunOption{
+				WithArgs{"arg1": "value1", "arg2": "value2"},
+				WithArgs{"arg2": "override"},
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Equal(t, map[string]string{"arg1": "value1", "arg2": "override"}, opts.Args)
+			},
+		},
+		{
+			name: "templates are appended in order without duplicates",
+			options: []AnalysisRunOption{
+				WithTemplates{"template2", "template1"},
+				WithTemplates{"template1", "template3"},
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Equal(t, []string{"template2", "template1", "template3"}, opts.Templates)
+			},
+		},
+		{
+			name: "dry-run metrics and measurement retention",
+			options: []AnalysisRunOption{
+				WithDryRunMetrics{"metric1", "metric2"},
+				WithDryRunMetrics{"metric2"},
+				WithMeasurementRetention("metric1", 5),
+				WithMeasurementRetention("metric1", 10),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Equal(t, []string{"metric1", "metric2"}, opts.DryRunMetrics)
+				assert.Equal(t, map[string]int32{"metric1": 10}, opts.MeasurementRetention)
+			},
+		},
+		{
+			name: "finalizers are deduplicated",
+			options: []AnalysisRunOption{
+				WithFinalizers("example.com/archive", "example.com/cleanup"),
+				WithFinalizers("example.com/archive"),
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Equal(t, []string{"example.com/archive", "example.com/cleanup"}, opts.Finalizers)
+			},
+		},
+		{
+			name: "cluster templates are accumulated without duplicates",
+			options: []AnalysisRunOption{
+				WithClusterTemplates{"template1", "template2"},
+				WithClusterTemplates{"template2", "template3"},
+			},
+			assertions: func(t *testing.T, opts *AnalysisRunOptions) {
+				assert.Equal(t, []string{"template1", "template2", "template3"}, opts.ClusterTemplates)
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -144,6 +427,1022 @@ func TestAnalysisRunOptions(t *testing.T) {
 	}
 }
 
+func TestNewAnalysisRunOptions(t *testing.T) {
+	t.Run("no options", func(t *testing.T) {
+		opts := NewAnalysisRunOptions()
+		require.NotNil(t, opts)
+		assert.Equal(t, &AnalysisRunOptions{}, opts)
+	})
+
+	t.Run("interface options", func(t *testing.T) {
+		opts := NewAnalysisRunOptions(
+			WithNamePrefix("prefix"),
+			WithNameSuffix("suffix"),
+			WithExtraLabels{"key": "value"},
+		)
+		assert.Equal(t, "prefix", opts.NamePrefix)
+		assert.Equal(t, "suffix", opts.NameSuffix)
+		assert.Equal(t, map[string]string{"key": "value"}, opts.ExtraLabels)
+	})
+
+	t.Run("functional options", func(t *testing.T) {
+		opts := NewAnalysisRunOptions(
+			WithNamePrefix("prefix"),
+			AnalysisRunOptionFunc(func(o *AnalysisRunOptions) {
+				o.NameSuffix = "custom"
+			}),
+		)
+		assert.Equal(t, "prefix", opts.NamePrefix)
+		assert.Equal(t, "custom", opts.NameSuffix)
+	})
+
+	t.Run("equivalent to Apply", func(t *testing.T) {
+		options := []AnalysisRunOption{
+			WithNamePrefix("prefix"),
+			WithExtraAnnotations{"key": "value"},
+		}
+		applied := &AnalysisRunOptions{}
+		applied.Apply(options...)
+		assert.Equal(t, applied, NewAnalysisRunOptions(options...))
+	})
+}
+
+func TestWithExtraLabels_doesNotAliasMap(t *testing.T) {
+	labels := map[string]string{"key": "value"}
+
+	opts := &AnalysisRunOptions{}
+	opts.Apply(WithExtraLabels(labels))
+
+	labels["key"] = "mutated"
+	labels["other"] = "value"
+
+	assert.Equal(t, map[string]string{"key": "value"}, opts.ExtraLabels)
+}
+
+func TestWithArgs_merge(t *testing.T) {
+	defaults := map[string]string{"service": "default", "region": "eu-west-1", "timeout": "5m"}
+
+	opts := NewAnalysisRunOptions(
+		WithArgs(defaults),
+		WithArgs(nil),
+		WithArgs{"service": "stage", "replicas": "3"},
+		WithArgs{"service": "freight", "region": "us-east-1"},
+	)
+	defaults["timeout"] = "mutated"
+
+	assert.Equal(t, map[string]string{
+		"service":  "freight",
+		"region":   "us-east-1",
+		"timeout":  "5m",
+		"replicas": "3",
+	}, opts.Args)
+}
+
+func TestWithExtraAnnotations_doesNotAliasMap(t *testing.T) {
+	annotations := map[string]string{"key": "value"}
+
+	opts := &AnalysisRunOptions{}
+	opts.Apply(WithExtraAnnotations(annotations))
+
+	annotations["key"] = "mutated"
+	annotations["other"] = "value"
+
+	assert.Equal(t, map[string]string{"key": "value"}, opts.ExtraAnnotations)
+}
+
+func TestWithOwnerObject(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, kargoapi.AddToScheme(scheme))
+
+	t.Run("registered type", func(t *testing.T) {
+		opts := NewAnalysisRunOptions(WithOwnerObject(&kargoapi.Stage{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "project",
+				Name:      "stage",
+			},
+		}, scheme))
+		require.NoError(t, opts.Validate())
+		assert.Equal(t, []Owner{{
+			APIVersion:    kargoapi.GroupVersion.String(),
+			Kind:          "Stage",
+			Reference:     types.NamespacedName{Namespace: "project", Name: "stage"},
+			BlockDeletion: true,
+		}}, opts.Owners)
+	})
+
+	t.Run("with UID", func(t *testing.T) {
+		stage := &kargoapi.Stage{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "project",
+				Name:      "stage",
+				UID:       "stage-uid",
+			},
+		}
+		opts := NewAnalysisRunOptions(WithOwnerObject(stage, scheme))
+		require.NoError(t, opts.Validate())
+		require.Len(t, opts.Owners, 1)
+		assert.Equal(t, types.UID("stage-uid"), opts.Owners[0].UID)
+
+		ar, err := Build("project", nil, nil, WithOwnerObject(stage, scheme))
+		require.NoError(t, err)
+		assert.Equal(t, []metav1.OwnerReference{{
+			APIVersion:         kargoapi.GroupVersion.String(),
+			Kind:               "Stage",
+			Name:               "stage",
+			UID:                "stage-uid",
+			BlockOwnerDeletion: ptr.To(true),
+		}}, ar.OwnerReferences)
+	})
+
+	t.Run("WithOwner without UID", func(t *testing.T) {
+		ar, err := Build("project", nil, nil, WithOwner(Owner{
+			APIVersion:    kargoapi.GroupVersion.String(),
+			Kind:          "Stage",
+			Reference:     types.NamespacedName{Namespace: "project", Name: "stage"},
+			BlockDeletion: true,
+		}))
+		require.NoError(t, err)
+		require.Len(t, ar.OwnerReferences, 1)
+		assert.Empty(t, ar.OwnerReferences[0].UID)
+	})
+
+	t.Run("composes with WithOwner", func(t *testing.T) {
+		opts := NewAnalysisRunOptions(
+			WithOwner(Owner{
+				APIVersion: kargoapi.GroupVersion.String(),
+				Kind:       "Stage",
+				Reference:  types.NamespacedName{Namespace: "project", Name: "stage"},
+				Controller: true,
+			}),
+			WithOwnerObject(&kargoapi.Stage{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "project",
+					Name:      "stage",
+				},
+			}, scheme),
+		)
+		require.Len(t, opts.Owners, 1)
+		assert.True(t, opts.Owners[0].BlockDeletion)
+		assert.True(t, opts.Owners[0].Controller)
+	})
+
+	t.Run("keeps UID of duplicate", func(t *testing.T) {
+		opts := NewAnalysisRunOptions(
+			WithOwnerObject(&kargoapi.Stage{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "project",
+					Name:      "stage",
+					UID:       "stage-uid",
+				},
+			}, scheme),
+			WithOwner(Owner{
+				APIVersion: kargoapi.GroupVersion.String(),
+				Kind:       "Stage",
+				Reference:  types.NamespacedName{Namespace: "project", Name: "stage"},
+				Controller: true,
+			}),
+		)
+		require.Len(t, opts.Owners, 1)
+		assert.Equal(t, types.UID("stage-uid"), opts.Owners[0].UID)
+		assert.True(t, opts.Owners[0].Controller)
+	})
+
+	t.Run("unregistered type", func(t *testing.T) {
+		opts := NewAnalysisRunOptions(WithOwnerObject(&rolloutsapi.AnalysisRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "project",
+				Name:      "run",
+			},
+		}, scheme))
+		assert.Empty(t, opts.Owners)
+		assert.ErrorContains(t, opts.Validate(), "resolve owner kind")
+	})
+}
+
+func TestWithControllerOwner(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, kargoapi.AddToScheme(scheme))
+
+	stage := &kargoapi.Stage{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "project",
+			Name:      "stage",
+		},
+	}
+
+	t.Run("registered type", func(t *testing.T) {
+		opts := NewAnalysisRunOptions(WithControllerOwner(stage, scheme))
+		require.NoError(t, opts.Validate())
+		assert.Equal(t, []Owner{{
+			APIVersion:    kargoapi.GroupVersion.String(),
+			Kind:          "Stage",
+			Reference:     types.NamespacedName{Namespace: "project", Name: "stage"},
+			BlockDeletion: true,
+			Controller:    true,
+		}}, opts.Owners)
+	})
+
+	t.Run("unregistered type", func(t *testing.T) {
+		opts := NewAnalysisRunOptions(WithControllerOwner(stage, runtime.NewScheme()))
+		assert.Empty(t, opts.Owners)
+		assert.ErrorContains(t, opts.Validate(), "resolve owner kind")
+	})
+
+	t.Run("second controller owner", func(t *testing.T) {
+		ar, err := Build(
+			"project",
+			nil,
+			nil,
+			WithControllerOwner(stage, scheme),
+			WithOwner(Owner{
+				APIVersion: kargoapi.GroupVersion.String(),
+				Kind:       "Freight",
+				Reference:  types.NamespacedName{Namespace: "project", Name: "freight"},
+				Controller: true,
+			}),
+		)
+		assert.ErrorContains(t, err, "only one owner can be a controller")
+		assert.Nil(t, ar)
+	})
+}
+
+func TestWithReferenceOwner(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, kargoapi.AddToScheme(scheme))
+
+	stage := &kargoapi.Stage{ObjectMeta: metav1.ObjectMeta{Namespace: "project", Name: "stage"}}
+	freight := &kargoapi.Freight{ObjectMeta: metav1.ObjectMeta{Namespace: "project", Name: "freight"}}
+	promotion := &kargoapi.Promotion{ObjectMeta: metav1.ObjectMeta{Namespace: "project", Name: "promotion"}}
+
+	t.Run("mixed with a controller owner", func(t *testing.T) {
+		ar, err := Build(
+			"project",
+			nil,
+			nil,
+			WithControllerOwner(stage, scheme),
+			WithReferenceOwner(freight, scheme),
+			WithReferenceOwner(promotion, scheme),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, []metav1.OwnerReference{
+			{
+				APIVersion:         kargoapi.GroupVersion.String(),
+				Kind:               "Stage",
+				Name:               "stage",
+				BlockOwnerDeletion: ptr.To(true),
+				Controller:         ptr.To(true),
+			},
+			{
+				APIVersion:         kargoapi.GroupVersion.String(),
+				Kind:               "Freight",
+				Name:               "freight",
+				BlockOwnerDeletion: ptr.To(false),
+			},
+			{
+				APIVersion:         kargoapi.GroupVersion.String(),
+				Kind:               "Promotion",
+				Name:               "promotion",
+				BlockOwnerDeletion: ptr.To(false),
+			},
+		}, ar.OwnerReferences)
+	})
+
+	t.Run("unregistered type", func(t *testing.T) {
+		opts := NewAnalysisRunOptions(WithReferenceOwner(freight, runtime.NewScheme()))
+		assert.Empty(t, opts.Owners)
+		assert.ErrorContains(t, opts.Validate(), "resolve owner kind")
+	})
+}
+
+func TestAnalysisRunOptions_DeepCopy(t *testing.T) {
+	t.Run("nil", func(t *testing.T) {
+		var opts *AnalysisRunOptions
+		assert.Nil(t, opts.DeepCopy())
+	})
+
+	t.Run("deriving variants does not affect the original", func(t *testing.T) {
+		base := &AnalysisRunOptions{}
+		base.Apply(
+			WithNamePrefix("base"),
+			WithExtraLabels{"key": "value"},
+			WithExtraAnnotations{"key": "value"},
+			WithArgs{"arg": "value"},
+			WithClusterTemplates{"template1"},
+			WithOwner(Owner{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Reference:  types.NamespacedName{Name: "pod1", Namespace: "default"},
+			}),
+		)
+
+		variant := base.DeepCopy()
+		require.Equal(t, base, variant)
+
+		variant.Apply(
+			WithNamePrefix("variant"),
+			WithExtraLabels{"key": "override", "other": "value"},
+			WithExtraAnnotations{"key": "override"},
+			WithArgs{"arg": "override"},
+			WithClusterTemplates{"template2"},
+			WithOwner(Owner{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Reference:  types.NamespacedName{Name: "pod1", Namespace: "default"},
+				Controller: true,
+			}),
+		)
+
+		assert.Equal(t, "base", base.NamePrefix)
+		assert.Equal(t, map[string]string{"key": "value"}, base.ExtraLabels)
+		assert.Equal(t, map[string]string{"key": "value"}, base.ExtraAnnotations)
+		assert.Equal(t, map[string]string{"arg": "value"}, base.Args)
+		assert.Equal(t, []string{"template1"}, base.ClusterTemplates)
+		require.Len(t, base.Owners, 1)
+		assert.False(t, base.Owners[0].Controller)
+
+		assert.Equal(t, "variant", variant.NamePrefix)
+		assert.Equal(t, map[string]string{"key": "override", "other": "value"}, variant.ExtraLabels)
+		assert.Equal(t, map[string]string{"key": "override"}, variant.ExtraAnnotations)
+		assert.Equal(t, map[string]string{"arg": "override"}, variant.Args)
+		assert.Equal(t, []string{"template1", "template2"}, variant.ClusterTemplates)
+		require.Len(t, variant.Owners, 1)
+		assert.True(t, variant.Owners[0].Controller)
+	})
+}
+
+func TestAnalysisRunOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    []AnalysisRunOption
+		assertions func(*testing.T, error)
+	}{
+		{
+			name:    "no options",
+			options: []AnalysisRunOption{},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "truncated name without strict naming",
+			options: []AnalysisRunOption{
+				WithNamePrefix(stringWithLength(maxNamePrefixLength + 1)),
+				WithNameSuffix(stringWithLength(maxNameSuffixLength + 1)),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "valid labels and annotations",
+			options: []AnalysisRunOption{
+				WithExtraLabels{"example.com/key": "value", "key": ""},
+				WithExtraAnnotations{"example.com/key": strings.Repeat("a", 100)},
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "empty label and annotation keys",
+			options: []AnalysisRunOption{
+				WithExtraLabels{"": "value"},
+				WithExtraAnnotations{"": "value"},
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "metadata.labels: Invalid value")
+				assert.ErrorContains(t, err, "metadata.annotations: Invalid value")
+			},
+		},
+		{
+			name: "excluded invalid label",
+			options: []AnalysisRunOption{
+				WithExtraLabels{"key": "-invalid-"},
+				WithExcludedLabelPrefixes{"key"},
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "too long label value",
+			options: []AnalysisRunOption{
+				WithExtraLabels{"key": strings.Repeat("a", 64)},
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "metadata.labels: Invalid value")
+				assert.ErrorContains(t, err, "must be no more than 63 characters")
+			},
+		},
+		{
+			name: "invalid label value",
+			options: []AnalysisRunOption{
+				WithExtraLabels{"key": "-invalid-"},
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `metadata.labels: Invalid value: "-invalid-"`)
+			},
+		},
+		{
+			name: "invalid label and annotation key prefixes",
+			options: []AnalysisRunOption{
+				WithExtraLabels{"Invalid_Prefix/key": "value"},
+				WithExtraAnnotations{"invalid..prefix/key": "value"},
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `metadata.labels: Invalid value: "Invalid_Prefix/key"`)
+				assert.ErrorContains(t, err, `metadata.annotations: Invalid value: "invalid..prefix/key"`)
+			},
+		},
+		{
+			name: "valid verification ID",
+			options: []AnalysisRunOption{
+				WithVerificationID("01hrz6k7zw0000000000000000"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "invalid verification ID",
+			options: []AnalysisRunOption{
+				WithVerificationID("invalid/id"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `verification ID "invalid/id" is not a valid label value`)
+			},
+		},
+		{
+			name: "negative attempt",
+			options: []AnalysisRunOption{
+				WithAttempt(-1),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "attempt -1 must not be negative")
+			},
+		},
+		{
+			name: "attempt exceeding suffix length",
+			options: []AnalysisRunOption{
+				WithSuffixLength(1),
+				WithAttempt(1),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `attempt "01" exceeds maximum name suffix length of 1 characters`)
+			},
+		},
+		{
+			name: "attempt truncating name suffix with strict naming",
+			options: []AnalysisRunOption{
+				WithNameSuffix("abcdef1"),
+				WithAttempt(1),
+				WithStrictNaming(true),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `name suffix "abcdef1" exceeds maximum length of 4 characters`)
+			},
+		},
+		{
+			name: "too long correlation ID",
+			options: []AnalysisRunOption{
+				WithCorrelationID(stringWithLength(apimachineryvalidation.TotalAnnotationSizeLimitB)),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "correlation ID is not a valid annotation value")
+			},
+		},
+		{
+			name: "negative deadline",
+			options: []AnalysisRunOption{
+				WithDeadline(-time.Minute),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "deadline -1m0s must not be negative")
+			},
+		},
+		{
+			name: "generated name",
+			options: []AnalysisRunOption{
+				WithNamePrefix(stringWithLength(names.MaxGeneratedNameLength - 1)),
+				WithGenerateName(),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "generated name exceeding budget",
+			options: []AnalysisRunOption{
+				WithNamePrefix(stringWithLength(names.MaxGeneratedNameLength)),
+				WithGenerateName(),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "exceeds maximum length of 58 characters to leave room for the random suffix")
+			},
+		},
+		{
+			name: "generated name exceeding maximum name length",
+			options: []AnalysisRunOption{
+				WithNamePrefix(stringWithLength(ulidLength)),
+				WithMaxNameLength(ulidLength),
+				WithGenerateName(),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "exceeds maximum length of 21 characters")
+			},
+		},
+		{
+			name: "generated name without name prefix",
+			options: []AnalysisRunOption{
+				WithGenerateName(),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "generated name requires a name prefix")
+			},
+		},
+		{
+			name: "generated name with explicit name",
+			options: []AnalysisRunOption{
+				WithExplicitName("analysis-run"),
+				WithGenerateName(),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `explicit name "analysis-run" cannot be combined with a generated name`)
+			},
+		},
+		{
+			name: "long target cluster",
+			options: []AnalysisRunOption{
+				WithTargetCluster(stringWithLength(100)),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "invalid target cluster",
+			options: []AnalysisRunOption{
+				WithTargetCluster("cluster/east"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `target cluster "cluster/east" is not a valid label value`)
+			},
+		},
+		{
+			name: "valid Git revision",
+			options: []AnalysisRunOption{
+				WithGitRevision("https://github.com/akuity/kargo.git", "abcdef0"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "valid Git revision in SCP-like syntax",
+			options: []AnalysisRunOption{
+				WithGitRevision(
+					"git@github.com:akuity/kargo.git",
+					"ABCDEF0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+				),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "invalid Git repository URL",
+			options: []AnalysisRunOption{
+				WithGitRevision("https://", "abcdef0"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `invalid Git repository URL "https://"`)
+			},
+		},
+		{
+			name: "invalid Git commit",
+			options: []AnalysisRunOption{
+				WithGitRevision("ssh://git@github.com/akuity/kargo.git", "main"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `invalid Git commit "main": must be a hexadecimal SHA`)
+			},
+		},
+		{
+			name: "abbreviated Git commit too short",
+			options: []AnalysisRunOption{
+				WithGitRevision("ssh://git@github.com/akuity/kargo.git", "abcdef"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `invalid Git commit "abcdef"`)
+			},
+		},
+		{
+			name: "incomplete Git revision",
+			options: []AnalysisRunOption{
+				WithGitRevision("", "abcdef0"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "repository URL is required when a Git commit is set")
+			},
+		},
+		{
+			name: "Git repository URL without commit",
+			options: []AnalysisRunOption{
+				WithGitRevision("not a URL", ""),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `invalid Git repository URL "not a URL"`)
+				assert.ErrorContains(t, err, "commit is required when a Git repository URL is set")
+			},
+		},
+		{
+			name: "negative concurrency limit",
+			options: []AnalysisRunOption{
+				WithConcurrencyLimit(-1),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "concurrency limit -1 must not be negative")
+			},
+		},
+		{
+			name: "negative maximum run duration",
+			options: []AnalysisRunOption{
+				WithMaxRunDuration(-time.Hour),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "maximum run duration -1h0m0s must not be negative")
+			},
+		},
+		{
+			name: "valid finalizers",
+			options: []AnalysisRunOption{
+				WithFinalizers("example.com/archive", "archive"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "invalid finalizers",
+			options: []AnalysisRunOption{
+				WithFinalizers("", "example.com/invalid/archive", "-archive"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `invalid finalizer ""`)
+				assert.ErrorContains(t, err, `invalid finalizer "example.com/invalid/archive"`)
+				assert.ErrorContains(t, err, `invalid finalizer "-archive"`)
+			},
+		},
+		{
+			name: "strict naming within limits",
+			options: []AnalysisRunOption{
+				WithStrictNaming(true),
+				WithNamePrefix(stringWithLength(maxNamePrefixLength)),
+				WithNameSuffix(stringWithLength(maxNameSuffixLength)),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "strict naming with long prefix",
+			options: []AnalysisRunOption{
+				WithStrictNaming(true),
+				WithNamePrefix(stringWithLength(maxNamePrefixLength + 1)),
+				WithNameSuffix("abc"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "name prefix")
+				assert.ErrorContains(t, err, "exceeds maximum length of 218 characters")
+			},
+		},
+		{
+			name: "strict naming with long prefix overridden by short prefix",
+			options: []AnalysisRunOption{
+				WithStrictNaming(true),
+				WithNamePrefix(stringWithLength(300)),
+				WithNamePrefix("short"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "strict naming with long suffix",
+			options: []AnalysisRunOption{
+				WithStrictNaming(true),
+				WithNameSuffix("abcdef12345"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `name suffix "abcdef12345" exceeds maximum length of 7 characters`)
+			},
+		},
+		{
+			name: "strict naming with reduced maximum name length",
+			options: []AnalysisRunOption{
+				WithStrictNaming(true),
+				WithMaxNameLength(63),
+				WithNamePrefix(stringWithLength(30)),
+				WithNameSuffix("abc"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "exceeds maximum length of 28 characters")
+			},
+		},
+		{
+			name: "strict naming with reduced maximum name length without suffix",
+			options: []AnalysisRunOption{
+				WithStrictNaming(true),
+				WithMaxNameLength(63),
+				WithNamePrefix(stringWithLength(36)),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "strict naming with increased suffix length",
+			options: []AnalysisRunOption{
+				WithStrictNaming(true),
+				WithNameSuffix("abcdef12345"),
+				WithSuffixLength(12),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "negative suffix length",
+			options: []AnalysisRunOption{
+				WithSuffixLength(-1),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "name suffix length -1 must not be negative")
+			},
+		},
+		{
+			name: "maximum name length too small for ULID",
+			options: []AnalysisRunOption{
+				WithMaxNameLength(10),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "maximum name length 10")
+			},
+		},
+		{
+			name: "single controller owner",
+			options: []AnalysisRunOption{
+				WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Kind:       "Stage",
+					Reference:  types.NamespacedName{Name: "stage", Namespace: "default"},
+					Controller: true,
+				}),
+				WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Kind:       "Freight",
+					Reference:  types.NamespacedName{Name: "freight", Namespace: "default"},
+				}),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "valid cluster-scoped owner",
+			options: []AnalysisRunOption{
+				WithOwner(Owner{
+					APIVersion: "v1",
+					Kind:       "Namespace",
+					Reference:  types.NamespacedName{Name: "project"},
+				}),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "owner without name",
+			options: []AnalysisRunOption{
+				WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Kind:       "Stage",
+					Reference:  types.NamespacedName{Namespace: "default"},
+				}),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.EqualError(t, err, "owner 0 is missing Name")
+			},
+		},
+		{
+			name: "owners with missing fields are listed by index",
+			options: []AnalysisRunOption{
+				WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Kind:       "Stage",
+					Reference:  types.NamespacedName{Name: "stage", Namespace: "default"},
+				}),
+				WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Reference:  types.NamespacedName{Name: "freight", Namespace: "default"},
+				}),
+				WithOwner(Owner{
+					Reference: types.NamespacedName{Namespace: "default"},
+				}),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "owner 1 is missing Kind")
+				assert.ErrorContains(t, err, "owner 2 is missing APIVersion, Kind, Name")
+				assert.NotContains(t, err.Error(), "owner 0")
+			},
+		},
+		{
+			name: "explicit namespace matching owners",
+			options: []AnalysisRunOption{
+				WithNamespace("verification"),
+				WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Kind:       "Stage",
+					Reference:  types.NamespacedName{Name: "stage", Namespace: "verification"},
+				}),
+				WithOwner(Owner{
+					APIVersion: "v1",
+					Kind:       "Namespace",
+					Reference:  types.NamespacedName{Name: "project"},
+				}),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "explicit namespace conflicting with owner",
+			options: []AnalysisRunOption{
+				WithNamespace("verification"),
+				WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Kind:       "Stage",
+					Reference:  types.NamespacedName{Name: "stage", Namespace: "default"},
+				}),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(
+					t, err,
+					`owner Stage "stage" in namespace "default" cannot own an AnalysisRun in namespace "verification"`,
+				)
+			},
+		},
+		{
+			name: "invalid explicit namespace",
+			options: []AnalysisRunOption{
+				WithNamespace("Invalid_Namespace"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `invalid namespace "Invalid_Namespace"`)
+			},
+		},
+		{
+			name: "multiple controller owners",
+			options: []AnalysisRunOption{
+				WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Kind:       "Stage",
+					Reference:  types.NamespacedName{Name: "stage", Namespace: "default"},
+					Controller: true,
+				}),
+				WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Kind:       "Freight",
+					Reference:  types.NamespacedName{Name: "freight", Namespace: "default"},
+					Controller: true,
+				}),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "only one owner can be a controller")
+				assert.ErrorContains(t, err, `Stage "stage" in namespace "default"`)
+				assert.ErrorContains(t, err, `Freight "freight" in namespace "default"`)
+			},
+		},
+		{
+			name: "valid explicit name",
+			options: []AnalysisRunOption{
+				WithExplicitName("stage.verification-1"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "explicit name of maximum length",
+			options: []AnalysisRunOption{
+				WithExplicitName(stringWithLength(maxNameLength)),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "too long explicit name",
+			options: []AnalysisRunOption{
+				WithExplicitName(stringWithLength(maxNameLength + 1)),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "exceeds maximum length of 253 characters")
+			},
+		},
+		{
+			name: "explicit name exceeding reduced maximum name length",
+			options: []AnalysisRunOption{
+				WithMaxNameLength(63),
+				WithExplicitName(stringWithLength(64)),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "exceeds maximum length of 63 characters")
+			},
+		},
+		{
+			name: "invalid explicit name",
+			options: []AnalysisRunOption{
+				WithExplicitName("Invalid_Name"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, `invalid explicit name "Invalid_Name"`)
+			},
+		},
+		{
+			name: "explicit name with name prefix",
+			options: []AnalysisRunOption{
+				WithNamePrefix("prefix"),
+				WithExplicitName("explicit-name"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "cannot be combined with a name prefix or suffix")
+			},
+		},
+		{
+			name: "explicit name with name suffix",
+			options: []AnalysisRunOption{
+				WithExplicitName("explicit-name"),
+				WithNameSuffix("suffix"),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "cannot be combined with a name prefix or suffix")
+			},
+		},
+		{
+			name: "strict naming applied after name options",
+			options: []AnalysisRunOption{
+				WithNamePrefix(stringWithLength(maxNamePrefixLength + 1)),
+				WithNameSuffix("abcdef12345"),
+				WithStrictNaming(true),
+			},
+			assertions: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "name prefix")
+				assert.ErrorContains(t, err, "name suffix")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &AnalysisRunOptions{}
+			opts.Apply(tt.options...)
+			tt.assertions(t, opts.Validate())
+		})
+	}
+}
+
+func Test_sortOwners(t *testing.T) {
+	stage := Owner{
+		APIVersion: "kargo.akuity.io/v1alpha1",
+		Kind:       "Stage",
+		Reference:  types.NamespacedName{Name: "stage", Namespace: "default"},
+		Controller: true,
+	}
+	freightA := Owner{
+		APIVersion: "kargo.akuity.io/v1alpha1",
+		Kind:       "Freight",
+		Reference:  types.NamespacedName{Name: "a", Namespace: "default"},
+	}
+	freightB := Owner{
+		APIVersion: "kargo.akuity.io/v1alpha1",
+		Kind:       "Freight",
+		Reference:  types.NamespacedName{Name: "b", Namespace: "default"},
+	}
+	deployment := Owner{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Reference:  types.NamespacedName{Name: "z", Namespace: "default"},
+	}
+
+	owners := []Owner{freightB, stage, deployment, freightA}
+	sorted := sortOwners(owners)
+
+	assert.Equal(t, []Owner{stage, deployment, freightA, freightB}, sorted)
+	assert.Equal(t, []Owner{freightB, stage, deployment, freightA}, owners, "input must not be modified")
+	assert.Equal(t, sorted, sortOwners([]Owner{freightA, deployment, freightB, stage}))
+}
+
 func stringWithLength(length int) string {
 	result := make([]rune, length)
 	for i := range result {
@@ -0,0 +1,114 @@
+package rollouts
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// FindOrphans returns the AnalysisRuns whose owners all no longer exist, in
+// the order in which they appear in runs, e.g. so they can be terminated or
+// deleted. An owner no longer exists if it cannot be found, or if it was
+// recreated with another UID since the owner reference was created.
+// AnalysisRuns without owner references are never orphans.
+//
+// As owner references do not carry a namespace, the client is used to
+// determine whether the kind of each owner is namespaced, in which case the
+// owner is looked up in the namespace of the AnalysisRun. Owners shared by
+// multiple AnalysisRuns are only looked up once. It returns an error if the
+// scope of an owner cannot be determined or an owner cannot be retrieved for
+// another reason than it not being found.
+func FindOrphans(
+	ctx context.Context,
+	c client.Client,
+	runs []*rolloutsapi.AnalysisRun,
+) ([]*rolloutsapi.AnalysisRun, error) {
+	type ownerKey struct {
+		apiVersion, kind string
+		key              types.NamespacedName
+		uid              types.UID
+	}
+	exists := make(map[ownerKey]bool)
+
+	var orphans []*rolloutsapi.AnalysisRun
+	for _, run := range runs {
+		if run == nil || len(run.OwnerReferences) == 0 {
+			continue
+		}
+
+		orphaned := true
+		for _, ref := range run.OwnerReferences {
+			key, err := ownerObjectKey(c, run.Namespace, ref)
+			if err != nil {
+				return nil, err
+			}
+			k := ownerKey{apiVersion: ref.APIVersion, kind: ref.Kind, key: key, uid: ref.UID}
+			found, ok := exists[k]
+			if !ok {
+				if found, err = ownerExists(ctx, c, key, ref); err != nil {
+					return nil, err
+				}
+				exists[k] = found
+			}
+			if found {
+				orphaned = false
+				break
+			}
+		}
+		if orphaned {
+			orphans = append(orphans, run)
+		}
+	}
+	return orphans, nil
+}
+
+// ownerObjectKey returns the key of the object referenced by the given owner
+// reference of an AnalysisRun in the given namespace, which only includes the
+// namespace if the kind of the owner is namespaced.
+func ownerObjectKey(c client.Client, namespace string, ref metav1.OwnerReference) (types.NamespacedName, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(ref.APIVersion)
+	obj.SetKind(ref.Kind)
+	namespaced, err := c.IsObjectNamespaced(obj)
+	if err != nil {
+		return types.NamespacedName{}, fmt.Errorf("determine scope of owner %s %q: %w", ref.Kind, ref.Name, err)
+	}
+	if !namespaced {
+		namespace = ""
+	}
+	return types.NamespacedName{Namespace: namespace, Name: ref.Name}, nil
+}
+
+// ownerExists reports whether the object referenced by the given owner
+// reference exists with the given key and, if the reference carries a UID,
+// the same UID.
+func ownerExists(
+	ctx context.Context,
+	c client.Client,
+	key types.NamespacedName,
+	ref metav1.OwnerReference,
+) (bool, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(ref.APIVersion)
+	obj.SetKind(ref.Kind)
+	if err := c.Get(ctx, key, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf(
+			"get %s %q in namespace %q: %w",
+			ref.Kind,
+			key.Name,
+			key.Namespace,
+			err,
+		)
+	}
+	return ref.UID == "" || obj.GetUID() == ref.UID, nil
+}
@@ -0,0 +1,183 @@
+package rollouts
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestFindOrphans(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, kargoapi.AddToScheme(scheme))
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(kargoapi.GroupVersion.WithKind("Stage"), meta.RESTScopeNamespace)
+	mapper.Add(kargoapi.GroupVersion.WithKind("Freight"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Namespace"), meta.RESTScopeRoot)
+
+	stageRef := func(name, uid string) metav1.OwnerReference {
+		return metav1.OwnerReference{
+			APIVersion: kargoapi.GroupVersion.String(),
+			Kind:       "Stage",
+			Name:       name,
+			UID:        types.UID(uid),
+		}
+	}
+	freightRef := metav1.OwnerReference{
+		APIVersion: kargoapi.GroupVersion.String(),
+		Kind:       "Freight",
+		Name:       "freight",
+	}
+	namespaceRef := metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "Namespace",
+		Name:       "project",
+	}
+	newRun := func(name string, refs ...metav1.OwnerReference) *rolloutsapi.AnalysisRun {
+		return &rolloutsapi.AnalysisRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "project",
+				Name:            name,
+				OwnerReferences: refs,
+			},
+		}
+	}
+	names := func(runs []*rolloutsapi.AnalysisRun) []string {
+		out := make([]string, len(runs))
+		for i, run := range runs {
+			out[i] = run.Name
+		}
+		return out
+	}
+	objects := []client.Object{
+		&kargoapi.Stage{ObjectMeta: metav1.ObjectMeta{Namespace: "project", Name: "stage", UID: "stage-uid"}},
+		&kargoapi.Stage{ObjectMeta: metav1.ObjectMeta{Namespace: "other-project", Name: "other-stage"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "project"}},
+	}
+
+	tests := []struct {
+		name        string
+		runs        []*rolloutsapi.AnalysisRun
+		interceptor interceptor.Funcs
+		assertions  func(*testing.T, []*rolloutsapi.AnalysisRun, error)
+	}{
+		{
+			name: "present owner",
+			runs: []*rolloutsapi.AnalysisRun{
+				newRun("run", stageRef("stage", "stage-uid")),
+				newRun("without-uid", stageRef("stage", "")),
+			},
+			assertions: func(t *testing.T, orphans []*rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Empty(t, orphans)
+			},
+		},
+		{
+			name: "missing owner",
+			runs: []*rolloutsapi.AnalysisRun{
+				newRun("run", stageRef("stage", "stage-uid")),
+				newRun("missing", stageRef("missing", "")),
+				// The Stage exists, but in another namespace.
+				newRun("other-namespace", stageRef("other-stage", "")),
+			},
+			assertions: func(t *testing.T, orphans []*rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []string{"missing", "other-namespace"}, names(orphans))
+			},
+		},
+		{
+			name: "recreated owner",
+			runs: []*rolloutsapi.AnalysisRun{
+				newRun("run", stageRef("stage", "old-uid")),
+			},
+			assertions: func(t *testing.T, orphans []*rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []string{"run"}, names(orphans))
+			},
+		},
+		{
+			name: "multiple owners",
+			runs: []*rolloutsapi.AnalysisRun{
+				newRun("one-present", freightRef, stageRef("stage", "stage-uid")),
+				newRun("all-missing", freightRef, stageRef("missing", "")),
+			},
+			assertions: func(t *testing.T, orphans []*rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []string{"all-missing"}, names(orphans))
+			},
+		},
+		{
+			name: "cluster-scoped owner",
+			runs: []*rolloutsapi.AnalysisRun{
+				newRun("present", namespaceRef),
+				newRun("missing", metav1.OwnerReference{APIVersion: "v1", Kind: "Namespace", Name: "missing"}),
+			},
+			assertions: func(t *testing.T, orphans []*rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []string{"missing"}, names(orphans))
+			},
+		},
+		{
+			name: "without owners",
+			runs: []*rolloutsapi.AnalysisRun{newRun("run"), nil},
+			assertions: func(t *testing.T, orphans []*rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Empty(t, orphans)
+			},
+		},
+		{
+			name: "unknown owner kind",
+			runs: []*rolloutsapi.AnalysisRun{
+				newRun("run", metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "Unknown", Name: "owner"}),
+			},
+			assertions: func(t *testing.T, orphans []*rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, `determine scope of owner Unknown "owner"`)
+				assert.Nil(t, orphans)
+			},
+		},
+		{
+			name: "get error",
+			runs: []*rolloutsapi.AnalysisRun{
+				newRun("run", stageRef("stage", "stage-uid")),
+			},
+			interceptor: interceptor.Funcs{
+				Get: func(context.Context, client.WithWatch, client.ObjectKey, client.Object, ...client.GetOption) error {
+					return errors.New("something went wrong")
+				},
+			},
+			assertions: func(t *testing.T, orphans []*rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, `get Stage "stage" in namespace "project"`)
+				assert.ErrorContains(t, err, "something went wrong")
+				assert.Nil(t, orphans)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRESTMapper(mapper).
+				WithObjects(objects...).
+				WithInterceptorFuncs(tt.interceptor).
+				Build()
+			orphans, err := FindOrphans(context.Background(), c, tt.runs)
+			tt.assertions(t, orphans, err)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package rollouts
+
+import (
+	"time"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// PhaseToVerificationState maps the phase of an AnalysisRun to the phase of
+// the Kargo verification it backs, and reports whether that phase is terminal.
+//
+// An empty phase, as observed before the Argo Rollouts controller picked up
+// the AnalysisRun, maps to kargoapi.VerificationPhasePending. Any phase which
+// is not recognized maps to kargoapi.VerificationPhaseError, so that a
+// verification never waits indefinitely for a phase it cannot interpret.
+func PhaseToVerificationState(phase rolloutsapi.AnalysisPhase) (kargoapi.VerificationPhase, bool) {
+	var state kargoapi.VerificationPhase
+	switch phase {
+	case "", rolloutsapi.AnalysisPhasePending:
+		state = kargoapi.VerificationPhasePending
+	case rolloutsapi.AnalysisPhaseRunning:
+		state = kargoapi.VerificationPhaseRunning
+	case rolloutsapi.AnalysisPhaseSuccessful:
+		state = kargoapi.VerificationPhaseSuccessful
+	case rolloutsapi.AnalysisPhaseFailed:
+		state = kargoapi.VerificationPhaseFailed
+	case rolloutsapi.AnalysisPhaseError:
+		state = kargoapi.VerificationPhaseError
+	case rolloutsapi.AnalysisPhaseInconclusive:
+		state = kargoapi.VerificationPhaseInconclusive
+	default:
+		state = kargoapi.VerificationPhaseError
+	}
+	return state, state.IsTerminal()
+}
+
+// ClassifyStuck returns the phase the given AnalysisRun should be considered
+// to be in at the given time. If the AnalysisRun is still running after the
+// maximum run duration set using WithMaxRunDuration has been exceeded, it
+// returns rolloutsapi.AnalysisPhaseError, so that it can be treated as an
+// error instead of being waited on indefinitely. Otherwise, it returns the
+// phase of the AnalysisRun. The start of the AnalysisRun is taken from its
+// status, or its creation time if it has not been reported. The AnalysisRun
+// itself is never modified.
+func ClassifyStuck(ar *rolloutsapi.AnalysisRun, now time.Time) rolloutsapi.AnalysisPhase {
+	if ar == nil {
+		return ""
+	}
+	phase := ar.Status.Phase
+	if phase != rolloutsapi.AnalysisPhaseRunning {
+		return phase
+	}
+	value, ok := ar.Annotations[maxRunDurationAnnotationKey]
+	if !ok {
+		return phase
+	}
+	maxDuration, err := time.ParseDuration(value)
+	if err != nil || maxDuration <= 0 {
+		return phase
+	}
+	startedAt := ar.CreationTimestamp.Time
+	if ar.Status.StartedAt != nil {
+		startedAt = ar.Status.StartedAt.Time
+	}
+	if startedAt.IsZero() || !now.After(startedAt.Add(maxDuration)) {
+		return phase
+	}
+	return rolloutsapi.AnalysisPhaseError
+}
+
+// AggregateResult returns the phase of a verification backed by the given
+// AnalysisRuns, e.g. the AnalysisRuns of a matrix verification. The phases of
+// the AnalysisRuns are mapped using PhaseToVerificationState and aggregated
+// in order of precedence:
+//
+//   - kargoapi.VerificationPhaseFailed if any AnalysisRun failed.
+//   - kargoapi.VerificationPhaseError if any AnalysisRun resulted in an
+//     error.
+//   - kargoapi.VerificationPhaseRunning if any AnalysisRun is not terminal
+//     yet, including AnalysisRuns which are still pending.
+//   - kargoapi.VerificationPhaseSuccessful if all AnalysisRuns succeeded.
+//   - kargoapi.VerificationPhaseInconclusive otherwise.
+//
+// As a verification without AnalysisRuns has not started, it returns
+// kargoapi.VerificationPhasePending if no AnalysisRuns are given. Nil
+// AnalysisRuns are ignored.
+func AggregateResult(runs []*rolloutsapi.AnalysisRun) kargoapi.VerificationPhase {
+	var failed, errored, running, successful, total int
+	for _, ar := range runs {
+		if ar == nil {
+			continue
+		}
+		total++
+		switch state, terminal := PhaseToVerificationState(ar.Status.Phase); {
+		case state == kargoapi.VerificationPhaseFailed:
+			failed++
+		case state == kargoapi.VerificationPhaseError:
+			errored++
+		case !terminal:
+			running++
+		case state == kargoapi.VerificationPhaseSuccessful:
+			successful++
+		}
+	}
+
+	switch {
+	case total == 0:
+		return kargoapi.VerificationPhasePending
+	case failed > 0:
+		return kargoapi.VerificationPhaseFailed
+	case errored > 0:
+		return kargoapi.VerificationPhaseError
+	case running > 0:
+		return kargoapi.VerificationPhaseRunning
+	case successful == total:
+		return kargoapi.VerificationPhaseSuccessful
+	default:
+		return kargoapi.VerificationPhaseInconclusive
+	}
+}
+
+// IsInconclusive returns true if the given AnalysisRun completed with the
+// Inconclusive phase, e.g. because a metric has neither met its success nor
+// its failure condition, which often points at a misconfigured threshold.
+func IsInconclusive(ar *rolloutsapi.AnalysisRun) bool {
+	return ar != nil && ar.Status.Phase == rolloutsapi.AnalysisPhaseInconclusive
+}
+
+// InconclusiveRate returns the fraction of the given AnalysisRuns which
+// completed with the Inconclusive phase, e.g. to alert on verifications which
+// are frequently inconclusive rather than clean passes or failures. Only
+// completed AnalysisRuns are taken into account: AnalysisRuns which are still
+// pending or running, and nil entries, are ignored. It returns 0 if none of
+// the AnalysisRuns has completed.
+func InconclusiveRate(runs []*rolloutsapi.AnalysisRun) float64 {
+	var completed, inconclusive int
+	for _, ar := range runs {
+		if ar == nil || !ar.Status.Phase.Completed() {
+			continue
+		}
+		completed++
+		if IsInconclusive(ar) {
+			inconclusive++
+		}
+	}
+	if completed == 0 {
+		return 0
+	}
+	return float64(inconclusive) / float64(completed)
+}
@@ -0,0 +1,310 @@
+package rollouts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kargoapi "github.com/akuity/kargo/api/v1alpha1"
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestPhaseToVerificationState(t *testing.T) {
+	tests := []struct {
+		phase    rolloutsapi.AnalysisPhase
+		state    kargoapi.VerificationPhase
+		terminal bool
+	}{
+		{
+			phase: "",
+			state: kargoapi.VerificationPhasePending,
+		},
+		{
+			phase: rolloutsapi.AnalysisPhasePending,
+			state: kargoapi.VerificationPhasePending,
+		},
+		{
+			phase: rolloutsapi.AnalysisPhaseRunning,
+			state: kargoapi.VerificationPhaseRunning,
+		},
+		{
+			phase:    rolloutsapi.AnalysisPhaseSuccessful,
+			state:    kargoapi.VerificationPhaseSuccessful,
+			terminal: true,
+		},
+		{
+			phase:    rolloutsapi.AnalysisPhaseFailed,
+			state:    kargoapi.VerificationPhaseFailed,
+			terminal: true,
+		},
+		{
+			phase:    rolloutsapi.AnalysisPhaseError,
+			state:    kargoapi.VerificationPhaseError,
+			terminal: true,
+		},
+		{
+			phase:    rolloutsapi.AnalysisPhaseInconclusive,
+			state:    kargoapi.VerificationPhaseInconclusive,
+			terminal: true,
+		},
+		{
+			phase:    "Unrecognized",
+			state:    kargoapi.VerificationPhaseError,
+			terminal: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.phase), func(t *testing.T) {
+			state, terminal := PhaseToVerificationState(tt.phase)
+			assert.Equal(t, tt.state, state)
+			assert.Equal(t, tt.terminal, terminal)
+			if tt.phase.Completed() {
+				assert.True(t, terminal)
+			}
+		})
+	}
+}
+
+func TestClassifyStuck(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	started := created.Add(time.Minute)
+	newAnalysisRun := func(annotations map[string]string, phase rolloutsapi.AnalysisPhase) *rolloutsapi.AnalysisRun {
+		startedAt := metav1.NewTime(started)
+		return &rolloutsapi.AnalysisRun{
+			ObjectMeta: metav1.ObjectMeta{
+				CreationTimestamp: metav1.NewTime(created),
+				Annotations:       annotations,
+			},
+			Status: rolloutsapi.AnalysisRunStatus{
+				Phase:     phase,
+				StartedAt: &startedAt,
+			},
+		}
+	}
+	withMaxRunDuration := map[string]string{maxRunDurationAnnotationKey: "1h0m0s"}
+
+	tests := []struct {
+		name     string
+		ar       *rolloutsapi.AnalysisRun
+		now      time.Time
+		expected rolloutsapi.AnalysisPhase
+	}{
+		{
+			name: "nil AnalysisRun",
+			now:  started,
+		},
+		{
+			name:     "no maximum run duration",
+			ar:       newAnalysisRun(nil, rolloutsapi.AnalysisPhaseRunning),
+			now:      started.Add(24 * time.Hour),
+			expected: rolloutsapi.AnalysisPhaseRunning,
+		},
+		{
+			name:     "invalid maximum run duration",
+			ar:       newAnalysisRun(map[string]string{maxRunDurationAnnotationKey: "long"}, rolloutsapi.AnalysisPhaseRunning),
+			now:      started.Add(24 * time.Hour),
+			expected: rolloutsapi.AnalysisPhaseRunning,
+		},
+		{
+			name:     "at maximum run duration",
+			ar:       newAnalysisRun(withMaxRunDuration, rolloutsapi.AnalysisPhaseRunning),
+			now:      started.Add(time.Hour),
+			expected: rolloutsapi.AnalysisPhaseRunning,
+		},
+		{
+			name:     "exceeded maximum run duration",
+			ar:       newAnalysisRun(withMaxRunDuration, rolloutsapi.AnalysisPhaseRunning),
+			now:      started.Add(time.Hour + time.Nanosecond),
+			expected: rolloutsapi.AnalysisPhaseError,
+		},
+		{
+			name: "exceeded maximum run duration since creation",
+			ar: func() *rolloutsapi.AnalysisRun {
+				ar := newAnalysisRun(withMaxRunDuration, rolloutsapi.AnalysisPhaseRunning)
+				ar.Status.StartedAt = nil
+				return ar
+			}(),
+			now:      created.Add(time.Hour + time.Nanosecond),
+			expected: rolloutsapi.AnalysisPhaseError,
+		},
+		{
+			name:     "completed after maximum run duration",
+			ar:       newAnalysisRun(withMaxRunDuration, rolloutsapi.AnalysisPhaseSuccessful),
+			now:      started.Add(2 * time.Hour),
+			expected: rolloutsapi.AnalysisPhaseSuccessful,
+		},
+		{
+			name:     "pending after maximum run duration",
+			ar:       newAnalysisRun(withMaxRunDuration, rolloutsapi.AnalysisPhasePending),
+			now:      started.Add(2 * time.Hour),
+			expected: rolloutsapi.AnalysisPhasePending,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := tt.ar.DeepCopy()
+			assert.Equal(t, tt.expected, ClassifyStuck(tt.ar, tt.now))
+			assert.Equal(t, original, tt.ar)
+		})
+	}
+}
+
+func TestAggregateResult(t *testing.T) {
+	const (
+		pending      = rolloutsapi.AnalysisPhasePending
+		running      = rolloutsapi.AnalysisPhaseRunning
+		successful   = rolloutsapi.AnalysisPhaseSuccessful
+		failed       = rolloutsapi.AnalysisPhaseFailed
+		errored      = rolloutsapi.AnalysisPhaseError
+		inconclusive = rolloutsapi.AnalysisPhaseInconclusive
+	)
+
+	tests := []struct {
+		name     string
+		phases   []rolloutsapi.AnalysisPhase
+		expected kargoapi.VerificationPhase
+	}{
+		{
+			name:     "no runs",
+			expected: kargoapi.VerificationPhasePending,
+		},
+		{
+			name:     "all successful",
+			phases:   []rolloutsapi.AnalysisPhase{successful, successful},
+			expected: kargoapi.VerificationPhaseSuccessful,
+		},
+		{
+			name:     "failed takes precedence over everything",
+			phases:   []rolloutsapi.AnalysisPhase{successful, running, errored, inconclusive, failed},
+			expected: kargoapi.VerificationPhaseFailed,
+		},
+		{
+			name:     "error without failure",
+			phases:   []rolloutsapi.AnalysisPhase{successful, running, inconclusive, errored},
+			expected: kargoapi.VerificationPhaseError,
+		},
+		{
+			name:     "unrecognized phase is an error",
+			phases:   []rolloutsapi.AnalysisPhase{successful, "Unrecognized"},
+			expected: kargoapi.VerificationPhaseError,
+		},
+		{
+			name:     "running with successful",
+			phases:   []rolloutsapi.AnalysisPhase{successful, running},
+			expected: kargoapi.VerificationPhaseRunning,
+		},
+		{
+			name:     "pending with inconclusive",
+			phases:   []rolloutsapi.AnalysisPhase{inconclusive, pending},
+			expected: kargoapi.VerificationPhaseRunning,
+		},
+		{
+			name:     "not yet picked up",
+			phases:   []rolloutsapi.AnalysisPhase{""},
+			expected: kargoapi.VerificationPhaseRunning,
+		},
+		{
+			name:     "inconclusive with successful",
+			phases:   []rolloutsapi.AnalysisPhase{successful, inconclusive},
+			expected: kargoapi.VerificationPhaseInconclusive,
+		},
+		{
+			name:     "all inconclusive",
+			phases:   []rolloutsapi.AnalysisPhase{inconclusive},
+			expected: kargoapi.VerificationPhaseInconclusive,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := make([]*rolloutsapi.AnalysisRun, 0, len(tt.phases)+1)
+			for _, phase := range tt.phases {
+				runs = append(runs, &rolloutsapi.AnalysisRun{
+					Status: rolloutsapi.AnalysisRunStatus{Phase: phase},
+				})
+			}
+			// Nil runs do not affect the result.
+			runs = append(runs, nil)
+			assert.Equal(t, tt.expected, AggregateResult(runs))
+		})
+	}
+}
+
+func TestIsInconclusive(t *testing.T) {
+	assert.False(t, IsInconclusive(nil))
+	for _, phase := range []rolloutsapi.AnalysisPhase{
+		"",
+		rolloutsapi.AnalysisPhasePending,
+		rolloutsapi.AnalysisPhaseRunning,
+		rolloutsapi.AnalysisPhaseSuccessful,
+		rolloutsapi.AnalysisPhaseFailed,
+		rolloutsapi.AnalysisPhaseError,
+	} {
+		assert.False(t, IsInconclusive(&rolloutsapi.AnalysisRun{
+			Status: rolloutsapi.AnalysisRunStatus{Phase: phase},
+		}), phase)
+	}
+	assert.True(t, IsInconclusive(&rolloutsapi.AnalysisRun{
+		Status: rolloutsapi.AnalysisRunStatus{Phase: rolloutsapi.AnalysisPhaseInconclusive},
+	}))
+}
+
+func TestInconclusiveRate(t *testing.T) {
+	const (
+		pending      = rolloutsapi.AnalysisPhasePending
+		running      = rolloutsapi.AnalysisPhaseRunning
+		successful   = rolloutsapi.AnalysisPhaseSuccessful
+		failed       = rolloutsapi.AnalysisPhaseFailed
+		errored      = rolloutsapi.AnalysisPhaseError
+		inconclusive = rolloutsapi.AnalysisPhaseInconclusive
+	)
+
+	tests := []struct {
+		name     string
+		phases   []rolloutsapi.AnalysisPhase
+		expected float64
+	}{
+		{
+			name:     "no runs",
+			expected: 0,
+		},
+		{
+			name:     "only running runs",
+			phases:   []rolloutsapi.AnalysisPhase{"", pending, running},
+			expected: 0,
+		},
+		{
+			name:     "mix of terminal phases",
+			phases:   []rolloutsapi.AnalysisPhase{successful, failed, errored, inconclusive, inconclusive, inconclusive},
+			expected: 0.5,
+		},
+		{
+			name:     "running runs are ignored",
+			phases:   []rolloutsapi.AnalysisPhase{inconclusive, successful, running, pending, inconclusive, successful},
+			expected: 0.5,
+		},
+		{
+			name:     "all inconclusive",
+			phases:   []rolloutsapi.AnalysisPhase{inconclusive, inconclusive, running},
+			expected: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := make([]*rolloutsapi.AnalysisRun, 0, len(tt.phases)+1)
+			for _, phase := range tt.phases {
+				runs = append(runs, &rolloutsapi.AnalysisRun{
+					Status: rolloutsapi.AnalysisRunStatus{Phase: phase},
+				})
+			}
+			// Nil runs do not affect the result.
+			runs = append(runs, nil)
+			assert.InDelta(t, tt.expected, InconclusiveRate(runs), 1e-9)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package rollouts
+
+import (
+	"time"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+const (
+	// minRequeueInterval is the shortest interval returned by RequeueAfter,
+	// so that short metric intervals do not cause AnalysisRuns to be polled
+	// excessively.
+	minRequeueInterval = 10 * time.Second
+	// maxRequeueInterval is the longest interval returned by RequeueAfter,
+	// so that the completion of an AnalysisRun with long metric intervals is
+	// still noticed in a timely manner.
+	maxRequeueInterval = 5 * time.Minute
+	// defaultRequeueInterval is the interval returned by RequeueAfter for
+	// running AnalysisRuns without any metric interval.
+	defaultRequeueInterval = 30 * time.Second
+)
+
+// RequeueAfter returns the interval after which a controller waiting for the
+// given AnalysisRun should check on it again, and whether it should check
+// again at all.
+//
+// It returns false if the AnalysisRun is nil or has completed, as its phase
+// will not change anymore. If the AnalysisRun has not been picked up by the
+// Argo Rollouts controller yet, it returns minRequeueInterval. Otherwise, it
+// returns the shortest interval of the metrics of the AnalysisRun, as there
+// is no point in polling faster than measurements arrive, or
+// defaultRequeueInterval if no metric has a valid interval. The interval is
+// bound by minRequeueInterval and maxRequeueInterval.
+func RequeueAfter(ar *rolloutsapi.AnalysisRun) (time.Duration, bool) {
+	if ar == nil || ar.Status.Phase.Completed() {
+		return 0, false
+	}
+	if ar.Status.Phase == "" || ar.Status.Phase == rolloutsapi.AnalysisPhasePending {
+		return minRequeueInterval, true
+	}
+
+	var shortest time.Duration
+	for _, metric := range ar.Spec.Metrics {
+		interval, err := metric.Interval.Duration()
+		if err != nil || interval <= 0 {
+			continue
+		}
+		if shortest == 0 || interval < shortest {
+			shortest = interval
+		}
+	}
+	if shortest == 0 {
+		shortest = defaultRequeueInterval
+	}
+	return min(max(shortest, minRequeueInterval), maxRequeueInterval), true
+}
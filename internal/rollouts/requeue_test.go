@@ -0,0 +1,96 @@
+package rollouts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestRequeueAfter(t *testing.T) {
+	newAnalysisRun := func(
+		phase rolloutsapi.AnalysisPhase,
+		intervals ...rolloutsapi.DurationString,
+	) *rolloutsapi.AnalysisRun {
+		ar := &rolloutsapi.AnalysisRun{
+			Status: rolloutsapi.AnalysisRunStatus{Phase: phase},
+		}
+		for _, interval := range intervals {
+			ar.Spec.Metrics = append(ar.Spec.Metrics, rolloutsapi.Metric{Interval: interval})
+		}
+		return ar
+	}
+
+	tests := []struct {
+		name     string
+		ar       *rolloutsapi.AnalysisRun
+		interval time.Duration
+		requeue  bool
+	}{
+		{
+			name: "nil AnalysisRun",
+		},
+		{
+			name:     "not picked up yet",
+			ar:       newAnalysisRun("", "1m"),
+			interval: minRequeueInterval,
+			requeue:  true,
+		},
+		{
+			name:     "pending",
+			ar:       newAnalysisRun(rolloutsapi.AnalysisPhasePending, "1m"),
+			interval: minRequeueInterval,
+			requeue:  true,
+		},
+		{
+			name:     "running with shortest metric interval",
+			ar:       newAnalysisRun(rolloutsapi.AnalysisPhaseRunning, "2m", "45s", ""),
+			interval: 45 * time.Second,
+			requeue:  true,
+		},
+		{
+			name:     "running with short interval",
+			ar:       newAnalysisRun(rolloutsapi.AnalysisPhaseRunning, "1s"),
+			interval: minRequeueInterval,
+			requeue:  true,
+		},
+		{
+			name:     "running with long interval",
+			ar:       newAnalysisRun(rolloutsapi.AnalysisPhaseRunning, "1h"),
+			interval: maxRequeueInterval,
+			requeue:  true,
+		},
+		{
+			name:     "running without valid interval",
+			ar:       newAnalysisRun(rolloutsapi.AnalysisPhaseRunning, "", "invalid"),
+			interval: defaultRequeueInterval,
+			requeue:  true,
+		},
+		{
+			name: "successful",
+			ar:   newAnalysisRun(rolloutsapi.AnalysisPhaseSuccessful, "1m"),
+		},
+		{
+			name: "failed",
+			ar:   newAnalysisRun(rolloutsapi.AnalysisPhaseFailed, "1m"),
+		},
+		{
+			name: "error",
+			ar:   newAnalysisRun(rolloutsapi.AnalysisPhaseError, "1m"),
+		},
+		{
+			name: "inconclusive",
+			ar:   newAnalysisRun(rolloutsapi.AnalysisPhaseInconclusive, "1m"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interval, requeue := RequeueAfter(tt.ar)
+			assert.Equal(t, tt.interval, interval)
+			assert.Equal(t, tt.requeue, requeue)
+		})
+	}
+}
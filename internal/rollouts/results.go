@@ -0,0 +1,235 @@
+package rollouts
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// AnalysisResults holds the results of an AnalysisRun.
+type AnalysisResults struct {
+	// Phase is the overall phase of the AnalysisRun. It is Pending if the
+	// AnalysisRun has not been picked up by the Argo Rollouts controller yet.
+	Phase rolloutsapi.AnalysisPhase
+	// Message is the message of the AnalysisRun explaining its phase, if any.
+	Message string
+	// Metrics holds the results of the metrics of the AnalysisRun, in the
+	// order the metrics are defined in its spec.
+	Metrics []MetricResults
+}
+
+// MetricResults holds the results of a single metric of an AnalysisRun.
+type MetricResults struct {
+	// Name is the name of the metric.
+	Name string
+	// Phase is the phase of the metric. It is Pending if no results have been
+	// reported for the metric yet.
+	Phase rolloutsapi.AnalysisPhase
+	// Message is the message of the metric explaining its phase, if any.
+	Message string
+	// Value is the value of the latest completed measurement of the metric.
+	// It is empty if no measurement has been completed yet.
+	Value string
+	// Measurements is the number of measurements taken for the metric.
+	Measurements int32
+	// Successful is the number of successful measurements.
+	Successful int32
+	// Failed is the number of failed measurements.
+	Failed int32
+	// Errors is the number of measurements which resulted in an error.
+	Errors int32
+	// Inconclusive is the number of inconclusive measurements.
+	Inconclusive int32
+	// DryRun indicates the metric is evaluated in dry-run mode, in which
+	// case its results do not affect the phase of the AnalysisRun.
+	DryRun bool
+}
+
+// Results returns the results of the given AnalysisRun. It tolerates a
+// partially populated status, as is the case while the AnalysisRun is still
+// running: metrics without reported results are included with a Pending
+// phase. Results reported for metrics which are not defined in the spec are
+// appended after the defined metrics.
+func Results(ar *rolloutsapi.AnalysisRun) AnalysisResults {
+	results := AnalysisResults{
+		Phase: rolloutsapi.AnalysisPhasePending,
+	}
+	if ar == nil {
+		return results
+	}
+	if ar.Status.Phase != "" {
+		results.Phase = ar.Status.Phase
+	}
+	results.Message = ar.Status.Message
+
+	for _, result := range orderedMetricResults(ar) {
+		results.Metrics = append(results.Metrics, newMetricResults(result))
+	}
+	return results
+}
+
+// orderedMetricResults returns the reported results of the metrics of the
+// given AnalysisRun in the order the metrics are defined in its spec, with an
+// empty result for metrics without reported results. Results reported for
+// metrics which are not defined in the spec are appended after the defined
+// metrics.
+func orderedMetricResults(ar *rolloutsapi.AnalysisRun) []rolloutsapi.MetricResult {
+	reported := make(map[string]rolloutsapi.MetricResult, len(ar.Status.MetricResults))
+	for _, result := range ar.Status.MetricResults {
+		reported[result.Name] = result
+	}
+
+	ordered := make([]rolloutsapi.MetricResult, 0, len(ar.Spec.Metrics)+len(ar.Status.MetricResults))
+	for _, metric := range ar.Spec.Metrics {
+		result, ok := reported[metric.Name]
+		if !ok {
+			result = rolloutsapi.MetricResult{Name: metric.Name}
+		}
+		delete(reported, metric.Name)
+		ordered = append(ordered, result)
+	}
+	for _, result := range ar.Status.MetricResults {
+		if _, ok := reported[result.Name]; ok {
+			delete(reported, result.Name)
+			ordered = append(ordered, result)
+		}
+	}
+	return ordered
+}
+
+// FailureReason returns a concise description of why the given AnalysisRun
+// failed, e.g. `metric "latency" failed: value 0.9 matches failure condition
+// "result[0] > 0.5"`, and whether a reason was found. It describes the first
+// metric, in the order of Results, which failed or resulted in an error,
+// using its latest failed or erroneous measurement. Metrics evaluated in
+// dry-run mode are ignored, as they do not affect the phase of the
+// AnalysisRun. If no such metric is found, the message of a failed or
+// erroneous AnalysisRun is returned instead, if any.
+func FailureReason(ar *rolloutsapi.AnalysisRun) (string, bool) {
+	if ar == nil {
+		return "", false
+	}
+
+	for _, result := range orderedMetricResults(ar) {
+		if result.DryRun {
+			continue
+		}
+		switch result.Phase {
+		case rolloutsapi.AnalysisPhaseFailed:
+			return metricFailureReason(ar, result), true
+		case rolloutsapi.AnalysisPhaseError:
+			return metricErrorReason(result), true
+		}
+	}
+
+	switch ar.Status.Phase {
+	case rolloutsapi.AnalysisPhaseFailed, rolloutsapi.AnalysisPhaseError:
+		if ar.Status.Message != "" {
+			return ar.Status.Message, true
+		}
+	}
+	return "", false
+}
+
+// metricFailureReason describes why the given failed metric result of the
+// AnalysisRun failed, using the conditions of the metric from the spec.
+func metricFailureReason(ar *rolloutsapi.AnalysisRun, result rolloutsapi.MetricResult) string {
+	m, ok := latestMeasurement(result, rolloutsapi.AnalysisPhaseFailed)
+	if !ok || m.Value == "" {
+		if msg := cmp.Or(m.Message, result.Message); msg != "" {
+			return fmt.Sprintf("metric %q failed: %s", result.Name, msg)
+		}
+		return fmt.Sprintf("metric %q failed", result.Name)
+	}
+
+	var metric rolloutsapi.Metric
+	if i := slices.IndexFunc(ar.Spec.Metrics, func(m rolloutsapi.Metric) bool {
+		return m.Name == result.Name
+	}); i >= 0 {
+		metric = ar.Spec.Metrics[i]
+	}
+	switch {
+	case metric.FailureCondition != "":
+		return fmt.Sprintf(
+			"metric %q failed: value %s matches failure condition %q",
+			result.Name, m.Value, metric.FailureCondition,
+		)
+	case metric.SuccessCondition != "":
+		return fmt.Sprintf(
+			"metric %q failed: value %s does not match success condition %q",
+			result.Name, m.Value, metric.SuccessCondition,
+		)
+	default:
+		return fmt.Sprintf("metric %q failed: value %s", result.Name, m.Value)
+	}
+}
+
+// metricErrorReason describes why the given metric result resulted in an
+// error, using the message of its latest erroneous measurement.
+func metricErrorReason(result rolloutsapi.MetricResult) string {
+	m, _ := latestMeasurement(result, rolloutsapi.AnalysisPhaseError)
+	if msg := cmp.Or(m.Message, result.Message); msg != "" {
+		return fmt.Sprintf("metric %q errored: %s", result.Name, msg)
+	}
+	return fmt.Sprintf("metric %q errored", result.Name)
+}
+
+// latestMeasurement returns the latest measurement of the given metric result
+// with the given phase, and whether one was found.
+func latestMeasurement(
+	result rolloutsapi.MetricResult,
+	phase rolloutsapi.AnalysisPhase,
+) (rolloutsapi.Measurement, bool) {
+	for i := len(result.Measurements) - 1; i >= 0; i-- {
+		if result.Measurements[i].Phase == phase {
+			return result.Measurements[i], true
+		}
+	}
+	return rolloutsapi.Measurement{}, false
+}
+
+// ResultsSorted returns the results of the metrics of the given AnalysisRun
+// the same way as Results, but sorted by metric name rather than in the order
+// the metrics are defined in the spec and reported in the status, e.g. for
+// reports which should not change order between reads. As the status of an
+// AnalysisRun does not guarantee the order of its results, the order of
+// Results may change, while the order of ResultsSorted is stable. It returns
+// nil if the AnalysisRun is nil or has no metrics.
+func ResultsSorted(ar *rolloutsapi.AnalysisRun) []MetricResults {
+	metrics := Results(ar).Metrics
+	slices.SortStableFunc(metrics, func(a, b MetricResults) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return metrics
+}
+
+// newMetricResults returns the MetricResults for the given reported result.
+func newMetricResults(result rolloutsapi.MetricResult) MetricResults {
+	phase := result.Phase
+	if phase == "" {
+		phase = rolloutsapi.AnalysisPhasePending
+	}
+
+	var value string
+	for i := len(result.Measurements) - 1; i >= 0; i-- {
+		if result.Measurements[i].Phase.Completed() {
+			value = result.Measurements[i].Value
+			break
+		}
+	}
+
+	return MetricResults{
+		Name:         result.Name,
+		Phase:        phase,
+		Message:      result.Message,
+		Value:        value,
+		Measurements: result.Count,
+		Successful:   result.Successful,
+		Failed:       result.Failed,
+		Errors:       result.Error,
+		Inconclusive: result.Inconclusive,
+		DryRun:       result.DryRun,
+	}
+}
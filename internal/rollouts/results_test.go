@@ -0,0 +1,428 @@
+package rollouts
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestResults(t *testing.T) {
+	metrics := []rolloutsapi.Metric{
+		{Name: "error-rate"},
+		{Name: "latency"},
+	}
+
+	tests := []struct {
+		name       string
+		ar         *rolloutsapi.AnalysisRun
+		assertions func(*testing.T, AnalysisResults)
+	}{
+		{
+			name: "nil AnalysisRun",
+			assertions: func(t *testing.T, results AnalysisResults) {
+				assert.Equal(t, rolloutsapi.AnalysisPhasePending, results.Phase)
+				assert.Empty(t, results.Metrics)
+			},
+		},
+		{
+			name: "successful run",
+			ar: &rolloutsapi.AnalysisRun{
+				Spec: rolloutsapi.AnalysisRunSpec{
+					Metrics: metrics,
+				},
+				Status: rolloutsapi.AnalysisRunStatus{
+					Phase: rolloutsapi.AnalysisPhaseSuccessful,
+					MetricResults: []rolloutsapi.MetricResult{
+						{
+							Name:  "latency",
+							Phase: rolloutsapi.AnalysisPhaseSuccessful,
+							Measurements: []rolloutsapi.Measurement{
+								{Phase: rolloutsapi.AnalysisPhaseSuccessful, Value: "120"},
+								{Phase: rolloutsapi.AnalysisPhaseSuccessful, Value: "110"},
+							},
+							Count:      2,
+							Successful: 2,
+						},
+						{
+							Name:  "error-rate",
+							Phase: rolloutsapi.AnalysisPhaseSuccessful,
+							Measurements: []rolloutsapi.Measurement{
+								{Phase: rolloutsapi.AnalysisPhaseSuccessful, Value: "0.01"},
+							},
+							Count:      1,
+							Successful: 1,
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, results AnalysisResults) {
+				assert.Equal(t, rolloutsapi.AnalysisPhaseSuccessful, results.Phase)
+				assert.Equal(t, []MetricResults{
+					{
+						Name:         "error-rate",
+						Phase:        rolloutsapi.AnalysisPhaseSuccessful,
+						Value:        "0.01",
+						Measurements: 1,
+						Successful:   1,
+					},
+					{
+						Name:         "latency",
+						Phase:        rolloutsapi.AnalysisPhaseSuccessful,
+						Value:        "110",
+						Measurements: 2,
+						Successful:   2,
+					},
+				}, results.Metrics)
+			},
+		},
+		{
+			name: "run failed on one metric",
+			ar: &rolloutsapi.AnalysisRun{
+				Spec: rolloutsapi.AnalysisRunSpec{
+					Metrics: metrics,
+				},
+				Status: rolloutsapi.AnalysisRunStatus{
+					Phase:   rolloutsapi.AnalysisPhaseFailed,
+					Message: "Metric \"error-rate\" assessed Failed due to failed (2) > failureLimit (1)",
+					MetricResults: []rolloutsapi.MetricResult{
+						{
+							Name:    "error-rate",
+							Phase:   rolloutsapi.AnalysisPhaseFailed,
+							Message: "failed (2) > failureLimit (1)",
+							Measurements: []rolloutsapi.Measurement{
+								{Phase: rolloutsapi.AnalysisPhaseError, Message: "connection refused"},
+								{Phase: rolloutsapi.AnalysisPhaseFailed, Value: "0.2"},
+								{Phase: rolloutsapi.AnalysisPhaseInconclusive, Value: "0.05"},
+								{Phase: rolloutsapi.AnalysisPhaseFailed, Value: "0.3"},
+							},
+							Count:        4,
+							Failed:       2,
+							Error:        1,
+							Inconclusive: 1,
+						},
+						{
+							Name:  "latency",
+							Phase: rolloutsapi.AnalysisPhaseSuccessful,
+							Measurements: []rolloutsapi.Measurement{
+								{Phase: rolloutsapi.AnalysisPhaseSuccessful, Value: "100"},
+							},
+							Count:      1,
+							Successful: 1,
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, results AnalysisResults) {
+				assert.Equal(t, rolloutsapi.AnalysisPhaseFailed, results.Phase)
+				assert.Contains(t, results.Message, "error-rate")
+				require.Len(t, results.Metrics, 2)
+				assert.Equal(t, MetricResults{
+					Name:         "error-rate",
+					Phase:        rolloutsapi.AnalysisPhaseFailed,
+					Message:      "failed (2) > failureLimit (1)",
+					Value:        "0.3",
+					Measurements: 4,
+					Failed:       2,
+					Errors:       1,
+					Inconclusive: 1,
+				}, results.Metrics[0])
+				assert.Equal(t, rolloutsapi.AnalysisPhaseSuccessful, results.Metrics[1].Phase)
+			},
+		},
+		{
+			name: "run in progress",
+			ar: &rolloutsapi.AnalysisRun{
+				Spec: rolloutsapi.AnalysisRunSpec{
+					Metrics: metrics,
+				},
+				Status: rolloutsapi.AnalysisRunStatus{
+					Phase: rolloutsapi.AnalysisPhaseRunning,
+					MetricResults: []rolloutsapi.MetricResult{
+						{
+							Name:  "error-rate",
+							Phase: rolloutsapi.AnalysisPhaseRunning,
+							Measurements: []rolloutsapi.Measurement{
+								{Phase: rolloutsapi.AnalysisPhaseSuccessful, Value: "0.01"},
+								{Phase: rolloutsapi.AnalysisPhaseRunning},
+							},
+							Count:      1,
+							Successful: 1,
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, results AnalysisResults) {
+				assert.Equal(t, rolloutsapi.AnalysisPhaseRunning, results.Phase)
+				require.Len(t, results.Metrics, 2)
+				assert.Equal(t, rolloutsapi.AnalysisPhaseRunning, results.Metrics[0].Phase)
+				assert.Equal(t, "0.01", results.Metrics[0].Value)
+				assert.Equal(t, MetricResults{
+					Name:  "latency",
+					Phase: rolloutsapi.AnalysisPhasePending,
+				}, results.Metrics[1])
+			},
+		},
+		{
+			name: "run without status",
+			ar: &rolloutsapi.AnalysisRun{
+				Spec: rolloutsapi.AnalysisRunSpec{
+					Metrics: metrics,
+				},
+			},
+			assertions: func(t *testing.T, results AnalysisResults) {
+				assert.Equal(t, rolloutsapi.AnalysisPhasePending, results.Phase)
+				require.Len(t, results.Metrics, 2)
+				for _, metric := range results.Metrics {
+					assert.Equal(t, rolloutsapi.AnalysisPhasePending, metric.Phase)
+					assert.Empty(t, metric.Value)
+				}
+			},
+		},
+		{
+			name: "results for metrics not in spec",
+			ar: &rolloutsapi.AnalysisRun{
+				Spec: rolloutsapi.AnalysisRunSpec{
+					Metrics: metrics[:1],
+				},
+				Status: rolloutsapi.AnalysisRunStatus{
+					MetricResults: []rolloutsapi.MetricResult{
+						{Name: "removed", Phase: rolloutsapi.AnalysisPhaseSuccessful},
+					},
+				},
+			},
+			assertions: func(t *testing.T, results AnalysisResults) {
+				require.Len(t, results.Metrics, 2)
+				assert.Equal(t, "error-rate", results.Metrics[0].Name)
+				assert.Equal(t, "removed", results.Metrics[1].Name)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.assertions(t, Results(tt.ar))
+		})
+	}
+}
+
+func TestResultsSorted(t *testing.T) {
+	assert.Nil(t, ResultsSorted(nil))
+
+	ar := &rolloutsapi.AnalysisRun{
+		Status: rolloutsapi.AnalysisRunStatus{
+			Phase: rolloutsapi.AnalysisPhaseRunning,
+			MetricResults: []rolloutsapi.MetricResult{
+				{
+					Name:  "saturation",
+					Phase: rolloutsapi.AnalysisPhaseRunning,
+				},
+				{
+					Name:  "latency",
+					Phase: rolloutsapi.AnalysisPhaseFailed,
+					Count: 2,
+					Measurements: []rolloutsapi.Measurement{
+						{Phase: rolloutsapi.AnalysisPhaseSuccessful, Value: "0.2"},
+						{Phase: rolloutsapi.AnalysisPhaseFailed, Value: "0.9"},
+					},
+				},
+				{
+					Name:  "error-rate",
+					Phase: rolloutsapi.AnalysisPhaseSuccessful,
+					Count: 1,
+					Measurements: []rolloutsapi.Measurement{
+						{Phase: rolloutsapi.AnalysisPhaseSuccessful, Value: "0.01"},
+					},
+				},
+			},
+		},
+	}
+
+	results := ResultsSorted(ar)
+	require.Len(t, results, 3)
+	assert.Equal(t, "error-rate", results[0].Name)
+	assert.Equal(t, rolloutsapi.AnalysisPhaseSuccessful, results[0].Phase)
+	assert.Equal(t, "0.01", results[0].Value)
+	assert.Equal(t, "latency", results[1].Name)
+	assert.Equal(t, rolloutsapi.AnalysisPhaseFailed, results[1].Phase)
+	assert.Equal(t, "0.9", results[1].Value)
+	assert.Equal(t, "saturation", results[2].Name)
+	assert.Equal(t, rolloutsapi.AnalysisPhaseRunning, results[2].Phase)
+	assert.Empty(t, results[2].Value)
+
+	// The order does not depend on the order of the reported results, nor on
+	// the order of the metrics in the spec.
+	reordered := ar.DeepCopy()
+	slices.Reverse(reordered.Status.MetricResults)
+	reordered.Spec.Metrics = []rolloutsapi.Metric{{Name: "saturation"}, {Name: "latency"}}
+	for range 3 {
+		assert.Equal(t, results, ResultsSorted(reordered))
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		ar     *rolloutsapi.AnalysisRun
+		reason string
+		found  bool
+	}{
+		{
+			name: "nil AnalysisRun",
+		},
+		{
+			name: "no failed metrics",
+			ar: &rolloutsapi.AnalysisRun{
+				Spec: rolloutsapi.AnalysisRunSpec{
+					Metrics: []rolloutsapi.Metric{{Name: "latency"}},
+				},
+				Status: rolloutsapi.AnalysisRunStatus{
+					Phase: rolloutsapi.AnalysisPhaseSuccessful,
+					MetricResults: []rolloutsapi.MetricResult{{
+						Name:  "latency",
+						Phase: rolloutsapi.AnalysisPhaseSuccessful,
+					}},
+				},
+			},
+		},
+		{
+			name: "failed metric with failure condition",
+			ar: &rolloutsapi.AnalysisRun{
+				Spec: rolloutsapi.AnalysisRunSpec{
+					Metrics: []rolloutsapi.Metric{
+						{Name: "error-rate"},
+						{Name: "latency", FailureCondition: "result[0] > 0.5"},
+					},
+				},
+				Status: rolloutsapi.AnalysisRunStatus{
+					Phase: rolloutsapi.AnalysisPhaseFailed,
+					MetricResults: []rolloutsapi.MetricResult{
+						{
+							Name:  "latency",
+							Phase: rolloutsapi.AnalysisPhaseFailed,
+							Measurements: []rolloutsapi.Measurement{
+								{Phase: rolloutsapi.AnalysisPhaseFailed, Value: "0.7"},
+								{Phase: rolloutsapi.AnalysisPhaseFailed, Value: "0.9"},
+								{Phase: rolloutsapi.AnalysisPhaseRunning},
+							},
+						},
+						{
+							Name:  "error-rate",
+							Phase: rolloutsapi.AnalysisPhaseSuccessful,
+						},
+					},
+				},
+			},
+			reason: `metric "latency" failed: value 0.9 matches failure condition "result[0] > 0.5"`,
+			found:  true,
+		},
+		{
+			name: "failed metric with success condition",
+			ar: &rolloutsapi.AnalysisRun{
+				Spec: rolloutsapi.AnalysisRunSpec{
+					Metrics: []rolloutsapi.Metric{
+						{Name: "latency", SuccessCondition: "result[0] <= 0.5"},
+					},
+				},
+				Status: rolloutsapi.AnalysisRunStatus{
+					Phase: rolloutsapi.AnalysisPhaseFailed,
+					MetricResults: []rolloutsapi.MetricResult{{
+						Name:  "latency",
+						Phase: rolloutsapi.AnalysisPhaseFailed,
+						Measurements: []rolloutsapi.Measurement{
+							{Phase: rolloutsapi.AnalysisPhaseFailed, Value: "0.9"},
+						},
+					}},
+				},
+			},
+			reason: `metric "latency" failed: value 0.9 does not match success condition "result[0] <= 0.5"`,
+			found:  true,
+		},
+		{
+			name: "failed metric without measurements",
+			ar: &rolloutsapi.AnalysisRun{
+				Status: rolloutsapi.AnalysisRunStatus{
+					Phase: rolloutsapi.AnalysisPhaseFailed,
+					MetricResults: []rolloutsapi.MetricResult{{
+						Name:    "latency",
+						Phase:   rolloutsapi.AnalysisPhaseFailed,
+						Message: "failure limit exceeded",
+					}},
+				},
+			},
+			reason: `metric "latency" failed: failure limit exceeded`,
+			found:  true,
+		},
+		{
+			name: "errored metric",
+			ar: &rolloutsapi.AnalysisRun{
+				Spec: rolloutsapi.AnalysisRunSpec{
+					Metrics: []rolloutsapi.Metric{{Name: "error-rate"}, {Name: "latency"}},
+				},
+				Status: rolloutsapi.AnalysisRunStatus{
+					Phase: rolloutsapi.AnalysisPhaseError,
+					MetricResults: []rolloutsapi.MetricResult{
+						{
+							Name:  "latency",
+							Phase: rolloutsapi.AnalysisPhaseFailed,
+						},
+						{
+							Name:  "error-rate",
+							Phase: rolloutsapi.AnalysisPhaseError,
+							Measurements: []rolloutsapi.Measurement{
+								{Phase: rolloutsapi.AnalysisPhaseError, Message: "connection refused"},
+								{Phase: rolloutsapi.AnalysisPhaseError, Message: "query timed out"},
+							},
+						},
+					},
+				},
+			},
+			reason: `metric "error-rate" errored: query timed out`,
+			found:  true,
+		},
+		{
+			name: "errored metric without measurement message",
+			ar: &rolloutsapi.AnalysisRun{
+				Status: rolloutsapi.AnalysisRunStatus{
+					Phase: rolloutsapi.AnalysisPhaseError,
+					MetricResults: []rolloutsapi.MetricResult{{
+						Name:    "latency",
+						Phase:   rolloutsapi.AnalysisPhaseError,
+						Message: "consecutive errors exceeded",
+						Measurements: []rolloutsapi.Measurement{
+							{Phase: rolloutsapi.AnalysisPhaseError},
+						},
+					}},
+				},
+			},
+			reason: `metric "latency" errored: consecutive errors exceeded`,
+			found:  true,
+		},
+		{
+			name: "dry-run metrics are ignored",
+			ar: &rolloutsapi.AnalysisRun{
+				Status: rolloutsapi.AnalysisRunStatus{
+					Phase:   rolloutsapi.AnalysisPhaseFailed,
+					Message: "template not found",
+					MetricResults: []rolloutsapi.MetricResult{{
+						Name:   "latency",
+						Phase:  rolloutsapi.AnalysisPhaseFailed,
+						DryRun: true,
+					}},
+				},
+			},
+			reason: "template not found",
+			found:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, found := FailureReason(tt.ar)
+			assert.Equal(t, tt.reason, reason)
+			assert.Equal(t, tt.found, found)
+		})
+	}
+}
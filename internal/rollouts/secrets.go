@@ -0,0 +1,108 @@
+package rollouts
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// RequiredSecrets returns the Secrets the metrics of the given AnalysisRun
+// depend on, e.g. to verify upfront that they can be read, sorted by namespace
+// and name and without duplicates. A metric depends on a Secret if it
+// references an argument resolved from a Secret, in any of the forms accepted
+// by the builder, e.g. "{{args.<name>}}", "{{ args.<name> }}" or
+// "${args.<name>}", or, for Job metrics, if the Pod template of the Job
+// references a Secret through an environment variable or volume. The Secrets
+// are assumed to be in the namespace of the AnalysisRun.
+func RequiredSecrets(ar *rolloutsapi.AnalysisRun) []types.NamespacedName {
+	if ar == nil {
+		return nil
+	}
+
+	secretArgs := make(map[string]string)
+	for _, arg := range ar.Spec.Args {
+		if arg.ValueFrom != nil && arg.ValueFrom.SecretKeyRef != nil {
+			secretArgs[arg.Name] = arg.ValueFrom.SecretKeyRef.Name
+		}
+	}
+
+	var secrets []types.NamespacedName
+	add := func(name string) {
+		if name == "" {
+			return
+		}
+		secret := types.NamespacedName{Namespace: ar.Namespace, Name: name}
+		if !slices.Contains(secrets, secret) {
+			secrets = append(secrets, secret)
+		}
+	}
+	for _, metric := range ar.Spec.Metrics {
+		for _, name := range secretArgReferences(metric, secretArgs) {
+			add(name)
+		}
+		if metric.Provider.Job != nil {
+			for _, name := range podSecretReferences(metric.Provider.Job.Spec.Template.Spec) {
+				add(name)
+			}
+		}
+	}
+
+	slices.SortFunc(secrets, func(a, b types.NamespacedName) int {
+		return cmp.Or(
+			cmp.Compare(a.Namespace, b.Namespace),
+			cmp.Compare(a.Name, b.Name),
+		)
+	})
+	return secrets
+}
+
+// secretArgReferences returns the names of the Secrets of the given
+// Secret-backed arguments which are referenced by the metric.
+func secretArgReferences(metric rolloutsapi.Metric, secretArgs map[string]string) []string {
+	if len(secretArgs) == 0 {
+		return nil
+	}
+	// The metric is marshaled to find references in any of its fields,
+	// regardless of the provider.
+	data, err := json.Marshal(metric)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, arg := range argReferences(data) {
+		if secret, ok := secretArgs[arg]; ok {
+			names = append(names, secret)
+		}
+	}
+	return names
+}
+
+// podSecretReferences returns the names of the Secrets referenced by the
+// environment variables and volumes of the given Pod spec.
+func podSecretReferences(spec corev1.PodSpec) []string {
+	var names []string
+	containers := slices.Concat(spec.InitContainers, spec.Containers)
+	for _, container := range containers {
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+				names = append(names, env.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil {
+				names = append(names, envFrom.SecretRef.Name)
+			}
+		}
+	}
+	for _, volume := range spec.Volumes {
+		if volume.Secret != nil {
+			names = append(names, volume.Secret.SecretName)
+		}
+	}
+	return names
+}
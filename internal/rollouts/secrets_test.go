@@ -0,0 +1,170 @@
+package rollouts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestRequiredSecrets(t *testing.T) {
+	secretArg := func(name, secret string) rolloutsapi.Argument {
+		return rolloutsapi.Argument{
+			Name: name,
+			ValueFrom: &rolloutsapi.ValueFrom{
+				SecretKeyRef: &rolloutsapi.SecretKeyRef{Name: secret, Key: "key"},
+			},
+		}
+	}
+	newAnalysisRun := func(args []rolloutsapi.Argument, metrics ...rolloutsapi.Metric) *rolloutsapi.AnalysisRun {
+		return &rolloutsapi.AnalysisRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "run",
+				Namespace: "default",
+			},
+			Spec: rolloutsapi.AnalysisRunSpec{
+				Metrics: metrics,
+				Args:    args,
+			},
+		}
+	}
+	prometheusMetric := rolloutsapi.Metric{
+		Name: "prometheus",
+		Provider: rolloutsapi.MetricProvider{
+			Prometheus: &rolloutsapi.PrometheusMetric{
+				Address: "http://prometheus:9090",
+				Query:   `sum(rate(errors{service="{{args.service}}"}[5m]))`,
+			},
+		},
+	}
+	datadogMetric := rolloutsapi.Metric{
+		Name: "datadog",
+		Provider: rolloutsapi.MetricProvider{
+			Datadog: &rolloutsapi.DatadogMetric{
+				Query: `avg:errors{service:{{args.service}},token:{{args.api-key}}}`,
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		ar       *rolloutsapi.AnalysisRun
+		expected []types.NamespacedName
+	}{
+		{
+			name: "nil AnalysisRun",
+		},
+		{
+			name: "Prometheus metric without secret",
+			ar: newAnalysisRun(
+				[]rolloutsapi.Argument{
+					{Name: "service", Value: ptr.To("api")},
+					secretArg("api-key", "datadog"),
+				},
+				prometheusMetric,
+			),
+		},
+		{
+			name: "Datadog metric with secret",
+			ar: newAnalysisRun(
+				[]rolloutsapi.Argument{
+					{Name: "service", Value: ptr.To("api")},
+					secretArg("api-key", "datadog"),
+				},
+				prometheusMetric,
+				datadogMetric,
+			),
+			expected: []types.NamespacedName{{Namespace: "default", Name: "datadog"}},
+		},
+		{
+			name: "reference with spaces",
+			ar: newAnalysisRun(
+				[]rolloutsapi.Argument{secretArg("api-key", "web")},
+				rolloutsapi.Metric{
+					Name: "web",
+					Provider: rolloutsapi.MetricProvider{
+						Web: &rolloutsapi.WebMetric{
+							URL:     "https://example.com/health",
+							Headers: []rolloutsapi.WebMetricHeader{{Key: "Authorization", Value: "Bearer {{ args.api-key }}"}},
+						},
+					},
+				},
+			),
+			expected: []types.NamespacedName{{Namespace: "default", Name: "web"}},
+		},
+		{
+			name: "reference in ${} form",
+			ar: newAnalysisRun(
+				[]rolloutsapi.Argument{
+					secretArg("api-key", "datadog"),
+					secretArg("unused", "unused"),
+				},
+				rolloutsapi.Metric{
+					Name: "datadog",
+					Provider: rolloutsapi.MetricProvider{
+						Datadog: &rolloutsapi.DatadogMetric{
+							Query: `avg:errors{token:${args.api-key}}`,
+						},
+					},
+				},
+			),
+			expected: []types.NamespacedName{{Namespace: "default", Name: "datadog"}},
+		},
+		{
+			name: "Job metric with secrets",
+			ar: newAnalysisRun(
+				[]rolloutsapi.Argument{secretArg("api-key", "datadog")},
+				datadogMetric,
+				rolloutsapi.Metric{
+					Name: "job",
+					Provider: rolloutsapi.MetricProvider{
+						Job: &rolloutsapi.JobMetric{
+							Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+								Containers: []corev1.Container{{
+									Name: "check",
+									Env: []corev1.EnvVar{{
+										Name: "TOKEN",
+										ValueFrom: &corev1.EnvVarSource{
+											SecretKeyRef: &corev1.SecretKeySelector{
+												LocalObjectReference: corev1.LocalObjectReference{Name: "token"},
+												Key:                  "token",
+											},
+										},
+									}},
+									EnvFrom: []corev1.EnvFromSource{{
+										SecretRef: &corev1.SecretEnvSource{
+											LocalObjectReference: corev1.LocalObjectReference{Name: "datadog"},
+										},
+									}},
+								}},
+								Volumes: []corev1.Volume{{
+									Name: "certs",
+									VolumeSource: corev1.VolumeSource{
+										Secret: &corev1.SecretVolumeSource{SecretName: "certs"},
+									},
+								}},
+							}}},
+						},
+					},
+				},
+			),
+			expected: []types.NamespacedName{
+				{Namespace: "default", Name: "certs"},
+				{Namespace: "default", Name: "datadog"},
+				{Namespace: "default", Name: "token"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, RequiredSecrets(tt.ar))
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package rollouts
+
+import "k8s.io/apimachinery/pkg/labels"
+
+// SelectorForStage returns a label selector matching the AnalysisRuns of the
+// given Stage of the given Project, as labeled using WithStage, e.g. to List
+// them. The values are sanitized the same way as the labels, so that they
+// match the labels of built AnalysisRuns.
+func SelectorForStage(project, stage string) labels.Selector {
+	return SelectorForVerification(project, stage, "")
+}
+
+// SelectorForVerification returns a label selector matching the AnalysisRuns
+// of the given Stage of the given Project which belong to the verification
+// with the given ID, as set using WithVerificationID. If the ID is empty, the
+// selector matches all AnalysisRuns of the Stage, as with SelectorForStage.
+func SelectorForVerification(project, stage, verificationID string) labels.Selector {
+	set := labels.Set{
+		ProjectLabelKey: labelValue(project),
+		StageLabelKey:   labelValue(stage),
+	}
+	if verificationID != "" {
+		set[VerificationIDLabelKey] = verificationID
+	}
+	return labels.SelectorFromSet(set)
+}
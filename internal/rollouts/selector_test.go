@@ -0,0 +1,58 @@
+package rollouts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestSelectorForStage(t *testing.T) {
+	build := func(t *testing.T, opts ...AnalysisRunOption) labels.Set {
+		ar, err := Build("default", nil, nil, opts...)
+		require.NoError(t, err)
+		return ar.Labels
+	}
+
+	selector := SelectorForStage("project", "stage")
+	assert.True(t, selector.Matches(build(t, WithStage("project", "stage"))))
+	assert.True(t, selector.Matches(build(t,
+		WithStage("project", "stage"),
+		WithVerificationID("verification"),
+	)))
+	assert.False(t, selector.Matches(build(t, WithStage("project", "other-stage"))))
+	assert.False(t, selector.Matches(build(t, WithStage("other-project", "stage"))))
+	assert.False(t, selector.Matches(build(t)))
+
+	t.Run("sanitized values", func(t *testing.T) {
+		stage := "Stage With Spaces"
+		assert.True(t, SelectorForStage("project", stage).Matches(build(t, WithStage("project", stage))))
+	})
+}
+
+func TestSelectorForVerification(t *testing.T) {
+	build := func(t *testing.T, opts ...AnalysisRunOption) labels.Set {
+		ar, err := Build("default", nil, nil, opts...)
+		require.NoError(t, err)
+		return ar.Labels
+	}
+
+	selector := SelectorForVerification("project", "stage", "verification")
+	assert.True(t, selector.Matches(build(t,
+		WithStage("project", "stage"),
+		WithVerificationID("verification"),
+	)))
+	assert.False(t, selector.Matches(build(t,
+		WithStage("project", "stage"),
+		WithVerificationID("other-verification"),
+	)))
+	assert.False(t, selector.Matches(build(t, WithStage("project", "stage"))))
+
+	t.Run("empty verification ID", func(t *testing.T) {
+		assert.Equal(t,
+			SelectorForStage("project", "stage").String(),
+			SelectorForVerification("project", "stage", "").String(),
+		)
+	})
+}
@@ -0,0 +1,143 @@
+package rollouts
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+const (
+	// unknownProvider is the provider type reported for metrics without any
+	// known provider.
+	unknownProvider = "unknown"
+	// pluginProviderPrefix is the prefix of the provider type reported for
+	// metrics using a metric provider plugin.
+	pluginProviderPrefix = "plugin/"
+)
+
+// MetricSummary summarizes the metrics of an AnalysisRun.
+type MetricSummary struct {
+	// Metrics is the number of metrics.
+	Metrics int
+	// Providers holds the number of metrics per provider type, e.g.
+	// "prometheus" or "datadog". Metric provider plugins are reported as
+	// "plugin/<name>", and metrics without any known provider as "unknown".
+	// A metric with multiple providers is counted once for each of them.
+	Providers map[string]int
+}
+
+// ProviderTypes returns the provider types of the summary, sorted by name.
+func (s MetricSummary) ProviderTypes() []string {
+	return slices.Sorted(maps.Keys(s.Providers))
+}
+
+// Summarize returns a summary of the metrics of the given AnalysisRun.
+func Summarize(ar *rolloutsapi.AnalysisRun) MetricSummary {
+	summary := MetricSummary{
+		Providers: make(map[string]int),
+	}
+	if ar == nil {
+		return summary
+	}
+
+	summary.Metrics = len(ar.Spec.Metrics)
+	for _, metric := range ar.Spec.Metrics {
+		for _, provider := range metricProviders(metric.Provider) {
+			summary.Providers[provider]++
+		}
+	}
+	return summary
+}
+
+// metricProviders returns the types of the providers configured for a metric.
+// If no known provider is configured, it returns unknownProvider.
+func metricProviders(provider rolloutsapi.MetricProvider) []string {
+	var providers []string
+	add := func(name string, set bool) {
+		if set {
+			providers = append(providers, name)
+		}
+	}
+
+	add("prometheus", provider.Prometheus != nil)
+	add("kayenta", provider.Kayenta != nil)
+	add("web", provider.Web != nil)
+	add("datadog", provider.Datadog != nil)
+	add("wavefront", provider.Wavefront != nil)
+	add("newRelic", provider.NewRelic != nil)
+	add("job", provider.Job != nil)
+	add("cloudWatch", provider.CloudWatch != nil)
+	add("graphite", provider.Graphite != nil)
+	add("influxdb", provider.Influxdb != nil)
+	add("skywalking", provider.SkyWalking != nil)
+	for _, name := range slices.Sorted(maps.Keys(provider.Plugin)) {
+		providers = append(providers, pluginProviderPrefix+name)
+	}
+
+	if len(providers) == 0 {
+		return []string{unknownProvider}
+	}
+	return providers
+}
+
+// EstimateQueryLoad returns a rough estimate of the number of queries per
+// minute the metrics of the given AnalysisRun issue against their providers
+// while it runs, e.g. to warn before starting many verifications in parallel.
+// It is advisory only, and errs on the high side:
+//
+//   - A metric with an interval issues one query per interval, but no more
+//     queries per minute than its count, if it has one.
+//   - A metric without a (valid) interval, or with a count of one, issues a
+//     single query, which is counted as one query per minute.
+//   - Early exits caused by e.g. a failure limit are not taken into account,
+//     as every measurement may succeed.
+//
+// Counts which cannot be resolved to a number, e.g. because they reference an
+// argument, are treated as if the metric runs indefinitely.
+func EstimateQueryLoad(ar *rolloutsapi.AnalysisRun) float64 {
+	if ar == nil {
+		return 0
+	}
+	var load float64
+	for _, metric := range ar.Spec.Metrics {
+		load += estimateMetricQueryLoad(metric)
+	}
+	return load
+}
+
+// estimateMetricQueryLoad returns the estimated number of queries per minute
+// issued by the given metric, as described by EstimateQueryLoad.
+func estimateMetricQueryLoad(metric rolloutsapi.Metric) float64 {
+	count, bounded := metricCount(metric.Count)
+	interval, err := metric.Interval.Duration()
+	if err != nil || interval <= 0 || (bounded && count == 1) {
+		return 1
+	}
+	perMinute := float64(time.Minute) / float64(interval)
+	if bounded {
+		perMinute = min(perMinute, float64(count))
+	}
+	return perMinute
+}
+
+// metricCount returns the count of a metric, and whether the metric is
+// bounded by it. A metric without a count, with a count of zero or less, or
+// with a count which is not a number, is not bounded.
+func metricCount(count *intstr.IntOrString) (int, bool) {
+	if count == nil {
+		return 0, false
+	}
+	value := count.IntValue()
+	if count.Type == intstr.String {
+		var err error
+		if value, err = strconv.Atoi(count.StrVal); err != nil {
+			return 0, false
+		}
+	}
+	return value, value > 0
+}
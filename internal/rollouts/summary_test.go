@@ -0,0 +1,241 @@
+package rollouts
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name       string
+		ar         *rolloutsapi.AnalysisRun
+		assertions func(*testing.T, MetricSummary)
+	}{
+		{
+			name: "nil AnalysisRun",
+			assertions: func(t *testing.T, summary MetricSummary) {
+				assert.Zero(t, summary.Metrics)
+				assert.Empty(t, summary.Providers)
+			},
+		},
+		{
+			name: "metrics with different providers",
+			ar: &rolloutsapi.AnalysisRun{
+				Spec: rolloutsapi.AnalysisRunSpec{
+					Metrics: []rolloutsapi.Metric{
+						{
+							Name: "prometheus1",
+							Provider: rolloutsapi.MetricProvider{
+								Prometheus: &rolloutsapi.PrometheusMetric{},
+							},
+						},
+						{
+							Name: "prometheus2",
+							Provider: rolloutsapi.MetricProvider{
+								Prometheus: &rolloutsapi.PrometheusMetric{},
+							},
+						},
+						{
+							Name: "datadog",
+							Provider: rolloutsapi.MetricProvider{
+								Datadog: &rolloutsapi.DatadogMetric{},
+							},
+						},
+						{
+							Name: "web",
+							Provider: rolloutsapi.MetricProvider{
+								Web: &rolloutsapi.WebMetric{},
+							},
+						},
+						{
+							Name: "job",
+							Provider: rolloutsapi.MetricProvider{
+								Job: &rolloutsapi.JobMetric{},
+							},
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, summary MetricSummary) {
+				assert.Equal(t, 5, summary.Metrics)
+				assert.Equal(t, map[string]int{
+					"prometheus": 2,
+					"datadog":    1,
+					"web":        1,
+					"job":        1,
+				}, summary.Providers)
+				assert.Equal(t, []string{"datadog", "job", "prometheus", "web"}, summary.ProviderTypes())
+			},
+		},
+		{
+			name: "metric with multiple providers",
+			ar: &rolloutsapi.AnalysisRun{
+				Spec: rolloutsapi.AnalysisRunSpec{
+					Metrics: []rolloutsapi.Metric{
+						{
+							Name: "multiple",
+							Provider: rolloutsapi.MetricProvider{
+								Prometheus: &rolloutsapi.PrometheusMetric{},
+								Web:        &rolloutsapi.WebMetric{},
+							},
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, summary MetricSummary) {
+				assert.Equal(t, 1, summary.Metrics)
+				assert.Equal(t, map[string]int{
+					"prometheus": 1,
+					"web":        1,
+				}, summary.Providers)
+			},
+		},
+		{
+			name: "plugin and unknown providers",
+			ar: &rolloutsapi.AnalysisRun{
+				Spec: rolloutsapi.AnalysisRunSpec{
+					Metrics: []rolloutsapi.Metric{
+						{
+							Name: "plugin",
+							Provider: rolloutsapi.MetricProvider{
+								Plugin: map[string]json.RawMessage{
+									"example/metric": json.RawMessage(`{}`),
+								},
+							},
+						},
+						{
+							Name: "unknown",
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, summary MetricSummary) {
+				assert.Equal(t, 2, summary.Metrics)
+				assert.Equal(t, map[string]int{
+					"plugin/example/metric": 1,
+					"unknown":               1,
+				}, summary.Providers)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.assertions(t, Summarize(tt.ar))
+		})
+	}
+}
+
+func TestEstimateQueryLoad(t *testing.T) {
+	newAnalysisRun := func(metrics ...rolloutsapi.Metric) *rolloutsapi.AnalysisRun {
+		return &rolloutsapi.AnalysisRun{
+			Spec: rolloutsapi.AnalysisRunSpec{
+				Metrics: metrics,
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		ar       *rolloutsapi.AnalysisRun
+		expected float64
+	}{
+		{
+			name:     "nil AnalysisRun",
+			expected: 0,
+		},
+		{
+			name:     "no metrics",
+			ar:       newAnalysisRun(),
+			expected: 0,
+		},
+		{
+			name:     "single-shot metric",
+			ar:       newAnalysisRun(rolloutsapi.Metric{Name: "metric"}),
+			expected: 1,
+		},
+		{
+			name: "single-shot metric with interval",
+			ar: newAnalysisRun(rolloutsapi.Metric{
+				Name:     "metric",
+				Interval: "10s",
+				Count:    ptr.To(intstr.FromInt32(1)),
+			}),
+			expected: 1,
+		},
+		{
+			name: "invalid interval",
+			ar: newAnalysisRun(rolloutsapi.Metric{
+				Name:     "metric",
+				Interval: "often",
+			}),
+			expected: 1,
+		},
+		{
+			name: "indefinitely running metric",
+			ar: newAnalysisRun(rolloutsapi.Metric{
+				Name:     "metric",
+				Interval: "15s",
+			}),
+			expected: 4,
+		},
+		{
+			name: "metric bounded by its count",
+			ar: newAnalysisRun(rolloutsapi.Metric{
+				Name:     "metric",
+				Interval: "5s",
+				Count:    ptr.To(intstr.FromInt32(3)),
+			}),
+			expected: 3,
+		},
+		{
+			name: "count as string",
+			ar: newAnalysisRun(rolloutsapi.Metric{
+				Name:     "metric",
+				Interval: "5s",
+				Count:    ptr.To(intstr.FromString("6")),
+			}),
+			expected: 6,
+		},
+		{
+			name: "unresolved count",
+			ar: newAnalysisRun(rolloutsapi.Metric{
+				Name:     "metric",
+				Interval: "5s",
+				Count:    ptr.To(intstr.FromString("{{args.count}}")),
+			}),
+			expected: 12,
+		},
+		{
+			name: "failure limit is ignored",
+			ar: newAnalysisRun(rolloutsapi.Metric{
+				Name:         "metric",
+				Interval:     "30s",
+				Count:        ptr.To(intstr.FromInt32(10)),
+				FailureLimit: ptr.To(intstr.FromInt32(0)),
+			}),
+			expected: 2,
+		},
+		{
+			name: "multiple metrics",
+			ar: newAnalysisRun(
+				rolloutsapi.Metric{Name: "single-shot"},
+				rolloutsapi.Metric{Name: "slow", Interval: "2m"},
+				rolloutsapi.Metric{Name: "fast", Interval: "10s", Count: ptr.To(intstr.FromInt32(100))},
+			),
+			expected: 7.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.expected, EstimateQueryLoad(tt.ar), 0.001)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package rollouts
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// TerminateResult describes the outcome of a Terminate call.
+type TerminateResult string
+
+const (
+	// TerminateResultTerminated indicates the AnalysisRun was requested to
+	// terminate.
+	TerminateResultTerminated TerminateResult = "Terminated"
+	// TerminateResultAlreadyTerminated indicates the AnalysisRun was already
+	// requested to terminate, or had already completed.
+	TerminateResultAlreadyTerminated TerminateResult = "AlreadyTerminated"
+	// TerminateResultNotFound indicates the AnalysisRun does not exist.
+	TerminateResultNotFound TerminateResult = "NotFound"
+)
+
+// Terminate requests the AnalysisRun with the given reference to terminate by
+// setting spec.terminate to true. It returns once the request has been
+// observed on the AnalysisRun, without waiting for the Argo Rollouts
+// controller to act upon it.
+//
+// Terminate is idempotent: if the AnalysisRun has already completed or was
+// already requested to terminate, it is left untouched. An AnalysisRun which
+// does not exist is not considered an error, but reported through the result.
+func Terminate(
+	ctx context.Context,
+	c client.Client,
+	ref types.NamespacedName,
+) (TerminateResult, error) {
+	ar := &rolloutsapi.AnalysisRun{}
+	if err := c.Get(ctx, ref, ar); err != nil {
+		if apierrors.IsNotFound(err) {
+			return TerminateResultNotFound, nil
+		}
+		return "", fmt.Errorf("get AnalysisRun %q in namespace %q: %w", ref.Name, ref.Namespace, err)
+	}
+
+	if ar.Spec.Terminate || ar.Status.Phase.Completed() {
+		return TerminateResultAlreadyTerminated, nil
+	}
+
+	if err := c.Patch(
+		ctx,
+		ar,
+		client.RawPatch(types.MergePatchType, []byte(`{"spec":{"terminate":true}}`)),
+	); err != nil {
+		if apierrors.IsNotFound(err) {
+			return TerminateResultNotFound, nil
+		}
+		return "", fmt.Errorf("terminate AnalysisRun %q in namespace %q: %w", ref.Name, ref.Namespace, err)
+	}
+
+	if !ar.Spec.Terminate {
+		return "", fmt.Errorf(
+			"terminate AnalysisRun %q in namespace %q: termination request was not observed",
+			ref.Name, ref.Namespace,
+		)
+	}
+	return TerminateResultTerminated, nil
+}
+
+// ShouldTerminate returns true if the deadline of the given AnalysisRun, as
+// set using WithDeadline, has been reached at the given time. It returns false
+// if the AnalysisRun has no (valid) deadline annotation, has not been created
+// yet, or has already completed.
+func ShouldTerminate(ar *rolloutsapi.AnalysisRun, now time.Time) bool {
+	if ar == nil || ar.CreationTimestamp.IsZero() || ar.Status.Phase.Completed() {
+		return false
+	}
+	value, ok := ar.Annotations[deadlineAnnotationKey]
+	if !ok {
+		return false
+	}
+	deadline, err := time.ParseDuration(value)
+	if err != nil || deadline <= 0 {
+		return false
+	}
+	return !now.Before(ar.CreationTimestamp.Add(deadline))
+}
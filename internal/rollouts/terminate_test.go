@@ -0,0 +1,223 @@
+package rollouts
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestTerminate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, rolloutsapi.AddToScheme(scheme))
+
+	ref := types.NamespacedName{Namespace: "default", Name: "run"}
+	newRun := func(terminate bool, phase rolloutsapi.AnalysisPhase) *rolloutsapi.AnalysisRun {
+		return &rolloutsapi.AnalysisRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ref.Namespace,
+				Name:      ref.Name,
+			},
+			Spec: rolloutsapi.AnalysisRunSpec{
+				Terminate: terminate,
+			},
+			Status: rolloutsapi.AnalysisRunStatus{
+				Phase: phase,
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		objects     []client.Object
+		interceptor interceptor.Funcs
+		assertions  func(*testing.T, client.Client, TerminateResult, error)
+	}{
+		{
+			name:    "running AnalysisRun",
+			objects: []client.Object{newRun(false, rolloutsapi.AnalysisPhaseRunning)},
+			assertions: func(t *testing.T, c client.Client, result TerminateResult, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, TerminateResultTerminated, result)
+
+				ar := &rolloutsapi.AnalysisRun{}
+				require.NoError(t, c.Get(context.Background(), ref, ar))
+				assert.True(t, ar.Spec.Terminate)
+			},
+		},
+		{
+			name:    "already terminated AnalysisRun",
+			objects: []client.Object{newRun(true, rolloutsapi.AnalysisPhaseRunning)},
+			interceptor: interceptor.Funcs{
+				Patch: func(context.Context, client.WithWatch, client.Object, client.Patch, ...client.PatchOption) error {
+					return errors.New("unexpected patch")
+				},
+			},
+			assertions: func(t *testing.T, _ client.Client, result TerminateResult, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, TerminateResultAlreadyTerminated, result)
+			},
+		},
+		{
+			name:    "completed AnalysisRun",
+			objects: []client.Object{newRun(false, rolloutsapi.AnalysisPhaseSuccessful)},
+			assertions: func(t *testing.T, c client.Client, result TerminateResult, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, TerminateResultAlreadyTerminated, result)
+
+				ar := &rolloutsapi.AnalysisRun{}
+				require.NoError(t, c.Get(context.Background(), ref, ar))
+				assert.False(t, ar.Spec.Terminate)
+			},
+		},
+		{
+			name: "missing AnalysisRun",
+			assertions: func(t *testing.T, _ client.Client, result TerminateResult, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, TerminateResultNotFound, result)
+			},
+		},
+		{
+			name:    "AnalysisRun deleted before patch",
+			objects: []client.Object{newRun(false, rolloutsapi.AnalysisPhaseRunning)},
+			interceptor: interceptor.Funcs{
+				Patch: func(context.Context, client.WithWatch, client.Object, client.Patch, ...client.PatchOption) error {
+					return apierrors.NewNotFound(schema.GroupResource{}, ref.Name)
+				},
+			},
+			assertions: func(t *testing.T, _ client.Client, result TerminateResult, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, TerminateResultNotFound, result)
+			},
+		},
+		{
+			name:    "get error",
+			objects: []client.Object{newRun(false, rolloutsapi.AnalysisPhaseRunning)},
+			interceptor: interceptor.Funcs{
+				Get: func(context.Context, client.WithWatch, client.ObjectKey, client.Object, ...client.GetOption) error {
+					return errors.New("something went wrong")
+				},
+			},
+			assertions: func(t *testing.T, _ client.Client, result TerminateResult, err error) {
+				assert.ErrorContains(t, err, "get AnalysisRun")
+				assert.ErrorContains(t, err, "something went wrong")
+				assert.Empty(t, result)
+			},
+		},
+		{
+			name:    "patch error",
+			objects: []client.Object{newRun(false, rolloutsapi.AnalysisPhaseRunning)},
+			interceptor: interceptor.Funcs{
+				Patch: func(context.Context, client.WithWatch, client.Object, client.Patch, ...client.PatchOption) error {
+					return errors.New("something went wrong")
+				},
+			},
+			assertions: func(t *testing.T, _ client.Client, result TerminateResult, err error) {
+				assert.ErrorContains(t, err, "terminate AnalysisRun")
+				assert.ErrorContains(t, err, "something went wrong")
+				assert.Empty(t, result)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(tt.objects...).
+				WithInterceptorFuncs(tt.interceptor).
+				Build()
+
+			result, err := Terminate(context.Background(), c, ref)
+			tt.assertions(t, c, result, err)
+		})
+	}
+}
+
+func TestShouldTerminate(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	newAnalysisRun := func(annotations map[string]string, phase rolloutsapi.AnalysisPhase) *rolloutsapi.AnalysisRun {
+		return &rolloutsapi.AnalysisRun{
+			ObjectMeta: metav1.ObjectMeta{
+				CreationTimestamp: metav1.NewTime(created),
+				Annotations:       annotations,
+			},
+			Status: rolloutsapi.AnalysisRunStatus{
+				Phase: phase,
+			},
+		}
+	}
+	withDeadline := map[string]string{deadlineAnnotationKey: "30m0s"}
+
+	tests := []struct {
+		name     string
+		ar       *rolloutsapi.AnalysisRun
+		now      time.Time
+		expected bool
+	}{
+		{
+			name: "nil AnalysisRun",
+			now:  created,
+		},
+		{
+			name: "no deadline annotation",
+			ar:   newAnalysisRun(nil, rolloutsapi.AnalysisPhaseRunning),
+			now:  created.Add(24 * time.Hour),
+		},
+		{
+			name: "invalid deadline annotation",
+			ar:   newAnalysisRun(map[string]string{deadlineAnnotationKey: "soon"}, rolloutsapi.AnalysisPhaseRunning),
+			now:  created.Add(24 * time.Hour),
+		},
+		{
+			name: "before deadline",
+			ar:   newAnalysisRun(withDeadline, rolloutsapi.AnalysisPhaseRunning),
+			now:  created.Add(30*time.Minute - time.Nanosecond),
+		},
+		{
+			name:     "at deadline",
+			ar:       newAnalysisRun(withDeadline, rolloutsapi.AnalysisPhaseRunning),
+			now:      created.Add(30 * time.Minute),
+			expected: true,
+		},
+		{
+			name:     "after deadline",
+			ar:       newAnalysisRun(withDeadline, rolloutsapi.AnalysisPhasePending),
+			now:      created.Add(time.Hour),
+			expected: true,
+		},
+		{
+			name: "completed after deadline",
+			ar:   newAnalysisRun(withDeadline, rolloutsapi.AnalysisPhaseSuccessful),
+			now:  created.Add(time.Hour),
+		},
+		{
+			name: "not created yet",
+			ar: &rolloutsapi.AnalysisRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: withDeadline,
+				},
+			},
+			now: created.Add(time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ShouldTerminate(tt.ar, tt.now))
+		})
+	}
+}
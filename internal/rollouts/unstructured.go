@@ -0,0 +1,44 @@
+package rollouts
+
+import (
+	"fmt"
+
+	"github.com/oklog/ulid/v2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// analysisRunKind is the kind of the Argo Rollouts AnalysisRun.
+const analysisRunKind = "AnalysisRun"
+
+// BuildUnstructured creates the AnalysisRun which would be built with the
+// given options, in unstructured form, e.g. for a CLI to render a diff
+// against the AnalysisRun in the cluster without importing the typed Argo
+// Rollouts API. Like Build, it does not consult the cluster, so the spec only
+// holds the inline metrics and arguments from the options, and the namespace
+// is the one set using WithNamespace.
+//
+// To keep diffs stable, the ULID portion of the name is the zero ULID unless
+// a generator is passed using WithULIDGenerator. Fields which are only set
+// by the API server, i.e. the creation timestamp and status, are omitted.
+func BuildUnstructured(opts ...AnalysisRunOption) (*unstructured.Unstructured, error) {
+	var zero ulid.ULID
+	opts = append([]AnalysisRunOption{WithULIDGenerator(func() ulid.ULID { return zero })}, opts...)
+
+	ar, err := Build("", nil, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ar.SetGroupVersionKind(rolloutsapi.GroupVersion.WithKind(analysisRunKind))
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(ar)
+	if err != nil {
+		return nil, fmt.Errorf("convert AnalysisRun: %w", err)
+	}
+	obj := &unstructured.Unstructured{Object: content}
+	unstructured.RemoveNestedField(obj.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(obj.Object, "status")
+	return obj, nil
+}
@@ -0,0 +1,82 @@
+package rollouts
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestBuildUnstructured(t *testing.T) {
+	options := []AnalysisRunOption{
+		WithNamespace("project"),
+		WithNamePrefix("stage"),
+		WithStage("project", "stage"),
+		WithOwner(Owner{
+			APIVersion: "kargo.akuity.io/v1alpha1",
+			Kind:       "Stage",
+			Reference:  types.NamespacedName{Namespace: "project", Name: "stage"},
+			Controller: true,
+		}),
+		WithInlineMetrics{{
+			Name: "success-rate",
+			Provider: rolloutsapi.MetricProvider{
+				Prometheus: &rolloutsapi.PrometheusMetric{
+					Address: "http://prometheus:9090",
+					Query:   "vector(1)",
+				},
+			},
+			Count: ptr.To(intstr.FromInt32(1)),
+		}},
+	}
+
+	t.Run("matches the typed build", func(t *testing.T) {
+		obj, err := BuildUnstructured(options...)
+		require.NoError(t, err)
+
+		var zero ulid.ULID
+		expected, err := Build("", nil, nil, append(options, WithULIDGenerator(func() ulid.ULID { return zero }))...)
+		require.NoError(t, err)
+
+		assert.Equal(t, rolloutsapi.GroupVersion.String(), obj.GetAPIVersion())
+		assert.Equal(t, "AnalysisRun", obj.GetKind())
+		assert.Equal(t, "stage."+strings.ToLower(zero.String()), obj.GetName())
+		assert.NotContains(t, obj.Object, "status")
+		assert.NotContains(t, obj.Object["metadata"], "creationTimestamp")
+
+		actual := &rolloutsapi.AnalysisRun{}
+		require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, actual))
+		expected.SetGroupVersionKind(rolloutsapi.GroupVersion.WithKind("AnalysisRun"))
+		// Empty slices of the typed build are omitted in unstructured form.
+		assert.True(t, equality.Semantic.DeepEqual(expected, actual))
+	})
+
+	t.Run("stable across calls", func(t *testing.T) {
+		obj1, err := BuildUnstructured(options...)
+		require.NoError(t, err)
+		obj2, err := BuildUnstructured(options...)
+		require.NoError(t, err)
+		assert.Equal(t, obj1, obj2)
+	})
+
+	t.Run("injected ULID", func(t *testing.T) {
+		id := ulid.MustParse("01HRZ6K7ZW0000000000000000")
+		obj, err := BuildUnstructured(append(options, WithULIDGenerator(func() ulid.ULID { return id }))...)
+		require.NoError(t, err)
+		assert.Equal(t, "stage."+strings.ToLower(id.String()), obj.GetName())
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := BuildUnstructured(WithMaxNameLength(1))
+		assert.ErrorContains(t, err, "invalid options")
+	})
+}
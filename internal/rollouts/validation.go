@@ -0,0 +1,66 @@
+package rollouts
+
+import (
+	"errors"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ValidateFields checks the AnalysisRunOptions for consistency, the same way
+// as Validate, but returns the problems found as field errors, e.g. to be
+// returned by an admission webhook. The field paths refer to the AnalysisRun
+// which would be built where possible, e.g. metadata.labels[<key>] or
+// ownerReferences[<index>].name, and to the options otherwise, e.g. deadline.
+// It returns an empty list if the options are valid.
+func (o *AnalysisRunOptions) ValidateFields() field.ErrorList {
+	return fieldErrors(o.Validate())
+}
+
+// fieldError is an error which is described by field errors.
+type fieldError struct {
+	err    error
+	fields field.ErrorList
+}
+
+func (e *fieldError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.err
+}
+
+// withFields returns an error which behaves like the given error, and is
+// described by the given field errors when returned by ValidateFields.
+func withFields(err error, fields ...*field.Error) error {
+	return &fieldError{err: err, fields: fields}
+}
+
+// invalidField returns an error which behaves like the given error, and is
+// described by an invalid value of the given field.
+func invalidField(path *field.Path, value any, err error) error {
+	return withFields(err, field.Invalid(path, value, err.Error()))
+}
+
+// fieldErrors returns the field errors describing the given error, which may
+// join multiple errors. An error which is not described by field errors is
+// reported as an invalid value of the options.
+func fieldErrors(err error) field.ErrorList {
+	if err == nil {
+		return nil
+	}
+	if fe, ok := err.(*fieldError); ok { // nolint: errorlint
+		return fe.fields
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok { // nolint: errorlint
+		var list field.ErrorList
+		for _, err := range joined.Unwrap() {
+			list = append(list, fieldErrors(err)...)
+		}
+		return list
+	}
+	if fe := (*fieldError)(nil); errors.As(err, &fe) {
+		return fe.fields
+	}
+	return field.ErrorList{field.Invalid(field.NewPath("options"), field.OmitValueType{}, err.Error())}
+}
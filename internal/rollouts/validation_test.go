@@ -0,0 +1,130 @@
+package rollouts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestAnalysisRunOptions_ValidateFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    []AnalysisRunOption
+		assertions func(*testing.T, field.ErrorList)
+	}{
+		{
+			name:    "valid options",
+			options: []AnalysisRunOption{WithNamePrefix("stage"), WithVerificationID("verification")},
+			assertions: func(t *testing.T, errs field.ErrorList) {
+				assert.Empty(t, errs)
+			},
+		},
+		{
+			name: "owner missing name",
+			options: []AnalysisRunOption{
+				WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Kind:       "Stage",
+					Reference:  types.NamespacedName{Name: "stage"},
+				}),
+				WithOwner(Owner{
+					APIVersion: "kargo.akuity.io/v1alpha1",
+					Kind:       "Freight",
+				}),
+			},
+			assertions: func(t *testing.T, errs field.ErrorList) {
+				require.Len(t, errs, 1)
+				assert.Equal(t, field.ErrorTypeRequired, errs[0].Type)
+				assert.Equal(t, "ownerReferences[1].name", errs[0].Field)
+			},
+		},
+		{
+			name: "invalid label and verification ID",
+			options: []AnalysisRunOption{
+				WithExtraLabels{"key": "-invalid-"},
+				WithVerificationID("invalid/id"),
+			},
+			assertions: func(t *testing.T, errs field.ErrorList) {
+				require.Len(t, errs, 2)
+				assert.Equal(t, field.ErrorTypeInvalid, errs[0].Type)
+				assert.Equal(t, "metadata.labels", errs[0].Field)
+				assert.Equal(t, "-invalid-", errs[0].BadValue)
+				assert.Equal(t, field.ErrorTypeInvalid, errs[1].Type)
+				assert.Equal(t, "metadata.labels[kargo.akuity.io/verification-id]", errs[1].Field)
+				assert.Equal(t, "invalid/id", errs[1].BadValue)
+			},
+		},
+		{
+			name: "invalid inline metric and deadline",
+			options: []AnalysisRunOption{
+				WithInlineMetrics{{}},
+				WithDeadline(-time.Minute),
+			},
+			assertions: func(t *testing.T, errs field.ErrorList) {
+				require.Len(t, errs, 3)
+				assert.Equal(t, "inlineMetrics[0].name", errs[0].Field)
+				assert.Equal(t, "inlineMetrics[0].provider", errs[1].Field)
+				assert.Equal(t, "deadline", errs[2].Field)
+			},
+		},
+		{
+			name: "invalid explicit name",
+			options: []AnalysisRunOption{
+				WithExplicitName("Invalid"),
+			},
+			assertions: func(t *testing.T, errs field.ErrorList) {
+				require.Len(t, errs, 1)
+				assert.Equal(t, field.ErrorTypeInvalid, errs[0].Type)
+				assert.Equal(t, "metadata.name", errs[0].Field)
+			},
+		},
+		{
+			name: "strict naming with truncated prefix and suffix",
+			options: []AnalysisRunOption{
+				WithStrictNaming(true),
+				WithNamePrefix(stringWithLength(300)),
+				WithNameSuffix("abc"),
+			},
+			assertions: func(t *testing.T, errs field.ErrorList) {
+				assert.Equal(t, field.ErrorList{
+					field.TooLong(field.NewPath("namePrefix"), stringWithLength(300), maxNamePrefixLength),
+				}, errs)
+			},
+		},
+		{
+			name: "deferred option error",
+			options: []AnalysisRunOption{
+				WithOwnerObject(&rolloutsapi.AnalysisRun{
+					ObjectMeta: metav1.ObjectMeta{Name: "run"},
+				}, runtime.NewScheme()),
+			},
+			assertions: func(t *testing.T, errs field.ErrorList) {
+				require.Len(t, errs, 1)
+				assert.Equal(t, "options", errs[0].Field)
+				assert.Contains(t, errs[0].Detail, "resolve owner kind")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewAnalysisRunOptions(tt.options...)
+			errs := opts.ValidateFields()
+			tt.assertions(t, errs)
+			// The convenience error describes the same problems.
+			if len(errs) == 0 {
+				assert.NoError(t, opts.Validate())
+			} else {
+				assert.Error(t, opts.Validate())
+			}
+		})
+	}
+}
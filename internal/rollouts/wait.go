@@ -0,0 +1,133 @@
+package rollouts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+// watchRestartDelay is the delay before restarting a watch which failed.
+const watchRestartDelay = time.Second
+
+// analysisRunResource is the resource of the Argo Rollouts AnalysisRun.
+var analysisRunResource = rolloutsapi.GroupVersion.WithResource("analysisruns").GroupResource()
+
+// errWatchEnded is returned by watchForCompletion when the watch ended before
+// the AnalysisRun completed, and may be restarted right away.
+var errWatchEnded = errors.New("watch ended")
+
+// WaitForCompletion watches the AnalysisRun with the given reference until it
+// has completed, e.g. for a CLI to wait for the outcome of a verification,
+// and returns the completed AnalysisRun. An AnalysisRun which has already
+// completed is returned right away.
+//
+// The watch is restarted when it ends, e.g. because the API server closed it,
+// or fails with an error which may be transient. It returns the error of the
+// context if the context is canceled or its deadline is exceeded first, a
+// NotFound error if the AnalysisRun is deleted, and an error if it cannot be
+// watched at all, e.g. due to missing permissions.
+func WaitForCompletion(
+	ctx context.Context,
+	c client.WithWatch,
+	ref types.NamespacedName,
+) (*rolloutsapi.AnalysisRun, error) {
+	for {
+		ar, err := watchForCompletion(ctx, c, ref)
+		if err == nil {
+			return ar, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if errors.Is(err, errWatchEnded) {
+			continue
+		}
+		if !isTransientWatchError(err) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(watchRestartDelay):
+		}
+	}
+}
+
+// watchForCompletion watches the AnalysisRun with the given reference once,
+// and returns it as soon as it has completed. As a watch started without a
+// resource version begins with the current state of the AnalysisRun, no
+// completion is missed between restarts.
+func watchForCompletion(
+	ctx context.Context,
+	c client.WithWatch,
+	ref types.NamespacedName,
+) (*rolloutsapi.AnalysisRun, error) {
+	w, err := c.Watch(
+		ctx,
+		&rolloutsapi.AnalysisRunList{},
+		client.InNamespace(ref.Namespace),
+		client.MatchingFields{"metadata.name": ref.Name},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("watch AnalysisRun %q in namespace %q: %w", ref.Name, ref.Namespace, err)
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return nil, errWatchEnded
+			}
+			switch event.Type {
+			case watch.Error:
+				return nil, fmt.Errorf(
+					"watch AnalysisRun %q in namespace %q: %w",
+					ref.Name, ref.Namespace, apierrors.FromObject(event.Object),
+				)
+			case watch.Added, watch.Modified, watch.Deleted:
+				ar, ok := event.Object.(*rolloutsapi.AnalysisRun)
+				if !ok || ar.Name != ref.Name {
+					continue
+				}
+				if event.Type == watch.Deleted {
+					return nil, fmt.Errorf(
+						"AnalysisRun %q in namespace %q was deleted before completing: %w",
+						ref.Name, ref.Namespace, apierrors.NewNotFound(analysisRunResource, ref.Name),
+					)
+				}
+				if ar.Status.Phase.Completed() {
+					return ar, nil
+				}
+			}
+		}
+	}
+}
+
+// isTransientWatchError returns true if the given error of a watch may be
+// resolved by restarting the watch, i.e. it is not caused by the request
+// itself or missing permissions.
+func isTransientWatchError(err error) bool {
+	switch {
+	case apierrors.IsBadRequest(err),
+		apierrors.IsForbidden(err),
+		apierrors.IsUnauthorized(err),
+		apierrors.IsMethodNotSupported(err),
+		apierrors.IsNotFound(err),
+		apierrors.IsInvalid(err):
+		return false
+	default:
+		return true
+	}
+}
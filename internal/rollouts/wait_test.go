@@ -0,0 +1,176 @@
+package rollouts
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestWaitForCompletion(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, rolloutsapi.AddToScheme(scheme))
+
+	ref := types.NamespacedName{Namespace: "default", Name: "run"}
+	newRun := func(name string, phase rolloutsapi.AnalysisPhase) *rolloutsapi.AnalysisRun {
+		return &rolloutsapi.AnalysisRun{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: name},
+			Status:     rolloutsapi.AnalysisRunStatus{Phase: phase},
+		}
+	}
+
+	// watchers returns a Watch function which serves the given watch results
+	// in order. Every watcher is a list of events, after which the watch is
+	// closed, or an error returned by Watch.
+	type result struct {
+		events []watch.Event
+		err    error
+	}
+	watchers := func(results ...result) func(
+		context.Context, client.WithWatch, client.ObjectList, ...client.ListOption,
+	) (watch.Interface, error) {
+		return func(context.Context, client.WithWatch, client.ObjectList, ...client.ListOption) (watch.Interface, error) {
+			if len(results) == 0 {
+				return watch.NewFake(), nil
+			}
+			r := results[0]
+			results = results[1:]
+			if r.err != nil {
+				return nil, r.err
+			}
+			w := watch.NewFakeWithChanSize(len(r.events), false)
+			for _, event := range r.events {
+				w.Action(event.Type, event.Object)
+			}
+			w.Stop()
+			return w, nil
+		}
+	}
+
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		watch      func(context.Context, client.WithWatch, client.ObjectList, ...client.ListOption) (watch.Interface, error)
+		assertions func(*testing.T, *rolloutsapi.AnalysisRun, error)
+	}{
+		{
+			name: "running then successful",
+			watch: watchers(result{events: []watch.Event{
+				{Type: watch.Added, Object: newRun("run", rolloutsapi.AnalysisPhaseRunning)},
+				{Type: watch.Modified, Object: newRun("other", rolloutsapi.AnalysisPhaseFailed)},
+				{Type: watch.Modified, Object: newRun("run", rolloutsapi.AnalysisPhaseSuccessful)},
+			}}),
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "run", ar.Name)
+				assert.Equal(t, rolloutsapi.AnalysisPhaseSuccessful, ar.Status.Phase)
+			},
+		},
+		{
+			name: "restarts ended and failed watches",
+			watch: watchers(
+				result{events: []watch.Event{
+					{Type: watch.Added, Object: newRun("run", rolloutsapi.AnalysisPhaseRunning)},
+				}},
+				result{err: apierrors.NewServiceUnavailable("unavailable")},
+				result{events: []watch.Event{
+					{Type: watch.Error, Object: &apierrors.NewResourceExpired("expired").ErrStatus},
+				}},
+				result{events: []watch.Event{
+					{Type: watch.Added, Object: newRun("run", rolloutsapi.AnalysisPhaseFailed)},
+				}},
+			),
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, rolloutsapi.AnalysisPhaseFailed, ar.Status.Phase)
+			},
+		},
+		{
+			name: "deleted",
+			watch: watchers(result{events: []watch.Event{
+				{Type: watch.Added, Object: newRun("run", rolloutsapi.AnalysisPhaseRunning)},
+				{Type: watch.Deleted, Object: newRun("run", rolloutsapi.AnalysisPhaseRunning)},
+			}}),
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "was deleted before completing")
+				assert.True(t, apierrors.IsNotFound(err))
+				assert.Nil(t, ar)
+			},
+		},
+		{
+			name: "forbidden",
+			watch: watchers(result{
+				err: apierrors.NewForbidden(schema.GroupResource{Resource: "analysisruns"}, "", errors.New("denied")),
+			}),
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.True(t, apierrors.IsForbidden(err))
+				assert.ErrorContains(t, err, `watch AnalysisRun "run" in namespace "default"`)
+				assert.Nil(t, ar)
+			},
+		},
+		{
+			name:    "context deadline exceeded",
+			timeout: 50 * time.Millisecond,
+			watch: watchers(result{events: []watch.Event{
+				{Type: watch.Added, Object: newRun("run", rolloutsapi.AnalysisPhaseRunning)},
+			}}),
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+				assert.Nil(t, ar)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithInterceptorFuncs(interceptor.Funcs{Watch: tt.watch}).
+				Build()
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			ar, err := WaitForCompletion(ctx, c, ref)
+			tt.assertions(t, ar, err)
+		})
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		w := watch.NewFake()
+		c := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithInterceptorFuncs(interceptor.Funcs{
+				Watch: func(context.Context, client.WithWatch, client.ObjectList, ...client.ListOption) (watch.Interface, error) {
+					return w, nil
+				},
+			}).
+			Build()
+
+		go func() {
+			w.Add(newRun("run", rolloutsapi.AnalysisPhaseRunning))
+			cancel()
+		}()
+		ar, err := WaitForCompletion(ctx, c, ref)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Nil(t, ar)
+	})
+}
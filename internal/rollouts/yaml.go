@@ -0,0 +1,87 @@
+package rollouts
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// optionsSpec is the serialized form of AnalysisRunOptions accepted by
+// OptionsFromYAML.
+type optionsSpec struct {
+	Prefix      string            `json:"prefix,omitempty"`
+	Suffix      string            `json:"suffix,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Owners      []ownerSpec       `json:"owners,omitempty"`
+	Args        map[string]string `json:"args,omitempty"`
+}
+
+// ownerSpec is the serialized form of an Owner.
+type ownerSpec struct {
+	APIVersion    string `json:"apiVersion,omitempty"`
+	Kind          string `json:"kind,omitempty"`
+	Namespace     string `json:"namespace,omitempty"`
+	Name          string `json:"name,omitempty"`
+	BlockDeletion bool   `json:"blockDeletion,omitempty"`
+	Controller    bool   `json:"controller,omitempty"`
+}
+
+// OptionsFromYAML parses the given YAML or JSON document into options, e.g.
+// to build AnalysisRuns from verification settings declared in GitOps
+// configuration. The document may hold the following fields, which map to
+// the options of the same purpose:
+//
+//	prefix: stage            # WithNamePrefix
+//	suffix: abc1234          # WithNameSuffix
+//	labels: {}               # WithExtraLabels
+//	annotations: {}          # WithExtraAnnotations
+//	owners:                  # WithOwner, for every owner
+//	- apiVersion: kargo.akuity.io/v1alpha1
+//	  kind: Stage
+//	  namespace: project
+//	  name: stage
+//	  blockDeletion: true
+//	  controller: true
+//	args: {}                 # WithArgs
+//
+// Fields which are not set do not result in an option. It returns an error if
+// the document cannot be parsed, or holds an unknown field, to catch typos.
+// The options themselves are validated when the AnalysisRun is built.
+func OptionsFromYAML(data []byte) ([]AnalysisRunOption, error) {
+	var spec optionsSpec
+	if err := yaml.UnmarshalStrict(data, &spec); err != nil {
+		return nil, fmt.Errorf("parse options: %w", err)
+	}
+
+	var opts []AnalysisRunOption
+	if spec.Prefix != "" {
+		opts = append(opts, WithNamePrefix(spec.Prefix))
+	}
+	if spec.Suffix != "" {
+		opts = append(opts, WithNameSuffix(spec.Suffix))
+	}
+	if len(spec.Labels) > 0 {
+		opts = append(opts, WithExtraLabels(spec.Labels))
+	}
+	if len(spec.Annotations) > 0 {
+		opts = append(opts, WithExtraAnnotations(spec.Annotations))
+	}
+	for _, owner := range spec.Owners {
+		opts = append(opts, WithOwner(Owner{
+			APIVersion: owner.APIVersion,
+			Kind:       owner.Kind,
+			Reference: types.NamespacedName{
+				Namespace: owner.Namespace,
+				Name:      owner.Name,
+			},
+			BlockDeletion: owner.BlockDeletion,
+			Controller:    owner.Controller,
+		}))
+	}
+	if len(spec.Args) > 0 {
+		opts = append(opts, WithArgs(spec.Args))
+	}
+	return opts, nil
+}
@@ -0,0 +1,113 @@
+package rollouts
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	rolloutsapi "github.com/akuity/kargo/internal/controller/rollouts/api/v1alpha1"
+)
+
+func TestOptionsFromYAML(t *testing.T) {
+	templates := []*rolloutsapi.AnalysisTemplate{{
+		Spec: rolloutsapi.AnalysisTemplateSpec{
+			Metrics: []rolloutsapi.Metric{{Name: "metric"}},
+			Args:    []rolloutsapi.Argument{{Name: "service", Value: ptr.To("web")}},
+		},
+	}}
+
+	tests := []struct {
+		name       string
+		data       string
+		assertions func(*testing.T, *rolloutsapi.AnalysisRun, error)
+	}{
+		{
+			name: "YAML",
+			data: `
+prefix: Stage
+suffix: abc1234
+labels:
+  example.com/team: payments
+annotations:
+  example.com/note: nightly
+owners:
+- apiVersion: kargo.akuity.io/v1alpha1
+  kind: Stage
+  namespace: default
+  name: stage
+  blockDeletion: true
+  controller: true
+args:
+  service: api
+`,
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.True(t, strings.HasPrefix(ar.Name, "stage."))
+				assert.True(t, strings.HasSuffix(ar.Name, ".abc1234"))
+				assert.Equal(t, map[string]string{"example.com/team": "payments"}, ar.Labels)
+				assert.Equal(t, map[string]string{"example.com/note": "nightly"}, ar.Annotations)
+				assert.Equal(t, []metav1.OwnerReference{{
+					APIVersion:         "kargo.akuity.io/v1alpha1",
+					Kind:               "Stage",
+					Name:               "stage",
+					BlockOwnerDeletion: ptr.To(true),
+					Controller:         ptr.To(true),
+				}}, ar.OwnerReferences)
+				require.Len(t, ar.Spec.Args, 1)
+				assert.Equal(t, "service", ar.Spec.Args[0].Name)
+				assert.Equal(t, ptr.To("api"), ar.Spec.Args[0].Value)
+			},
+		},
+		{
+			name: "JSON",
+			data: `{"prefix": "stage", "args": {"service": "api"}}`,
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.True(t, strings.HasPrefix(ar.Name, "stage."))
+				assert.Len(t, strings.Split(ar.Name, "."), 2)
+				require.Len(t, ar.Spec.Args, 1)
+				assert.Equal(t, ptr.To("api"), ar.Spec.Args[0].Value)
+			},
+		},
+		{
+			name: "empty document",
+			assertions: func(t *testing.T, ar *rolloutsapi.AnalysisRun, err error) {
+				require.NoError(t, err)
+				assert.Len(t, ar.Name, ulidLength)
+				assert.Empty(t, ar.Labels)
+				assert.Empty(t, ar.OwnerReferences)
+			},
+		},
+		{
+			name: "unknown field",
+			data: "prefix: stage\nlabel:\n  example.com/team: payments\n",
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "parse options")
+				assert.ErrorContains(t, err, `unknown field "label"`)
+			},
+		},
+		{
+			name: "invalid document",
+			data: "owners: stage",
+			assertions: func(t *testing.T, _ *rolloutsapi.AnalysisRun, err error) {
+				assert.ErrorContains(t, err, "parse options")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := OptionsFromYAML([]byte(tt.data))
+			if err != nil {
+				tt.assertions(t, nil, err)
+				return
+			}
+			ar, err := Build("default", templates, nil, opts...)
+			tt.assertions(t, ar, err)
+		})
+	}
+}